@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -15,7 +16,10 @@ import (
 
 	"github.com/labmino/runsight-backend/internal/database"
 	"github.com/labmino/runsight-backend/internal/handlers"
+	"github.com/labmino/runsight-backend/internal/jobs"
 	"github.com/labmino/runsight-backend/internal/middleware"
+	"github.com/labmino/runsight-backend/internal/services"
+	"github.com/labmino/runsight-backend/internal/storage"
 	"github.com/labmino/runsight-backend/internal/utils"
 )
 
@@ -40,6 +44,43 @@ func main() {
 
 	utils.Info("Database connected and migrations completed")
 
+	// Elevation correction is optional; without tiles, device altitudes are used
+	if demDir := os.Getenv("DEM_DIR"); demDir != "" {
+		dem, err := services.LoadDEM(demDir)
+		if err != nil {
+			utils.Warn("Failed to load DEM tiles, using device altitudes", zap.String("dir", demDir), zap.Error(err))
+		} else {
+			services.SetDefaultDEM(dem)
+			utils.Info("DEM tiles loaded", zap.String("dir", demDir))
+		}
+	}
+
+	// Blobs live on local disk unless an S3-compatible bucket is configured
+	var blobs storage.Store
+	if os.Getenv("BLOB_BACKEND") == "s3" {
+		blobs, err = storage.NewS3Store(storage.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       os.Getenv("S3_PATH_STYLE") == "true",
+		})
+		if err != nil {
+			utils.Fatal("Failed to configure S3 blob store", zap.Error(err))
+		}
+	} else {
+		blobDir := os.Getenv("BLOB_DIR")
+		if blobDir == "" {
+			blobDir = "data/blobs"
+		}
+		blobs, err = storage.NewLocalStore(blobDir)
+		if err != nil {
+			utils.Fatal("Failed to open blob store", zap.String("dir", blobDir), zap.Error(err))
+		}
+	}
+	storage.SetDefault(blobs)
+
 	if os.Getenv("GIN_MODE") == "release" {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -52,8 +93,10 @@ func main() {
 
 	r.Use(middleware.LoggingMiddleware())
 
-	// Set max request size to 10MB
-	r.Use(middleware.MaxRequestSize(10 * 1024 * 1024))
+	// Set max request size to 10MB, with room for history archives on import
+	r.Use(middleware.MaxRequestSize(10*1024*1024, map[string]int64{
+		"/api/v1/mobile/runs/import": handlers.MaxImportRequestBytes,
+	}))
 
 	// Global rate limit allows 100 requests per burst and 200 per window
 	r.Use(middleware.RateLimitMiddleware(100, 200))
@@ -62,6 +105,7 @@ func main() {
 	mobileHandler := handlers.NewMobileHandler(db)
 	iotHandler := handlers.NewIoTHandler(db)
 	monitoringHandler := handlers.NewMonitoringHandler(db)
+	adminHandler := handlers.NewAdminHandler(db)
 
 	api := r.Group("/api/v1")
 	{
@@ -70,6 +114,7 @@ func main() {
 		api.GET("/ready", monitoringHandler.Ready)
 		api.GET("/live", monitoringHandler.Live)
 		api.GET("/metrics", monitoringHandler.Metrics)
+		api.GET("/media/:media_id", mobileHandler.ServeMedia)
 
 		auth := api.Group("/auth")
 		auth.Use(middleware.StrictRateLimitMiddleware(20))
@@ -99,10 +144,49 @@ func main() {
 			mobile.DELETE("/devices/:device_id", mobileHandler.RemoveDevice)
 
 			mobile.GET("/runs", mobileHandler.ListRuns)
+			mobile.POST("/runs/import", mobileHandler.ImportRuns)
 			mobile.GET("/runs/:run_id", mobileHandler.GetRun)
 			mobile.GET("/runs/:run_id/waypoints", mobileHandler.GetRunWaypoints)
+			mobile.GET("/runs/:run_id/export", mobileHandler.ExportRun)
+			mobile.POST("/runs/:run_id/reanalyze", mobileHandler.ReanalyzeRun)
+			mobile.GET("/runs/:run_id/splits", mobileHandler.GetRunSplits)
+			mobile.GET("/runs/:run_id/elevation", mobileHandler.GetRunElevation)
+			mobile.GET("/runs/:run_id/streams", mobileHandler.GetRunStreams)
+			mobile.GET("/runs/:run_id/ai-events", mobileHandler.GetRunAIEvents)
+			mobile.GET("/runs/:run_id/lane-events", mobileHandler.GetRunLaneEvents)
+			mobile.GET("/runs/:run_id/ai-feedback", mobileHandler.ListAIFeedback)
+			mobile.POST("/runs/:run_id/ai-feedback", mobileHandler.LabelAIEvent)
+			mobile.DELETE("/runs/:run_id/ai-feedback/:feedback_id", mobileHandler.DeleteAIFeedback)
+			mobile.GET("/runs/:run_id/media", mobileHandler.ListRunMedia)
 			mobile.PATCH("/runs/:run_id", mobileHandler.UpdateRunNotes)
+			mobile.DELETE("/runs/:run_id", mobileHandler.DeleteRun)
+			mobile.GET("/records", mobileHandler.GetRecords)
 			mobile.GET("/stats", mobileHandler.GetStats)
+			mobile.GET("/stats/series", mobileHandler.GetStatsSeries)
+			mobile.GET("/stats/zones", mobileHandler.GetZoneStats)
+			mobile.GET("/training-load", mobileHandler.GetTrainingLoad)
+			mobile.GET("/hazards", mobileHandler.GetHazards)
+			mobile.POST("/hazards", mobileHandler.ReportHazard)
+			mobile.GET("/hazards/reports", mobileHandler.ListHazardReports)
+			mobile.DELETE("/hazards/:hazard_id", mobileHandler.DeleteHazardReport)
+			mobile.GET("/goals", mobileHandler.ListGoals)
+			mobile.POST("/goals", mobileHandler.CreateGoal)
+			mobile.GET("/goals/events", mobileHandler.ListGoalEvents)
+			mobile.PATCH("/goals/:goal_id", mobileHandler.UpdateGoal)
+			mobile.DELETE("/goals/:goal_id", mobileHandler.DeleteGoal)
+			mobile.GET("/workout-templates", mobileHandler.ListWorkoutTemplates)
+			mobile.POST("/workout-templates", mobileHandler.CreateWorkoutTemplate)
+			mobile.DELETE("/workout-templates/:template_id", mobileHandler.DeleteWorkoutTemplate)
+			mobile.GET("/plans", mobileHandler.ListTrainingPlans)
+			mobile.POST("/plans", mobileHandler.CreateTrainingPlan)
+			mobile.DELETE("/plans/:plan_id", mobileHandler.DeleteTrainingPlan)
+			mobile.POST("/plans/:plan_id/schedule", mobileHandler.ScheduleTrainingPlan)
+			mobile.GET("/workouts", mobileHandler.ListScheduledWorkouts)
+			mobile.POST("/workouts", mobileHandler.ScheduleWorkout)
+			mobile.PATCH("/workouts/:workout_id", mobileHandler.UpdateScheduledWorkout)
+			mobile.DELETE("/workouts/:workout_id", mobileHandler.DeleteScheduledWorkout)
+			mobile.GET("/zones", mobileHandler.GetZoneSettings)
+			mobile.PUT("/zones", mobileHandler.UpdateZoneSettings)
 		}
 
 		iot := api.Group("/iot")
@@ -114,10 +198,35 @@ func main() {
 			{
 				iotProtected.POST("/runs/upload", iotHandler.UploadRun)
 				iotProtected.POST("/runs/batch", iotHandler.BatchUploadRuns)
+				iotProtected.POST("/runs/:session_id/media", iotHandler.UploadRunMedia)
 				iotProtected.POST("/devices/status", iotHandler.UpdateDeviceStatus)
 				iotProtected.GET("/devices/config", iotHandler.GetDeviceConfig)
+				iotProtected.GET("/workouts/next", iotHandler.NextWorkout)
+				iotProtected.GET("/hazards", iotHandler.GetHazards)
+				iotProtected.GET("/models/check", iotHandler.CheckAIModel)
 			}
 		}
+
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware(db))
+		{
+			admin.GET("/ai-models", adminHandler.ListAIModels)
+			admin.GET("/ai-models/compare", adminHandler.CompareAIModels)
+			admin.GET("/ai-models/precision", adminHandler.GetAIModelPrecision)
+			admin.GET("/ai-models/artifacts", adminHandler.ListAIModelArtifacts)
+			admin.POST("/ai-models/artifacts", adminHandler.PublishAIModelArtifact)
+			admin.GET("/ai-models/rollouts", adminHandler.ListAIModelRollouts)
+			admin.POST("/ai-models/rollouts", adminHandler.StartAIModelRollout)
+			admin.PATCH("/ai-models/rollouts/:rollout_id", adminHandler.UpdateAIModelRollout)
+			admin.PUT("/devices/:device_id/ai-model", adminHandler.PinDeviceAIModel)
+			admin.DELETE("/devices/:device_id/ai-model", adminHandler.UnpinDeviceAIModel)
+			admin.GET("/datasets", adminHandler.ListDatasetExports)
+			admin.POST("/datasets", adminHandler.RequestDatasetExport)
+			admin.GET("/datasets/:export_id", adminHandler.GetDatasetExport)
+			admin.GET("/datasets/:export_id/manifest", adminHandler.DownloadDatasetManifest)
+			admin.GET("/hazards/reports", adminHandler.ListHazardReports)
+			admin.PATCH("/hazards/:hazard_id", adminHandler.ModerateHazardReport)
+		}
 	}
 
 	port := os.Getenv("PORT")
@@ -149,6 +258,46 @@ func main() {
 		IdleTimeout:  idleTimeout,
 	}
 
+	// Background jobs stop with the server; each runs once at startup
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	scheduler := jobs.NewScheduler()
+	scheduler.Add(jobs.Job{
+		Name:     "training_load",
+		Interval: time.Hour,
+		Run:      services.NewTrainingLoadService(db).UpdateAll,
+	})
+	scheduler.Add(jobs.Job{
+		Name:     "zone_recompute",
+		Interval: time.Minute,
+		Run:      services.NewZoneService(db).RecomputePending,
+	})
+	scheduler.Add(jobs.Job{
+		Name:     "safety_scores",
+		Interval: time.Hour,
+		Run:      services.NewSafetyService(db).ScorePending,
+	})
+	scheduler.Add(jobs.Job{
+		Name:     "hazard_layer",
+		Interval: 6 * time.Hour,
+		Run:      services.NewHazardService(db).RefreshAggregated,
+	})
+	scheduler.Add(jobs.Job{
+		Name:     "ai_model_rollouts",
+		Interval: time.Hour,
+		Run:      services.NewAIModelService(db).CheckRollouts,
+	})
+	scheduler.Add(jobs.Job{
+		Name:     "dataset_exports",
+		Interval: time.Minute,
+		Run:      services.NewDatasetService(db, blobs).RunPending,
+	})
+	scheduler.Add(jobs.Job{
+		Name:     "media_gc",
+		Interval: 6 * time.Hour,
+		Run:      services.NewMediaService(db, blobs).CollectGarbage,
+	})
+	scheduler.Start(jobCtx)
+
 	go func() {
 		utils.Info("Starting HTTP server", 
 			zap.String("port", port),
@@ -176,5 +325,8 @@ func main() {
 		utils.Error("Server forced to shutdown", zap.Error(err))
 	}
 
+	stopJobs()
+	scheduler.Wait()
+
 	utils.Info("Server shutdown complete")
-}
\ No newline at end of file
+}
\ No newline at end of file
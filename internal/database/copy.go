@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+type pinnedConnKey struct{}
+
+// BeginPinned starts a transaction on a dedicated connection taken from the
+// pool. Statements issued through the returned handle and CopyFrom calls made
+// with it share that connection, so COPY loads take part in the same
+// transaction. The release func must be called once the transaction has been
+// committed or rolled back. On non-PostgreSQL dialects this is a plain Begin.
+func BeginPinned(db *gorm.DB) (*gorm.DB, func(), error) {
+	if db.Dialector.Name() != "postgres" {
+		tx := db.Begin()
+		return tx, func() {}, tx.Error
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	pinned := db.WithContext(context.WithValue(ctx, pinnedConnKey{}, conn))
+	pinned.Statement.ConnPool = conn
+
+	tx := pinned.Begin()
+	if tx.Error != nil {
+		conn.Close()
+		return nil, nil, tx.Error
+	}
+
+	return tx, func() { conn.Close() }, nil
+}
+
+// CopyFrom streams rows into table with PostgreSQL COPY. It reports false
+// without touching the database when tx was not opened with BeginPinned, so
+// callers can fall back to batched inserts.
+func CopyFrom(tx *gorm.DB, table string, columns []string, rows [][]interface{}) (bool, error) {
+	ctx := tx.Statement.Context
+	if ctx == nil {
+		return false, nil
+	}
+
+	conn, ok := ctx.Value(pinnedConnKey{}).(*sql.Conn)
+	if !ok {
+		return false, nil
+	}
+
+	err := conn.Raw(func(driverConn interface{}) error {
+		pgConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("pinned connection is not a pgx connection")
+		}
+		_, err := pgConn.Conn().CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromRows(rows))
+		return err
+	})
+	if err != nil {
+		return true, fmt.Errorf("copy into %s failed: %w", table, err)
+	}
+
+	return true, nil
+}
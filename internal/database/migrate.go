@@ -1,16 +1,89 @@
 package database
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"gorm.io/gorm"
 	"github.com/labmino/runsight-backend/internal/models"
 )
 
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	// The waypoint uniqueness index gained the track column; drop the old
+	// (run_id, sequence) index so raw and filtered tracks can coexist.
+	if db.Migrator().HasIndex(&models.RunWaypoint{}, "idx_run_waypoints_run_seq") {
+		if err := db.Migrator().DropIndex(&models.RunWaypoint{}, "idx_run_waypoints_run_seq"); err != nil {
+			return err
+		}
+	}
+
+	if err := db.AutoMigrate(
 		&models.User{},
 		&models.Device{},
 		&models.PairingSession{},
 		&models.Run{},
+		&models.AIModel{},
+		&models.AIModelArtifact{},
+		&models.AIModelRollout{},
+		&models.AIModelAssignment{},
 		&models.AIMetrics{},
-	)
-}
\ No newline at end of file
+		&models.AIEvent{},
+		&models.AIEventFeedback{},
+		&models.DatasetExport{},
+		&models.MediaBlob{},
+		&models.RunMedia{},
+		&models.LaneEvent{},
+		&models.Hazard{},
+		&models.RunWaypoint{},
+		&models.RunSplit{},
+		&models.RunStream{},
+		&models.ZoneSettings{},
+		&models.RunZoneTime{},
+		&models.RunBestEffort{},
+		&models.PersonalRecord{},
+		&models.DailyTrainingLoad{},
+		&models.Goal{},
+		&models.GoalEvent{},
+		&models.WorkoutTemplate{},
+		&models.TrainingPlan{},
+		&models.ScheduledWorkout{},
+		&models.RunWorkoutStep{},
+	); err != nil {
+		return err
+	}
+
+	return backfillRunWaypoints(db)
+}
+
+// backfillRunWaypoints copies waypoints out of the legacy route_data blob into
+// run_waypoints for runs that have not been migrated yet. It is safe to run on
+// every start: runs that already own waypoint rows are skipped.
+func backfillRunWaypoints(db *gorm.DB) error {
+	var runs []models.Run
+
+	result := db.Select("id", "route_data").
+		Where("route_data IS NOT NULL AND route_data <> ''").
+		Where("NOT EXISTS (SELECT 1 FROM run_waypoints w WHERE w.run_id = runs.id)").
+		FindInBatches(&runs, 100, func(tx *gorm.DB, batch int) error {
+			for _, run := range runs {
+				var routeData struct {
+					Waypoints []models.WaypointData `json:"waypoints"`
+				}
+				if err := json.Unmarshal([]byte(*run.RouteData), &routeData); err != nil {
+					// Unreadable blobs are left in place rather than failing startup
+					continue
+				}
+				if len(routeData.Waypoints) == 0 {
+					continue
+				}
+
+				rows := models.NewRunWaypoints(run.ID, models.TrackRaw, routeData.Waypoints)
+				if err := db.CreateInBatches(rows, 500).Error; err != nil {
+					return fmt.Errorf("failed to backfill waypoints for run %s: %w", run.ID, err)
+				}
+			}
+			return nil
+		})
+
+	return result.Error
+}
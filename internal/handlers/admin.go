@@ -0,0 +1,438 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+	"github.com/labmino/runsight-backend/internal/storage"
+	"github.com/labmino/runsight-backend/internal/utils"
+)
+
+// AdminHandler serves fleet-wide endpoints for the team. Routes are guarded by
+// AdminMiddleware.
+type AdminHandler struct {
+	db             *gorm.DB
+	validator      *validator.Validate
+	aiModelService *services.AIModelService
+	datasetService *services.DatasetService
+	hazardService  *services.HazardService
+}
+
+func NewAdminHandler(db *gorm.DB) *AdminHandler {
+	return &AdminHandler{
+		db:             db,
+		validator:      validator.New(),
+		aiModelService: services.NewAIModelService(db),
+		datasetService: services.NewDatasetService(db, storage.Default()),
+		hazardService:  services.NewHazardService(db),
+	}
+}
+
+func (h *AdminHandler) ListAIModels(c *gin.Context) {
+	registry, err := h.aiModelService.List()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch AI models", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "AI models retrieved successfully", gin.H{
+		"models": registry,
+	})
+}
+
+// CompareAIModels compares inference time and detection rates per model and
+// hardware version.
+func (h *AdminHandler) CompareAIModels(c *gin.Context) {
+	filter, ok := parseAIModelFilter(c)
+	if !ok {
+		return
+	}
+
+	comparisons, err := h.aiModelService.Compare(filter)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to compare AI models", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "AI model comparison retrieved successfully", gin.H{
+		"comparisons": comparisons,
+	})
+}
+
+// GetAIModelPrecision estimates each model's precision, overall and per class,
+// from the feedback runners gave on its detections.
+func (h *AdminHandler) GetAIModelPrecision(c *gin.Context) {
+	filter, ok := parseAIModelFilter(c)
+	if !ok {
+		return
+	}
+
+	precision, err := h.aiModelService.Precision(filter)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to estimate AI model precision", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "AI model precision retrieved successfully", gin.H{
+		"models": precision,
+	})
+}
+
+// parseAIModelFilter reads the model, hardware_version and from/to
+// (YYYY-MM-DD, to inclusive) query parameters, responding with an error when
+// they are invalid.
+func parseAIModelFilter(c *gin.Context) (services.AIModelFilter, bool) {
+	filter := services.AIModelFilter{
+		ModelName:       c.Query("model"),
+		HardwareVersion: c.Query("hardware_version"),
+	}
+
+	if v := c.Query("from"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid from", "from must be YYYY-MM-DD")
+			return filter, false
+		}
+		filter.From = &parsed
+	}
+	if v := c.Query("to"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid to", "to must be YYYY-MM-DD")
+			return filter, false
+		}
+		end := parsed.AddDate(0, 0, 1)
+		filter.To = &end
+	}
+	if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid range", "to must be on or after from")
+		return filter, false
+	}
+	return filter, true
+}
+
+func (h *AdminHandler) PublishAIModelArtifact(c *gin.Context) {
+	var req models.AIModelArtifactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	artifact, err := h.aiModelService.PublishArtifact(&req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to publish model artifact", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Model artifact published successfully", artifact)
+}
+
+func (h *AdminHandler) ListAIModelArtifacts(c *gin.Context) {
+	var modelID *uuid.UUID
+	if v := c.Query("model_id"); v != "" {
+		parsed, err := uuid.Parse(v)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid model ID", "model_id must be a valid UUID")
+			return
+		}
+		modelID = &parsed
+	}
+
+	artifacts, err := h.aiModelService.ListArtifacts(modelID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch model artifacts", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Model artifacts retrieved successfully", gin.H{
+		"artifacts": artifacts,
+	})
+}
+
+func (h *AdminHandler) StartAIModelRollout(c *gin.Context) {
+	var req models.AIModelRolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	rollout, err := h.aiModelService.StartRollout(&req)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "AI model not found", "Candidate or baseline model does not exist")
+			return
+		}
+		if errors.Is(err, services.ErrRolloutActive) {
+			utils.ErrorResponse(c, http.StatusConflict, "Rollout already active", "Complete or roll back the active rollout first")
+			return
+		}
+		if errors.Is(err, services.ErrRolloutBaseline) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid baseline", err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to start rollout", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Rollout started successfully", rollout)
+}
+
+// ListAIModelRollouts returns recent rollouts with the candidate and control
+// cohorts' metrics since each started.
+func (h *AdminHandler) ListAIModelRollouts(c *gin.Context) {
+	reports, err := h.aiModelService.ListRollouts()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch rollouts", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Rollouts retrieved successfully", gin.H{
+		"rollouts": reports,
+	})
+}
+
+func (h *AdminHandler) UpdateAIModelRollout(c *gin.Context) {
+	rolloutID, err := uuid.Parse(c.Param("rollout_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid rollout ID", "rollout_id must be a valid UUID")
+		return
+	}
+
+	var req models.AIModelRolloutUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	rollout, err := h.aiModelService.UpdateRollout(rolloutID, &req)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Rollout not found", "Rollout does not exist")
+			return
+		}
+		if errors.Is(err, services.ErrRolloutEnded) {
+			utils.ErrorResponse(c, http.StatusConflict, "Rollout already ended", "Start a new rollout instead")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update rollout", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Rollout updated successfully", rollout)
+}
+
+func (h *AdminHandler) PinDeviceAIModel(c *gin.Context) {
+	deviceID := c.Param("device_id")
+
+	var req models.AIModelPinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	assignment, err := h.aiModelService.PinDevice(deviceID, req.ModelID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Device or AI model not found", "Device or model does not exist")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to pin device model", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Device model pinned successfully", assignment)
+}
+
+func (h *AdminHandler) UnpinDeviceAIModel(c *gin.Context) {
+	if err := h.aiModelService.UnpinDevice(c.Param("device_id")); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Pin not found", "Device has no pinned model")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to unpin device model", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Device model unpinned successfully", nil)
+}
+
+// RequestDatasetExport queues a training dataset export of labelled
+// detections; a background job builds it.
+func (h *AdminHandler) RequestDatasetExport(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	var req models.DatasetFilter
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if req.From != nil && req.To != nil && !req.To.After(*req.From) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid range", "to must be after from")
+		return
+	}
+
+	export, err := h.datasetService.RequestExport(uid, req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to queue dataset export", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusAccepted, "Dataset export queued successfully", export)
+}
+
+func (h *AdminHandler) ListDatasetExports(c *gin.Context) {
+	exports, err := h.datasetService.ListExports()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch dataset exports", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Dataset exports retrieved successfully", gin.H{
+		"exports": exports,
+	})
+}
+
+func (h *AdminHandler) GetDatasetExport(c *gin.Context) {
+	export, ok := h.loadDatasetExport(c)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Dataset export retrieved successfully", export)
+}
+
+// DownloadDatasetManifest streams a completed export's JSONL manifest.
+func (h *AdminHandler) DownloadDatasetManifest(c *gin.Context) {
+	export, ok := h.loadDatasetExport(c)
+	if !ok {
+		return
+	}
+	if export.Status != models.DatasetExportCompleted {
+		utils.ErrorResponse(c, http.StatusConflict, "Dataset export not ready", "Export is "+export.Status)
+		return
+	}
+
+	manifest, err := h.datasetService.OpenManifest(c.Request.Context(), export)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to open dataset manifest", err.Error())
+		return
+	}
+	defer manifest.Close()
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{
+		"filename": fmt.Sprintf("dataset-v%d.jsonl", export.Version),
+	})
+	c.Header("Content-Disposition", disposition)
+	c.Header("Cache-Control", "no-store")
+	c.DataFromReader(http.StatusOK, -1, "application/x-ndjson", manifest, nil)
+}
+
+func (h *AdminHandler) loadDatasetExport(c *gin.Context) (*models.DatasetExport, bool) {
+	exportID, err := uuid.Parse(c.Param("export_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid export ID", "export_id must be a valid UUID")
+		return nil, false
+	}
+
+	export, err := h.datasetService.GetExport(exportID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Dataset export not found", "Dataset export does not exist")
+			return nil, false
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database error", err.Error())
+		return nil, false
+	}
+	return export, true
+}
+
+// ListHazardReports returns the hazard reports waiting for review.
+func (h *AdminHandler) ListHazardReports(c *gin.Context) {
+	hazards, err := h.hazardService.PendingReports()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch hazard reports", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Hazard reports retrieved successfully", gin.H{
+		"hazards": hazards,
+	})
+}
+
+// ModerateHazardReport approves a hazard report into the layer devices
+// download, or rejects it.
+func (h *AdminHandler) ModerateHazardReport(c *gin.Context) {
+	hazardID, err := uuid.Parse(c.Param("hazard_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid hazard ID", "hazard_id must be a valid UUID")
+		return
+	}
+
+	var req models.HazardModerationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	hazard, err := h.hazardService.Moderate(hazardID, req.Status)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Hazard report not found", "Hazard report does not exist or was removed")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to moderate hazard report", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Hazard report moderated successfully", hazard)
+}
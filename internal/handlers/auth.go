@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -153,6 +154,22 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 	if req.Phone != "" {
 		user.Phone = req.Phone
 	}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid timezone", "timezone must be an IANA zone name such as Asia/Jakarta")
+			return
+		}
+		user.Timezone = req.Timezone
+	}
+	if req.WeekStart != "" {
+		user.WeekStart = req.WeekStart
+	}
+	if req.ShareHazardData != nil {
+		user.ShareHazardData = *req.ShareHazardData
+	}
+	if req.ShareTrainingData != nil {
+		user.ShareTrainingData = *req.ShareTrainingData
+	}
 
 	if err := h.db.Save(&user).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update profile", err.Error())
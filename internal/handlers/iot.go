@@ -1,7 +1,8 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -9,22 +10,36 @@ import (
 	"github.com/go-playground/validator/v10"
 	"gorm.io/gorm"
 
+	"github.com/labmino/runsight-backend/internal/database"
 	"github.com/labmino/runsight-backend/internal/models"
 	"github.com/labmino/runsight-backend/internal/services"
+	"github.com/labmino/runsight-backend/internal/storage"
 	"github.com/labmino/runsight-backend/internal/utils"
 )
 
 type IoTHandler struct {
-	db             *gorm.DB
-	validator      *validator.Validate
-	pairingService *services.PairingService
+	db              *gorm.DB
+	validator       *validator.Validate
+	pairingService  *services.PairingService
+	analysisService *services.RunAnalysisService
+	workoutService  *services.WorkoutService
+	hazardService   *services.HazardService
+	aiModelService  *services.AIModelService
+	runPersistence  *services.RunPersistence
+	mediaService    *services.MediaService
 }
 
 func NewIoTHandler(db *gorm.DB) *IoTHandler {
 	return &IoTHandler{
-		db:             db,
-		validator:      validator.New(),
-		pairingService: services.NewPairingService(db),
+		db:              db,
+		validator:       validator.New(),
+		pairingService:  services.NewPairingService(db),
+		analysisService: services.NewRunAnalysisService(db),
+		workoutService:  services.NewWorkoutService(db),
+		hazardService:   services.NewHazardService(db),
+		aiModelService:  services.NewAIModelService(db),
+		runPersistence:  services.NewRunPersistence(db),
+		mediaService:    services.NewMediaService(db, storage.Default()),
 	}
 }
 
@@ -117,69 +132,38 @@ func (h *IoTHandler) UploadRun(c *gin.Context) {
 		utils.ValidationErrorResponse(c, err)
 		return
 	}
-
-	var routeDataJSON *string
-	if len(req.RunData.Waypoints) > 0 {
-		routeData := map[string]interface{}{
-			"waypoints": req.RunData.Waypoints,
-			"summary": map[string]interface{}{
-				"total_points": len(req.RunData.Waypoints),
-			},
-		}
-		
-		if jsonData, err := json.Marshal(routeData); err == nil {
-			jsonString := string(jsonData)
-			routeDataJSON = &jsonString
+	if req.AIMetrics != nil {
+		if err := h.validator.Struct(req.AIMetrics); err != nil {
+			utils.ValidationErrorResponse(c, err)
+			return
 		}
 	}
 
-	run := models.Run{
-		UserID:          deviceInfo.UserID,
-		DeviceID:        req.DeviceID,
-		SessionID:       req.SessionID,
-		Title:           req.RunData.Title,
-		Notes:           req.RunData.Notes,
-		StartedAt:       req.RunData.StartedAt,
-		EndedAt:         req.RunData.EndedAt,
-		DurationSeconds: req.RunData.DurationSeconds,
-		DistanceMeters:  req.RunData.DistanceMeters,
-		AvgSpeedKmh:     req.RunData.AvgSpeedKmh,
-		MaxSpeedKmh:     req.RunData.MaxSpeedKmh,
-		CaloriesBurned:  req.RunData.CaloriesBurned,
-		StepsCount:      req.RunData.StepsCount,
-		StartLatitude:   req.RunData.StartLatitude,
-		StartLongitude:  req.RunData.StartLongitude,
-		EndLatitude:     req.RunData.EndLatitude,
-		EndLongitude:    req.RunData.EndLongitude,
-		RouteData:       routeDataJSON,
+	streams, err := services.BuildStreams(req.RunData.Streams)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid sensor streams", err.Error())
+		return
 	}
 
-	// Use transaction to ensure run and AI metrics are saved atomically
-	tx := h.db.Begin()
-	if tx.Error != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to start transaction", tx.Error.Error())
+	run, payload := h.prepareUploadedRun(deviceInfo, req.SessionID, &req.RunData, streams, req.AIMetrics)
+
+	// Use transaction to ensure run, waypoints and AI metrics are saved atomically
+	tx, release, err := database.BeginPinned(h.db)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to start transaction", err.Error())
 		return
 	}
+	defer release()
 
-	if err := tx.Create(&run).Error; err != nil {
+	saved, err := h.runPersistence.Save(tx, run, payload)
+	if err != nil {
 		tx.Rollback()
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create run", err.Error())
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to save run", err.Error())
 		return
 	}
 
-	if req.AIMetrics != nil {
-		if err := h.validator.Struct(req.AIMetrics); err != nil {
-			tx.Rollback()
-			utils.ValidationErrorResponse(c, err)
-			return
-		}
-
-		aiMetrics := req.AIMetrics.ToModel(run.ID)
-		if err := tx.Create(aiMetrics).Error; err != nil {
-			tx.Rollback()
-			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to save AI metrics", err.Error())
-			return
-		}
+	if saved.Model != nil {
+		deviceInfo.CurrentModelID = &saved.Model.ID
 	}
 
 	now := time.Now()
@@ -195,10 +179,56 @@ func (h *IoTHandler) UploadRun(c *gin.Context) {
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusCreated, "Run uploaded successfully", gin.H{
-		"run_id": run.ID,
-		"status": "saved",
-	})
+	utils.SuccessResponse(c, http.StatusCreated, "Run uploaded successfully", savedRunResponse(run, saved))
+}
+
+// prepareUploadedRun builds a run from what the glasses sent, with metrics
+// computed from the cleaned track. Raw fixes are kept as uploaded.
+func (h *IoTHandler) prepareUploadedRun(device *models.Device, sessionID string, data *models.RunCreateRequest,
+	streams []models.RunStream, aiMetrics *models.AIMetricsRequest) (*models.Run, *services.RunPayload) {
+	run := &models.Run{
+		UserID:          device.UserID,
+		DeviceID:        device.DeviceID,
+		SessionID:       sessionID,
+		Title:           data.Title,
+		Notes:           data.Notes,
+		StartedAt:       data.StartedAt,
+		EndedAt:         data.EndedAt,
+		DurationSeconds: data.DurationSeconds,
+		DistanceMeters:  data.DistanceMeters,
+		AvgSpeedKmh:     data.AvgSpeedKmh,
+		MaxSpeedKmh:     data.MaxSpeedKmh,
+		CaloriesBurned:  data.CaloriesBurned,
+		StepsCount:      data.StepsCount,
+		StartLatitude:   data.StartLatitude,
+		StartLongitude:  data.StartLongitude,
+		EndLatitude:     data.EndLatitude,
+		EndLongitude:    data.EndLongitude,
+	}
+
+	payload := &services.RunPayload{
+		Raw:                data.Waypoints,
+		Filtered:           h.analysisService.Prepare(run, data.Waypoints),
+		LapMarkers:         data.LapMarkers,
+		Streams:            streams,
+		WorkoutSteps:       data.WorkoutSteps,
+		ScheduledWorkoutID: data.ScheduledWorkoutID,
+		AIMetrics:          aiMetrics,
+		Device:             device,
+	}
+	return run, payload
+}
+
+// savedRunResponse is what the glasses get back for each stored run.
+func savedRunResponse(run *models.Run, saved *services.RunSaveResult) gin.H {
+	return gin.H{
+		"run_id":          run.ID,
+		"status":          "saved",
+		"safety_score":    run.SafetyScore,
+		"new_records":     saved.NewRecords,
+		"completed_goals": saved.CompletedGoals,
+		"workout":         saved.Workout,
+	}
 }
 
 func (h *IoTHandler) BatchUploadRuns(c *gin.Context) {
@@ -268,105 +298,68 @@ func (h *IoTHandler) BatchUploadRuns(c *gin.Context) {
 			errorCount++
 			continue
 		}
-
-		var routeDataJSON *string
-		if len(runReq.RunData.Waypoints) > 0 {
-			routeData := map[string]interface{}{
-				"waypoints": runReq.RunData.Waypoints,
-				"summary": map[string]interface{}{
-					"total_points": len(runReq.RunData.Waypoints),
-				},
-			}
-			
-			if jsonData, err := json.Marshal(routeData); err == nil {
-				jsonString := string(jsonData)
-				routeDataJSON = &jsonString
+		if runReq.AIMetrics != nil {
+			if err := h.validator.Struct(runReq.AIMetrics); err != nil {
+				results = append(results, gin.H{
+					"session_id": runReq.SessionID,
+					"status":     "error",
+					"error":      "AI metrics validation error: " + err.Error(),
+				})
+				errorCount++
+				continue
 			}
 		}
 
-		run := models.Run{
-			UserID:          deviceInfo.UserID,
-			DeviceID:        req.DeviceID,
-			SessionID:       runReq.SessionID,
-			Title:           runReq.RunData.Title,
-			Notes:           runReq.RunData.Notes,
-			StartedAt:       runReq.RunData.StartedAt,
-			EndedAt:         runReq.RunData.EndedAt,
-			DurationSeconds: runReq.RunData.DurationSeconds,
-			DistanceMeters:  runReq.RunData.DistanceMeters,
-			AvgSpeedKmh:     runReq.RunData.AvgSpeedKmh,
-			MaxSpeedKmh:     runReq.RunData.MaxSpeedKmh,
-			CaloriesBurned:  runReq.RunData.CaloriesBurned,
-			StepsCount:      runReq.RunData.StepsCount,
-			StartLatitude:   runReq.RunData.StartLatitude,
-			StartLongitude:  runReq.RunData.StartLongitude,
-			EndLatitude:     runReq.RunData.EndLatitude,
-			EndLongitude:    runReq.RunData.EndLongitude,
-			RouteData:       routeDataJSON,
-		}
-
-		tx := h.db.Begin()
-		if tx.Error != nil {
+		streams, err := services.BuildStreams(runReq.RunData.Streams)
+		if err != nil {
 			results = append(results, gin.H{
 				"session_id": runReq.SessionID,
 				"status":     "error",
-				"error":      "Transaction error: " + tx.Error.Error(),
+				"error":      "Invalid sensor streams: " + err.Error(),
 			})
 			errorCount++
 			continue
 		}
 
-		if err := tx.Create(&run).Error; err != nil {
-			tx.Rollback()
+		run, payload := h.prepareUploadedRun(deviceInfo, runReq.SessionID, &runReq.RunData, streams, runReq.AIMetrics)
+
+		tx, release, err := database.BeginPinned(h.db)
+		if err != nil {
 			results = append(results, gin.H{
 				"session_id": runReq.SessionID,
 				"status":     "error",
-				"error":      "Failed to create run: " + err.Error(),
+				"error":      "Transaction error: " + err.Error(),
 			})
 			errorCount++
 			continue
 		}
 
-		if runReq.AIMetrics != nil {
-			if err := h.validator.Struct(runReq.AIMetrics); err != nil {
-				tx.Rollback()
-				results = append(results, gin.H{
-					"session_id": runReq.SessionID,
-					"status":     "error",
-					"error":      "AI metrics validation error: " + err.Error(),
-				})
-				errorCount++
-				continue
-			}
-
-			aiMetrics := runReq.AIMetrics.ToModel(run.ID)
-			if err := tx.Create(aiMetrics).Error; err != nil {
-				tx.Rollback()
-				results = append(results, gin.H{
-					"session_id": runReq.SessionID,
-					"status":     "error",
-					"error":      "Failed to save AI metrics: " + err.Error(),
-				})
-				errorCount++
-				continue
-			}
+		saved, err := h.runPersistence.Save(tx, run, payload)
+		if err != nil {
+			tx.Rollback()
+		} else if err = tx.Commit().Error; err != nil {
+			err = fmt.Errorf("failed to commit: %w", err)
 		}
-
-		if err := tx.Commit().Error; err != nil {
+		release()
+		if err != nil {
 			results = append(results, gin.H{
 				"session_id": runReq.SessionID,
 				"status":     "error",
-				"error":      "Failed to commit: " + err.Error(),
+				"error":      err.Error(),
 			})
 			errorCount++
 			continue
 		}
 
-		results = append(results, gin.H{
-			"session_id": runReq.SessionID,
-			"run_id":     run.ID,
-			"status":     "saved",
-		})
+		// Only committed runs name the device's model, so it never points at
+		// a registry entry that was rolled back
+		if saved.Model != nil {
+			deviceInfo.CurrentModelID = &saved.Model.ID
+		}
+
+		result := savedRunResponse(run, saved)
+		result["session_id"] = runReq.SessionID
+		results = append(results, result)
 		successCount++
 	}
 
@@ -375,7 +368,7 @@ func (h *IoTHandler) BatchUploadRuns(c *gin.Context) {
 	h.db.Save(deviceInfo)
 
 	utils.SuccessResponse(c, http.StatusOK, "Batch upload completed", gin.H{
-		"results":       results,
+		"results": results,
 		"summary": gin.H{
 			"total":   len(req.Runs),
 			"success": successCount,
@@ -420,6 +413,14 @@ func (h *IoTHandler) UpdateDeviceStatus(c *gin.Context) {
 	if req.FirmwareVersion != "" {
 		deviceInfo.FirmwareVersion = req.FirmwareVersion
 	}
+	if req.Model != nil {
+		model, err := h.aiModelService.Resolve(h.db, req.Model)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to record AI model", err.Error())
+			return
+		}
+		deviceInfo.CurrentModelID = &model.ID
+	}
 
 	now := time.Now()
 	deviceInfo.LastSyncAt = &now
@@ -430,9 +431,9 @@ func (h *IoTHandler) UpdateDeviceStatus(c *gin.Context) {
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Device status updated successfully", gin.H{
-		"device_id":   deviceInfo.DeviceID,
-		"updated_at":  now.Format(time.RFC3339),
-		"status":      "updated",
+		"device_id":  deviceInfo.DeviceID,
+		"updated_at": now.Format(time.RFC3339),
+		"status":     "updated",
 	})
 }
 
@@ -451,12 +452,180 @@ func (h *IoTHandler) GetDeviceConfig(c *gin.Context) {
 
 	config := models.DeviceConfig{
 		UploadIntervalSeconds: 300,
-		BatchSize:            10,   
-		CompressionEnabled:   true,
+		BatchSize:             10,
+		CompressionEnabled:    true,
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Device configuration retrieved successfully", gin.H{
 		"device_id": deviceInfo.DeviceID,
 		"config":    config,
 	})
-}
\ No newline at end of file
+}
+
+// CheckAIModel tells the device which detection model to run and where to
+// download it, following its pin or the current rollout.
+func (h *IoTHandler) CheckAIModel(c *gin.Context) {
+	device, exists := c.Get("device")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Device not found in context", "")
+		return
+	}
+
+	deviceInfo, ok := device.(*models.Device)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid device context", "")
+		return
+	}
+
+	check, err := h.aiModelService.CheckForDevice(deviceInfo)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check AI model", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "AI model check completed", check)
+}
+
+// UploadRunMedia stores a frame the glasses captured during an uploaded run,
+// sent as multipart form data with the image in file and its capture time in
+// captured_at. Re-sending a frame is answered with the stored media.
+func (h *IoTHandler) UploadRunMedia(c *gin.Context) {
+	device, exists := c.Get("device")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Device not found in context", "")
+		return
+	}
+
+	deviceInfo, ok := device.(*models.Device)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid device context", "")
+		return
+	}
+
+	var run models.Run
+	if err := h.db.Where("session_id = ? AND user_id = ?", c.Param("session_id"), deviceInfo.UserID).First(&run).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Upload the run before its media")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch run", err.Error())
+		return
+	}
+
+	capturedAt, err := time.Parse(time.RFC3339, c.PostForm("captured_at"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid captured_at", "captured_at must be an RFC 3339 timestamp")
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "File required", "file must contain the image")
+		return
+	}
+	if header.Size > services.MaxMediaSizeBytes {
+		utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "File too large", fmt.Sprintf("file must not exceed %d bytes", services.MaxMediaSizeBytes))
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Failed to read file", err.Error())
+		return
+	}
+	defer file.Close()
+
+	media, duplicate, err := h.mediaService.Upload(c.Request.Context(), &run, capturedAt, file)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMediaTooLarge):
+			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "File too large", fmt.Sprintf("file must not exceed %d bytes", services.MaxMediaSizeBytes))
+		case errors.Is(err, services.ErrMediaType):
+			utils.ErrorResponse(c, http.StatusUnsupportedMediaType, "Unsupported media type", "file must be a JPEG, PNG or WebP image")
+		case errors.Is(err, services.ErrMediaQuota):
+			utils.ErrorResponse(c, http.StatusForbidden, "Media quota exceeded", err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to upload media", err.Error())
+		}
+		return
+	}
+
+	if duplicate {
+		utils.SuccessResponse(c, http.StatusOK, "Media already uploaded", media)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusCreated, "Media uploaded successfully", media)
+}
+
+// NextWorkout serves the next planned workout of the device owner so the
+// glasses can guide it; workout is null when nothing is scheduled.
+func (h *IoTHandler) NextWorkout(c *gin.Context) {
+	device, exists := c.Get("device")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Device not found in context", "")
+		return
+	}
+
+	deviceInfo, ok := device.(*models.Device)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid device context", "")
+		return
+	}
+
+	workout, err := h.workoutService.NextWorkout(deviceInfo.UserID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch next workout", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Next workout retrieved successfully", gin.H{
+		"workout": workout,
+	})
+}
+
+// GetHazards serves the curated hazard layer for the device's area. Devices
+// pass back synced_at from the previous response as since to receive only
+// what changed; when delta is false the response replaces their whole layer.
+func (h *IoTHandler) GetHazards(c *gin.Context) {
+	if _, exists := c.Get("device"); !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Device not found in context", "")
+		return
+	}
+
+	bbox, err := services.ParseBBox(c.Query("bbox"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid bbox", err.Error())
+		return
+	}
+	if bbox.Span() > services.MaxSharedHazardSpanDegrees {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid bbox",
+			fmt.Sprintf("bbox must be at most %.0f degree across", services.MaxSharedHazardSpanDegrees))
+		return
+	}
+
+	var since *time.Time
+	if v := c.Query("since"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid since", "since must be an RFC 3339 timestamp")
+			return
+		}
+		since = &parsed
+	}
+
+	now := time.Now()
+	if since != nil && now.Sub(*since) > services.MaxHazardDeltaAge {
+		since = nil
+	}
+	hazards, removed, err := h.hazardService.Feed(bbox, since, now)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch hazards", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Hazards retrieved successfully", gin.H{
+		"hazards":   hazards,
+		"removed":   removed,
+		"delta":     since != nil,
+		"synced_at": now.UTC().Format(time.RFC3339Nano),
+	})
+}
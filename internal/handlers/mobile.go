@@ -1,8 +1,14 @@
 package handlers
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,20 +18,51 @@ import (
 
 	"github.com/labmino/runsight-backend/internal/models"
 	"github.com/labmino/runsight-backend/internal/services"
+	"github.com/labmino/runsight-backend/internal/storage"
 	"github.com/labmino/runsight-backend/internal/utils"
 )
 
 type MobileHandler struct {
-	db             *gorm.DB
-	validator      *validator.Validate
-	pairingService *services.PairingService
+	db              *gorm.DB
+	validator       *validator.Validate
+	pairingService  *services.PairingService
+	waypointService *services.WaypointService
+	importService   *services.RunImportService
+	analysisService *services.RunAnalysisService
+	splitService    *services.SplitService
+	streamService   *services.StreamService
+	zoneService     *services.ZoneService
+	recordService   *services.RecordService
+	runService      *services.RunService
+	statsService    *services.StatsService
+	loadService     *services.TrainingLoadService
+	goalService     *services.GoalService
+	workoutService  *services.WorkoutService
+	aiEventService  *services.AIEventService
+	hazardService   *services.HazardService
+	mediaService    *services.MediaService
 }
 
 func NewMobileHandler(db *gorm.DB) *MobileHandler {
 	return &MobileHandler{
-		db:             db,
-		validator:      validator.New(),
-		pairingService: services.NewPairingService(db),
+		db:              db,
+		validator:       validator.New(),
+		pairingService:  services.NewPairingService(db),
+		waypointService: services.NewWaypointService(db),
+		importService:   services.NewRunImportService(db),
+		analysisService: services.NewRunAnalysisService(db),
+		splitService:    services.NewSplitService(db),
+		streamService:   services.NewStreamService(db),
+		zoneService:     services.NewZoneService(db),
+		recordService:   services.NewRecordService(db),
+		runService:      services.NewRunService(db),
+		statsService:    services.NewStatsService(db),
+		loadService:     services.NewTrainingLoadService(db),
+		goalService:     services.NewGoalService(db),
+		workoutService:  services.NewWorkoutService(db),
+		aiEventService:  services.NewAIEventService(db),
+		hazardService:   services.NewHazardService(db),
+		mediaService:    services.NewMediaService(db, storage.Default()),
 	}
 }
 
@@ -107,15 +144,36 @@ func (h *MobileHandler) GetDevices(c *gin.Context) {
 		return
 	}
 
+	// Detection models the devices last reported running
+	var modelIDs []uuid.UUID
+	for _, device := range devices {
+		if device.CurrentModelID != nil {
+			modelIDs = append(modelIDs, *device.CurrentModelID)
+		}
+	}
+	currentModels := make(map[uuid.UUID]*models.AIModel)
+	if len(modelIDs) > 0 {
+		var registry []models.AIModel
+		if err := h.db.Where("id IN ?", modelIDs).Find(&registry).Error; err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch device models", err.Error())
+			return
+		}
+		for i := range registry {
+			currentModels[registry[i].ID] = &registry[i]
+		}
+	}
+
 	type DeviceResponse struct {
-		DeviceID        string `json:"device_id"`
-		DeviceName      string `json:"device_name"`
-		DeviceType      string `json:"device_type"`
-		FirmwareVersion string `json:"firmware_version"`
-		IsActive        bool   `json:"is_active"`
-		BatteryLevel    *int   `json:"battery_level,omitempty"`
-		LastSyncAt      string `json:"last_sync_at,omitempty"`
-		PairedAt        string `json:"paired_at"`
+		DeviceID        string          `json:"device_id"`
+		DeviceName      string          `json:"device_name"`
+		DeviceType      string          `json:"device_type"`
+		FirmwareVersion string          `json:"firmware_version"`
+		HardwareVersion string          `json:"hardware_version,omitempty"`
+		CurrentModel    *models.AIModel `json:"current_model,omitempty"`
+		IsActive        bool            `json:"is_active"`
+		BatteryLevel    *int            `json:"battery_level,omitempty"`
+		LastSyncAt      string          `json:"last_sync_at,omitempty"`
+		PairedAt        string          `json:"paired_at"`
 	}
 
 	var response []DeviceResponse
@@ -125,10 +183,14 @@ func (h *MobileHandler) GetDevices(c *gin.Context) {
 			DeviceName:      device.DeviceName,
 			DeviceType:      device.DeviceType,
 			FirmwareVersion: device.FirmwareVersion,
+			HardwareVersion: device.HardwareVersion,
 			IsActive:        device.IsActive,
 			BatteryLevel:    device.BatteryLevel,
 			PairedAt:        device.PairedAt.Format("2006-01-02T15:04:05Z07:00"),
 		}
+		if device.CurrentModelID != nil {
+			deviceResp.CurrentModel = currentModels[*device.CurrentModelID]
+		}
 		if device.LastSyncAt != nil {
 			deviceResp.LastSyncAt = device.LastSyncAt.Format("2006-01-02T15:04:05Z07:00")
 		}
@@ -212,16 +274,27 @@ func (h *MobileHandler) ListRuns(c *gin.Context) {
 
 	query := h.db.Where("user_id = ?", uid)
 
+	// Dates are calendar days in the user's timezone
+	loc, _, ok := h.userCalendar(c, uid)
+	if !ok {
+		return
+	}
+
 	if startDate := c.Query("start_date"); startDate != "" {
-		if parsedStartDate, err := time.Parse("2006-01-02", startDate); err == nil {
+		if parsedStartDate, err := time.ParseInLocation("2006-01-02", startDate, loc); err == nil {
 			query = query.Where("started_at >= ?", parsedStartDate)
 		}
 	}
 
 	if endDate := c.Query("end_date"); endDate != "" {
-		if parsedEndDate, err := time.Parse("2006-01-02", endDate); err == nil {
-			endOfDay := parsedEndDate.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
-			query = query.Where("started_at <= ?", endOfDay)
+		if parsedEndDate, err := time.ParseInLocation("2006-01-02", endDate, loc); err == nil {
+			query = query.Where("started_at < ?", parsedEndDate.AddDate(0, 0, 1))
+		}
+	}
+
+	if flagged := c.Query("flagged"); flagged != "" {
+		if parsedFlagged, err := strconv.ParseBool(flagged); err == nil {
+			query = query.Where("metrics_flagged = ?", parsedFlagged)
 		}
 	}
 
@@ -239,33 +312,39 @@ func (h *MobileHandler) ListRuns(c *gin.Context) {
 	}
 
 	type RunListResponse struct {
-		ID              uuid.UUID  `json:"id"`
-		DeviceID        string     `json:"device_id"`
-		SessionID       string     `json:"session_id"`
-		Title           string     `json:"title,omitempty"`
-		StartedAt       time.Time  `json:"started_at"`
-		EndedAt         *time.Time `json:"ended_at,omitempty"`
-		DurationSeconds *int       `json:"duration_seconds,omitempty"`
-		DistanceMeters  *float64   `json:"distance_meters,omitempty"`
-		AvgSpeedKmh     *float64   `json:"avg_speed_kmh,omitempty"`
-		CaloriesBurned  *int       `json:"calories_burned,omitempty"`
-		CreatedAt       time.Time  `json:"created_at"`
+		ID                  uuid.UUID  `json:"id"`
+		DeviceID            string     `json:"device_id"`
+		SessionID           string     `json:"session_id"`
+		Title               string     `json:"title,omitempty"`
+		StartedAt           time.Time  `json:"started_at"`
+		EndedAt             *time.Time `json:"ended_at,omitempty"`
+		DurationSeconds     *int       `json:"duration_seconds,omitempty"`
+		DistanceMeters      *float64   `json:"distance_meters,omitempty"`
+		AvgSpeedKmh         *float64   `json:"avg_speed_kmh,omitempty"`
+		CaloriesBurned      *int       `json:"calories_burned,omitempty"`
+		ElevationGainMeters *float64   `json:"elevation_gain_meters,omitempty"`
+		AvgHeartRateBpm     *int       `json:"avg_heart_rate_bpm,omitempty"`
+		MetricsFlagged      bool       `json:"metrics_flagged"`
+		CreatedAt           time.Time  `json:"created_at"`
 	}
 
 	var response []RunListResponse
 	for _, run := range runs {
 		response = append(response, RunListResponse{
-			ID:              run.ID,
-			DeviceID:        run.DeviceID,
-			SessionID:       run.SessionID,
-			Title:           run.Title,
-			StartedAt:       run.StartedAt,
-			EndedAt:         run.EndedAt,
-			DurationSeconds: run.DurationSeconds,
-			DistanceMeters:  run.DistanceMeters,
-			AvgSpeedKmh:     run.AvgSpeedKmh,
-			CaloriesBurned:  run.CaloriesBurned,
-			CreatedAt:       run.CreatedAt,
+			ID:                  run.ID,
+			DeviceID:            run.DeviceID,
+			SessionID:           run.SessionID,
+			Title:               run.Title,
+			StartedAt:           run.StartedAt,
+			EndedAt:             run.EndedAt,
+			DurationSeconds:     run.DurationSeconds,
+			DistanceMeters:      run.DistanceMeters,
+			AvgSpeedKmh:         run.AvgSpeedKmh,
+			CaloriesBurned:      run.CaloriesBurned,
+			ElevationGainMeters: run.ElevationGainMeters,
+			AvgHeartRateBpm:     run.AvgHeartRateBpm,
+			MetricsFlagged:      run.MetricsFlagged,
+			CreatedAt:           run.CreatedAt,
 		})
 	}
 
@@ -328,13 +407,29 @@ func (h *MobileHandler) GetRun(c *gin.Context) {
 		return
 	}
 
+	zoneTimes, err := h.zoneService.GetRunZones(run.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch zone times", err.Error())
+		return
+	}
+
+	workoutSteps, err := h.workoutService.GetRunSteps(run.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch workout steps", err.Error())
+		return
+	}
+
 	type RunDetailResponse struct {
 		models.Run
-		AIMetrics *models.AIMetrics `json:"ai_metrics,omitempty"`
+		AIMetrics    *models.AIMetrics       `json:"ai_metrics,omitempty"`
+		ZoneTimes    []models.RunZoneTime    `json:"zone_times,omitempty"`
+		WorkoutSteps []models.RunWorkoutStep `json:"workout_steps,omitempty"`
 	}
 
 	response := RunDetailResponse{
-		Run: run,
+		Run:          run,
+		ZoneTimes:    zoneTimes,
+		WorkoutSteps: workoutSteps,
 	}
 
 	if hasAIMetrics {
@@ -370,7 +465,7 @@ func (h *MobileHandler) GetRunWaypoints(c *gin.Context) {
 	}
 
 	var run models.Run
-	err = h.db.Select("route_data").Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
+	err = h.db.Select("id").Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
@@ -380,19 +475,114 @@ func (h *MobileHandler) GetRunWaypoints(c *gin.Context) {
 		return
 	}
 
-	if run.RouteData == nil {
-		utils.SuccessResponse(c, http.StatusOK, "No waypoints available", gin.H{
-			"waypoints": []interface{}{},
-		})
+	var query services.WaypointQuery
+
+	switch track := c.DefaultQuery("track", models.TrackFiltered); track {
+	case models.TrackRaw, models.TrackFiltered:
+		query.Track = track
+	default:
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid track", "track must be raw or filtered")
+		return
+	}
+
+	var simplifyMeters float64
+	if v := c.Query("simplify"); v != "" {
+		tolerance, err := strconv.ParseFloat(v, 64)
+		if err != nil || tolerance <= 0 || tolerance > 1000 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid simplify", "simplify must be a tolerance in meters between 0 and 1000")
+			return
+		}
+		simplifyMeters = tolerance
+	}
+
+	if v := c.Query("from_seq"); v != "" {
+		seq, err := strconv.Atoi(v)
+		if err != nil || seq < 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid from_seq", "from_seq must be a non-negative integer")
+			return
+		}
+		query.FromSeq = &seq
+	}
+
+	if v := c.Query("to_seq"); v != "" {
+		seq, err := strconv.Atoi(v)
+		if err != nil || seq < 0 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid to_seq", "to_seq must be a non-negative integer")
+			return
+		}
+		query.ToSeq = &seq
+	}
+
+	if v := c.Query("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid from", "from must be an RFC3339 timestamp")
+			return
+		}
+		query.From = &from
+	}
+
+	if v := c.Query("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid to", "to must be an RFC3339 timestamp")
+			return
+		}
+		query.To = &to
+	}
+
+	if v := c.Query("max_points"); v != "" {
+		maxPoints, err := strconv.Atoi(v)
+		if err != nil || maxPoints < 2 || maxPoints > 10000 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid max_points", "max_points must be between 2 and 10000")
+			return
+		}
+		query.MaxPoints = maxPoints
+	}
+
+	page, err := h.waypointService.GetWaypoints(run.ID, query)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch waypoints", err.Error())
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Waypoints retrieved successfully", gin.H{
-		"route_data": *run.RouteData,
+	waypoints := page.Waypoints
+	if waypoints == nil {
+		waypoints = []models.RunWaypoint{}
+	}
+
+	// Douglas-Peucker simplification for display keeps the route's shape with
+	// far fewer points than the stored track
+	if simplifyMeters > 0 && len(waypoints) > 2 {
+		indexes := services.SimplifyIndexes(len(waypoints), func(i int) (float64, float64) {
+			return waypoints[i].Latitude, waypoints[i].Longitude
+		}, simplifyMeters)
+		simplified := make([]models.RunWaypoint, len(indexes))
+		for i, idx := range indexes {
+			simplified[i] = waypoints[idx]
+		}
+		waypoints = simplified
+	}
+
+	message := "Waypoints retrieved successfully"
+	if page.TotalPoints == 0 {
+		message = "No waypoints available"
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, message, gin.H{
+		"run_id":          run.ID,
+		"track":           page.Track,
+		"waypoints":       waypoints,
+		"total_points":    page.TotalPoints,
+		"matched_points":  page.Matched,
+		"returned_points": len(waypoints),
+		"downsampled":     page.Step > 1,
+		"step":            page.Step,
+		"simplified":      simplifyMeters > 0,
 	})
 }
 
-func (h *MobileHandler) GetStats(c *gin.Context) {
+func (h *MobileHandler) ExportRun(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
@@ -405,70 +595,151 @@ func (h *MobileHandler) GetStats(c *gin.Context) {
 		return
 	}
 
-	type Stats struct {
-		TotalDistance   float64 `json:"total_distance_meters"`
-		TotalRuns       int64   `json:"total_runs"`
-		TotalDuration   int     `json:"total_duration_seconds"`
-		AvgSpeed        float64 `json:"avg_speed_kmh"`
-		TotalCalories   int     `json:"total_calories_burned"`
-		TotalSteps      int     `json:"total_steps"`
+	runIDParam := c.Param("run_id")
+	if runIDParam == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Run ID required", "run_id parameter is missing")
+		return
 	}
 
-	var stats Stats
+	runID, err := uuid.Parse(runIDParam)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid run ID", "run_id must be a valid UUID")
+		return
+	}
 
-	err := h.db.Model(&models.Run{}).
-		Select(`
-			COUNT(*) as total_runs,
-			COALESCE(SUM(distance_meters), 0) as total_distance,
-			COALESCE(SUM(duration_seconds), 0) as total_duration,
-			COALESCE(AVG(avg_speed_kmh), 0) as avg_speed,
-			COALESCE(SUM(calories_burned), 0) as total_calories,
-			COALESCE(SUM(steps_count), 0) as total_steps
-		`).
-		Where("user_id = ?", uid).
-		Scan(&stats).Error
+	format := strings.ToLower(c.DefaultQuery("format", services.ExportFormatGPX))
+	contentType, supported := services.ExportContentType(format)
+	if !supported {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Unsupported export format", "format must be one of gpx, tcx, geojson, csv")
+		return
+	}
 
+	var run models.Run
+	err = h.db.Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch statistics", err.Error())
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database error", err.Error())
 		return
 	}
 
-	type StatsResponse struct {
-		TotalDistanceMeters   float64 `json:"total_distance_meters"`
-		TotalDistanceKm       float64 `json:"total_distance_km"`
-		TotalRuns             int64   `json:"total_runs"`
-		TotalDurationSeconds  int     `json:"total_duration_seconds"`
-		TotalDurationHours    float64 `json:"total_duration_hours"`
-		AvgSpeedKmh          float64 `json:"avg_speed_kmh"`
-		TotalCaloriesBurned  int     `json:"total_calories_burned"`
-		TotalSteps           int     `json:"total_steps"`
-		AvgDistancePerRun    float64 `json:"avg_distance_per_run_meters"`
-		AvgDurationPerRun    float64 `json:"avg_duration_per_run_seconds"`
+	points, err := h.waypointService.LoadTrack(run.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch waypoints", err.Error())
+		return
 	}
 
-	var avgDistance, avgDuration float64
-	if stats.TotalRuns > 0 {
-		avgDistance = stats.TotalDistance / float64(stats.TotalRuns)
-		avgDuration = float64(stats.TotalDuration) / float64(stats.TotalRuns)
+	// Render into a buffer first so a failure can still produce a JSON error
+	var buf bytes.Buffer
+	if err := services.ExportRun(&buf, format, &run, points); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to export run", err.Error())
+		return
 	}
 
-	response := StatsResponse{
-		TotalDistanceMeters:   stats.TotalDistance,
-		TotalDistanceKm:       stats.TotalDistance / 1000,
-		TotalRuns:             stats.TotalRuns,
-		TotalDurationSeconds:  stats.TotalDuration,
-		TotalDurationHours:    float64(stats.TotalDuration) / 3600,
-		AvgSpeedKmh:          stats.AvgSpeed,
-		TotalCaloriesBurned:  stats.TotalCalories,
-		TotalSteps:           stats.TotalSteps,
-		AvgDistancePerRun:    avgDistance,
-		AvgDurationPerRun:    avgDuration,
+	disposition := mime.FormatMediaType("attachment", map[string]string{
+		"filename": services.ExportFilename(&run, format),
+	})
+	c.Header("Content-Disposition", disposition)
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// maxImportFiles caps how many files a single import request may carry; zip
+// archives count as one file regardless of how many activities they hold.
+const maxImportFiles = 20
+
+// MaxImportRequestBytes is the body limit of the import route, enough for
+// services.MaxImportActivities long runs. Longer histories are imported over
+// several requests. Uploaded files beyond the multipart memory limit are
+// spooled to disk rather than held in memory.
+const MaxImportRequestBytes = 64 << 20
+
+func (h *MobileHandler) ImportRuns(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Statistics retrieved successfully", response)
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", "Expected multipart/form-data with one or more files")
+		return
+	}
+
+	files := append(form.File["files"], form.File["file"]...)
+	if len(files) == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "No files provided", "Attach GPX, TCX, FIT or zip files in the files field")
+		return
+	}
+	if len(files) > maxImportFiles {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Too many files", fmt.Sprintf("At most %d files can be imported per request", maxImportFiles))
+		return
+	}
+
+	var results []services.ImportResult
+	var successCount, skipCount, errorCount int
+	remaining := services.MaxImportActivities
+
+	// Process each file individually; failures don't stop the entire import
+	for _, fileHeader := range files {
+		var fileResults []services.ImportResult
+
+		if remaining <= 0 {
+			fileResults = []services.ImportResult{{
+				File:   fileHeader.Filename,
+				Status: services.ImportStatusError,
+				Error:  services.ErrImportLimit.Error(),
+			}}
+		} else if file, err := fileHeader.Open(); err != nil {
+			fileResults = []services.ImportResult{{
+				File:   fileHeader.Filename,
+				Status: services.ImportStatusError,
+				Error:  "Failed to read file: " + err.Error(),
+			}}
+		} else {
+			fileResults = h.importService.Import(uid, services.ImportFile{
+				Name: fileHeader.Filename,
+				Data: file,
+				Size: fileHeader.Size,
+			}, remaining)
+			remaining -= len(fileResults)
+			file.Close()
+		}
+
+		for _, result := range fileResults {
+			switch result.Status {
+			case services.ImportStatusSaved:
+				successCount++
+			case services.ImportStatusAlreadyExists:
+				skipCount++
+			default:
+				errorCount++
+			}
+		}
+		results = append(results, fileResults...)
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Import completed", gin.H{
+		"results": results,
+		"summary": gin.H{
+			"total":   len(results),
+			"success": successCount,
+			"skipped": skipCount,
+			"errors":  errorCount,
+		},
+	})
 }
 
-func (h *MobileHandler) UpdateRunNotes(c *gin.Context) {
+func (h *MobileHandler) ReanalyzeRun(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
@@ -493,24 +764,83 @@ func (h *MobileHandler) UpdateRunNotes(c *gin.Context) {
 		return
 	}
 
-	type UpdateRunNotesRequest struct {
-		Title *string `json:"title,omitempty" validate:"omitempty,max=100"`
-		Notes *string `json:"notes,omitempty"`
+	var run models.Run
+	err = h.db.Select("id").Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database error", err.Error())
+		return
 	}
 
-	var req UpdateRunNotesRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+	analyzed, saved, err := h.analysisService.Reanalyze(run.ID)
+	if err != nil {
+		if errors.Is(err, services.ErrTrackTooShort) {
+			utils.ErrorResponse(c, http.StatusUnprocessableEntity, "Run cannot be analyzed", "At least two waypoints are required")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to analyze run", err.Error())
 		return
 	}
 
-	if err := h.validator.Struct(&req); err != nil {
-		utils.ValidationErrorResponse(c, err)
+	utils.SuccessResponse(c, http.StatusOK, "Run analyzed successfully", gin.H{
+		"run_id":                    analyzed.ID,
+		"reported_distance_meters":  analyzed.DistanceMeters,
+		"computed_distance_meters":  analyzed.ComputedDistanceMeters,
+		"reported_duration_seconds": analyzed.DurationSeconds,
+		"computed_duration_seconds": analyzed.ComputedDurationSeconds,
+		"moving_time_seconds":       analyzed.MovingTimeSeconds,
+		"reported_avg_speed_kmh":    analyzed.AvgSpeedKmh,
+		"computed_avg_speed_kmh":    analyzed.ComputedAvgSpeedKmh,
+		"reported_max_speed_kmh":    analyzed.MaxSpeedKmh,
+		"computed_max_speed_kmh":    analyzed.ComputedMaxSpeedKmh,
+		"metrics_flagged":           analyzed.MetricsFlagged,
+		"metrics_discrepancies":     analyzed.MetricsDiscrepancies,
+		"analyzed_at":               analyzed.AnalyzedAt,
+		"training_load":             analyzed.TrainingLoad,
+		"safety_score":              analyzed.SafetyScore,
+		"new_records":               saved.NewRecords,
+		"completed_goals":           saved.CompletedGoals,
+	})
+}
+
+func (h *MobileHandler) GetRunSplits(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	runIDParam := c.Param("run_id")
+	if runIDParam == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Run ID required", "run_id parameter is missing")
+		return
+	}
+
+	runID, err := uuid.Parse(runIDParam)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid run ID", "run_id must be a valid UUID")
+		return
+	}
+
+	kind := c.Query("kind")
+	switch kind {
+	case "", models.SplitKindKilometer, models.SplitKindMile, models.SplitKindLap, models.SplitKindEffort:
+	default:
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid kind", "kind must be one of km, mile, lap, effort")
 		return
 	}
 
 	var run models.Run
-	err = h.db.Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
+	err = h.db.Select("id").Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
@@ -520,32 +850,1879 @@ func (h *MobileHandler) UpdateRunNotes(c *gin.Context) {
 		return
 	}
 
-	updated := false
+	splits, err := h.splitService.GetSplits(run.ID, kind)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch splits", err.Error())
+		return
+	}
 
-	if req.Title != nil {
-		run.Title = *req.Title
-		updated = true
+	grouped := map[string][]models.RunSplit{}
+	for _, k := range []string{models.SplitKindKilometer, models.SplitKindMile, models.SplitKindLap, models.SplitKindEffort} {
+		if kind == "" || kind == k {
+			grouped[k] = []models.RunSplit{}
+		}
+	}
+	for _, split := range splits {
+		grouped[split.Kind] = append(grouped[split.Kind], split)
 	}
 
-	if req.Notes != nil {
-		run.Notes = *req.Notes
-		updated = true
+	utils.SuccessResponse(c, http.StatusOK, "Splits retrieved successfully", gin.H{
+		"run_id": run.ID,
+		"splits": grouped,
+	})
+}
+
+func (h *MobileHandler) GetRunElevation(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
 	}
 
-	if !updated {
-		utils.ErrorResponse(c, http.StatusBadRequest, "No fields to update", "At least one field (title or notes) must be provided")
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
 		return
 	}
 
-	if err := h.db.Save(&run).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update run", err.Error())
+	runIDParam := c.Param("run_id")
+	if runIDParam == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Run ID required", "run_id parameter is missing")
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Run updated successfully", gin.H{
-		"run_id":     run.ID,
-		"title":      run.Title,
-		"notes":      run.Notes,
-		"updated_at": run.UpdatedAt,
+	runID, err := uuid.Parse(runIDParam)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid run ID", "run_id must be a valid UUID")
+		return
+	}
+
+	resolution := services.DefaultProfileResolutionMeters
+	if v := c.Query("resolution_m"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed < services.MinProfileResolutionMeters || parsed > services.MaxProfileResolutionMeters {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid resolution",
+				fmt.Sprintf("resolution_m must be between %.0f and %.0f", services.MinProfileResolutionMeters, services.MaxProfileResolutionMeters))
+			return
+		}
+		resolution = parsed
+	}
+
+	var run models.Run
+	err = h.db.Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+
+	points, err := h.waypointService.LoadTrack(run.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch waypoints", err.Error())
+		return
+	}
+
+	profile, usedResolution := services.ElevationProfile(points, resolution)
+
+	utils.SuccessResponse(c, http.StatusOK, "Elevation profile retrieved successfully", gin.H{
+		"run_id":                run.ID,
+		"source":                run.ElevationSource,
+		"resolution_m":          usedResolution,
+		"elevation_gain_meters": run.ElevationGainMeters,
+		"elevation_loss_meters": run.ElevationLossMeters,
+		"min_elevation_meters":  run.MinElevationMeters,
+		"max_elevation_meters":  run.MaxElevationMeters,
+		"profile":               profile,
 	})
-}
\ No newline at end of file
+}
+
+func (h *MobileHandler) GetRunStreams(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	runIDParam := c.Param("run_id")
+	if runIDParam == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Run ID required", "run_id parameter is missing")
+		return
+	}
+
+	runID, err := uuid.Parse(runIDParam)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid run ID", "run_id must be a valid UUID")
+		return
+	}
+
+	var types []string
+	if v := c.Query("types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if !services.IsStreamType(t) {
+				utils.ErrorResponse(c, http.StatusBadRequest, "Invalid stream type",
+					"types must be a comma-separated list of "+strings.Join(services.StreamTypes, ", "))
+				return
+			}
+			types = append(types, t)
+		}
+	}
+
+	var run models.Run
+	err = h.db.Select("id", "started_at").Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+
+	streams, err := h.streamService.GetStreams(run.ID, types)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch sensor streams", err.Error())
+		return
+	}
+
+	type StreamResponse struct {
+		models.RunStream
+		// Offsets are seconds from the run's start, so streams line up with
+		// each other and with the waypoints.
+		OffsetsSeconds []float64 `json:"offsets_seconds"`
+		Values         []float64 `json:"values"`
+	}
+
+	response := make([]StreamResponse, 0, len(streams))
+	for i := range streams {
+		points, err := services.DecodeStream(&streams[i])
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to decode sensor stream", err.Error())
+			return
+		}
+
+		item := StreamResponse{
+			RunStream:      streams[i],
+			OffsetsSeconds: make([]float64, len(points)),
+			Values:         make([]float64, len(points)),
+		}
+		for j, p := range points {
+			item.OffsetsSeconds[j] = p.Timestamp.Sub(run.StartedAt).Seconds()
+			item.Values[j] = p.Value
+		}
+		response = append(response, item)
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Sensor streams retrieved successfully", gin.H{
+		"run_id":  run.ID,
+		"streams": response,
+	})
+}
+
+func (h *MobileHandler) GetRunAIEvents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	runIDParam := c.Param("run_id")
+	if runIDParam == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Run ID required", "run_id parameter is missing")
+		return
+	}
+
+	runID, err := uuid.Parse(runIDParam)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid run ID", "run_id must be a valid UUID")
+		return
+	}
+
+	var filter services.AIEventFilter
+	if v := c.Query("types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				filter.Types = append(filter.Types, t)
+			}
+		}
+	}
+	for param, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		v := c.Query(param)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid "+param, param+" must be an RFC 3339 timestamp")
+			return
+		}
+		*target = &parsed
+	}
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid time range", "to must not be before from")
+		return
+	}
+
+	var run models.Run
+	err = h.db.Select("id", "started_at").Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+
+	events, err := h.aiEventService.ListEvents(run.ID, filter)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch AI events", err.Error())
+		return
+	}
+
+	type EventResponse struct {
+		models.AIEvent
+		OffsetSeconds float64 `json:"offset_seconds"`
+	}
+
+	response := make([]EventResponse, len(events))
+	counts := make(map[string]int)
+	warnings := 0
+	for i, e := range events {
+		response[i] = EventResponse{AIEvent: e, OffsetSeconds: e.Timestamp.Sub(run.StartedAt).Seconds()}
+		counts[e.Type]++
+		if e.WarningSpoken {
+			warnings++
+		}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "AI events retrieved successfully", gin.H{
+		"run_id":         run.ID,
+		"events":         response,
+		"counts_by_type": counts,
+		"warnings":       warnings,
+	})
+}
+
+func (h *MobileHandler) GetRunLaneEvents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	runIDParam := c.Param("run_id")
+	if runIDParam == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Run ID required", "run_id parameter is missing")
+		return
+	}
+
+	runID, err := uuid.Parse(runIDParam)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid run ID", "run_id must be a valid UUID")
+		return
+	}
+
+	resolution := services.DefaultLaneCurveResolutionMeters
+	if v := c.Query("resolution_m"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || parsed < services.MinLaneCurveResolutionMeters || parsed > services.MaxLaneCurveResolutionMeters {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid resolution",
+				fmt.Sprintf("resolution_m must be between %.0f and %.0f", services.MinLaneCurveResolutionMeters, services.MaxLaneCurveResolutionMeters))
+			return
+		}
+		resolution = parsed
+	}
+
+	var run models.Run
+	err = h.db.Select("id", "started_at").Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+
+	events, err := h.aiEventService.ListLaneEvents(run.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch lane events", err.Error())
+		return
+	}
+
+	points, err := h.waypointService.LoadTrack(run.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch waypoints", err.Error())
+		return
+	}
+
+	curve, usedResolution := services.LaneKeepingCurve(points, events, resolution)
+
+	type EventResponse struct {
+		models.LaneEvent
+		StartOffsetSeconds float64 `json:"start_offset_seconds"`
+		EndOffsetSeconds   float64 `json:"end_offset_seconds"`
+	}
+
+	response := make([]EventResponse, len(events))
+	for i, e := range events {
+		response[i] = EventResponse{
+			LaneEvent:          e,
+			StartOffsetSeconds: e.StartedAt.Sub(run.StartedAt).Seconds(),
+			EndOffsetSeconds:   e.EndedAt.Sub(run.StartedAt).Seconds(),
+		}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Lane events retrieved successfully", gin.H{
+		"run_id":       run.ID,
+		"events":       response,
+		"resolution_m": usedResolution,
+		"curve":        curve,
+	})
+}
+
+// LabelAIEvent records the runner's verdict on a detection, or an obstacle
+// the glasses missed during the run.
+func (h *MobileHandler) LabelAIEvent(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	runIDParam := c.Param("run_id")
+	if runIDParam == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Run ID required", "run_id parameter is missing")
+		return
+	}
+
+	runID, err := uuid.Parse(runIDParam)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid run ID", "run_id must be a valid UUID")
+		return
+	}
+
+	var req models.AIFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	var run models.Run
+	err = h.db.Select("id", "started_at", "ended_at").Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+
+	var track []models.WaypointData
+	if req.Label == models.AIFeedbackMissed {
+		if req.Timestamp.Before(run.StartedAt) || (run.EndedAt != nil && req.Timestamp.After(*run.EndedAt)) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid timestamp", "timestamp must be during the run")
+			return
+		}
+		if req.Latitude == nil {
+			track, err = h.waypointService.LoadTrack(run.ID)
+			if err != nil {
+				utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch waypoints", err.Error())
+				return
+			}
+		}
+	}
+
+	feedback, err := h.aiEventService.Label(run.ID, &req, track)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "AI event not found", "AI event not found in this run")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to save AI feedback", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "AI feedback saved successfully", feedback)
+}
+
+func (h *MobileHandler) ListAIFeedback(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	runIDParam := c.Param("run_id")
+	if runIDParam == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Run ID required", "run_id parameter is missing")
+		return
+	}
+
+	runID, err := uuid.Parse(runIDParam)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid run ID", "run_id must be a valid UUID")
+		return
+	}
+
+	var run models.Run
+	err = h.db.Select("id").Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+
+	feedback, err := h.aiEventService.ListFeedback(run.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch AI feedback", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "AI feedback retrieved successfully", gin.H{
+		"run_id":   run.ID,
+		"feedback": feedback,
+	})
+}
+
+// ListRunMedia returns the frames captured during a run with short-lived
+// download links, and how much of the runner's quota is used.
+func (h *MobileHandler) ListRunMedia(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	runIDParam := c.Param("run_id")
+	if runIDParam == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Run ID required", "run_id parameter is missing")
+		return
+	}
+
+	runID, err := uuid.Parse(runIDParam)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid run ID", "run_id must be a valid UUID")
+		return
+	}
+
+	var run models.Run
+	err = h.db.Select("id").Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+
+	media, err := h.mediaService.ListForRun(c.Request.Context(), run.ID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch media", err.Error())
+		return
+	}
+	usage, err := h.mediaService.Usage(uid)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch media usage", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Media retrieved successfully", gin.H{
+		"run_id": run.ID,
+		"media":  media,
+		"usage":  usage,
+	})
+}
+
+// ServeMedia downloads a frame through a link from ListRunMedia. The signed
+// link is the only credential, so it works in image views that cannot send
+// the auth header.
+func (h *MobileHandler) ServeMedia(c *gin.Context) {
+	mediaID, err := uuid.Parse(c.Param("media_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid media ID", "media_id must be a valid UUID")
+		return
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid expires", "expires must be a Unix timestamp")
+		return
+	}
+
+	media, file, err := h.mediaService.OpenSigned(c.Request.Context(), mediaID, expires, c.Query("signature"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMediaURLInvalid):
+			utils.ErrorResponse(c, http.StatusForbidden, "Invalid media link", err.Error())
+		case errors.Is(err, services.ErrMediaURLExpired):
+			utils.ErrorResponse(c, http.StatusGone, "Media link expired", err.Error())
+		case err == gorm.ErrRecordNotFound || errors.Is(err, storage.ErrNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "Media not found", "")
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to open media", err.Error())
+		}
+		return
+	}
+	defer file.Close()
+
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(time.Until(time.Unix(expires, 0)).Seconds())))
+	c.DataFromReader(http.StatusOK, media.SizeBytes, media.ContentType, file, nil)
+}
+
+func (h *MobileHandler) DeleteAIFeedback(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	runIDParam := c.Param("run_id")
+	if runIDParam == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Run ID required", "run_id parameter is missing")
+		return
+	}
+
+	runID, err := uuid.Parse(runIDParam)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid run ID", "run_id must be a valid UUID")
+		return
+	}
+
+	feedbackID, err := uuid.Parse(c.Param("feedback_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid feedback ID", "feedback_id must be a valid UUID")
+		return
+	}
+
+	var run models.Run
+	err = h.db.Select("id").Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+
+	if err := h.aiEventService.DeleteFeedback(run.ID, feedbackID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "AI feedback not found", "AI feedback not found in this run")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete AI feedback", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "AI feedback deleted successfully", nil)
+}
+
+func (h *MobileHandler) DeleteRun(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	runIDParam := c.Param("run_id")
+	if runIDParam == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Run ID required", "run_id parameter is missing")
+		return
+	}
+
+	runID, err := uuid.Parse(runIDParam)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid run ID", "run_id must be a valid UUID")
+		return
+	}
+
+	var run models.Run
+	err = h.db.Select("id", "user_id", "started_at").Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+
+	if err := h.runService.DeleteRun(&run); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete run", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Run deleted successfully", gin.H{
+		"run_id": run.ID,
+	})
+}
+
+func (h *MobileHandler) GetRecords(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	records, err := h.recordService.GetRecords(uid)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch personal records", err.Error())
+		return
+	}
+
+	type RecordResponse struct {
+		models.PersonalRecord
+		RunURL string `json:"run_url"`
+	}
+
+	response := make([]RecordResponse, 0, len(records))
+	for _, record := range records {
+		response = append(response, RecordResponse{
+			PersonalRecord: record,
+			RunURL:         "/api/v1/mobile/runs/" + record.RunID.String(),
+		})
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Personal records retrieved successfully", gin.H{
+		"records": response,
+	})
+}
+
+func (h *MobileHandler) GetStats(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	type Stats struct {
+		TotalDistance    float64  `json:"total_distance_meters"`
+		TotalRuns        int64    `json:"total_runs"`
+		TotalDuration    int      `json:"total_duration_seconds"`
+		AvgSpeed         float64  `json:"avg_speed_kmh"`
+		TotalCalories    int      `json:"total_calories_burned"`
+		TotalSteps       int      `json:"total_steps"`
+		AvgSafetyScore   *float64 `json:"avg_safety_score"`
+		SafetyScoredRuns int64    `json:"safety_scored_runs"`
+	}
+
+	var stats Stats
+
+	err := h.db.Model(&models.Run{}).
+		Select(`
+			COUNT(*) as total_runs,
+			COALESCE(SUM(distance_meters), 0) as total_distance,
+			COALESCE(SUM(duration_seconds), 0) as total_duration,
+			COALESCE(AVG(avg_speed_kmh), 0) as avg_speed,
+			COALESCE(SUM(calories_burned), 0) as total_calories,
+			COALESCE(SUM(steps_count), 0) as total_steps,
+			AVG(safety_score) as avg_safety_score,
+			COUNT(safety_score) as safety_scored_runs
+		`).
+		Where("user_id = ?", uid).
+		Scan(&stats).Error
+
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch statistics", err.Error())
+		return
+	}
+
+	type StatsResponse struct {
+		TotalDistanceMeters  float64 `json:"total_distance_meters"`
+		TotalDistanceKm      float64 `json:"total_distance_km"`
+		TotalRuns            int64   `json:"total_runs"`
+		TotalDurationSeconds int     `json:"total_duration_seconds"`
+		TotalDurationHours   float64 `json:"total_duration_hours"`
+		AvgSpeedKmh          float64 `json:"avg_speed_kmh"`
+		TotalCaloriesBurned  int     `json:"total_calories_burned"`
+		TotalSteps           int     `json:"total_steps"`
+		AvgDistancePerRun    float64 `json:"avg_distance_per_run_meters"`
+		AvgDurationPerRun    float64 `json:"avg_duration_per_run_seconds"`
+		// AvgSafetyScore averages the runs that have a safety score
+		AvgSafetyScore   *float64 `json:"avg_safety_score"`
+		SafetyScoredRuns int64    `json:"safety_scored_runs"`
+	}
+
+	var avgDistance, avgDuration float64
+	if stats.TotalRuns > 0 {
+		avgDistance = stats.TotalDistance / float64(stats.TotalRuns)
+		avgDuration = float64(stats.TotalDuration) / float64(stats.TotalRuns)
+	}
+
+	response := StatsResponse{
+		TotalDistanceMeters:  stats.TotalDistance,
+		TotalDistanceKm:      stats.TotalDistance / 1000,
+		TotalRuns:            stats.TotalRuns,
+		TotalDurationSeconds: stats.TotalDuration,
+		TotalDurationHours:   float64(stats.TotalDuration) / 3600,
+		AvgSpeedKmh:          stats.AvgSpeed,
+		TotalCaloriesBurned:  stats.TotalCalories,
+		TotalSteps:           stats.TotalSteps,
+		AvgDistancePerRun:    avgDistance,
+		AvgDurationPerRun:    avgDuration,
+		SafetyScoredRuns:     stats.SafetyScoredRuns,
+	}
+	if stats.AvgSafetyScore != nil {
+		avgSafety := math.Round(*stats.AvgSafetyScore*100) / 100
+		response.AvgSafetyScore = &avgSafety
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Statistics retrieved successfully", response)
+}
+
+func (h *MobileHandler) GetStatsSeries(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	bucket := c.DefaultQuery("bucket", services.BucketWeek)
+	if !services.IsStatsBucket(bucket) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid bucket", "bucket must be one of day, week, month, year")
+		return
+	}
+
+	loc, weekStart, ok := h.userCalendar(c, uid)
+	if !ok {
+		return
+	}
+
+	// from and to are inclusive calendar days in the user's timezone
+	now := time.Now().In(loc)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	if v := c.Query("to"); v != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid to", "to must be YYYY-MM-DD")
+			return
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+
+	from := services.DefaultSeriesFrom(to, bucket)
+	if v := c.Query("from"); v != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid from", "from must be YYYY-MM-DD")
+			return
+		}
+		from = parsed
+	}
+
+	if !from.Before(to) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid range", "from must not be after to")
+		return
+	}
+
+	series, err := h.statsService.Series(uid, bucket, from, to, weekStart)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid range", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Statistics series retrieved successfully", gin.H{
+		"bucket":     bucket,
+		"timezone":   loc.String(),
+		"week_start": strings.ToLower(weekStart.String()),
+		"from":       from.Format("2006-01-02"),
+		"to":         to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"series":     series,
+	})
+}
+
+// userCalendar returns the timezone and first day of week used to interpret
+// calendar dates, taking the timezone from the tz query parameter when given
+// and from the user's profile otherwise. It responds with an error when the
+// calendar cannot be resolved.
+func (h *MobileHandler) userCalendar(c *gin.Context, uid uuid.UUID) (*time.Location, time.Weekday, bool) {
+	loc, weekStart, err := services.LoadUserCalendar(h.db, uid)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch user calendar", err.Error())
+		return nil, 0, false
+	}
+
+	if tz := c.Query("tz"); tz != "" {
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid timezone", "tz must be an IANA zone name such as Asia/Jakarta")
+			return nil, 0, false
+		}
+	}
+	return loc, weekStart, true
+}
+
+func (h *MobileHandler) GetZoneSettings(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	settings, err := h.zoneService.GetSettings(uid)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch zone settings", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Zone settings retrieved successfully", zoneSettingsResponse(settings))
+}
+
+func (h *MobileHandler) UpdateZoneSettings(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	var req models.ZoneSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	if err := services.ValidateZoneSettings(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid zone bounds", err.Error())
+		return
+	}
+
+	settings, err := h.zoneService.UpdateSettings(uid, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update zone settings", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Zone settings updated successfully", zoneSettingsResponse(settings))
+}
+
+func (h *MobileHandler) GetTrainingLoad(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	days := services.TrainingLoadDefaultDays
+	if v := c.Query("days"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > services.TrainingLoadMaxDays {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid days", fmt.Sprintf("days must be between 1 and %d", services.TrainingLoadMaxDays))
+			return
+		}
+		days = parsed
+	}
+
+	summary, err := h.loadService.Summary(uid, days)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch training load", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Training load retrieved successfully", summary)
+}
+
+// GetHazards returns obstacle hotspots as a GeoJSON FeatureCollection rather
+// than the usual response envelope, so map libraries can load it directly.
+func (h *MobileHandler) GetHazards(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	query := services.HazardQuery{Scope: c.DefaultQuery("scope", services.HazardScopeMine)}
+	if query.Scope != services.HazardScopeMine && query.Scope != services.HazardScopeShared {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid scope", "scope must be mine or shared")
+		return
+	}
+
+	if v := c.Query("bbox"); v != "" {
+		bbox, err := services.ParseBBox(v)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid bbox", err.Error())
+			return
+		}
+		query.BBox = bbox
+	}
+	if query.Scope == services.HazardScopeShared && (query.BBox == nil || query.BBox.Span() > services.MaxSharedHazardSpanDegrees) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid bbox",
+			fmt.Sprintf("shared hazards need a bbox at most %.0f degree across", services.MaxSharedHazardSpanDegrees))
+		return
+	}
+
+	if v := c.Query("types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				query.Types = append(query.Types, t)
+			}
+		}
+	}
+
+	days := services.DefaultHazardLookbackDays
+	if v := c.Query("days"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > services.MaxHazardLookbackDays {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid days", fmt.Sprintf("days must be between 1 and %d", services.MaxHazardLookbackDays))
+			return
+		}
+		days = parsed
+	}
+	query.Since = time.Now().AddDate(0, 0, -days)
+
+	query.MinRuns = services.DefaultHazardMinRuns
+	if v := c.Query("min_runs"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid min_runs", "min_runs must be a positive integer")
+			return
+		}
+		query.MinRuns = parsed
+	}
+
+	hotspots, err := h.hazardService.Hotspots(uid, query)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch hazards", err.Error())
+		return
+	}
+
+	c.Header("Content-Type", "application/geo+json")
+	c.JSON(http.StatusOK, services.HazardsGeoJSON(query.Scope, hotspots))
+}
+
+func (h *MobileHandler) ReportHazard(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	var req models.HazardReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	hazard, err := h.hazardService.Report(uid, &req)
+	if err != nil {
+		if errors.Is(err, services.ErrHazardReportLimit) {
+			utils.ErrorResponse(c, http.StatusTooManyRequests, "Hazard report limit reached",
+				fmt.Sprintf("at most %d hazards can be reported per day", services.MaxHazardReportsPerDay))
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to report hazard", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Hazard reported successfully", hazard)
+}
+
+func (h *MobileHandler) ListHazardReports(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	hazards, err := h.hazardService.ListReports(uid)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch hazard reports", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Hazard reports retrieved successfully", gin.H{
+		"hazards": hazards,
+	})
+}
+
+func (h *MobileHandler) DeleteHazardReport(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	hazardID, err := uuid.Parse(c.Param("hazard_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid hazard ID", "hazard_id must be a valid UUID")
+		return
+	}
+
+	if err := h.hazardService.RemoveReport(uid, hazardID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Hazard not found", "Hazard not found or not reported by you")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to remove hazard", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Hazard removed successfully", gin.H{
+		"hazard_id": hazardID,
+	})
+}
+
+func zoneSettingsResponse(settings *models.ZoneSettings) gin.H {
+	return gin.H{
+		"settings": settings,
+		"bounds":   services.ResolveZoneBounds(settings),
+	}
+}
+
+func (h *MobileHandler) GetZoneStats(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	loc, _, ok := h.userCalendar(c, uid)
+	if !ok {
+		return
+	}
+
+	var from, to time.Time
+	if startDate := c.Query("start_date"); startDate != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", startDate, loc)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid start_date", "start_date must be YYYY-MM-DD")
+			return
+		}
+		from = parsed
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", endDate, loc)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid end_date", "end_date must be YYYY-MM-DD")
+			return
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+
+	settings, err := h.zoneService.GetSettings(uid)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch zone settings", err.Error())
+		return
+	}
+
+	distribution, err := h.zoneService.Distribution(uid, from, to)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch zone statistics", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Zone statistics retrieved successfully", gin.H{
+		"heart_rate": distribution[models.ZoneKindHeartRate],
+		"pace":       distribution[models.ZoneKindPace],
+		"bounds":     services.ResolveZoneBounds(settings),
+	})
+}
+
+func (h *MobileHandler) UpdateRunNotes(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	runIDParam := c.Param("run_id")
+	if runIDParam == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Run ID required", "run_id parameter is missing")
+		return
+	}
+
+	runID, err := uuid.Parse(runIDParam)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid run ID", "run_id must be a valid UUID")
+		return
+	}
+
+	type UpdateRunNotesRequest struct {
+		Title *string `json:"title,omitempty" validate:"omitempty,max=100"`
+		Notes *string `json:"notes,omitempty"`
+	}
+
+	var req UpdateRunNotesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	var run models.Run
+	err = h.db.Where("id = ? AND user_id = ?", runID, uid).First(&run).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Run not found", "Run not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database error", err.Error())
+		return
+	}
+
+	updated := false
+
+	if req.Title != nil {
+		run.Title = *req.Title
+		updated = true
+	}
+
+	if req.Notes != nil {
+		run.Notes = *req.Notes
+		updated = true
+	}
+
+	if !updated {
+		utils.ErrorResponse(c, http.StatusBadRequest, "No fields to update", "At least one field (title or notes) must be provided")
+		return
+	}
+
+	if err := h.db.Save(&run).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update run", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Run updated successfully", gin.H{
+		"run_id":     run.ID,
+		"title":      run.Title,
+		"notes":      run.Notes,
+		"updated_at": run.UpdatedAt,
+	})
+}
+
+func (h *MobileHandler) ListGoals(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	goals, err := h.goalService.List(uid, c.Query("all") == "true")
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch goals", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Goals retrieved successfully", gin.H{
+		"goals": goals,
+	})
+}
+
+func (h *MobileHandler) CreateGoal(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	var req models.GoalCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	if err := services.ValidateGoal(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid goal", err.Error())
+		return
+	}
+
+	goal, err := h.goalService.Create(uid, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create goal", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Goal created successfully", goal)
+}
+
+func (h *MobileHandler) UpdateGoal(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	goalID, err := uuid.Parse(c.Param("goal_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid goal ID", "goal_id must be a valid UUID")
+		return
+	}
+
+	var req models.GoalUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	goal, err := h.goalService.Update(uid, goalID, &req)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Goal not found", "Goal not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update goal", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Goal updated successfully", goal)
+}
+
+func (h *MobileHandler) DeleteGoal(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	goalID, err := uuid.Parse(c.Param("goal_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid goal ID", "goal_id must be a valid UUID")
+		return
+	}
+
+	if err := h.goalService.Delete(uid, goalID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Goal not found", "Goal not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete goal", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Goal deleted successfully", gin.H{
+		"goal_id": goalID,
+	})
+}
+
+func (h *MobileHandler) ListGoalEvents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	var since *time.Time
+	if v := c.Query("since"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid since", "since must be an RFC 3339 timestamp")
+			return
+		}
+		since = &parsed
+	}
+
+	limit := services.DefaultGoalEventLimit
+	if v := c.Query("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > services.MaxGoalEventLimit {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid limit", fmt.Sprintf("limit must be between 1 and %d", services.MaxGoalEventLimit))
+			return
+		}
+		limit = parsed
+	}
+
+	events, err := h.goalService.Events(uid, since, limit)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch goal events", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Goal events retrieved successfully", gin.H{
+		"events": events,
+	})
+}
+
+func (h *MobileHandler) ListWorkoutTemplates(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	templates, err := h.workoutService.ListTemplates(uid)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch workout templates", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Workout templates retrieved successfully", gin.H{
+		"templates": templates,
+	})
+}
+
+func (h *MobileHandler) CreateWorkoutTemplate(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	var req models.WorkoutTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	if err := services.ValidateWorkoutSteps(req.Steps); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid workout steps", err.Error())
+		return
+	}
+
+	template, err := h.workoutService.CreateTemplate(uid, &req)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create workout template", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Workout template created successfully", template)
+}
+
+func (h *MobileHandler) DeleteWorkoutTemplate(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	templateID, err := uuid.Parse(c.Param("template_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid template ID", "template_id must be a valid UUID")
+		return
+	}
+
+	if err := h.workoutService.DeleteTemplate(uid, templateID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Workout template not found", "Workout template not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete workout template", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Workout template deleted successfully", gin.H{
+		"template_id": templateID,
+	})
+}
+
+func (h *MobileHandler) ListTrainingPlans(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	plans, err := h.workoutService.ListPlans(uid)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch training plans", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Training plans retrieved successfully", gin.H{
+		"plans": plans,
+	})
+}
+
+func (h *MobileHandler) CreateTrainingPlan(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	var req models.TrainingPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	plan, err := h.workoutService.CreatePlan(uid, &req)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Unknown workout template", err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create training plan", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Training plan created successfully", plan)
+}
+
+func (h *MobileHandler) DeleteTrainingPlan(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	planID, err := uuid.Parse(c.Param("plan_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid plan ID", "plan_id must be a valid UUID")
+		return
+	}
+
+	if err := h.workoutService.DeletePlan(uid, planID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Training plan not found", "Training plan not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete training plan", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Training plan deleted successfully", gin.H{
+		"plan_id": planID,
+	})
+}
+
+func (h *MobileHandler) ScheduleTrainingPlan(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	planID, err := uuid.Parse(c.Param("plan_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid plan ID", "plan_id must be a valid UUID")
+		return
+	}
+
+	var req models.SchedulePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	workouts, err := h.workoutService.SchedulePlan(uid, planID, req.StartDate)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Training plan not found", err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to schedule training plan", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Training plan scheduled successfully", gin.H{
+		"workouts": workouts,
+	})
+}
+
+func (h *MobileHandler) ListScheduledWorkouts(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	loc, _, ok := h.userCalendar(c, uid)
+	if !ok {
+		return
+	}
+
+	// Defaults to the four weeks starting today
+	today := time.Now().In(loc)
+	from := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 27)
+	if v := c.Query("from"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid from", "from must be YYYY-MM-DD")
+			return
+		}
+		from = parsed
+	}
+	if v := c.Query("to"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid to", "to must be YYYY-MM-DD")
+			return
+		}
+		to = parsed
+	}
+
+	if to.Before(from) || to.Sub(from) > services.MaxScheduleRangeDays*24*time.Hour {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid range", fmt.Sprintf("to must be on or after from and at most %d days later", services.MaxScheduleRangeDays))
+		return
+	}
+
+	workouts, err := h.workoutService.ListSchedule(uid, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch scheduled workouts", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Scheduled workouts retrieved successfully", gin.H{
+		"from":     from.Format("2006-01-02"),
+		"to":       to.Format("2006-01-02"),
+		"workouts": workouts,
+	})
+}
+
+func (h *MobileHandler) ScheduleWorkout(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	var req models.ScheduleWorkoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	workout, err := h.workoutService.ScheduleWorkout(uid, &req)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Workout template not found", "Workout template not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to schedule workout", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Workout scheduled successfully", workout)
+}
+
+func (h *MobileHandler) UpdateScheduledWorkout(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	workoutID, err := uuid.Parse(c.Param("workout_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid workout ID", "workout_id must be a valid UUID")
+		return
+	}
+
+	var req models.ScheduledWorkoutUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+
+	workout, err := h.workoutService.UpdateScheduled(uid, workoutID, &req)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Workout not found", "Workout not found or access denied")
+			return
+		}
+		if errors.Is(err, services.ErrWorkoutCompleted) {
+			utils.ErrorResponse(c, http.StatusConflict, "Workout already completed", "Delete the matched run to change this workout")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update workout", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Workout updated successfully", workout)
+}
+
+func (h *MobileHandler) DeleteScheduledWorkout(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "User ID not found")
+		return
+	}
+
+	uid, ok := userID.(uuid.UUID)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Invalid user ID", "User ID type assertion failed")
+		return
+	}
+
+	workoutID, err := uuid.Parse(c.Param("workout_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid workout ID", "workout_id must be a valid UUID")
+		return
+	}
+
+	if err := h.workoutService.DeleteScheduled(uid, workoutID); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Workout not found", "Workout not found or access denied")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete workout", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Workout deleted successfully", gin.H{
+		"workout_id": workoutID,
+	})
+}
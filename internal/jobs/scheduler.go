@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/labmino/runsight-backend/internal/utils"
+)
+
+// Job is a background task run on a fixed interval. Run should return
+// promptly once ctx is cancelled.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs jobs in their own goroutines until its context is
+// cancelled. Each job runs once at start and then every Interval; a run that
+// overlaps the next tick delays it rather than running concurrently.
+type Scheduler struct {
+	jobs []Job
+	wg   sync.WaitGroup
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+func (s *Scheduler) Add(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go func(job Job) {
+			defer s.wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+}
+
+// Wait blocks until every job goroutine has returned.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.runOnce(ctx, job)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, job Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			utils.Error("Background job panicked", zap.String("job", job.Name), zap.Any("panic", r))
+		}
+	}()
+
+	started := time.Now()
+	if err := job.Run(ctx); err != nil && ctx.Err() == nil {
+		utils.Error("Background job failed", zap.String("job", job.Name), zap.Error(err))
+		return
+	}
+	utils.Debug("Background job finished", zap.String("job", job.Name), zap.Duration("took", time.Since(started)))
+}
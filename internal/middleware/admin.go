@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/utils"
+)
+
+// AdminMiddleware only lets users flagged as admins through. It runs after
+// AuthMiddleware, which puts the user id in the context.
+func AdminMiddleware(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token required"})
+			c.Abort()
+			return
+		}
+
+		var user models.User
+		if err := db.Select("id", "is_admin").Where("id = ?", userID).First(&user).Error; err != nil || !user.IsAdmin {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":     "error",
+				"message":    "Admin access required",
+				"error_code": utils.ErrForbidden,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
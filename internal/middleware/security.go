@@ -137,27 +137,34 @@ func ValidateContentType(allowedTypes ...string) gin.HandlerFunc {
 	}
 }
 
-func MaxRequestSize(maxSize int64) gin.HandlerFunc {
+// MaxRequestSize caps request bodies at maxSize bytes. Routes that take
+// larger uploads get their own cap in routeLimits, keyed by full route path.
+func MaxRequestSize(maxSize int64, routeLimits map[string]int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if c.Request.ContentLength > maxSize {
+		limit := maxSize
+		if routeLimit, ok := routeLimits[c.FullPath()]; ok {
+			limit = routeLimit
+		}
+
+		if c.Request.ContentLength > limit {
 			requestID := c.GetString("RequestID")
 			
 			utils.Warn("Request too large",
 				zap.String("request_id", requestID),
 				zap.Int64("content_length", c.Request.ContentLength),
-				zap.Int64("max_size", maxSize),
+				zap.Int64("max_size", limit),
 				zap.String("client_ip", c.ClientIP()),
 			)
 			
 			utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "Request too large", gin.H{
 				"error_code": "ERR_REQUEST_TOO_LARGE",
-				"max_size_bytes": maxSize,
+				"max_size_bytes": limit,
 			})
 			c.Abort()
 			return
 		}
 		
-		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
 		
 		c.Next()
 	}
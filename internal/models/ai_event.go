@@ -0,0 +1,111 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BoundingBox is the detection's box in the camera frame, normalized to 0-1
+// with the origin in the top-left corner.
+type BoundingBox struct {
+	X      float64 `json:"x" validate:"min=0,max=1"`
+	Y      float64 `json:"y" validate:"min=0,max=1"`
+	Width  float64 `json:"width" validate:"min=0,max=1"`
+	Height float64 `json:"height" validate:"min=0,max=1"`
+}
+
+// AIEvent is a single obstacle detection reported by the glasses during a run,
+// placed on the route by its timestamp.
+type AIEvent struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RunID     uuid.UUID `json:"-" gorm:"type:uuid;not null;index:idx_ai_events_run_time,priority:1"`
+	Timestamp time.Time `json:"timestamp" gorm:"not null;index:idx_ai_events_run_time,priority:2"`
+	// Type is the detected object class as named by the on-device model,
+	// e.g. "person", "bicycle" or "pole".
+	Type           string   `json:"type" gorm:"type:varchar(50);not null"`
+	Confidence     float64  `json:"confidence" gorm:"type:decimal(4,3)"`
+	DistanceMeters *float64 `json:"distance_meters,omitempty" gorm:"type:decimal(6,2)"`
+	// BearingDegrees is relative to the direction of travel, negative to the
+	// left.
+	BearingDegrees *float64     `json:"bearing_degrees,omitempty" gorm:"type:decimal(5,2)"`
+	BoundingBox    *BoundingBox `json:"bounding_box,omitempty" gorm:"type:text;serializer:json"`
+	WarningSpoken  bool         `json:"warning_spoken"`
+
+	// Where the runner was when the detection happened, interpolated from the
+	// filtered track, and the first waypoint at or after it.
+	Latitude            *float64 `json:"lat,omitempty" gorm:"type:decimal(10,8)"`
+	Longitude           *float64 `json:"lng,omitempty" gorm:"type:decimal(11,8)"`
+	RouteDistanceMeters *float64 `json:"route_distance_meters,omitempty" gorm:"type:decimal(10,2)"`
+	WaypointSequence    *int     `json:"waypoint_sequence,omitempty"`
+	// Estimated position of the object itself, projected from the runner's
+	// position along the bearing when the device reported a distance.
+	ObjectLatitude  *float64 `json:"object_lat,omitempty" gorm:"type:decimal(10,8)"`
+	ObjectLongitude *float64 `json:"object_lng,omitempty" gorm:"type:decimal(11,8)"`
+
+	Feedback *AIEventFeedback `json:"feedback,omitempty" gorm:"foreignKey:AIEventID"`
+}
+
+func (e *AIEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// AIEventData is a detection as uploaded by the glasses.
+type AIEventData struct {
+	Timestamp      time.Time    `json:"timestamp" validate:"required"`
+	Type           string       `json:"type" validate:"required,max=50"`
+	Confidence     float64      `json:"confidence" validate:"min=0,max=1"`
+	DistanceMeters *float64     `json:"distance_meters,omitempty" validate:"omitempty,min=0,max=500"`
+	BearingDegrees *float64     `json:"bearing_degrees,omitempty" validate:"omitempty,min=-180,max=180"`
+	BoundingBox    *BoundingBox `json:"bounding_box,omitempty" validate:"omitempty"`
+	WarningSpoken  bool         `json:"warning_spoken"`
+}
+
+const (
+	LaneDirectionLeft  = "left"
+	LaneDirectionRight = "right"
+)
+
+// LaneEvent is one stretch where the runner drifted out of their lane, with
+// where on the route it started and ended.
+type LaneEvent struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RunID     uuid.UUID `json:"-" gorm:"type:uuid;not null;index:idx_lane_events_run_time,priority:1"`
+	StartedAt time.Time `json:"started_at" gorm:"not null;index:idx_lane_events_run_time,priority:2"`
+	EndedAt   time.Time `json:"ended_at" gorm:"not null"`
+	Direction string    `json:"direction" gorm:"type:varchar(10);not null"`
+	// MaxOffsetMeters is the furthest the runner got from the lane centre.
+	MaxOffsetMeters float64 `json:"max_offset_meters" gorm:"type:decimal(5,2)"`
+	// CorrectionLatencyMs is how long the runner took to start correcting
+	// after the device warned them.
+	CorrectionLatencyMs *int `json:"correction_latency_ms,omitempty"`
+
+	StartLatitude         *float64 `json:"start_lat,omitempty" gorm:"type:decimal(10,8)"`
+	StartLongitude        *float64 `json:"start_lng,omitempty" gorm:"type:decimal(11,8)"`
+	EndLatitude           *float64 `json:"end_lat,omitempty" gorm:"type:decimal(10,8)"`
+	EndLongitude          *float64 `json:"end_lng,omitempty" gorm:"type:decimal(11,8)"`
+	StartDistanceMeters   *float64 `json:"start_distance_meters,omitempty" gorm:"type:decimal(10,2)"`
+	EndDistanceMeters     *float64 `json:"end_distance_meters,omitempty" gorm:"type:decimal(10,2)"`
+	StartWaypointSequence *int     `json:"start_waypoint_sequence,omitempty"`
+	EndWaypointSequence   *int     `json:"end_waypoint_sequence,omitempty"`
+}
+
+func (e *LaneEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// LaneEventData is a lane deviation as uploaded by the glasses.
+type LaneEventData struct {
+	StartedAt           time.Time `json:"started_at" validate:"required"`
+	EndedAt             time.Time `json:"ended_at" validate:"required,gtefield=StartedAt"`
+	Direction           string    `json:"direction" validate:"required,oneof=left right"`
+	MaxOffsetMeters     float64   `json:"max_offset_meters" validate:"min=0,max=20"`
+	CorrectionLatencyMs *int      `json:"correction_latency_ms,omitempty" validate:"omitempty,min=0,max=60000"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	AIFeedbackCorrect       = "correct"
+	AIFeedbackFalsePositive = "false_positive"
+	AIFeedbackMissed        = "missed"
+)
+
+const (
+	AIFeedbackSourceApp    = "app"
+	AIFeedbackSourceDevice = "device"
+)
+
+// AIEventFeedback is a runner's verdict on the glasses' detections. Correct
+// and false positive labels point at the detection they judge, one label per
+// detection; missed labels mark an obstacle nothing was detected for, so they
+// only carry a time and place.
+type AIEventFeedback struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RunID     uuid.UUID  `json:"-" gorm:"type:uuid;not null;index"`
+	AIEventID *uuid.UUID `json:"ai_event_id,omitempty" gorm:"type:uuid;uniqueIndex"`
+	Label     string     `json:"label" gorm:"type:varchar(20);not null"`
+	Source    string     `json:"source" gorm:"type:varchar(10);not null"`
+	// Type is the labelled detection's class, or what was missed when the
+	// runner said so.
+	Type      string    `json:"type,omitempty" gorm:"type:varchar(50)"`
+	Timestamp time.Time `json:"timestamp" gorm:"not null"`
+	Latitude  *float64  `json:"lat,omitempty" gorm:"type:decimal(10,8)"`
+	Longitude *float64  `json:"lng,omitempty" gorm:"type:decimal(11,8)"`
+	Note      string    `json:"note,omitempty" gorm:"type:varchar(255)"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (f *AIEventFeedback) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	return nil
+}
+
+// AIFeedbackData is a feedback button press logged by the glasses.
+type AIFeedbackData struct {
+	Timestamp time.Time `json:"timestamp" validate:"required"`
+	Label     string    `json:"label" validate:"required,oneof=correct false_positive missed"`
+}
+
+// AIFeedbackRequest labels a detection from the app, or reports an obstacle
+// the glasses missed at a time in the run.
+type AIFeedbackRequest struct {
+	AIEventID *uuid.UUID `json:"ai_event_id,omitempty" validate:"required_unless=Label missed"`
+	Label     string     `json:"label" validate:"required,oneof=correct false_positive missed"`
+	Timestamp *time.Time `json:"timestamp,omitempty" validate:"required_if=Label missed"`
+	Type      string     `json:"type,omitempty" validate:"max=50"`
+	Latitude  *float64   `json:"lat,omitempty" validate:"required_with=Longitude,omitempty,latitude"`
+	Longitude *float64   `json:"lng,omitempty" validate:"required_with=Latitude,omitempty,longitude"`
+	Note      string     `json:"note,omitempty" validate:"max=255"`
+}
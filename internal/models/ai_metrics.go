@@ -10,6 +10,11 @@ import (
 type AIMetrics struct {
 	ID                       uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	RunID                    uuid.UUID `json:"run_id" gorm:"type:uuid;not null;index"`
+	ModelID                  *uuid.UUID `json:"model_id,omitempty" gorm:"type:uuid;index"`
+	// Hardware and firmware of the device when the run was recorded, so
+	// metrics stay comparable after the device is updated.
+	HardwareVersion          string    `json:"hardware_version,omitempty" gorm:"type:varchar(20)"`
+	FirmwareVersion          string    `json:"firmware_version,omitempty" gorm:"type:varchar(20)"`
 	TotalFramesProcessed     *int      `json:"total_frames_processed,omitempty" validate:"omitempty,min=0"`
 	TotalObstaclesDetected   *int      `json:"total_obstacles_detected,omitempty" validate:"omitempty,min=0"`
 	TotalWarningsIssued      *int      `json:"total_warnings_issued,omitempty" validate:"omitempty,min=0"`
@@ -20,10 +25,12 @@ type AIMetrics struct {
 	MinInferenceTimeMs       *float64  `json:"min_inference_time_ms,omitempty" gorm:"type:decimal(6,2)" validate:"omitempty,min=0"`
 	CreatedAt                time.Time `json:"created_at"`
 
-	Run Run `json:"run,omitempty" gorm:"foreignKey:RunID"`
+	Model *AIModel `json:"model,omitempty" gorm:"foreignKey:ModelID"`
+	Run   Run      `json:"run,omitempty" gorm:"foreignKey:RunID"`
 }
 
 type AIMetricsRequest struct {
+	Model                *AIModelInfo `json:"model,omitempty" validate:"omitempty"`
 	TotalFrames          *int     `json:"total_frames,omitempty" validate:"omitempty,min=0"`
 	ObstaclesDetected    *int     `json:"obstacles_detected,omitempty" validate:"omitempty,min=0"`
 	WarningsIssued       *int     `json:"warnings_issued,omitempty" validate:"omitempty,min=0"`
@@ -32,6 +39,13 @@ type AIMetricsRequest struct {
 	AvgInferenceMs       *float64 `json:"avg_inference_ms,omitempty" validate:"omitempty,min=0"`
 	MaxInferenceMs       *float64 `json:"max_inference_ms,omitempty" validate:"omitempty,min=0"`
 	MinInferenceMs       *float64 `json:"min_inference_ms,omitempty" validate:"omitempty,min=0"`
+	// Events and LaneEvents are the individual detections and lane deviations
+	// behind the totals above.
+	Events               []AIEventData `json:"events,omitempty" validate:"omitempty,max=20000,dive"`
+	LaneEvents           []LaneEventData `json:"lane_events,omitempty" validate:"omitempty,max=5000,dive"`
+	// Feedback holds presses of the feedback button on the glasses, labelling
+	// the warning just given or an obstacle that went unnoticed.
+	Feedback             []AIFeedbackData `json:"feedback,omitempty" validate:"omitempty,max=1000,dive"`
 }
 
 func (req *AIMetricsRequest) ToModel(runID uuid.UUID) *AIMetrics {
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AIModel is an on-device detection model as reported by the glasses. A model
+// is identified by name, version and quantization, since an int8 build of a
+// version performs differently from its fp16 build.
+type AIModel struct {
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name         string    `json:"name" gorm:"type:varchar(100);not null;uniqueIndex:idx_ai_models_identity,priority:1"`
+	Version      string    `json:"version" gorm:"type:varchar(50);not null;uniqueIndex:idx_ai_models_identity,priority:2"`
+	Quantization string    `json:"quantization" gorm:"type:varchar(20);not null;default:'';uniqueIndex:idx_ai_models_identity,priority:3"`
+	FirstSeenAt  time.Time `json:"first_seen_at"`
+	LastSeenAt   time.Time `json:"last_seen_at"`
+}
+
+func (m *AIModel) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+// AIModelInfo identifies the model that produced a run's AI metrics.
+type AIModelInfo struct {
+	Name         string `json:"name" validate:"required,max=100"`
+	Version      string `json:"version" validate:"required,max=50"`
+	Quantization string `json:"quantization,omitempty" validate:"omitempty,max=20"`
+}
+
+// AIModelArtifact is a downloadable build of a model. Devices verify the
+// SHA-256 checksum and the signature before loading it, and are only offered
+// builds for their hardware and firmware.
+type AIModelArtifact struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ModelID   uuid.UUID `json:"model_id" gorm:"type:uuid;not null;index"`
+	URL       string    `json:"url" gorm:"type:text;not null"`
+	SizeBytes int64     `json:"size_bytes" gorm:"not null"`
+	SHA256    string    `json:"sha256" gorm:"type:varchar(64);not null"`
+	Signature string    `json:"signature" gorm:"type:text;not null"`
+	// HardwareVersions lists the boards the build runs on; empty means all.
+	HardwareVersions   []string  `json:"hardware_versions" gorm:"type:text;serializer:json"`
+	MinFirmwareVersion string    `json:"min_firmware_version,omitempty" gorm:"type:varchar(20)"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+func (a *AIModelArtifact) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// AIModelArtifactRequest publishes a build, registering its model if needed.
+type AIModelArtifactRequest struct {
+	Model              AIModelInfo `json:"model" validate:"required"`
+	URL                string      `json:"url" validate:"required,url,max=2048"`
+	SizeBytes          int64       `json:"size_bytes" validate:"required,min=1"`
+	SHA256             string      `json:"sha256" validate:"required,len=64,hexadecimal"`
+	Signature          string      `json:"signature" validate:"required,max=1024"`
+	HardwareVersions   []string    `json:"hardware_versions,omitempty" validate:"omitempty,max=20,dive,required,max=20"`
+	MinFirmwareVersion string      `json:"min_firmware_version,omitempty" validate:"omitempty,max=20"`
+}
+
+const (
+	AIRolloutStatusActive     = "active"
+	AIRolloutStatusCompleted  = "completed"
+	AIRolloutStatusRolledBack = "rolled_back"
+)
+
+const (
+	AICohortCandidate = "candidate"
+	AICohortControl   = "control"
+	AICohortPinned    = "pinned"
+)
+
+// AIModelRollout stages a candidate model across the fleet. While active,
+// Percentage of devices form the candidate cohort and the rest keep the
+// baseline as control. Completing it moves every device to the candidate;
+// rolling back returns every device to the baseline. Rollouts run one at a
+// time and the latest one decides what devices should run.
+type AIModelRollout struct {
+	ID              uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ModelID         uuid.UUID  `json:"model_id" gorm:"type:uuid;not null"`
+	BaselineModelID *uuid.UUID `json:"baseline_model_id,omitempty" gorm:"type:uuid"`
+	Percentage      int        `json:"percentage" gorm:"not null"`
+	Status          string     `json:"status" gorm:"type:varchar(20);not null;index;uniqueIndex:idx_ai_model_rollouts_one_active,where:status = 'active'"`
+	// Regression thresholds checked against the control cohort once both
+	// cohorts have MinRuns runs on their model.
+	MinRuns                   int        `json:"min_runs"`
+	MaxInferenceRegressionPct float64    `json:"max_inference_regression_pct"`
+	MaxDetectionDropPct       float64    `json:"max_detection_drop_pct"`
+	RollbackReason            string     `json:"rollback_reason,omitempty" gorm:"type:varchar(255)"`
+	StartedAt                 time.Time  `json:"started_at" gorm:"not null;index"`
+	EndedAt                   *time.Time `json:"ended_at,omitempty"`
+	CreatedAt                 time.Time  `json:"created_at"`
+	UpdatedAt                 time.Time  `json:"updated_at"`
+
+	Model         *AIModel `json:"model,omitempty" gorm:"foreignKey:ModelID"`
+	BaselineModel *AIModel `json:"baseline_model,omitempty" gorm:"foreignKey:BaselineModelID"`
+}
+
+func (r *AIModelRollout) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// AIModelAssignment records which model a device was last told to run and
+// why. Pinned assignments are set by the team and override rollouts.
+type AIModelAssignment struct {
+	DeviceID  string     `json:"device_id" gorm:"type:varchar(50);primary_key"`
+	ModelID   uuid.UUID  `json:"model_id" gorm:"type:uuid;not null"`
+	RolloutID *uuid.UUID `json:"rollout_id,omitempty" gorm:"type:uuid;index"`
+	Cohort    string     `json:"cohort" gorm:"type:varchar(20);not null"`
+	// PreviousModelID is what the device ran before it was given ModelID,
+	// where a rolled back model sends it when the baseline cannot.
+	PreviousModelID *uuid.UUID `json:"previous_model_id,omitempty" gorm:"type:uuid"`
+	AssignedAt      time.Time  `json:"assigned_at"`
+}
+
+type AIModelRolloutRequest struct {
+	ModelID uuid.UUID `json:"model_id" validate:"required"`
+	// BaselineModelID defaults to the model the previous rollout left the
+	// fleet on.
+	BaselineModelID           *uuid.UUID `json:"baseline_model_id,omitempty"`
+	Percentage                int        `json:"percentage" validate:"required,min=1,max=100"`
+	MinRuns                   *int       `json:"min_runs,omitempty" validate:"omitempty,min=1,max=100000"`
+	MaxInferenceRegressionPct *float64   `json:"max_inference_regression_pct,omitempty" validate:"omitempty,gt=0,max=1000"`
+	MaxDetectionDropPct       *float64   `json:"max_detection_drop_pct,omitempty" validate:"omitempty,gt=0,max=100"`
+}
+
+type AIModelRolloutUpdateRequest struct {
+	Percentage *int   `json:"percentage,omitempty" validate:"omitempty,min=1,max=100"`
+	Status     string `json:"status,omitempty" validate:"omitempty,oneof=completed rolled_back"`
+	Reason     string `json:"reason,omitempty" validate:"max=255"`
+}
+
+type AIModelPinRequest struct {
+	ModelID uuid.UUID `json:"model_id" validate:"required"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	DatasetExportPending   = "pending"
+	DatasetExportRunning   = "running"
+	DatasetExportCompleted = "completed"
+	DatasetExportFailed    = "failed"
+)
+
+// DatasetFilter selects the labelled detections exported for retraining.
+// Zero values match everything.
+type DatasetFilter struct {
+	ModelName    string     `json:"model,omitempty" validate:"omitempty,max=100"`
+	ModelVersion string     `json:"model_version,omitempty" validate:"omitempty,max=50"`
+	Types        []string   `json:"types,omitempty" validate:"omitempty,max=50,dive,required,max=50"`
+	Labels       []string   `json:"labels,omitempty" validate:"omitempty,dive,oneof=correct false_positive missed"`
+	From         *time.Time `json:"from,omitempty"`
+	To           *time.Time `json:"to,omitempty"`
+}
+
+// DatasetExport is a versioned training dataset built in the background from
+// runner feedback. Its manifest and metadata are written to the blob store
+// under datasets/v<version>/.
+type DatasetExport struct {
+	ID          uuid.UUID     `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Version     int           `json:"version" gorm:"not null;uniqueIndex"`
+	Status      string        `json:"status" gorm:"type:varchar(20);not null;index"`
+	Filter      DatasetFilter `json:"filter" gorm:"type:text;serializer:json"`
+	RequestedBy uuid.UUID     `json:"requested_by" gorm:"type:uuid;not null"`
+	Samples     int           `json:"samples"`
+	ManifestKey string        `json:"manifest_key,omitempty" gorm:"type:varchar(255)"`
+	Error       string        `json:"error,omitempty" gorm:"type:text"`
+	CreatedAt   time.Time     `json:"created_at"`
+	StartedAt   *time.Time    `json:"started_at,omitempty"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+}
+
+func (e *DatasetExport) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
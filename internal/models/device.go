@@ -20,6 +20,8 @@ type Device struct {
 	IsActive         bool       `json:"is_active" gorm:"default:true"`
 	BatteryLevel     *int       `json:"battery_level,omitempty" validate:"omitempty,min=0,max=100"`
 	LastSyncAt       *time.Time `json:"last_sync_at,omitempty"`
+	// CurrentModelID is the detection model the device last reported running.
+	CurrentModelID   *uuid.UUID `json:"current_model_id,omitempty" gorm:"type:uuid"`
 	PairedAt         time.Time  `json:"paired_at"`
 	CreatedAt        time.Time  `json:"created_at"`
 	UpdatedAt        time.Time  `json:"updated_at"`
@@ -42,6 +44,7 @@ type DeviceStatusRequest struct {
 	BatteryLevel        *int       `json:"battery_level,omitempty" validate:"omitempty,min=0,max=100"`
 	StorageAvailableMB  *int       `json:"storage_available_mb,omitempty" validate:"omitempty,min=0"`
 	FirmwareVersion     string     `json:"firmware_version,omitempty" validate:"omitempty,max=20"`
+	Model               *AIModelInfo `json:"model,omitempty" validate:"omitempty"`
 	ErrorCount          *int       `json:"error_count,omitempty" validate:"omitempty,min=0"`
 	LastRunAt           *time.Time `json:"last_run_at,omitempty"`
 }
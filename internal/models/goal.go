@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	GoalTypeDistance = "distance"
+	GoalTypeRuns     = "runs"
+	GoalTypeDuration = "duration"
+	GoalTypeRaceTime = "race_time"
+
+	GoalPeriodWeek  = "week"
+	GoalPeriodMonth = "month"
+
+	GoalEventPeriodCompleted = "period_completed"
+	GoalEventRaceTargetMet   = "race_target_met"
+)
+
+// Goal is a user's target. Distance (meters), runs and duration (seconds on
+// feet) goals repeat every week or month; race time goals are met once the
+// personal record for RaceCategory is at or under Target seconds.
+type Goal struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID       uuid.UUID  `json:"-" gorm:"type:uuid;not null;index"`
+	Type         string     `json:"type" gorm:"type:varchar(20);not null"`
+	Period       string     `json:"period,omitempty" gorm:"type:varchar(10)"`
+	Target       float64    `json:"target" gorm:"type:decimal(12,2);not null"`
+	RaceCategory string     `json:"race_category,omitempty" gorm:"type:varchar(30)"`
+	TargetDate   *time.Time `json:"target_date,omitempty"`
+	Title        string     `json:"title,omitempty" gorm:"type:varchar(100)"`
+	Active       bool       `json:"active" gorm:"default:true;index"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func (g *Goal) BeforeCreate(tx *gorm.DB) error {
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	g.CreatedAt = time.Now()
+	g.UpdatedAt = time.Now()
+	return nil
+}
+
+func (g *Goal) BeforeUpdate(tx *gorm.DB) error {
+	g.UpdatedAt = time.Now()
+	return nil
+}
+
+type GoalCreateRequest struct {
+	Type         string     `json:"type" validate:"required,oneof=distance runs duration race_time"`
+	Period       string     `json:"period,omitempty" validate:"omitempty,oneof=week month"`
+	Target       float64    `json:"target" validate:"required,gt=0"`
+	RaceCategory string     `json:"race_category,omitempty" validate:"omitempty,oneof=1k 5k 10k half_marathon marathon"`
+	TargetDate   *time.Time `json:"target_date,omitempty"`
+	Title        string     `json:"title,omitempty" validate:"omitempty,max=100"`
+}
+
+type GoalUpdateRequest struct {
+	Target     *float64   `json:"target,omitempty" validate:"omitempty,gt=0"`
+	TargetDate *time.Time `json:"target_date,omitempty"`
+	Title      *string    `json:"title,omitempty" validate:"omitempty,max=100"`
+	Active     *bool      `json:"active,omitempty"`
+}
+
+// GoalEvent records a goal being met: a period reaching its target or a race
+// time being achieved. NotifiedAt is left empty until a notification for the
+// event has been sent.
+type GoalEvent struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	GoalID      uuid.UUID  `json:"goal_id" gorm:"type:uuid;not null;uniqueIndex:idx_goal_events_goal_type_period,priority:1"`
+	UserID      uuid.UUID  `json:"-" gorm:"type:uuid;not null;index"`
+	Type        string     `json:"type" gorm:"type:varchar(30);not null;uniqueIndex:idx_goal_events_goal_type_period,priority:2"`
+	PeriodStart string     `json:"period_start,omitempty" gorm:"type:varchar(10);uniqueIndex:idx_goal_events_goal_type_period,priority:3"`
+	RunID       *uuid.UUID `json:"run_id,omitempty" gorm:"type:uuid"`
+	Value       float64    `json:"value" gorm:"type:decimal(12,2)"`
+	Streak      int        `json:"streak,omitempty"`
+	NotifiedAt  *time.Time `json:"notified_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"index"`
+}
+
+func (e *GoalEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	e.CreatedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	HazardSourceReported   = "reported"
+	HazardSourceAggregated = "aggregated"
+
+	HazardStatusPending  = "pending"
+	HazardStatusApproved = "approved"
+	HazardStatusRejected = "rejected"
+)
+
+// Hazard is a known obstacle in the curated layer the glasses download to
+// warn ahead of the camera. Reported hazards come from runners in the app;
+// aggregated ones are refreshed from the shared hotspot map. Reports stay
+// pending, visible only to their reporter, until an admin approves them.
+// Removed hazards are kept with RemovedAt set so devices syncing deltas learn
+// to drop them.
+type Hazard struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Source       string     `json:"source" gorm:"type:varchar(20);not null;index"`
+	Status       string     `json:"status" gorm:"type:varchar(20);not null;default:'approved';index"`
+	Type         string     `json:"type" gorm:"type:varchar(50);not null"`
+	Latitude     float64    `json:"lat" gorm:"type:decimal(10,8);not null;index:idx_hazards_location,priority:1"`
+	Longitude    float64    `json:"lng" gorm:"type:decimal(11,8);not null;index:idx_hazards_location,priority:2"`
+	RadiusMeters float64    `json:"radius_m" gorm:"type:decimal(6,2)"`
+	Confidence   float64    `json:"confidence" gorm:"type:decimal(3,2)"`
+	Description  string     `json:"description,omitempty" gorm:"type:varchar(255)"`
+	ReportedBy   *uuid.UUID `json:"-" gorm:"type:uuid;index"`
+	// Detections and Users describe the evidence behind aggregated hazards.
+	Detections int        `json:"detections,omitempty"`
+	Users      int        `json:"users,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null;index"`
+	RemovedAt  *time.Time `json:"removed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" gorm:"index"`
+}
+
+func (h *Hazard) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
+
+// Active reports whether devices should still warn about the hazard.
+func (h *Hazard) Active(now time.Time) bool {
+	return h.RemovedAt == nil && h.ExpiresAt.After(now)
+}
+
+type HazardReportRequest struct {
+	Type         string   `json:"type" validate:"required,max=50"`
+	Latitude     float64  `json:"lat" validate:"required,latitude"`
+	Longitude    float64  `json:"lng" validate:"required,longitude"`
+	RadiusMeters *float64 `json:"radius_m,omitempty" validate:"omitempty,min=1,max=100"`
+	Description  string   `json:"description,omitempty" validate:"max=255"`
+	// ExpiresInDays defaults to 30; temporary obstacles like roadworks can
+	// use less, permanent ones up to a year before being re-reported.
+	ExpiresInDays *int `json:"expires_in_days,omitempty" validate:"omitempty,min=1,max=365"`
+}
+
+type HazardModerationRequest struct {
+	Status string `json:"status" validate:"required,oneof=approved rejected"`
+}
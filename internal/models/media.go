@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MediaBlob is an uploaded file in the blob store, keyed by the SHA-256 of
+// its content so a file is stored once however many runs reference it.
+// UpdatedAt is touched whenever an upload reuses the blob.
+type MediaBlob struct {
+	SHA256      string    `json:"sha256" gorm:"type:varchar(64);primary_key"`
+	SizeBytes   int64     `json:"size_bytes" gorm:"not null"`
+	ContentType string    `json:"content_type" gorm:"type:varchar(50);not null"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// RunMedia is a frame the glasses captured during a run, linked to the
+// detection it was captured for when one was close enough in time.
+type RunMedia struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RunID       uuid.UUID  `json:"-" gorm:"type:uuid;not null;uniqueIndex:idx_run_media_content"`
+	UserID      uuid.UUID  `json:"-" gorm:"type:uuid;not null;index"`
+	AIEventID   *uuid.UUID `json:"ai_event_id,omitempty" gorm:"type:uuid;index"`
+	SHA256      string     `json:"sha256" gorm:"type:varchar(64);not null;uniqueIndex:idx_run_media_content;index"`
+	SizeBytes   int64      `json:"size_bytes" gorm:"not null"`
+	ContentType string     `json:"content_type" gorm:"type:varchar(50);not null"`
+	CapturedAt  time.Time  `json:"captured_at" gorm:"not null"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	// URL is a short-lived download link, filled in when listing for the app
+	URL       string     `json:"url,omitempty" gorm:"-"`
+	ExpiresAt *time.Time `json:"url_expires_at,omitempty" gorm:"-"`
+}
+
+func (m *RunMedia) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	RecordCategory1K           = "1k"
+	RecordCategory5K           = "5k"
+	RecordCategory10K          = "10k"
+	RecordCategoryHalfMarathon = "half_marathon"
+	RecordCategoryMarathon     = "marathon"
+	RecordCategoryLongestRun   = "longest_run"
+	RecordCategoryFastestPace  = "fastest_pace"
+)
+
+// RunBestEffort is the fastest segment of one run covering a standard
+// distance. Personal records are the best of these across a user's runs.
+type RunBestEffort struct {
+	ID              uuid.UUID `json:"-" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RunID           uuid.UUID `json:"-" gorm:"type:uuid;not null;uniqueIndex:idx_run_best_efforts_run_category,priority:1"`
+	Category        string    `json:"category" gorm:"type:varchar(30);not null;uniqueIndex:idx_run_best_efforts_run_category,priority:2;index"`
+	DistanceMeters  float64   `json:"distance_meters" gorm:"type:decimal(10,2);not null"`
+	DurationSeconds float64   `json:"duration_seconds" gorm:"type:decimal(10,2);not null"`
+	StartSeq        int       `json:"start_seq"`
+	EndSeq          int       `json:"end_seq"`
+	StartedAt       time.Time `json:"started_at"`
+}
+
+func (e *RunBestEffort) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// PersonalRecord is a user's current best in one category. Distance records
+// point at the segment of the source run where they were set.
+type PersonalRecord struct {
+	ID               uuid.UUID `json:"-" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID           uuid.UUID `json:"-" gorm:"type:uuid;not null;uniqueIndex:idx_personal_records_user_category,priority:1"`
+	Category         string    `json:"category" gorm:"type:varchar(30);not null;uniqueIndex:idx_personal_records_user_category,priority:2"`
+	RunID            uuid.UUID `json:"run_id" gorm:"type:uuid;not null;index"`
+	DistanceMeters   float64   `json:"distance_meters" gorm:"type:decimal(10,2)"`
+	DurationSeconds  float64   `json:"duration_seconds" gorm:"type:decimal(10,2)"`
+	PaceSecondsPerKm *float64  `json:"pace_seconds_per_km,omitempty" gorm:"type:decimal(8,2)"`
+	StartSeq         *int      `json:"start_seq,omitempty"`
+	EndSeq           *int      `json:"end_seq,omitempty"`
+	AchievedAt       time.Time `json:"achieved_at" gorm:"not null"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+func (r *PersonalRecord) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	r.CreatedAt = time.Now()
+	return nil
+}
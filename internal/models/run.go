@@ -7,6 +7,20 @@ import (
 	"gorm.io/gorm"
 )
 
+// ImportDeviceID is recorded as the device for runs imported from files
+// exported by other apps rather than uploaded by paired glasses.
+const ImportDeviceID = "import"
+
+const (
+	ElevationSourceGPS = "gps"
+	ElevationSourceDEM = "dem"
+)
+
+const (
+	TrainingLoadMethodTRIMP = "trimp"
+	TrainingLoadMethodPace  = "pace"
+)
+
 type Run struct {
 	ID              uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	UserID          uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
@@ -27,6 +41,49 @@ type Run struct {
 	EndLatitude     *float64   `json:"end_latitude,omitempty" gorm:"type:decimal(10,8)" validate:"omitempty,latitude"`
 	EndLongitude    *float64   `json:"end_longitude,omitempty" gorm:"type:decimal(11,8)" validate:"omitempty,longitude"`
 	RouteData       *string    `json:"route_data,omitempty" gorm:"type:text"`
+
+	// Server-computed metrics derived from the stored waypoints. The fields
+	// above keep whatever the device reported.
+	ComputedDistanceMeters  *float64   `json:"computed_distance_meters,omitempty" gorm:"type:decimal(10,2)"`
+	ComputedDurationSeconds *int       `json:"computed_duration_seconds,omitempty"`
+	MovingTimeSeconds       *int       `json:"moving_time_seconds,omitempty"`
+	ComputedAvgSpeedKmh     *float64   `json:"computed_avg_speed_kmh,omitempty" gorm:"type:decimal(8,2)"`
+	ComputedMaxSpeedKmh     *float64   `json:"computed_max_speed_kmh,omitempty" gorm:"type:decimal(8,2)"`
+	MetricsFlagged          bool       `json:"metrics_flagged" gorm:"default:false;index"`
+	MetricsDiscrepancies    string     `json:"metrics_discrepancies,omitempty" gorm:"type:varchar(100)"`
+	AnalyzedAt              *time.Time `json:"analyzed_at,omitempty"`
+
+	// Elevation totals from the cleaned track. ElevationSource tells whether
+	// the altitudes came from the device or were corrected against a DEM.
+	ElevationGainMeters *float64 `json:"elevation_gain_meters,omitempty" gorm:"type:decimal(8,2)"`
+	ElevationLossMeters *float64 `json:"elevation_loss_meters,omitempty" gorm:"type:decimal(8,2)"`
+	MinElevationMeters  *float64 `json:"min_elevation_meters,omitempty" gorm:"type:decimal(8,2)"`
+	MaxElevationMeters  *float64 `json:"max_elevation_meters,omitempty" gorm:"type:decimal(8,2)"`
+	ElevationSource     string   `json:"elevation_source,omitempty" gorm:"type:varchar(10)"`
+
+	// Summaries of the uploaded sensor streams
+	AvgHeartRateBpm *int `json:"avg_heart_rate_bpm,omitempty"`
+	MaxHeartRateBpm *int `json:"max_heart_rate_bpm,omitempty"`
+	AvgCadenceSpm   *int `json:"avg_cadence_spm,omitempty"`
+
+	// TrainingLoad is the run's stress score, from heart rate (TRIMP) when a
+	// heart rate stream is available and from pace otherwise. One hour at
+	// threshold scores about 100.
+	TrainingLoad       *float64 `json:"training_load,omitempty" gorm:"type:decimal(8,2)"`
+	TrainingLoadMethod string   `json:"training_load_method,omitempty" gorm:"type:varchar(10)"`
+
+	// SafetyScore rates from 0 to 100 how safely the run went according to
+	// the glasses, combining the parts in SafetyBreakdown. Runs without
+	// AI metrics have none. SafetyScoredAt marks runs that have been scored,
+	// so runs uploaded before scores existed can be backfilled.
+	SafetyScore     *float64         `json:"safety_score,omitempty" gorm:"type:decimal(5,2)"`
+	SafetyBreakdown *SafetyBreakdown `json:"safety_breakdown,omitempty" gorm:"type:text;serializer:json"`
+	SafetyScoredAt  *time.Time       `json:"-"`
+
+	// BestEffortsAt marks runs whose best efforts have been extracted, so
+	// runs uploaded before records existed can be backfilled.
+	BestEffortsAt *time.Time `json:"-"`
+
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at"`
 	
@@ -51,6 +108,15 @@ type RunCreateRequest struct {
 	EndLatitude     *float64   `json:"end_latitude,omitempty" validate:"omitempty,latitude"`
 	EndLongitude    *float64   `json:"end_longitude,omitempty" validate:"omitempty,longitude"`
 	Waypoints       []WaypointData `json:"waypoints,omitempty" validate:"omitempty,dive"`
+	// LapMarkers are the times the runner pressed the lap button; each one
+	// ends the current lap and starts the next.
+	LapMarkers      []time.Time    `json:"lap_markers,omitempty"`
+	Streams         []SensorStreamData `json:"streams,omitempty" validate:"omitempty,max=4,dive"`
+	// ScheduledWorkoutID is the workout the glasses guided, as served by
+	// /iot/workouts/next. Without it the run is matched by date.
+	ScheduledWorkoutID *uuid.UUID `json:"scheduled_workout_id,omitempty"`
+	// WorkoutSteps are the steps the glasses guided, in the order they ran.
+	WorkoutSteps []WorkoutStepData `json:"workout_steps,omitempty" validate:"omitempty,max=200,dive"`
 }
 
 type RunUpdateRequest struct {
@@ -81,9 +147,14 @@ func (r *Run) BeforeUpdate(tx *gorm.DB) error {
 	return nil
 }
 
+// WaypointData is a single GPS fix. Speed is in metres per second as reported
+// by the receiver; altitude and accuracy are in metres, heading in degrees.
 type WaypointData struct {
 	Latitude  float64   `json:"lat" validate:"required,latitude"`
 	Longitude float64   `json:"lng" validate:"required,longitude"`
+	Altitude  *float64  `json:"alt,omitempty" validate:"omitempty,min=-500,max=9000"`
+	Heading   *float64  `json:"heading,omitempty" validate:"omitempty,min=0,max=360"`
+	Accuracy  *float64  `json:"accuracy,omitempty" validate:"omitempty,min=0"`
 	Speed     *float64  `json:"speed,omitempty" validate:"omitempty,min=0"`
 	Timestamp time.Time `json:"timestamp" validate:"required"`
-}
\ No newline at end of file
+}
\ No newline at end of file
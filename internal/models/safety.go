@@ -0,0 +1,27 @@
+package models
+
+// SafetyScoreVersion is bumped whenever the safety score formula changes.
+const SafetyScoreVersion = 1
+
+// SafetyBreakdown scores each part of a run's safety from 0 to 100, higher
+// being safer, next to the measurements behind it. Parts the run has no data
+// for are omitted.
+type SafetyBreakdown struct {
+	Version int `json:"version"`
+
+	ObstacleDensityScore *float64 `json:"obstacle_density_score,omitempty"`
+	WarningResponseScore *float64 `json:"warning_response_score,omitempty"`
+	LaneKeepingScore     *float64 `json:"lane_keeping_score,omitempty"`
+	NearMissScore        *float64 `json:"near_miss_score,omitempty"`
+
+	DistanceKm      float64  `json:"distance_km"`
+	Detections      int      `json:"detections"`
+	DetectionsPerKm *float64 `json:"detections_per_km,omitempty"`
+	// Warnings counts spoken warnings; a warning is heeded unless the
+	// runner came within near miss distance of the object shortly after.
+	Warnings            int      `json:"warnings"`
+	WarningsHeeded      int      `json:"warnings_heeded"`
+	LaneKeepingAccuracy *float64 `json:"lane_keeping_accuracy,omitempty"`
+	LaneDeviationsPerKm *float64 `json:"lane_deviations_per_km,omitempty"`
+	NearMisses          int      `json:"near_misses"`
+}
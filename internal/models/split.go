@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	SplitKindKilometer = "km"
+	SplitKindMile      = "mile"
+	SplitKindLap       = "lap"
+	SplitKindEffort    = "effort"
+)
+
+type RunSplit struct {
+	ID               uuid.UUID `json:"-" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RunID            uuid.UUID `json:"-" gorm:"type:uuid;not null;uniqueIndex:idx_run_splits_run_kind_index,priority:1"`
+	Kind             string    `json:"kind" gorm:"type:varchar(10);not null;uniqueIndex:idx_run_splits_run_kind_index,priority:2"`
+	Index            int       `json:"index" gorm:"column:split_index;not null;uniqueIndex:idx_run_splits_run_kind_index,priority:3"`
+	StartSeq         int       `json:"start_seq"`
+	EndSeq           int       `json:"end_seq"`
+	StartedAt        time.Time `json:"started_at"`
+	DurationSeconds  float64   `json:"duration_seconds" gorm:"type:decimal(10,2)"`
+	DistanceMeters   float64   `json:"distance_meters" gorm:"type:decimal(10,2)"`
+	PaceSecondsPerKm *float64  `json:"pace_seconds_per_km,omitempty" gorm:"type:decimal(8,2)"`
+	AvgSpeedKmh      float64   `json:"avg_speed_kmh" gorm:"type:decimal(8,2)"`
+	Partial          bool      `json:"partial"`
+
+	ElevationGainMeters *float64 `json:"elevation_gain_meters,omitempty" gorm:"type:decimal(8,2)"`
+	ElevationLossMeters *float64 `json:"elevation_loss_meters,omitempty" gorm:"type:decimal(8,2)"`
+	AvgGradePercent     *float64 `json:"avg_grade_percent,omitempty" gorm:"type:decimal(6,2)"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *RunSplit) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	s.CreatedAt = time.Now()
+	return nil
+}
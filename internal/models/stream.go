@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	StreamTypeHeartRate    = "hr"
+	StreamTypeCadence      = "cadence"
+	StreamTypeStrideLength = "stride_length"
+	StreamTypePower        = "power"
+)
+
+// RunStream holds one sensor channel of a run. Samples are packed into Data
+// as varints: each sample's millisecond offset and scaled value are stored
+// as deltas from the previous sample, which keeps a 1 Hz heart rate stream
+// at roughly three bytes per sample.
+type RunStream struct {
+	ID          uuid.UUID `json:"-" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RunID       uuid.UUID `json:"-" gorm:"type:uuid;not null;uniqueIndex:idx_run_streams_run_type,priority:1"`
+	Type        string    `json:"type" gorm:"type:varchar(20);not null;uniqueIndex:idx_run_streams_run_type,priority:2"`
+	StartedAt   time.Time `json:"started_at" gorm:"not null"`
+	SampleCount int       `json:"sample_count" gorm:"not null"`
+	Scale       int       `json:"-" gorm:"not null;default:1"`
+	Data        []byte    `json:"-" gorm:"type:bytea;not null"`
+	MinValue    float64   `json:"min" gorm:"type:decimal(8,2)"`
+	MaxValue    float64   `json:"max" gorm:"type:decimal(8,2)"`
+	AvgValue    float64   `json:"avg" gorm:"type:decimal(8,2)"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (s *RunStream) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	s.CreatedAt = time.Now()
+	return nil
+}
+
+type StreamSample struct {
+	Timestamp time.Time `json:"timestamp" validate:"required"`
+	Value     float64   `json:"value"`
+}
+
+// SensorStreamData is one sensor channel as uploaded by the glasses, e.g.
+// heart rate from a paired chest strap or cadence from a foot pod.
+type SensorStreamData struct {
+	Type    string         `json:"type" validate:"required,oneof=hr cadence stride_length power"`
+	Samples []StreamSample `json:"samples" validate:"required,min=1,max=50000,dive"`
+}
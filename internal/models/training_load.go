@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DailyTrainingLoad is one calendar day, in the user's profile timezone, of
+// the user's training load history. Fitness and fatigue are exponentially
+// weighted averages of daily load over 42 and 7 days; form is yesterday's
+// fitness minus yesterday's fatigue. The acute:chronic workload ratio
+// compares the last 7 days' average load with the last 28 days'.
+type DailyTrainingLoad struct {
+	ID          uuid.UUID `json:"-" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID `json:"-" gorm:"type:uuid;not null;uniqueIndex:idx_daily_training_loads_user_day,priority:1"`
+	Day         string    `json:"day" gorm:"type:varchar(10);not null;uniqueIndex:idx_daily_training_loads_user_day,priority:2"`
+	Load        float64   `json:"load" gorm:"type:decimal(8,2);not null"`
+	Fitness     float64   `json:"fitness" gorm:"type:decimal(8,2);not null"`
+	Fatigue     float64   `json:"fatigue" gorm:"type:decimal(8,2);not null"`
+	Form        float64   `json:"form" gorm:"type:decimal(8,2);not null"`
+	AcuteLoad   float64   `json:"acute_load" gorm:"type:decimal(8,2);not null"`
+	ChronicLoad float64   `json:"chronic_load" gorm:"type:decimal(8,2);not null"`
+	ACWR        *float64  `json:"acwr,omitempty" gorm:"column:acwr;type:decimal(6,2)"`
+	UpdatedAt   time.Time `json:"-"`
+}
+
+func (d *DailyTrainingLoad) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	d.UpdatedAt = time.Now()
+	return nil
+}
@@ -9,13 +9,24 @@ import (
 )
 
 type User struct {
-	ID           uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	FullName     string    `json:"full_name" gorm:"type:varchar(100);not null" validate:"required,min=2,max=100"`
-	Email        string    `json:"email" gorm:"type:varchar(100);uniqueIndex;not null" validate:"required,email,max=100"`
-	Phone        string    `json:"phone,omitempty" gorm:"type:varchar(20)" validate:"omitempty,min=10,max=20"`
-	PasswordHash string    `json:"-" gorm:"type:varchar(255);not null"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	FullName        string    `json:"full_name" gorm:"type:varchar(100);not null" validate:"required,min=2,max=100"`
+	Email           string    `json:"email" gorm:"type:varchar(100);uniqueIndex;not null" validate:"required,email,max=100"`
+	Phone           string    `json:"phone,omitempty" gorm:"type:varchar(20)" validate:"omitempty,min=10,max=20"`
+	PasswordHash    string    `json:"-" gorm:"type:varchar(255);not null"`
+	Timezone        string    `json:"timezone" gorm:"type:varchar(64);not null;default:'UTC'"`
+	WeekStart       string    `json:"week_start" gorm:"type:varchar(10);not null;default:'monday'"`
+	// ShareHazardData opts the user's obstacle detections into the anonymized
+	// hazard map shared with other runners.
+	ShareHazardData bool      `json:"share_hazard_data" gorm:"not null;default:false"`
+	// ShareTrainingData opts the user's labelled detections into the
+	// anonymized datasets exported to retrain the detection models.
+	ShareTrainingData bool `json:"share_training_data" gorm:"not null;default:false"`
+	// IsAdmin grants access to the /admin endpoints. It is set directly in
+	// the database, never through the API.
+	IsAdmin         bool      `json:"-" gorm:"not null;default:false"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 	
 	Runs []Run `json:"runs,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
 }
@@ -34,8 +45,37 @@ type UserLoginRequest struct {
 }
 
 type UserUpdateRequest struct {
-	FullName string `json:"full_name,omitempty" validate:"omitempty,min=2,max=100"`
-	Phone    string `json:"phone,omitempty" validate:"omitempty,min=10,max=20"`
+	FullName          string `json:"full_name,omitempty" validate:"omitempty,min=2,max=100"`
+	Phone             string `json:"phone,omitempty" validate:"omitempty,min=10,max=20"`
+	Timezone          string `json:"timezone,omitempty" validate:"omitempty,max=64"`
+	WeekStart         string `json:"week_start,omitempty" validate:"omitempty,oneof=monday sunday"`
+	ShareHazardData   *bool  `json:"share_hazard_data,omitempty"`
+	ShareTrainingData *bool  `json:"share_training_data,omitempty"`
+}
+
+const (
+	WeekStartMonday = "monday"
+	WeekStartSunday = "sunday"
+)
+
+// Location returns the user's IANA timezone, falling back to UTC for unset
+// or unknown zones.
+func (u *User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (u *User) FirstDayOfWeek() time.Weekday {
+	if u.WeekStart == WeekStartSunday {
+		return time.Sunday
+	}
+	return time.Monday
 }
 
 func (u *User) SetPassword(password string) error {
@@ -63,4 +103,4 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 func (u *User) BeforeUpdate(tx *gorm.DB) error {
 	u.UpdatedAt = time.Now()
 	return nil
-}
\ No newline at end of file
+}
\ No newline at end of file
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Every upload is stored twice: the raw track exactly as the device sent it
+// and the filtered track produced by the GPS cleanup pipeline, which is what
+// analysis, splits and exports work from.
+const (
+	TrackRaw      = "raw"
+	TrackFiltered = "filtered"
+)
+
+type RunWaypoint struct {
+	ID        uuid.UUID `json:"-" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RunID     uuid.UUID `json:"-" gorm:"type:uuid;not null;uniqueIndex:idx_run_waypoints_run_track_seq,priority:1"`
+	Track     string    `json:"-" gorm:"type:varchar(10);not null;default:'raw';uniqueIndex:idx_run_waypoints_run_track_seq,priority:2"`
+	Sequence  int       `json:"seq" gorm:"not null;uniqueIndex:idx_run_waypoints_run_track_seq,priority:3"`
+	Latitude  float64   `json:"lat" gorm:"type:decimal(10,8);not null"`
+	Longitude float64   `json:"lng" gorm:"type:decimal(11,8);not null"`
+	Altitude  *float64  `json:"alt,omitempty" gorm:"type:decimal(8,2)"`
+	Heading   *float64  `json:"heading,omitempty" gorm:"type:decimal(5,2)"`
+	Accuracy  *float64  `json:"accuracy,omitempty" gorm:"type:decimal(7,2)"`
+	Speed     *float64  `json:"speed,omitempty" gorm:"type:decimal(8,2)"`
+	Timestamp time.Time `json:"timestamp" gorm:"column:recorded_at;not null"`
+}
+
+// RunWaypointColumns lists the columns written for each waypoint, in the
+// order used by RunWaypoint.Values for bulk COPY loads.
+var RunWaypointColumns = []string{
+	"id", "run_id", "track", "sequence", "latitude", "longitude",
+	"altitude", "heading", "accuracy", "speed", "recorded_at",
+}
+
+func (w *RunWaypoint) Values() []interface{} {
+	return []interface{}{
+		w.ID, w.RunID, w.Track, w.Sequence, w.Latitude, w.Longitude,
+		w.Altitude, w.Heading, w.Accuracy, w.Speed, w.Timestamp,
+	}
+}
+
+func (w *RunWaypoint) ToData() WaypointData {
+	return WaypointData{
+		Latitude:  w.Latitude,
+		Longitude: w.Longitude,
+		Altitude:  w.Altitude,
+		Heading:   w.Heading,
+		Accuracy:  w.Accuracy,
+		Speed:     w.Speed,
+		Timestamp: w.Timestamp,
+	}
+}
+
+func (w *RunWaypoint) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return nil
+}
+
+// NewRunWaypoints converts waypoints into rows of one track of the given run,
+// numbering them in order starting at zero.
+func NewRunWaypoints(runID uuid.UUID, track string, points []WaypointData) []RunWaypoint {
+	rows := make([]RunWaypoint, len(points))
+	for i, p := range points {
+		rows[i] = RunWaypoint{
+			ID:        uuid.New(),
+			RunID:     runID,
+			Track:     track,
+			Sequence:  i,
+			Latitude:  p.Latitude,
+			Longitude: p.Longitude,
+			Altitude:  p.Altitude,
+			Heading:   p.Heading,
+			Accuracy:  p.Accuracy,
+			Speed:     p.Speed,
+			Timestamp: p.Timestamp,
+		}
+	}
+	return rows
+}
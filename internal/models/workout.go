@@ -0,0 +1,217 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	WorkoutTypeEasy      = "easy"
+	WorkoutTypeRecovery  = "recovery"
+	WorkoutTypeTempo     = "tempo"
+	WorkoutTypeIntervals = "intervals"
+	WorkoutTypeLongRun   = "long_run"
+
+	WorkoutStepWarmup   = "warmup"
+	WorkoutStepWork     = "work"
+	WorkoutStepRecovery = "recovery"
+	WorkoutStepCooldown = "cooldown"
+
+	WorkoutStatusPlanned   = "planned"
+	WorkoutStatusCompleted = "completed"
+	WorkoutStatusSkipped   = "skipped"
+)
+
+// WorkoutStep is one segment of a structured workout, ended by duration or
+// distance. A step with Repeat and nested Steps is a block repeated Repeat
+// times, e.g. 6 × (400 m work, 90 s recovery).
+type WorkoutStep struct {
+	Kind                   string        `json:"kind,omitempty" validate:"omitempty,oneof=warmup work recovery cooldown"`
+	DurationSeconds        *int          `json:"duration_seconds,omitempty" validate:"omitempty,min=1,max=86400"`
+	DistanceMeters         *float64      `json:"distance_meters,omitempty" validate:"omitempty,gt=0,max=100000"`
+	TargetPaceSecondsPerKm *int          `json:"target_pace_seconds_per_km,omitempty" validate:"omitempty,min=120,max=1200"`
+	Repeat                 int           `json:"repeat,omitempty" validate:"omitempty,min=1,max=50"`
+	Steps                  []WorkoutStep `json:"steps,omitempty" validate:"omitempty,max=10,dive"`
+}
+
+// WorkoutTemplate is a reusable workout definition owned by a user.
+type WorkoutTemplate struct {
+	ID                     uuid.UUID     `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID                 uuid.UUID     `json:"-" gorm:"type:uuid;not null;index"`
+	Name                   string        `json:"name" gorm:"type:varchar(100);not null"`
+	Type                   string        `json:"type" gorm:"type:varchar(20);not null"`
+	Description            string        `json:"description,omitempty" gorm:"type:text"`
+	TargetDistanceMeters   *float64      `json:"target_distance_meters,omitempty" gorm:"type:decimal(10,2)"`
+	TargetDurationSeconds  *int          `json:"target_duration_seconds,omitempty"`
+	TargetPaceSecondsPerKm *int          `json:"target_pace_seconds_per_km,omitempty"`
+	Steps                  []WorkoutStep `json:"steps,omitempty" gorm:"type:text;serializer:json"`
+	CreatedAt              time.Time     `json:"created_at"`
+	UpdatedAt              time.Time     `json:"updated_at"`
+}
+
+func (w *WorkoutTemplate) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	w.CreatedAt = time.Now()
+	w.UpdatedAt = time.Now()
+	return nil
+}
+
+type WorkoutTemplateRequest struct {
+	Name                   string        `json:"name" validate:"required,max=100"`
+	Type                   string        `json:"type" validate:"required,oneof=easy recovery tempo intervals long_run"`
+	Description            string        `json:"description,omitempty" validate:"omitempty,max=2000"`
+	TargetDistanceMeters   *float64      `json:"target_distance_meters,omitempty" validate:"omitempty,gt=0,max=300000"`
+	TargetDurationSeconds  *int          `json:"target_duration_seconds,omitempty" validate:"omitempty,min=60,max=86400"`
+	TargetPaceSecondsPerKm *int          `json:"target_pace_seconds_per_km,omitempty" validate:"omitempty,min=120,max=1200"`
+	Steps                  []WorkoutStep `json:"steps,omitempty" validate:"omitempty,max=20,dive"`
+}
+
+// PlanEntry places a template on a day of a plan, DayOffset days after the
+// day the plan is scheduled to start.
+type PlanEntry struct {
+	DayOffset  int       `json:"day_offset" validate:"min=0,max=365"`
+	TemplateID uuid.UUID `json:"template_id" validate:"required"`
+}
+
+// TrainingPlan is an ordered set of workouts that can be laid onto the
+// user's calendar from any start date.
+type TrainingPlan struct {
+	ID          uuid.UUID   `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID      uuid.UUID   `json:"-" gorm:"type:uuid;not null;index"`
+	Name        string      `json:"name" gorm:"type:varchar(100);not null"`
+	Description string      `json:"description,omitempty" gorm:"type:text"`
+	Entries     []PlanEntry `json:"entries" gorm:"type:text;serializer:json"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+func (p *TrainingPlan) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = time.Now()
+	return nil
+}
+
+type TrainingPlanRequest struct {
+	Name        string      `json:"name" validate:"required,max=100"`
+	Description string      `json:"description,omitempty" validate:"omitempty,max=2000"`
+	Entries     []PlanEntry `json:"entries" validate:"required,min=1,max=200,dive"`
+}
+
+type SchedulePlanRequest struct {
+	StartDate string `json:"start_date" validate:"required,datetime=2006-01-02"`
+}
+
+// ComplianceBreakdown scores each target of a scheduled workout from 0 to
+// 100 against the matched run. Targets the workout did not set are omitted.
+type ComplianceBreakdown struct {
+	DistanceScore          *float64 `json:"distance_score,omitempty"`
+	DurationScore          *float64 `json:"duration_score,omitempty"`
+	PaceScore              *float64 `json:"pace_score,omitempty"`
+	ActualDistanceMeters   float64  `json:"actual_distance_meters"`
+	ActualDurationSeconds  int      `json:"actual_duration_seconds"`
+	ActualPaceSecondsPerKm *float64 `json:"actual_pace_seconds_per_km,omitempty"`
+	// StepsScore is the share of targeted steps whose targets were hit, for
+	// workouts guided step by step on the glasses.
+	StepsScore *float64 `json:"steps_score,omitempty"`
+}
+
+// ScheduledWorkout is a workout on the user's calendar. The template's
+// targets and steps are copied in, so later template edits do not rewrite
+// the calendar. Once a run is matched, the workout records it with a
+// compliance score.
+type ScheduledWorkout struct {
+	ID                     uuid.UUID            `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID                 uuid.UUID            `json:"-" gorm:"type:uuid;not null;index:idx_scheduled_workouts_user_date,priority:1"`
+	Date                   string               `json:"date" gorm:"type:varchar(10);not null;index:idx_scheduled_workouts_user_date,priority:2"`
+	TemplateID             *uuid.UUID           `json:"template_id,omitempty" gorm:"type:uuid"`
+	PlanID                 *uuid.UUID           `json:"plan_id,omitempty" gorm:"type:uuid;index"`
+	Name                   string               `json:"name" gorm:"type:varchar(100);not null"`
+	Type                   string               `json:"type" gorm:"type:varchar(20);not null"`
+	Description            string               `json:"description,omitempty" gorm:"type:text"`
+	TargetDistanceMeters   *float64             `json:"target_distance_meters,omitempty" gorm:"type:decimal(10,2)"`
+	TargetDurationSeconds  *int                 `json:"target_duration_seconds,omitempty"`
+	TargetPaceSecondsPerKm *int                 `json:"target_pace_seconds_per_km,omitempty"`
+	Steps                  []WorkoutStep        `json:"steps,omitempty" gorm:"type:text;serializer:json"`
+	Status                 string               `json:"status" gorm:"type:varchar(20);not null;default:'planned'"`
+	RunID                  *uuid.UUID           `json:"run_id,omitempty" gorm:"type:uuid;index"`
+	ComplianceScore        *float64             `json:"compliance_score,omitempty" gorm:"type:decimal(5,2)"`
+	Compliance             *ComplianceBreakdown `json:"compliance,omitempty" gorm:"type:text;serializer:json"`
+	CompletedAt            *time.Time           `json:"completed_at,omitempty"`
+	CreatedAt              time.Time            `json:"created_at"`
+	UpdatedAt              time.Time            `json:"updated_at"`
+}
+
+func (w *ScheduledWorkout) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	w.CreatedAt = time.Now()
+	w.UpdatedAt = time.Now()
+	return nil
+}
+
+func (w *ScheduledWorkout) BeforeUpdate(tx *gorm.DB) error {
+	w.UpdatedAt = time.Now()
+	return nil
+}
+
+type ScheduleWorkoutRequest struct {
+	TemplateID uuid.UUID `json:"template_id" validate:"required"`
+	Date       string    `json:"date" validate:"required,datetime=2006-01-02"`
+}
+
+// ScheduledWorkoutUpdateRequest moves a workout to another day or marks it
+// skipped (or planned again).
+type ScheduledWorkoutUpdateRequest struct {
+	Date   *string `json:"date,omitempty" validate:"omitempty,datetime=2006-01-02"`
+	Status *string `json:"status,omitempty" validate:"omitempty,oneof=planned skipped"`
+}
+
+// WorkoutStepData is one step of a guided workout as executed on the
+// glasses: when it ran, what it targeted and, optionally, what the device
+// measured. Missing actuals are filled in from the track and streams.
+type WorkoutStepData struct {
+	Kind                   string    `json:"kind" validate:"required,oneof=warmup work recovery cooldown"`
+	Repetition             int       `json:"repetition,omitempty" validate:"omitempty,min=1,max=50"`
+	StartedAt              time.Time `json:"started_at" validate:"required"`
+	EndedAt                time.Time `json:"ended_at" validate:"required,gtfield=StartedAt"`
+	TargetDurationSeconds  *int      `json:"target_duration_seconds,omitempty" validate:"omitempty,min=1,max=86400"`
+	TargetDistanceMeters   *float64  `json:"target_distance_meters,omitempty" validate:"omitempty,gt=0,max=100000"`
+	TargetPaceSecondsPerKm *int      `json:"target_pace_seconds_per_km,omitempty" validate:"omitempty,min=120,max=1200"`
+	DistanceMeters         *float64  `json:"distance_meters,omitempty" validate:"omitempty,min=0,max=100000"`
+	AvgHeartRateBpm        *int      `json:"avg_heart_rate_bpm,omitempty" validate:"omitempty,min=25,max=250"`
+}
+
+// RunWorkoutStep is a stored step of a guided workout with its targets,
+// actual results and whether every target was hit.
+type RunWorkoutStep struct {
+	ID                     uuid.UUID `json:"-" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RunID                  uuid.UUID `json:"-" gorm:"type:uuid;not null;uniqueIndex:idx_run_workout_steps_run_index,priority:1"`
+	StepIndex              int       `json:"step_index" gorm:"not null;uniqueIndex:idx_run_workout_steps_run_index,priority:2"`
+	Kind                   string    `json:"kind" gorm:"type:varchar(20);not null"`
+	Repetition             int       `json:"repetition,omitempty"`
+	StartedAt              time.Time `json:"started_at"`
+	EndedAt                time.Time `json:"ended_at"`
+	TargetDurationSeconds  *int      `json:"target_duration_seconds,omitempty"`
+	TargetDistanceMeters   *float64  `json:"target_distance_meters,omitempty" gorm:"type:decimal(10,2)"`
+	TargetPaceSecondsPerKm *int      `json:"target_pace_seconds_per_km,omitempty"`
+	DurationSeconds        float64   `json:"duration_seconds" gorm:"type:decimal(10,2)"`
+	DistanceMeters         float64   `json:"distance_meters" gorm:"type:decimal(10,2)"`
+	PaceSecondsPerKm       *float64  `json:"pace_seconds_per_km,omitempty" gorm:"type:decimal(8,2)"`
+	AvgHeartRateBpm        *int      `json:"avg_heart_rate_bpm,omitempty"`
+	HitTarget              *bool     `json:"hit_target,omitempty"`
+}
+
+func (s *RunWorkoutStep) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ZoneKindHeartRate = "hr"
+	ZoneKindPace      = "pace"
+
+	// ZoneCount is the number of training zones per kind; zone 1 is the
+	// easiest and ZoneCount the hardest.
+	ZoneCount = 5
+)
+
+// ZoneSettings holds a user's zone definitions. Manually entered values take
+// precedence; when AutoEstimate is set, the Estimated* fields are refreshed
+// from the user's run history and fill in whatever was left empty. Custom
+// bounds, when present, replace the zones derived from max heart rate or
+// threshold pace and are stored comma-separated, easiest boundary first.
+type ZoneSettings struct {
+	ID                                 uuid.UUID  `json:"-" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID                             uuid.UUID  `json:"-" gorm:"type:uuid;not null;uniqueIndex"`
+	MaxHeartRateBpm                    *int       `json:"max_heart_rate_bpm,omitempty"`
+	RestingHeartRateBpm                *int       `json:"resting_heart_rate_bpm,omitempty"`
+	ThresholdPaceSecondsPerKm          *int       `json:"threshold_pace_seconds_per_km,omitempty"`
+	HeartRateZoneBounds                string     `json:"-" gorm:"type:varchar(50)"`
+	PaceZoneBounds                     string     `json:"-" gorm:"type:varchar(50)"`
+	AutoEstimate                       bool       `json:"auto_estimate" gorm:"default:true"`
+	EstimatedMaxHeartRateBpm           *int       `json:"estimated_max_heart_rate_bpm,omitempty"`
+	EstimatedThresholdPaceSecondsPerKm *int       `json:"estimated_threshold_pace_seconds_per_km,omitempty"`
+	EstimatedAt                        *time.Time `json:"estimated_at,omitempty"`
+	// RecomputeRequestedAt is set when the settings change and cleared once
+	// past runs have been re-bucketed under them.
+	RecomputeRequestedAt *time.Time `json:"recompute_requested_at,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+func (z *ZoneSettings) BeforeCreate(tx *gorm.DB) error {
+	if z.ID == uuid.Nil {
+		z.ID = uuid.New()
+	}
+	z.CreatedAt = time.Now()
+	z.UpdatedAt = time.Now()
+	return nil
+}
+
+func (z *ZoneSettings) BeforeUpdate(tx *gorm.DB) error {
+	z.UpdatedAt = time.Now()
+	return nil
+}
+
+// ZoneSettingsRequest replaces a user's zone settings. Heart rate bounds are
+// four ascending bpm values; pace bounds are four descending seconds-per-km
+// values, i.e. from slowest to fastest.
+type ZoneSettingsRequest struct {
+	MaxHeartRateBpm           *int  `json:"max_heart_rate_bpm,omitempty" validate:"omitempty,min=100,max=230"`
+	RestingHeartRateBpm       *int  `json:"resting_heart_rate_bpm,omitempty" validate:"omitempty,min=25,max=120"`
+	ThresholdPaceSecondsPerKm *int  `json:"threshold_pace_seconds_per_km,omitempty" validate:"omitempty,min=120,max=900"`
+	HeartRateZoneBounds       []int `json:"heart_rate_zone_bounds,omitempty" validate:"omitempty,len=4,dive,min=40,max=230"`
+	PaceZoneBounds            []int `json:"pace_zone_bounds,omitempty" validate:"omitempty,len=4,dive,min=60,max=1500"`
+	AutoEstimate              *bool `json:"auto_estimate,omitempty"`
+}
+
+// RunZoneTime is the time a run spent in one heart rate or pace zone.
+type RunZoneTime struct {
+	ID      uuid.UUID `json:"-" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RunID   uuid.UUID `json:"-" gorm:"type:uuid;not null;uniqueIndex:idx_run_zone_times_run_kind_zone,priority:1"`
+	Kind    string    `json:"kind" gorm:"type:varchar(10);not null;uniqueIndex:idx_run_zone_times_run_kind_zone,priority:2"`
+	Zone    int       `json:"zone" gorm:"not null;uniqueIndex:idx_run_zone_times_run_kind_zone,priority:3"`
+	Seconds float64   `json:"seconds" gorm:"type:decimal(10,2);not null"`
+}
+
+func (z *RunZoneTime) BeforeCreate(tx *gorm.DB) error {
+	if z.ID == uuid.Nil {
+		z.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+// AIEventFilter narrows a run's detection timeline. Zero values match
+// everything.
+type AIEventFilter struct {
+	Types []string
+	From  *time.Time
+	To    *time.Time
+}
+
+type AIEventService struct {
+	db *gorm.DB
+}
+
+func NewAIEventService(db *gorm.DB) *AIEventService {
+	return &AIEventService{db: db}
+}
+
+// BuildAIEvents turns uploaded detections into stored events ordered by time,
+// placing each on the track: the runner's interpolated position, how far along
+// the route it happened and, when the device estimated a distance, where the
+// object itself was.
+func BuildAIEvents(data []models.AIEventData, track []models.WaypointData) []models.AIEvent {
+	if len(data) == 0 {
+		return nil
+	}
+
+	var index *trackIndex
+	if len(track) > 1 {
+		index = newTrackIndex(track)
+	}
+
+	events := make([]models.AIEvent, len(data))
+	for i, d := range data {
+		event := models.AIEvent{
+			Timestamp:      d.Timestamp,
+			Type:           strings.ToLower(strings.TrimSpace(d.Type)),
+			Confidence:     d.Confidence,
+			DistanceMeters: d.DistanceMeters,
+			BearingDegrees: d.BearingDegrees,
+			BoundingBox:    d.BoundingBox,
+			WarningSpoken:  d.WarningSpoken,
+		}
+		if index != nil {
+			locateAIEvent(&event, index)
+		}
+		events[i] = event
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	return events
+}
+
+func locateAIEvent(event *models.AIEvent, index *trackIndex) {
+	distance, seq := index.distanceAtTime(event.Timestamp)
+	lat, lng, heading := index.positionAtTime(event.Timestamp)
+
+	event.Latitude = &lat
+	event.Longitude = &lng
+	routeDistance := round2(distance)
+	event.RouteDistanceMeters = &routeDistance
+	event.WaypointSequence = &seq
+
+	if event.DistanceMeters != nil && heading != nil {
+		bearing := *heading
+		if event.BearingDegrees != nil {
+			bearing += *event.BearingDegrees
+		}
+		objLat, objLng := destinationPoint(lat, lng, bearing, *event.DistanceMeters)
+		event.ObjectLatitude = &objLat
+		event.ObjectLongitude = &objLng
+	}
+}
+
+// positionAtTime interpolates the runner's coordinates at ts and the direction
+// of travel there. The heading comes from the segment being run, falling back
+// to the compass heading reported with the fix when the runner stood still.
+func (t *trackIndex) positionAtTime(ts time.Time) (float64, float64, *float64) {
+	i := sort.Search(len(t.points), func(i int) bool { return !t.points[i].Timestamp.Before(ts) })
+	if i == 0 {
+		i = 1
+		ts = t.points[0].Timestamp
+	}
+	if i >= len(t.points) {
+		i = len(t.points) - 1
+		ts = t.points[i].Timestamp
+	}
+
+	prev, next := t.points[i-1], t.points[i]
+	frac := 0.0
+	if span := next.Timestamp.Sub(prev.Timestamp); span > 0 {
+		frac = float64(ts.Sub(prev.Timestamp)) / float64(span)
+	}
+	lat := prev.Latitude + frac*(next.Latitude-prev.Latitude)
+	lng := prev.Longitude + frac*(next.Longitude-prev.Longitude)
+
+	var heading *float64
+	if t.cumulative[i]-t.cumulative[i-1] > 0.5 {
+		h := initialBearing(prev.Latitude, prev.Longitude, next.Latitude, next.Longitude)
+		heading = &h
+	} else if next.Heading != nil {
+		h := *next.Heading
+		heading = &h
+	}
+	return lat, lng, heading
+}
+
+// SaveEvents stores a run's detections.
+func (s *AIEventService) SaveEvents(tx *gorm.DB, runID uuid.UUID, events []models.AIEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	for i := range events {
+		events[i].RunID = runID
+	}
+	if err := tx.CreateInBatches(events, 500).Error; err != nil {
+		return fmt.Errorf("failed to save AI events: %w", err)
+	}
+	return nil
+}
+
+// ListEvents returns a run's detections in time order with their feedback.
+func (s *AIEventService) ListEvents(runID uuid.UUID, filter AIEventFilter) ([]models.AIEvent, error) {
+	query := s.db.Preload("Feedback").Where("run_id = ?", runID)
+	if len(filter.Types) > 0 {
+		query = query.Where("type IN ?", filter.Types)
+	}
+	if filter.From != nil {
+		query = query.Where("timestamp >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("timestamp <= ?", *filter.To)
+	}
+
+	var events []models.AIEvent
+	if err := query.Order("timestamp ASC").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch AI events: %w", err)
+	}
+	return events, nil
+}
+
+const (
+	DefaultLaneCurveResolutionMeters = 250.0
+	MinLaneCurveResolutionMeters     = 50.0
+	MaxLaneCurveResolutionMeters     = 5000.0
+	maxLaneCurveSamples              = 1000
+)
+
+// LaneKeepingSample summarizes lane keeping over one stretch of the route.
+type LaneKeepingSample struct {
+	FromMeters      float64  `json:"from_meters"`
+	ToMeters        float64  `json:"to_meters"`
+	Seconds         float64  `json:"seconds"`
+	DriftSeconds    float64  `json:"drift_seconds"`
+	InLaneRatio     float64  `json:"in_lane_ratio"`
+	Deviations      int      `json:"deviations"`
+	MaxOffsetMeters *float64 `json:"max_offset_meters,omitempty"`
+}
+
+// BuildLaneEvents turns uploaded lane deviations into stored events ordered by
+// start, placing their start and end on the track.
+func BuildLaneEvents(data []models.LaneEventData, track []models.WaypointData) []models.LaneEvent {
+	if len(data) == 0 {
+		return nil
+	}
+
+	var index *trackIndex
+	if len(track) > 1 {
+		index = newTrackIndex(track)
+	}
+
+	events := make([]models.LaneEvent, len(data))
+	for i, d := range data {
+		event := models.LaneEvent{
+			StartedAt:           d.StartedAt,
+			EndedAt:             d.EndedAt,
+			Direction:           d.Direction,
+			MaxOffsetMeters:     round2(d.MaxOffsetMeters),
+			CorrectionLatencyMs: d.CorrectionLatencyMs,
+		}
+		if index != nil {
+			event.StartLatitude, event.StartLongitude, event.StartDistanceMeters, event.StartWaypointSequence = index.locate(d.StartedAt)
+			event.EndLatitude, event.EndLongitude, event.EndDistanceMeters, event.EndWaypointSequence = index.locate(d.EndedAt)
+		}
+		events[i] = event
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].StartedAt.Before(events[j].StartedAt)
+	})
+	return events
+}
+
+// locate returns the runner's position, distance along the route and the
+// first fix at or after ts, in the shape stored on events.
+func (t *trackIndex) locate(ts time.Time) (*float64, *float64, *float64, *int) {
+	distance, seq := t.distanceAtTime(ts)
+	lat, lng, _ := t.positionAtTime(ts)
+	distance = round2(distance)
+	return &lat, &lng, &distance, &seq
+}
+
+// LaneKeepingCurve splits the route into stretches of resolution meters and
+// reports for each how long the runner spent drifting and how far they
+// strayed. A deviation is counted in the stretch where it started; its drift
+// time is shared between the stretches it spans. The resolution is coarsened
+// for very long runs and the one used is returned.
+func LaneKeepingCurve(track []models.WaypointData, events []models.LaneEvent, resolution float64) ([]LaneKeepingSample, float64) {
+	if len(track) < 2 {
+		return []LaneKeepingSample{}, resolution
+	}
+
+	index := newTrackIndex(track)
+	total := index.total()
+	if total <= 0 {
+		return []LaneKeepingSample{}, resolution
+	}
+	if total/resolution > maxLaneCurveSamples {
+		resolution = math.Ceil(total / maxLaneCurveSamples)
+	}
+
+	samples := make([]LaneKeepingSample, 0, int(total/resolution)+1)
+	for from := 0.0; from < total-0.5; from += resolution {
+		to := math.Min(from+resolution, total)
+		start, _ := index.timeAtDistance(from)
+		end, _ := index.timeAtDistance(to)
+		if to == total {
+			end = track[len(track)-1].Timestamp
+		}
+
+		sample := LaneKeepingSample{
+			FromMeters: round2(from),
+			ToMeters:   round2(to),
+			Seconds:    round2(end.Sub(start).Seconds()),
+		}
+		drift := 0.0
+		for _, e := range events {
+			overlap := minTime(e.EndedAt, end).Sub(maxTime(e.StartedAt, start)).Seconds()
+			if overlap > 0 {
+				drift += overlap
+			}
+			startsHere := !e.StartedAt.Before(start) && (e.StartedAt.Before(end) || (to == total && !e.StartedAt.After(end)))
+			if startsHere {
+				sample.Deviations++
+			}
+			if overlap > 0 || startsHere {
+				if sample.MaxOffsetMeters == nil || e.MaxOffsetMeters > *sample.MaxOffsetMeters {
+					offset := e.MaxOffsetMeters
+					sample.MaxOffsetMeters = &offset
+				}
+			}
+		}
+		sample.DriftSeconds = round2(drift)
+		sample.InLaneRatio = 1
+		if sample.Seconds > 0 {
+			sample.InLaneRatio = round2(math.Max(0, 1-drift/end.Sub(start).Seconds()))
+		}
+		samples = append(samples, sample)
+	}
+	return samples, resolution
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// SaveLaneEvents stores a run's lane deviations.
+func (s *AIEventService) SaveLaneEvents(tx *gorm.DB, runID uuid.UUID, events []models.LaneEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	for i := range events {
+		events[i].RunID = runID
+	}
+	if err := tx.CreateInBatches(events, 500).Error; err != nil {
+		return fmt.Errorf("failed to save lane events: %w", err)
+	}
+	return nil
+}
+
+// ListLaneEvents returns a run's lane deviations in time order.
+func (s *AIEventService) ListLaneEvents(runID uuid.UUID) ([]models.LaneEvent, error) {
+	var events []models.LaneEvent
+	if err := s.db.Where("run_id = ?", runID).Order("started_at ASC").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch lane events: %w", err)
+	}
+	return events, nil
+}
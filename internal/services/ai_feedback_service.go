@@ -0,0 +1,182 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+// aiFeedbackMatchWindow is how long after a warning a button press is still
+// taken as a reaction to it.
+const aiFeedbackMatchWindow = 10 * time.Second
+
+// MatchDeviceFeedback turns feedback button presses logged by the glasses into
+// labels. A correct or false positive press labels the last spoken warning in
+// the preceding ten seconds, or the last detection when none was spoken;
+// presses with nothing to label are dropped and a later press on the same
+// detection replaces an earlier one. A missed press is placed on the track.
+// Events must already be saved so they have IDs.
+func MatchDeviceFeedback(presses []models.AIFeedbackData, events []models.AIEvent, track []models.WaypointData) []models.AIEventFeedback {
+	if len(presses) == 0 {
+		return nil
+	}
+
+	var index *trackIndex
+	if len(track) > 1 {
+		index = newTrackIndex(track)
+	}
+
+	sorted := make([]models.AIFeedbackData, len(presses))
+	copy(sorted, presses)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	var feedback []models.AIEventFeedback
+	labelled := make(map[uuid.UUID]int)
+	for _, press := range sorted {
+		if press.Label == models.AIFeedbackMissed {
+			f := models.AIEventFeedback{
+				Label:     press.Label,
+				Source:    models.AIFeedbackSourceDevice,
+				Timestamp: press.Timestamp,
+			}
+			if index != nil {
+				lat, lng, _ := index.positionAtTime(press.Timestamp)
+				f.Latitude = &lat
+				f.Longitude = &lng
+			}
+			feedback = append(feedback, f)
+			continue
+		}
+
+		event := reactedTo(events, press.Timestamp)
+		if event == nil {
+			continue
+		}
+		f := models.AIEventFeedback{
+			AIEventID: &event.ID,
+			Label:     press.Label,
+			Source:    models.AIFeedbackSourceDevice,
+			Type:      event.Type,
+			Timestamp: event.Timestamp,
+			Latitude:  event.Latitude,
+			Longitude: event.Longitude,
+		}
+		if i, ok := labelled[event.ID]; ok {
+			feedback[i] = f
+			continue
+		}
+		labelled[event.ID] = len(feedback)
+		feedback = append(feedback, f)
+	}
+	return feedback
+}
+
+// reactedTo finds the detection a press at ts judges among events sorted by
+// time.
+func reactedTo(events []models.AIEvent, ts time.Time) *models.AIEvent {
+	i := sort.Search(len(events), func(i int) bool { return events[i].Timestamp.After(ts) })
+
+	var latest *models.AIEvent
+	for j := i - 1; j >= 0 && ts.Sub(events[j].Timestamp) <= aiFeedbackMatchWindow; j-- {
+		if events[j].WarningSpoken {
+			return &events[j]
+		}
+		if latest == nil {
+			latest = &events[j]
+		}
+	}
+	return latest
+}
+
+// SaveFeedback stores labels logged by the glasses with a run.
+func (s *AIEventService) SaveFeedback(tx *gorm.DB, runID uuid.UUID, feedback []models.AIEventFeedback) error {
+	if len(feedback) == 0 {
+		return nil
+	}
+	for i := range feedback {
+		feedback[i].RunID = runID
+	}
+	if err := tx.CreateInBatches(feedback, 500).Error; err != nil {
+		return fmt.Errorf("failed to save AI feedback: %w", err)
+	}
+	return nil
+}
+
+// Label records feedback given in the app. A label on a detection replaces
+// any earlier one, including the glasses'. A missed obstacle is placed on the
+// track unless the app gave its position.
+func (s *AIEventService) Label(runID uuid.UUID, req *models.AIFeedbackRequest, track []models.WaypointData) (*models.AIEventFeedback, error) {
+	feedback := models.AIEventFeedback{
+		RunID:  runID,
+		Label:  req.Label,
+		Source: models.AIFeedbackSourceApp,
+		Note:   strings.TrimSpace(req.Note),
+	}
+
+	if req.Label == models.AIFeedbackMissed {
+		feedback.Type = strings.ToLower(strings.TrimSpace(req.Type))
+		feedback.Timestamp = *req.Timestamp
+		feedback.Latitude, feedback.Longitude = req.Latitude, req.Longitude
+		if feedback.Latitude == nil && len(track) > 1 {
+			lat, lng, _ := newTrackIndex(track).positionAtTime(feedback.Timestamp)
+			feedback.Latitude, feedback.Longitude = &lat, &lng
+		}
+		if err := s.db.Create(&feedback).Error; err != nil {
+			return nil, fmt.Errorf("failed to save AI feedback: %w", err)
+		}
+		return &feedback, nil
+	}
+
+	var event models.AIEvent
+	if err := s.db.Where("id = ? AND run_id = ?", *req.AIEventID, runID).First(&event).Error; err != nil {
+		return nil, err
+	}
+	feedback.AIEventID = &event.ID
+	feedback.Type = event.Type
+	feedback.Timestamp = event.Timestamp
+	feedback.Latitude, feedback.Longitude = event.Latitude, event.Longitude
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "ai_event_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"label", "source", "note", "updated_at"}),
+	}).Create(&feedback).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to save AI feedback: %w", err)
+	}
+
+	var stored models.AIEventFeedback
+	if err := s.db.Where("ai_event_id = ?", event.ID).First(&stored).Error; err != nil {
+		return nil, fmt.Errorf("failed to load AI feedback: %w", err)
+	}
+	return &stored, nil
+}
+
+// ListFeedback returns a run's labels in time order.
+func (s *AIEventService) ListFeedback(runID uuid.UUID) ([]models.AIEventFeedback, error) {
+	var feedback []models.AIEventFeedback
+	if err := s.db.Where("run_id = ?", runID).Order("timestamp ASC").Find(&feedback).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch AI feedback: %w", err)
+	}
+	return feedback, nil
+}
+
+// DeleteFeedback removes a label from a run.
+func (s *AIEventService) DeleteFeedback(runID, feedbackID uuid.UUID) error {
+	result := s.db.Where("id = ? AND run_id = ?", feedbackID, runID).Delete(&models.AIEventFeedback{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete AI feedback: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+// AIModelFilter narrows the runs compared across models. Zero values match
+// everything.
+type AIModelFilter struct {
+	From            *time.Time
+	To              *time.Time
+	ModelName       string
+	HardwareVersion string
+}
+
+// AIModelComparison is one model on one hardware version, aggregated over the
+// runs it processed. Rates are only computed over runs that reported what
+// they need, and are nil when no run did.
+type AIModelComparison struct {
+	ModelID         uuid.UUID `json:"model_id"`
+	Name            string    `json:"name"`
+	Version         string    `json:"version"`
+	Quantization    string    `json:"quantization"`
+	HardwareVersion string    `json:"hardware_version"`
+	Runs            int64     `json:"runs"`
+	Devices         int64     `json:"devices"`
+	Frames          int64     `json:"frames"`
+	Detections      int64     `json:"detections"`
+	Warnings        int64     `json:"warnings"`
+	// AvgInferenceMs weights each run's average by its frame count, falling
+	// back to the plain mean of run averages when frames were not reported.
+	AvgInferenceMs        *float64 `json:"avg_inference_ms,omitempty"`
+	MinInferenceMs        *float64 `json:"min_inference_ms,omitempty"`
+	MaxInferenceMs        *float64 `json:"max_inference_ms,omitempty"`
+	DetectionsPer1kFrames *float64 `json:"detections_per_1k_frames,omitempty"`
+	DetectionsPerKm       *float64 `json:"detections_per_km,omitempty"`
+	WarningsPerDetection  *float64 `json:"warnings_per_detection,omitempty"`
+}
+
+// AIModelUsage is the raw aggregate behind an AIModelComparison.
+type AIModelUsage struct {
+	ModelID           uuid.UUID
+	Name              string
+	Version           string
+	Quantization      string
+	HardwareVersion   string
+	Runs              int64
+	Devices           int64
+	Frames            int64
+	Detections        int64
+	Warnings          int64
+	WeightedInference *float64
+	InferenceFrames   *float64
+	MeanInference     *float64
+	MinInference      *float64
+	MaxInference      *float64
+	DetectionFrames   *float64
+	DetectionMeters   *float64
+}
+
+// aiModelSeenInterval is how stale a model's last_seen_at may get before an
+// upload refreshes it. Every upload naming the model would otherwise update
+// the same row and queue behind each other's transactions.
+const aiModelSeenInterval = time.Hour
+
+type AIModelService struct {
+	db *gorm.DB
+}
+
+func NewAIModelService(db *gorm.DB) *AIModelService {
+	return &AIModelService{db: db}
+}
+
+// Resolve returns the registry entry for a reported model, registering it the
+// first time it is seen. It is safe to call inside an upload transaction:
+// concurrent first reports of the same model do not conflict, and last seen
+// is only moved forward once per aiModelSeenInterval.
+func (s *AIModelService) Resolve(tx *gorm.DB, info *models.AIModelInfo) (*models.AIModel, error) {
+	now := time.Now()
+	stored, err := s.register(tx, info, now)
+	if err != nil {
+		return nil, err
+	}
+	stale := now.Add(-aiModelSeenInterval)
+	if stored.LastSeenAt.Before(stale) {
+		err := tx.Model(&models.AIModel{}).
+			Where("id = ? AND last_seen_at < ?", stored.ID, stale).
+			Update("last_seen_at", now).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to update AI model: %w", err)
+		}
+		stored.LastSeenAt = now
+	}
+	return stored, nil
+}
+
+// register returns the registry entry for a model, creating it if needed.
+func (s *AIModelService) register(tx *gorm.DB, info *models.AIModelInfo, now time.Time) (*models.AIModel, error) {
+	model := models.AIModel{
+		Name:         strings.TrimSpace(info.Name),
+		Version:      strings.TrimSpace(info.Version),
+		Quantization: strings.ToLower(strings.TrimSpace(info.Quantization)),
+		FirstSeenAt:  now,
+		LastSeenAt:   now,
+	}
+
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to register AI model: %w", err)
+	}
+
+	var stored models.AIModel
+	err = tx.Where("name = ? AND version = ? AND quantization = ?", model.Name, model.Version, model.Quantization).
+		First(&stored).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AI model: %w", err)
+	}
+	return &stored, nil
+}
+
+// List returns the model registry, most recently seen first.
+func (s *AIModelService) List() ([]models.AIModel, error) {
+	var registry []models.AIModel
+	if err := s.db.Order("last_seen_at DESC").Find(&registry).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch AI models: %w", err)
+	}
+	return registry, nil
+}
+
+// aiModelUsageColumns aggregates ai_metrics joined with runs into the fields
+// of AIModelUsage.
+const aiModelUsageColumns = `COUNT(*) AS runs,
+	COUNT(DISTINCT runs.device_id) AS devices,
+	COALESCE(SUM(ai_metrics.total_frames_processed), 0) AS frames,
+	COALESCE(SUM(ai_metrics.total_obstacles_detected), 0) AS detections,
+	COALESCE(SUM(ai_metrics.total_warnings_issued), 0) AS warnings,
+	SUM(ai_metrics.avg_inference_time_ms * ai_metrics.total_frames_processed) AS weighted_inference,
+	SUM(CASE WHEN ai_metrics.avg_inference_time_ms IS NOT NULL THEN ai_metrics.total_frames_processed END) AS inference_frames,
+	AVG(ai_metrics.avg_inference_time_ms) AS mean_inference,
+	MIN(ai_metrics.min_inference_time_ms) AS min_inference,
+	MAX(ai_metrics.max_inference_time_ms) AS max_inference,
+	SUM(CASE WHEN ai_metrics.total_obstacles_detected IS NOT NULL THEN ai_metrics.total_frames_processed END) AS detection_frames,
+	SUM(CASE WHEN ai_metrics.total_obstacles_detected IS NOT NULL THEN COALESCE(runs.computed_distance_meters, runs.distance_meters) END) AS detection_meters`
+
+// Compare aggregates AI metrics per model and hardware version across every
+// user's runs.
+func (s *AIModelService) Compare(filter AIModelFilter) ([]AIModelComparison, error) {
+	query := s.db.Table("ai_metrics").
+		Select("ai_metrics.model_id, ai_models.name, ai_models.version, ai_models.quantization, ai_metrics.hardware_version, " + aiModelUsageColumns).
+		Joins("JOIN ai_models ON ai_models.id = ai_metrics.model_id").
+		Joins("JOIN runs ON runs.id = ai_metrics.run_id")
+
+	var usage []AIModelUsage
+	err := applyAIModelFilter(query, filter).
+		Group("ai_metrics.model_id, ai_models.name, ai_models.version, ai_models.quantization, ai_metrics.hardware_version").
+		Order("ai_models.name, ai_models.version, ai_models.quantization, ai_metrics.hardware_version").
+		Scan(&usage).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare AI models: %w", err)
+	}
+
+	comparisons := make([]AIModelComparison, len(usage))
+	for i := range usage {
+		comparisons[i] = CompareAIModelUsage(usage[i])
+	}
+	return comparisons, nil
+}
+
+// applyAIModelFilter narrows a query joining ai_metrics, ai_models and runs.
+func applyAIModelFilter(query *gorm.DB, filter AIModelFilter) *gorm.DB {
+	if filter.From != nil {
+		query = query.Where("runs.started_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("runs.started_at < ?", *filter.To)
+	}
+	if filter.ModelName != "" {
+		query = query.Where("ai_models.name = ?", filter.ModelName)
+	}
+	if filter.HardwareVersion != "" {
+		query = query.Where("ai_metrics.hardware_version = ?", filter.HardwareVersion)
+	}
+	return query
+}
+
+// CompareAIModelUsage derives the comparison rates from an aggregate.
+func CompareAIModelUsage(u AIModelUsage) AIModelComparison {
+	c := AIModelComparison{
+		ModelID:         u.ModelID,
+		Name:            u.Name,
+		Version:         u.Version,
+		Quantization:    u.Quantization,
+		HardwareVersion: u.HardwareVersion,
+		Runs:            u.Runs,
+		Devices:         u.Devices,
+		Frames:          u.Frames,
+		Detections:      u.Detections,
+		Warnings:        u.Warnings,
+		MinInferenceMs:  roundPtr(u.MinInference),
+		MaxInferenceMs:  roundPtr(u.MaxInference),
+	}
+
+	if u.WeightedInference != nil && u.InferenceFrames != nil && *u.InferenceFrames > 0 {
+		avg := round2(*u.WeightedInference / *u.InferenceFrames)
+		c.AvgInferenceMs = &avg
+	} else {
+		c.AvgInferenceMs = roundPtr(u.MeanInference)
+	}
+
+	if u.DetectionFrames != nil && *u.DetectionFrames > 0 {
+		rate := round2(float64(u.Detections) / *u.DetectionFrames * 1000)
+		c.DetectionsPer1kFrames = &rate
+	}
+	if u.DetectionMeters != nil && *u.DetectionMeters > 0 {
+		rate := round2(float64(u.Detections) / (*u.DetectionMeters / 1000))
+		c.DetectionsPerKm = &rate
+	}
+	if u.Detections > 0 {
+		rate := round2(float64(u.Warnings) / float64(u.Detections))
+		c.WarningsPerDetection = &rate
+	}
+	return c
+}
+
+func roundPtr(v *float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	r := round2(*v)
+	return &r
+}
+
+// AIFeedbackUsage counts the labels runners gave one model's detections of
+// one class.
+type AIFeedbackUsage struct {
+	ModelID        uuid.UUID
+	Name           string
+	Version        string
+	Quantization   string
+	Type           string
+	Correct        int64
+	FalsePositives int64
+	Missed         int64
+}
+
+// AIFeedbackCounts are the labels behind a precision estimate. Precision is
+// the share of labelled detections runners confirmed, with a 95% Wilson
+// interval; it is nil until a detection was labelled. Missed obstacles do not
+// affect precision and are reported alongside.
+type AIFeedbackCounts struct {
+	Correct        int64    `json:"correct"`
+	FalsePositives int64    `json:"false_positives"`
+	Missed         int64    `json:"missed"`
+	Precision      *float64 `json:"precision,omitempty"`
+	PrecisionLow   *float64 `json:"precision_low,omitempty"`
+	PrecisionHigh  *float64 `json:"precision_high,omitempty"`
+}
+
+type AIClassPrecision struct {
+	Type string `json:"type"`
+	AIFeedbackCounts
+}
+
+type AIModelPrecision struct {
+	ModelID      uuid.UUID `json:"model_id"`
+	Name         string    `json:"name"`
+	Version      string    `json:"version"`
+	Quantization string    `json:"quantization"`
+	AIFeedbackCounts
+	Classes []AIClassPrecision `json:"classes"`
+}
+
+// Precision estimates each model's precision from runner feedback, overall
+// and per detected class.
+func (s *AIModelService) Precision(filter AIModelFilter) ([]AIModelPrecision, error) {
+	query := s.db.Table("ai_event_feedbacks").
+		Select(`ai_models.id AS model_id, ai_models.name, ai_models.version, ai_models.quantization, ai_event_feedbacks.type,
+			SUM(CASE WHEN ai_event_feedbacks.label = ? THEN 1 ELSE 0 END) AS correct,
+			SUM(CASE WHEN ai_event_feedbacks.label = ? THEN 1 ELSE 0 END) AS false_positives,
+			SUM(CASE WHEN ai_event_feedbacks.label = ? THEN 1 ELSE 0 END) AS missed`,
+			models.AIFeedbackCorrect, models.AIFeedbackFalsePositive, models.AIFeedbackMissed).
+		Joins("JOIN ai_metrics ON ai_metrics.run_id = ai_event_feedbacks.run_id").
+		Joins("JOIN ai_models ON ai_models.id = ai_metrics.model_id").
+		Joins("JOIN runs ON runs.id = ai_event_feedbacks.run_id")
+
+	var usage []AIFeedbackUsage
+	err := applyAIModelFilter(query, filter).
+		Group("ai_models.id, ai_models.name, ai_models.version, ai_models.quantization, ai_event_feedbacks.type").
+		Order("ai_models.name, ai_models.version, ai_models.quantization, ai_event_feedbacks.type").
+		Scan(&usage).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate AI feedback: %w", err)
+	}
+	return RollupAIFeedback(usage), nil
+}
+
+// RollupAIFeedback groups per-class label counts by model, keeping the order
+// of first appearance. Missed obstacles reported without a class are counted
+// as "unspecified".
+func RollupAIFeedback(usage []AIFeedbackUsage) []AIModelPrecision {
+	rollup := []AIModelPrecision{}
+	byModel := make(map[uuid.UUID]int)
+	for _, u := range usage {
+		i, ok := byModel[u.ModelID]
+		if !ok {
+			i = len(rollup)
+			byModel[u.ModelID] = i
+			rollup = append(rollup, AIModelPrecision{
+				ModelID:      u.ModelID,
+				Name:         u.Name,
+				Version:      u.Version,
+				Quantization: u.Quantization,
+				Classes:      []AIClassPrecision{},
+			})
+		}
+		m := &rollup[i]
+		m.Correct += u.Correct
+		m.FalsePositives += u.FalsePositives
+		m.Missed += u.Missed
+
+		class := u.Type
+		if class == "" {
+			class = "unspecified"
+		}
+		m.Classes = append(m.Classes, AIClassPrecision{
+			Type:             class,
+			AIFeedbackCounts: feedbackCounts(u.Correct, u.FalsePositives, u.Missed),
+		})
+	}
+	for i := range rollup {
+		m := &rollup[i]
+		m.AIFeedbackCounts = feedbackCounts(m.Correct, m.FalsePositives, m.Missed)
+	}
+	return rollup
+}
+
+func feedbackCounts(correct, falsePositives, missed int64) AIFeedbackCounts {
+	counts := AIFeedbackCounts{Correct: correct, FalsePositives: falsePositives, Missed: missed}
+	if n := correct + falsePositives; n > 0 {
+		p, low, high := wilsonInterval(correct, n)
+		counts.Precision, counts.PrecisionLow, counts.PrecisionHigh = &p, &low, &high
+	}
+	return counts
+}
+
+// wilsonInterval returns the observed proportion of successes in n trials and
+// its 95% Wilson score interval, which stays sensible for small samples.
+func wilsonInterval(successes, n int64) (float64, float64, float64) {
+	const z = 1.96
+	p := float64(successes) / float64(n)
+	nf := float64(n)
+	denom := 1 + z*z/nf
+	center := (p + z*z/(2*nf)) / denom
+	margin := z * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf)) / denom
+	return round3(p), round3(math.Max(0, center-margin)), round3(math.Min(1, center+margin))
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,624 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/utils"
+)
+
+const (
+	DefaultRolloutMinRuns                   = 20
+	DefaultRolloutMaxInferenceRegressionPct = 20.0
+	DefaultRolloutMaxDetectionDropPct       = 25.0
+	maxRolloutReports                       = 50
+)
+
+var (
+	// ErrRolloutActive is returned when starting a rollout while another one
+	// is still active.
+	ErrRolloutActive = errors.New("another rollout is active")
+	// ErrRolloutEnded is returned when changing a completed or rolled back
+	// rollout.
+	ErrRolloutEnded = errors.New("rollout already ended")
+	// ErrRolloutBaseline is returned when a rollout's baseline is the
+	// candidate itself.
+	ErrRolloutBaseline = errors.New("baseline must differ from the candidate model")
+)
+
+// AIModelCheck tells a device which model it should run. Model and Artifact
+// are nil when nothing is assigned to the device or no build of its model
+// fits the device's hardware and firmware.
+type AIModelCheck struct {
+	UpdateAvailable bool                    `json:"update_available"`
+	Model           *models.AIModel         `json:"model"`
+	Artifact        *models.AIModelArtifact `json:"artifact"`
+	Cohort          string                  `json:"cohort,omitempty"`
+	RolloutID       *uuid.UUID              `json:"rollout_id,omitempty"`
+	// Revert tells a device running a rolled back model that no build can
+	// replace it, so it should go back to the model it ran before.
+	Revert bool `json:"revert,omitempty"`
+}
+
+// AIRolloutReport is a rollout with each cohort's metrics on its model since
+// the rollout started. Cohorts are the devices currently assigned through the
+// rollout, so reports of ended rollouts shrink as devices move on.
+type AIRolloutReport struct {
+	models.AIModelRollout
+	Candidate AIModelComparison  `json:"candidate"`
+	Control   *AIModelComparison `json:"control,omitempty"`
+}
+
+// PublishArtifact adds a build to the catalog.
+func (s *AIModelService) PublishArtifact(req *models.AIModelArtifactRequest) (*models.AIModelArtifact, error) {
+	var artifact models.AIModelArtifact
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		model, err := s.register(tx, &req.Model, time.Now())
+		if err != nil {
+			return err
+		}
+
+		hardware := make([]string, 0, len(req.HardwareVersions))
+		for _, v := range req.HardwareVersions {
+			hardware = append(hardware, strings.TrimSpace(v))
+		}
+		artifact = models.AIModelArtifact{
+			ModelID:            model.ID,
+			URL:                req.URL,
+			SizeBytes:          req.SizeBytes,
+			SHA256:             strings.ToLower(req.SHA256),
+			Signature:          req.Signature,
+			HardwareVersions:   hardware,
+			MinFirmwareVersion: strings.TrimSpace(req.MinFirmwareVersion),
+		}
+		if err := tx.Create(&artifact).Error; err != nil {
+			return fmt.Errorf("failed to save model artifact: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &artifact, nil
+}
+
+// ListArtifacts returns the catalog, newest first, optionally for one model.
+func (s *AIModelService) ListArtifacts(modelID *uuid.UUID) ([]models.AIModelArtifact, error) {
+	query := s.db.Order("created_at DESC")
+	if modelID != nil {
+		query = query.Where("model_id = ?", *modelID)
+	}
+
+	var artifacts []models.AIModelArtifact
+	if err := query.Find(&artifacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch model artifacts: %w", err)
+	}
+	return artifacts, nil
+}
+
+// StartRollout stages a candidate model. Missing thresholds take the
+// defaults.
+func (s *AIModelService) StartRollout(req *models.AIModelRolloutRequest) (*models.AIModelRollout, error) {
+	rollout := models.AIModelRollout{
+		ModelID:                   req.ModelID,
+		BaselineModelID:           req.BaselineModelID,
+		Percentage:                req.Percentage,
+		Status:                    models.AIRolloutStatusActive,
+		MinRuns:                   DefaultRolloutMinRuns,
+		MaxInferenceRegressionPct: DefaultRolloutMaxInferenceRegressionPct,
+		MaxDetectionDropPct:       DefaultRolloutMaxDetectionDropPct,
+		StartedAt:                 time.Now(),
+	}
+	if req.MinRuns != nil {
+		rollout.MinRuns = *req.MinRuns
+	}
+	if req.MaxInferenceRegressionPct != nil {
+		rollout.MaxInferenceRegressionPct = *req.MaxInferenceRegressionPct
+	}
+	if req.MaxDetectionDropPct != nil {
+		rollout.MaxDetectionDropPct = *req.MaxDetectionDropPct
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var active int64
+		if err := tx.Model(&models.AIModelRollout{}).Where("status = ?", models.AIRolloutStatusActive).Count(&active).Error; err != nil {
+			return fmt.Errorf("failed to check rollouts: %w", err)
+		}
+		if active > 0 {
+			return ErrRolloutActive
+		}
+
+		if err := tx.First(&models.AIModel{}, "id = ?", rollout.ModelID).Error; err != nil {
+			return err
+		}
+		if rollout.BaselineModelID == nil {
+			var previous models.AIModelRollout
+			err := tx.Order("started_at DESC").First(&previous).Error
+			if err != nil && err != gorm.ErrRecordNotFound {
+				return fmt.Errorf("failed to load previous rollout: %w", err)
+			}
+			if err == nil {
+				rollout.BaselineModelID, _ = RolloutTarget(&previous, "")
+			}
+		} else if err := tx.First(&models.AIModel{}, "id = ?", *rollout.BaselineModelID).Error; err != nil {
+			return err
+		}
+		if rollout.BaselineModelID != nil && *rollout.BaselineModelID == rollout.ModelID {
+			return ErrRolloutBaseline
+		}
+
+		// The partial unique index on active rollouts settles two starts
+		// racing past the check above
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rollout)
+		if result.Error != nil {
+			return fmt.Errorf("failed to start rollout: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrRolloutActive
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.loadRollout(rollout.ID)
+}
+
+// UpdateRollout resizes the candidate cohort of an active rollout, completes
+// it or rolls it back. The change only applies while the rollout is still
+// active, so it cannot undo an automatic rollback that got there first.
+func (s *AIModelService) UpdateRollout(rolloutID uuid.UUID, req *models.AIModelRolloutUpdateRequest) (*models.AIModelRollout, error) {
+	updates := map[string]interface{}{}
+	if req.Percentage != nil {
+		updates["percentage"] = *req.Percentage
+	}
+	if req.Status != "" {
+		updates["status"] = req.Status
+		updates["ended_at"] = time.Now()
+		if req.Status == models.AIRolloutStatusRolledBack {
+			reason := req.Reason
+			if reason == "" {
+				reason = "rolled back manually"
+			}
+			updates["rollback_reason"] = reason
+		}
+	}
+
+	if len(updates) > 0 {
+		result := s.db.Model(&models.AIModelRollout{}).
+			Where("id = ? AND status = ?", rolloutID, models.AIRolloutStatusActive).
+			Updates(updates)
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to update rollout: %w", result.Error)
+		}
+		if result.RowsAffected > 0 {
+			return s.loadRollout(rolloutID)
+		}
+	}
+
+	var rollout models.AIModelRollout
+	if err := s.db.Where("id = ?", rolloutID).First(&rollout).Error; err != nil {
+		return nil, err
+	}
+	if rollout.Status != models.AIRolloutStatusActive {
+		return nil, ErrRolloutEnded
+	}
+	return s.loadRollout(rollout.ID)
+}
+
+func (s *AIModelService) loadRollout(rolloutID uuid.UUID) (*models.AIModelRollout, error) {
+	var rollout models.AIModelRollout
+	if err := s.db.Preload("Model").Preload("BaselineModel").Where("id = ?", rolloutID).First(&rollout).Error; err != nil {
+		return nil, fmt.Errorf("failed to load rollout: %w", err)
+	}
+	return &rollout, nil
+}
+
+// ListRollouts returns recent rollouts, newest first, with their cohorts'
+// metrics.
+func (s *AIModelService) ListRollouts() ([]AIRolloutReport, error) {
+	var rollouts []models.AIModelRollout
+	err := s.db.Preload("Model").Preload("BaselineModel").
+		Order("started_at DESC").
+		Limit(maxRolloutReports).
+		Find(&rollouts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rollouts: %w", err)
+	}
+
+	reports := make([]AIRolloutReport, len(rollouts))
+	for i := range rollouts {
+		report, err := s.rolloutReport(s.db, &rollouts[i])
+		if err != nil {
+			return nil, err
+		}
+		reports[i] = *report
+	}
+	return reports, nil
+}
+
+func (s *AIModelService) rolloutReport(db *gorm.DB, rollout *models.AIModelRollout) (*AIRolloutReport, error) {
+	report := AIRolloutReport{AIModelRollout: *rollout}
+
+	candidate, err := s.cohortUsage(db, rollout, models.AICohortCandidate, rollout.ModelID)
+	if err != nil {
+		return nil, err
+	}
+	report.Candidate = CompareAIModelUsage(candidate)
+
+	if rollout.BaselineModelID != nil {
+		control, err := s.cohortUsage(db, rollout, models.AICohortControl, *rollout.BaselineModelID)
+		if err != nil {
+			return nil, err
+		}
+		comparison := CompareAIModelUsage(control)
+		report.Control = &comparison
+	}
+	return &report, nil
+}
+
+// cohortUsage aggregates the AI metrics of runs a rollout's cohort made on
+// its model while the rollout ran.
+func (s *AIModelService) cohortUsage(db *gorm.DB, rollout *models.AIModelRollout, cohort string, modelID uuid.UUID) (AIModelUsage, error) {
+	devices := db.Model(&models.AIModelAssignment{}).
+		Select("device_id").
+		Where("rollout_id = ? AND cohort = ?", rollout.ID, cohort)
+
+	query := db.Table("ai_metrics").
+		Select("ai_models.id AS model_id, ai_models.name, ai_models.version, ai_models.quantization, "+aiModelUsageColumns).
+		Joins("JOIN ai_models ON ai_models.id = ai_metrics.model_id").
+		Joins("JOIN runs ON runs.id = ai_metrics.run_id").
+		Where("ai_metrics.model_id = ?", modelID).
+		Where("runs.device_id IN (?)", devices).
+		Where("runs.started_at >= ?", rollout.StartedAt)
+	if rollout.EndedAt != nil {
+		query = query.Where("runs.started_at < ?", *rollout.EndedAt)
+	}
+
+	var usage []AIModelUsage
+	if err := query.Group("ai_models.id, ai_models.name, ai_models.version, ai_models.quantization").Scan(&usage).Error; err != nil {
+		return AIModelUsage{}, fmt.Errorf("failed to aggregate %s cohort: %w", cohort, err)
+	}
+	if len(usage) == 0 {
+		return AIModelUsage{ModelID: modelID}, nil
+	}
+	return usage[0], nil
+}
+
+// EvaluateRollout compares the candidate cohort against control and returns
+// why the rollout should be rolled back, if it regressed. Nothing is decided
+// until both cohorts have MinRuns runs.
+func EvaluateRollout(rollout *models.AIModelRollout, candidate, control AIModelComparison) (string, bool) {
+	if candidate.Runs < int64(rollout.MinRuns) || control.Runs < int64(rollout.MinRuns) {
+		return "", false
+	}
+
+	if candidate.AvgInferenceMs != nil && control.AvgInferenceMs != nil && *control.AvgInferenceMs > 0 {
+		increase := (*candidate.AvgInferenceMs - *control.AvgInferenceMs) / *control.AvgInferenceMs * 100
+		if increase > rollout.MaxInferenceRegressionPct {
+			return fmt.Sprintf("average inference %.1f ms vs %.1f ms on control (+%.0f%%)",
+				*candidate.AvgInferenceMs, *control.AvgInferenceMs, increase), true
+		}
+	}
+	if candidate.DetectionsPer1kFrames != nil && control.DetectionsPer1kFrames != nil && *control.DetectionsPer1kFrames > 0 {
+		drop := (*control.DetectionsPer1kFrames - *candidate.DetectionsPer1kFrames) / *control.DetectionsPer1kFrames * 100
+		if drop > rollout.MaxDetectionDropPct {
+			return fmt.Sprintf("%.1f detections per 1k frames vs %.1f on control (-%.0f%%)",
+				*candidate.DetectionsPer1kFrames, *control.DetectionsPer1kFrames, drop), true
+		}
+	}
+	return "", false
+}
+
+// CheckRollouts rolls back the active rollout when its candidate cohort
+// regressed against control. It runs as a background job.
+func (s *AIModelService) CheckRollouts(ctx context.Context) error {
+	db := s.db.WithContext(ctx)
+
+	var rollouts []models.AIModelRollout
+	err := db.Where("status = ? AND baseline_model_id IS NOT NULL", models.AIRolloutStatusActive).Find(&rollouts).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch active rollouts: %w", err)
+	}
+
+	for i := range rollouts {
+		rollout := &rollouts[i]
+		report, err := s.rolloutReport(db, rollout)
+		if err != nil {
+			return err
+		}
+		reason, regressed := EvaluateRollout(rollout, report.Candidate, *report.Control)
+		if !regressed {
+			continue
+		}
+
+		now := time.Now()
+		err = db.Model(rollout).Where("status = ?", models.AIRolloutStatusActive).Updates(map[string]interface{}{
+			"status":          models.AIRolloutStatusRolledBack,
+			"rollback_reason": reason,
+			"ended_at":        now,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to roll back rollout: %w", err)
+		}
+		utils.Warn("AI model rollout rolled back",
+			zap.String("rollout_id", rollout.ID.String()),
+			zap.String("reason", reason),
+		)
+	}
+	return nil
+}
+
+// RolloutCohort places a device in a rollout's candidate or control cohort.
+// The split is a stable hash of the device and rollout, so raising the
+// percentage only moves control devices to the candidate.
+func RolloutCohort(rolloutID uuid.UUID, deviceID string, percentage int) string {
+	h := fnv.New32a()
+	h.Write(rolloutID[:])
+	h.Write([]byte(deviceID))
+	if int(h.Sum32()%100) < percentage {
+		return models.AICohortCandidate
+	}
+	return models.AICohortControl
+}
+
+// RolloutTarget returns the model a rollout puts a device on and its cohort.
+// The model is nil for control devices when the rollout has no baseline.
+func RolloutTarget(rollout *models.AIModelRollout, deviceID string) (*uuid.UUID, string) {
+	switch rollout.Status {
+	case models.AIRolloutStatusCompleted:
+		return &rollout.ModelID, models.AICohortCandidate
+	case models.AIRolloutStatusRolledBack:
+		return rollout.BaselineModelID, models.AICohortControl
+	}
+	if RolloutCohort(rollout.ID, deviceID, rollout.Percentage) == models.AICohortCandidate {
+		return &rollout.ModelID, models.AICohortCandidate
+	}
+	return rollout.BaselineModelID, models.AICohortControl
+}
+
+// SelectArtifact picks the first build that runs on the given hardware and
+// firmware. Artifacts are expected newest first.
+func SelectArtifact(artifacts []models.AIModelArtifact, hardwareVersion, firmwareVersion string) *models.AIModelArtifact {
+	for i := range artifacts {
+		a := &artifacts[i]
+		if len(a.HardwareVersions) > 0 {
+			supported := false
+			for _, v := range a.HardwareVersions {
+				if strings.EqualFold(v, hardwareVersion) {
+					supported = true
+					break
+				}
+			}
+			if !supported {
+				continue
+			}
+		}
+		if a.MinFirmwareVersion != "" && (firmwareVersion == "" || CompareVersions(firmwareVersion, a.MinFirmwareVersion) < 0) {
+			continue
+		}
+		return a
+	}
+	return nil
+}
+
+// CompareVersions orders dotted version strings such as "1.10.2" or
+// "v2.0.0-rc1" numerically, ignoring pre-release and build suffixes. It
+// returns -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []int {
+	v = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(v)), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+
+	var parts []int
+	for _, field := range strings.Split(v, ".") {
+		end := 0
+		for end < len(field) && field[end] >= '0' && field[end] <= '9' {
+			end++
+		}
+		n, _ := strconv.Atoi(field[:end])
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// CheckForDevice decides which model a device should run: its pinned model,
+// otherwise what the latest rollout assigns it. The assignment is recorded so
+// cohort metrics can be compared. A device left on a rolled back model that
+// the rollout cannot replace, because there is no baseline or no baseline
+// build for its hardware, is sent back to the model it ran before.
+func (s *AIModelService) CheckForDevice(device *models.Device) (*AIModelCheck, error) {
+	var assignment models.AIModelAssignment
+	err := s.db.Where("device_id = ?", device.DeviceID).First(&assignment).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to load model assignment: %w", err)
+	}
+	assigned := err == nil
+
+	check := &AIModelCheck{}
+	var target *uuid.UUID
+	if assigned && assignment.Cohort == models.AICohortPinned {
+		target = &assignment.ModelID
+		check.Cohort = models.AICohortPinned
+	} else {
+		var rollout models.AIModelRollout
+		err := s.db.Order("started_at DESC").First(&rollout).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("failed to load rollout: %w", err)
+		}
+		if err == nil {
+			target, check.Cohort = RolloutTarget(&rollout, device.DeviceID)
+			check.RolloutID = &rollout.ID
+		}
+	}
+
+	model, artifact, err := s.buildForDevice(target, device)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil && check.Cohort != models.AICohortPinned {
+		rolledBack, err := s.runsRolledBackModel(device)
+		if err != nil {
+			return nil, err
+		}
+		if rolledBack {
+			if assigned && assignment.PreviousModelID != nil && *assignment.PreviousModelID != *device.CurrentModelID {
+				model, artifact, err = s.buildForDevice(assignment.PreviousModelID, device)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if model == nil {
+				check.UpdateAvailable = true
+				check.Revert = true
+				return check, nil
+			}
+			check.Cohort = models.AICohortControl
+		}
+	}
+	if model == nil {
+		// The device keeps what it runs until a build fits it
+		return &AIModelCheck{}, nil
+	}
+	check.Model = model
+	check.Artifact = artifact
+	check.UpdateAvailable = device.CurrentModelID == nil || *device.CurrentModelID != model.ID
+
+	if check.Cohort != models.AICohortPinned {
+		unchanged := assigned && assignment.ModelID == model.ID && assignment.Cohort == check.Cohort &&
+			assignment.RolloutID != nil && *assignment.RolloutID == *check.RolloutID
+		if !unchanged {
+			// Remember what the device ran before, unless it keeps running it
+			var previous *uuid.UUID
+			if assigned {
+				previous = assignment.PreviousModelID
+			}
+			if device.CurrentModelID != nil && *device.CurrentModelID != model.ID {
+				previous = device.CurrentModelID
+			}
+			err := s.db.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "device_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"model_id", "rollout_id", "cohort", "previous_model_id", "assigned_at"}),
+			}).Create(&models.AIModelAssignment{
+				DeviceID:        device.DeviceID,
+				ModelID:         model.ID,
+				RolloutID:       check.RolloutID,
+				Cohort:          check.Cohort,
+				PreviousModelID: previous,
+				AssignedAt:      time.Now(),
+			}).Error
+			if err != nil {
+				return nil, fmt.Errorf("failed to record model assignment: %w", err)
+			}
+		}
+	}
+	return check, nil
+}
+
+// buildForDevice loads a model and its newest build for the device's
+// hardware and firmware, returning nils when there is no model or no build
+// fits.
+func (s *AIModelService) buildForDevice(modelID *uuid.UUID, device *models.Device) (*models.AIModel, *models.AIModelArtifact, error) {
+	if modelID == nil {
+		return nil, nil, nil
+	}
+
+	var model models.AIModel
+	if err := s.db.Where("id = ?", *modelID).First(&model).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to load AI model: %w", err)
+	}
+	artifacts, err := s.ListArtifacts(modelID)
+	if err != nil {
+		return nil, nil, err
+	}
+	artifact := SelectArtifact(artifacts, device.HardwareVersion, device.FirmwareVersion)
+	if artifact == nil {
+		return nil, nil, nil
+	}
+	return &model, artifact, nil
+}
+
+// runsRolledBackModel reports whether the device last reported running a
+// model whose rollout was rolled back.
+func (s *AIModelService) runsRolledBackModel(device *models.Device) (bool, error) {
+	if device.CurrentModelID == nil {
+		return false, nil
+	}
+	var count int64
+	err := s.db.Model(&models.AIModelRollout{}).
+		Where("model_id = ? AND status = ?", *device.CurrentModelID, models.AIRolloutStatusRolledBack).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check rolled back rollouts: %w", err)
+	}
+	return count > 0, nil
+}
+
+// PinDevice keeps a device on a model regardless of rollouts.
+func (s *AIModelService) PinDevice(deviceID string, modelID uuid.UUID) (*models.AIModelAssignment, error) {
+	if err := s.db.Where("device_id = ?", deviceID).First(&models.Device{}).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("id = ?", modelID).First(&models.AIModel{}).Error; err != nil {
+		return nil, err
+	}
+
+	assignment := models.AIModelAssignment{
+		DeviceID:   deviceID,
+		ModelID:    modelID,
+		Cohort:     models.AICohortPinned,
+		AssignedAt: time.Now(),
+	}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"model_id", "rollout_id", "cohort", "assigned_at"}),
+	}).Create(&assignment).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to pin device model: %w", err)
+	}
+	return &assignment, nil
+}
+
+// UnpinDevice returns a pinned device to rollouts.
+func (s *AIModelService) UnpinDevice(deviceID string) error {
+	result := s.db.Where("device_id = ? AND cohort = ?", deviceID, models.AICohortPinned).Delete(&models.AIModelAssignment{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to unpin device model: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
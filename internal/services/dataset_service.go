@@ -0,0 +1,428 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/storage"
+	"github.com/labmino/runsight-backend/internal/utils"
+)
+
+const (
+	// Positions this close to where a run started or ended are dropped from
+	// exports, since runs tend to start and end at home.
+	datasetHomeRadiusMeters = 500.0
+	// Other positions are rounded to about 100 m.
+	datasetCoordinatePrecision = 1e3
+	// Exports left running this long are assumed to have died with their
+	// server and are picked up again.
+	datasetStaleAfter    = 6 * time.Hour
+	datasetSchemaVersion = 1
+)
+
+// DatasetSample is one line of an export manifest. Identifiers are
+// pseudonyms that only hold within one export: samples from the same run
+// share a group, but neither links back to a run or runner.
+type DatasetSample struct {
+	ID              string              `json:"id"`
+	Group           string              `json:"group"`
+	Model           DatasetModel        `json:"model"`
+	HardwareVersion string              `json:"hardware_version,omitempty"`
+	Label           string              `json:"label"`
+	LabelSource     string              `json:"label_source"`
+	Type            string              `json:"type,omitempty"`
+	OffsetSeconds   float64             `json:"offset_seconds"`
+	Confidence      *float64            `json:"confidence,omitempty"`
+	BoundingBox     *models.BoundingBox `json:"bounding_box,omitempty"`
+	DistanceMeters  *float64            `json:"distance_meters,omitempty"`
+	BearingDegrees  *float64            `json:"bearing_degrees,omitempty"`
+	WarningSpoken   *bool               `json:"warning_spoken,omitempty"`
+	Latitude        *float64            `json:"lat,omitempty"`
+	Longitude       *float64            `json:"lng,omitempty"`
+	// Frame is the path of the detection's snapshot relative to the
+	// manifest, when the glasses captured one.
+	Frame string `json:"frame,omitempty"`
+}
+
+type DatasetModel struct {
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	Quantization string `json:"quantization,omitempty"`
+}
+
+// DatasetRow is a labelled detection with the run context needed to strip
+// it, as read from the database. Detection fields are nil for missed labels.
+type DatasetRow struct {
+	FeedbackID        uuid.UUID
+	RunID             uuid.UUID
+	Label             string
+	Source            string
+	Type              string
+	Timestamp         time.Time
+	Latitude          *float64
+	Longitude         *float64
+	Confidence        *float64
+	BoundingBox       *models.BoundingBox `gorm:"serializer:json"`
+	DistanceMeters    *float64
+	BearingDegrees    *float64
+	WarningSpoken     *bool
+	ModelName         string
+	ModelVersion      string
+	ModelQuantization string
+	HardwareVersion   string
+	RunStartedAt      time.Time
+	StartLatitude     *float64
+	StartLongitude    *float64
+	EndLatitude       *float64
+	EndLongitude      *float64
+	FrameSHA256       string
+	FrameContentType  string
+}
+
+// datasetMetadata is written next to the manifest.
+type datasetMetadata struct {
+	Version       int                  `json:"version"`
+	SchemaVersion int                  `json:"schema_version"`
+	CreatedAt     time.Time            `json:"created_at"`
+	Filter        models.DatasetFilter `json:"filter"`
+	Samples       int                  `json:"samples"`
+	Frames        int                  `json:"frames"`
+	Labels        map[string]int       `json:"labels"`
+	Types         map[string]int       `json:"types"`
+	Privacy       string               `json:"privacy"`
+}
+
+type DatasetService struct {
+	db    *gorm.DB
+	store storage.Store
+}
+
+func NewDatasetService(db *gorm.DB, store storage.Store) *DatasetService {
+	return &DatasetService{db: db, store: store}
+}
+
+// RequestExport queues an export under the next dataset version.
+func (s *DatasetService) RequestExport(requestedBy uuid.UUID, filter models.DatasetFilter) (*models.DatasetExport, error) {
+	for i := range filter.Types {
+		filter.Types[i] = strings.ToLower(strings.TrimSpace(filter.Types[i]))
+	}
+
+	export := models.DatasetExport{
+		Status:      models.DatasetExportPending,
+		Filter:      filter,
+		RequestedBy: requestedBy,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&models.DatasetExport{}).Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return fmt.Errorf("failed to find dataset version: %w", err)
+		}
+		export.Version = latest + 1
+		if err := tx.Create(&export).Error; err != nil {
+			return fmt.Errorf("failed to queue dataset export: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// ListExports returns exports, newest version first.
+func (s *DatasetService) ListExports() ([]models.DatasetExport, error) {
+	var exports []models.DatasetExport
+	if err := s.db.Order("version DESC").Find(&exports).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch dataset exports: %w", err)
+	}
+	return exports, nil
+}
+
+func (s *DatasetService) GetExport(exportID uuid.UUID) (*models.DatasetExport, error) {
+	var export models.DatasetExport
+	if err := s.db.Where("id = ?", exportID).First(&export).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// OpenManifest reads a completed export's JSONL manifest from the blob store.
+func (s *DatasetService) OpenManifest(ctx context.Context, export *models.DatasetExport) (io.ReadCloser, error) {
+	return s.store.Open(ctx, export.ManifestKey)
+}
+
+// RunPending builds queued exports, oldest first. It runs as a background
+// job; an export is claimed before it is built so concurrent servers do not
+// build it twice.
+func (s *DatasetService) RunPending(ctx context.Context) error {
+	db := s.db.WithContext(ctx)
+	stale := time.Now().Add(-datasetStaleAfter)
+
+	var exports []models.DatasetExport
+	err := db.Where("status = ? OR (status = ? AND started_at < ?)", models.DatasetExportPending, models.DatasetExportRunning, stale).
+		Order("version ASC").
+		Find(&exports).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch pending dataset exports: %w", err)
+	}
+
+	for i := range exports {
+		export := &exports[i]
+		now := time.Now()
+		claim := db.Model(&models.DatasetExport{}).
+			Where("id = ? AND (status = ? OR (status = ? AND started_at < ?))",
+				export.ID, models.DatasetExportPending, models.DatasetExportRunning, stale).
+			Updates(map[string]interface{}{"status": models.DatasetExportRunning, "started_at": now})
+		if claim.Error != nil {
+			return fmt.Errorf("failed to claim dataset export: %w", claim.Error)
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		samples, key, err := s.build(ctx, export)
+		updates := map[string]interface{}{"completed_at": time.Now()}
+		switch {
+		case ctx.Err() != nil:
+			// Shutting down; the export goes back in the queue
+			updates = map[string]interface{}{"status": models.DatasetExportPending, "started_at": nil}
+		case err != nil:
+			utils.Error("Dataset export failed", zap.Int("version", export.Version), zap.Error(err))
+			updates["status"] = models.DatasetExportFailed
+			updates["error"] = err.Error()
+		default:
+			updates["status"] = models.DatasetExportCompleted
+			updates["samples"] = samples
+			updates["manifest_key"] = key
+		}
+		// Not bound to ctx so the outcome is recorded during shutdown too
+		if err := s.db.Model(export).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update dataset export: %w", err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// build streams the export's samples into its manifest and writes the
+// metadata next to it.
+func (s *DatasetService) build(ctx context.Context, export *models.DatasetExport) (int, string, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return 0, "", fmt.Errorf("failed to generate pseudonym key: %w", err)
+	}
+
+	prefix := fmt.Sprintf("datasets/v%d/", export.Version)
+	manifestKey := prefix + "manifest.jsonl"
+	meta := datasetMetadata{
+		Version:       export.Version,
+		SchemaVersion: datasetSchemaVersion,
+		CreatedAt:     time.Now().UTC(),
+		Filter:        export.Filter,
+		Labels:        make(map[string]int),
+		Types:         make(map[string]int),
+		Privacy: fmt.Sprintf("only runners who opted in; identifiers are per-export pseudonyms; "+
+			"positions within %.0f m of a run's start or end are removed, others rounded to 3 decimals; "+
+			"frames are only included with a kept position and have their metadata removed", datasetHomeRadiusMeters),
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		w := bufio.NewWriter(pw)
+		err := s.writeSamples(ctx, export.Filter, salt, prefix, w, &meta)
+		if err == nil {
+			err = w.Flush()
+		}
+		pw.CloseWithError(err)
+	}()
+	if err := s.store.Put(ctx, manifestKey, pr); err != nil {
+		pr.CloseWithError(err)
+		return 0, "", fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	body, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to encode dataset metadata: %w", err)
+	}
+	if err := s.store.Put(ctx, prefix+"dataset.json", bytes.NewReader(body)); err != nil {
+		return 0, "", fmt.Errorf("failed to write dataset metadata: %w", err)
+	}
+	return meta.Samples, manifestKey, nil
+}
+
+// writeSamples encodes the samples to w, copying their frames under prefix.
+func (s *DatasetService) writeSamples(ctx context.Context, filter models.DatasetFilter, salt []byte, prefix string, w io.Writer, meta *datasetMetadata) error {
+	query := s.db.WithContext(ctx).Table("ai_event_feedbacks").
+		Select(`ai_event_feedbacks.id AS feedback_id, ai_event_feedbacks.run_id, ai_event_feedbacks.label,
+			ai_event_feedbacks.source, ai_event_feedbacks.type, ai_event_feedbacks.timestamp,
+			ai_event_feedbacks.latitude, ai_event_feedbacks.longitude,
+			ai_events.confidence, ai_events.bounding_box, ai_events.distance_meters, ai_events.bearing_degrees, ai_events.warning_spoken,
+			ai_models.name AS model_name, ai_models.version AS model_version, ai_models.quantization AS model_quantization,
+			ai_metrics.hardware_version, runs.started_at AS run_started_at,
+			runs.start_latitude, runs.start_longitude, runs.end_latitude, runs.end_longitude,
+			(SELECT run_media.sha256 FROM run_media WHERE run_media.ai_event_id = ai_event_feedbacks.ai_event_id
+				ORDER BY run_media.captured_at LIMIT 1) AS frame_sha256,
+			(SELECT run_media.content_type FROM run_media WHERE run_media.ai_event_id = ai_event_feedbacks.ai_event_id
+				ORDER BY run_media.captured_at LIMIT 1) AS frame_content_type`).
+		Joins("JOIN runs ON runs.id = ai_event_feedbacks.run_id").
+		Joins("JOIN users ON users.id = runs.user_id").
+		Joins("JOIN ai_metrics ON ai_metrics.run_id = ai_event_feedbacks.run_id").
+		Joins("JOIN ai_models ON ai_models.id = ai_metrics.model_id").
+		Joins("LEFT JOIN ai_events ON ai_events.id = ai_event_feedbacks.ai_event_id").
+		Where("users.share_training_data = ?", true)
+
+	if filter.ModelName != "" {
+		query = query.Where("ai_models.name = ?", filter.ModelName)
+	}
+	if filter.ModelVersion != "" {
+		query = query.Where("ai_models.version = ?", filter.ModelVersion)
+	}
+	if len(filter.Types) > 0 {
+		query = query.Where("ai_event_feedbacks.type IN ?", filter.Types)
+	}
+	if len(filter.Labels) > 0 {
+		query = query.Where("ai_event_feedbacks.label IN ?", filter.Labels)
+	}
+	if filter.From != nil {
+		query = query.Where("runs.started_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("runs.started_at < ?", *filter.To)
+	}
+
+	rows, err := query.Order("runs.started_at, ai_event_feedbacks.timestamp").Rows()
+	if err != nil {
+		return fmt.Errorf("failed to query labelled events: %w", err)
+	}
+	defer rows.Close()
+
+	enc := json.NewEncoder(w)
+	for rows.Next() {
+		var row DatasetRow
+		if err := s.db.ScanRows(rows, &row); err != nil {
+			return fmt.Errorf("failed to read labelled event: %w", err)
+		}
+		sample := BuildDatasetSample(row, salt)
+		if sample.Frame != "" {
+			copied, err := s.copyFrame(ctx, MediaKey(row.FrameSHA256), row.FrameContentType, prefix+sample.Frame)
+			if err != nil {
+				return err
+			}
+			if copied {
+				meta.Frames++
+			} else {
+				sample.Frame = ""
+			}
+		}
+		if err := enc.Encode(sample); err != nil {
+			return err
+		}
+		meta.Samples++
+		meta.Labels[sample.Label]++
+		if sample.Type != "" {
+			meta.Types[sample.Type]++
+		}
+	}
+	return rows.Err()
+}
+
+// copyFrame copies a frame into the export without its metadata, reporting
+// false when the file is gone from the store or cannot be stripped.
+func (s *DatasetService) copyFrame(ctx context.Context, from, contentType, to string) (bool, error) {
+	r, err := s.store.Open(ctx, from)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read frame: %w", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, MaxMediaSizeBytes+1))
+	r.Close()
+	if err != nil {
+		return false, fmt.Errorf("failed to read frame: %w", err)
+	}
+
+	stripped, err := StripImageMetadata(contentType, data)
+	if err != nil {
+		utils.Warn("Leaving frame out of dataset export", zap.String("key", from), zap.Error(err))
+		return false, nil
+	}
+	if err := s.store.Put(ctx, to, bytes.NewReader(stripped)); err != nil {
+		return false, fmt.Errorf("failed to copy frame: %w", err)
+	}
+	return true, nil
+}
+
+// BuildDatasetSample strips a labelled detection down to what training
+// needs. Runs and detections are replaced by pseudonyms keyed by salt, times
+// become offsets into the run, and positions near where the run started or
+// ended, or on runs missing either end, are dropped while the rest are
+// coarsened. A frame can show as much as the position it was taken at, so
+// it is only kept alongside a coarsened position, and is named after the
+// sample so its content hash does not link samples across exports.
+func BuildDatasetSample(row DatasetRow, salt []byte) DatasetSample {
+	sample := DatasetSample{
+		ID:    datasetPseudonym(salt, row.FeedbackID),
+		Group: datasetPseudonym(salt, row.RunID),
+		Model: DatasetModel{
+			Name:         row.ModelName,
+			Version:      row.ModelVersion,
+			Quantization: row.ModelQuantization,
+		},
+		HardwareVersion: row.HardwareVersion,
+		Label:           row.Label,
+		LabelSource:     row.Source,
+		Type:            row.Type,
+		OffsetSeconds:   round2(row.Timestamp.Sub(row.RunStartedAt).Seconds()),
+		Confidence:      row.Confidence,
+		BoundingBox:     row.BoundingBox,
+		DistanceMeters:  row.DistanceMeters,
+		BearingDegrees:  row.BearingDegrees,
+		WarningSpoken:   row.WarningSpoken,
+	}
+	// Without both ends of the run there is no telling how close to home a
+	// position is
+	if row.Latitude == nil || row.Longitude == nil ||
+		row.StartLatitude == nil || row.StartLongitude == nil || row.EndLatitude == nil || row.EndLongitude == nil {
+		return sample
+	}
+	lat, lng := *row.Latitude, *row.Longitude
+	if haversineMeters(lat, lng, *row.StartLatitude, *row.StartLongitude) <= datasetHomeRadiusMeters ||
+		haversineMeters(lat, lng, *row.EndLatitude, *row.EndLongitude) <= datasetHomeRadiusMeters {
+		return sample
+	}
+	coarseLat := math.Round(lat*datasetCoordinatePrecision) / datasetCoordinatePrecision
+	coarseLng := math.Round(lng*datasetCoordinatePrecision) / datasetCoordinatePrecision
+	sample.Latitude, sample.Longitude = &coarseLat, &coarseLng
+	if row.FrameSHA256 != "" {
+		if ext, ok := mediaExtensions[row.FrameContentType]; ok {
+			sample.Frame = "frames/" + sample.ID + ext
+		}
+	}
+	return sample
+}
+
+func datasetPseudonym(salt []byte, id uuid.UUID) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(id[:])
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
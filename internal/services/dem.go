@@ -0,0 +1,535 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+// Fraction of points the DEM must cover before its altitudes replace the
+// device's; a track that leaves the loaded tiles keeps GPS altitudes so the
+// profile never mixes both sources.
+const demMinCoverage = 0.95
+
+const srtmVoid = -32768
+
+var (
+	defaultDEMMu sync.RWMutex
+	defaultDEM   *DEM
+)
+
+// SetDefaultDEM installs the terrain model used by services created after the
+// call. Passing nil disables DEM correction.
+func SetDefaultDEM(dem *DEM) {
+	defaultDEMMu.Lock()
+	defer defaultDEMMu.Unlock()
+	defaultDEM = dem
+}
+
+func currentDEM() *DEM {
+	defaultDEMMu.RLock()
+	defer defaultDEMMu.RUnlock()
+	return defaultDEM
+}
+
+// DEM answers terrain elevation queries from tiles on local disk. SRTM .hgt
+// tiles are found by name and opened on first use; GeoTIFF tiles are indexed
+// when the DEM is loaded. Both must be in WGS84 latitude/longitude. Lookups
+// are safe for concurrent use; samples are read with ReadAt, so only the
+// index of opened SRTM tiles needs a lock.
+type DEM struct {
+	dir string
+
+	mu       sync.RWMutex
+	hgt      map[string]*demRaster
+	geotiffs []*demRaster
+}
+
+// demRaster is a grid of samples where sample (col, row) lies at
+// (originLng + col*stepLng, originLat - row*stepLat).
+type demRaster struct {
+	file      io.ReaderAt
+	width     int
+	height    int
+	originLat float64
+	originLng float64
+	stepLat   float64
+	stepLng   float64
+	nodata    *float64
+	sample    func(col, row int) (float64, error)
+}
+
+// LoadDEM indexes the GeoTIFF tiles in dir. SRTM tiles in the same directory
+// are picked up lazily.
+func LoadDEM(dir string) (*DEM, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DEM directory: %w", err)
+	}
+
+	dem := &DEM{dir: dir, hgt: make(map[string]*demRaster)}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".tif" && ext != ".tiff") {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", entry.Name(), err)
+		}
+		raster, err := openGeoTIFF(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+		dem.geotiffs = append(dem.geotiffs, raster)
+	}
+	return dem, nil
+}
+
+// Elevation returns the bilinearly interpolated terrain height at a
+// coordinate, or false when no loaded tile covers it.
+func (d *DEM) Elevation(lat, lng float64) (float64, bool) {
+	if raster := d.hgtTile(lat, lng); raster != nil {
+		if v, ok := raster.elevation(lat, lng); ok {
+			return v, true
+		}
+	}
+	for _, raster := range d.geotiffs {
+		if v, ok := raster.elevation(lat, lng); ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// CorrectAltitudes returns a copy of points with altitudes taken from the DEM.
+// The points are returned unchanged, with false, unless the DEM covers nearly
+// the whole track.
+func (d *DEM) CorrectAltitudes(points []models.WaypointData) ([]models.WaypointData, bool) {
+	if d == nil || len(points) == 0 {
+		return points, false
+	}
+
+	corrected := make([]models.WaypointData, len(points))
+	covered := 0
+	for i, p := range points {
+		corrected[i] = p
+		if v, ok := d.Elevation(p.Latitude, p.Longitude); ok {
+			alt := round2(v)
+			corrected[i].Altitude = &alt
+			covered++
+		}
+	}
+
+	if float64(covered)/float64(len(points)) < demMinCoverage {
+		return points, false
+	}
+	return corrected, true
+}
+
+func (d *DEM) hgtTile(lat, lng float64) *demRaster {
+	latBase := int(math.Floor(lat))
+	lngBase := int(math.Floor(lng))
+
+	ns, ew := 'N', 'E'
+	if latBase < 0 {
+		ns = 'S'
+	}
+	if lngBase < 0 {
+		ew = 'W'
+	}
+	name := fmt.Sprintf("%c%02d%c%03d.hgt", ns, absInt(latBase), ew, absInt(lngBase))
+
+	d.mu.RLock()
+	raster, seen := d.hgt[name]
+	d.mu.RUnlock()
+	if seen {
+		return raster
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if raster, seen := d.hgt[name]; seen {
+		return raster
+	}
+	raster, err := openHGT(filepath.Join(d.dir, name), latBase, lngBase)
+	if err != nil {
+		raster = nil
+	}
+	d.hgt[name] = raster
+	return raster
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// openHGT opens an SRTM tile: a square grid of big-endian int16 heights whose
+// first row is the tile's northern edge.
+func openHGT(path string, latBase, lngBase int) (*demRaster, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var size int
+	switch info.Size() {
+	case 1201 * 1201 * 2:
+		size = 1201
+	case 3601 * 3601 * 2:
+		size = 3601
+	default:
+		f.Close()
+		return nil, fmt.Errorf("unexpected SRTM tile size %d", info.Size())
+	}
+
+	step := 1.0 / float64(size-1)
+	void := float64(srtmVoid)
+	raster := &demRaster{
+		file:      f,
+		width:     size,
+		height:    size,
+		originLat: float64(latBase + 1),
+		originLng: float64(lngBase),
+		stepLat:   step,
+		stepLng:   step,
+		nodata:    &void,
+	}
+	raster.sample = func(col, row int) (float64, error) {
+		var buf [2]byte
+		if _, err := f.ReadAt(buf[:], int64(row*size+col)*2); err != nil {
+			return 0, err
+		}
+		return float64(int16(binary.BigEndian.Uint16(buf[:]))), nil
+	}
+	return raster, nil
+}
+
+func (r *demRaster) elevation(lat, lng float64) (float64, bool) {
+	x := (lng - r.originLng) / r.stepLng
+	y := (r.originLat - lat) / r.stepLat
+	if x < -0.5 || y < -0.5 || x > float64(r.width)-0.5 || y > float64(r.height)-0.5 {
+		return 0, false
+	}
+
+	x = math.Max(0, math.Min(x, float64(r.width-1)))
+	y = math.Max(0, math.Min(y, float64(r.height-1)))
+	c0, r0 := int(x), int(y)
+	c1, r1 := min(c0+1, r.width-1), min(r0+1, r.height-1)
+	fx, fy := x-float64(c0), y-float64(r0)
+
+	// Void samples are left out and the remaining weights renormalised
+	corners := [4]struct {
+		col, row int
+		weight   float64
+	}{
+		{c0, r0, (1 - fx) * (1 - fy)},
+		{c1, r0, fx * (1 - fy)},
+		{c0, r1, (1 - fx) * fy},
+		{c1, r1, fx * fy},
+	}
+	var sum, weights float64
+	for _, corner := range corners {
+		if corner.weight == 0 {
+			continue
+		}
+		v, err := r.sample(corner.col, corner.row)
+		if err != nil || math.IsNaN(v) || (r.nodata != nil && v == *r.nodata) {
+			continue
+		}
+		sum += v * corner.weight
+		weights += corner.weight
+	}
+	if weights == 0 {
+		return 0, false
+	}
+	return sum / weights, true
+}
+
+const (
+	tiffTagImageWidth      = 256
+	tiffTagImageLength     = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagStripOffsets    = 273
+	tiffTagSamplesPerPixel = 277
+	tiffTagRowsPerStrip    = 278
+	tiffTagTileWidth       = 322
+	tiffTagTileLength      = 323
+	tiffTagTileOffsets     = 324
+	tiffTagSampleFormat    = 339
+	tiffTagPixelScale      = 33550
+	tiffTagTiepoint        = 33922
+	tiffTagGeoKeyDirectory = 34735
+	tiffTagGDALNoData      = 42113
+
+	geoKeyRasterType  = 1025
+	rasterPixelIsArea = 1
+)
+
+type tiffEntry struct {
+	typ    uint16
+	count  uint32
+	offset [4]byte
+}
+
+// openGeoTIFF reads the first image of an uncompressed, single-band GeoTIFF
+// with 16/32-bit integer or 32/64-bit float samples, stored in strips or
+// tiles. Compressed files must be converted first, e.g. with
+// gdal_translate -co COMPRESS=NONE.
+func openGeoTIFF(f io.ReaderAt) (*demRaster, error) {
+	var header [8]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil {
+		return nil, fmt.Errorf("invalid TIFF: %w", err)
+	}
+
+	var order binary.ByteOrder
+	switch string(header[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid TIFF byte order")
+	}
+	if order.Uint16(header[2:4]) != 42 {
+		return nil, fmt.Errorf("unsupported TIFF variant (BigTIFF is not supported)")
+	}
+
+	ifd := int64(order.Uint32(header[4:8]))
+	var countBuf [2]byte
+	if _, err := f.ReadAt(countBuf[:], ifd); err != nil {
+		return nil, fmt.Errorf("invalid TIFF directory: %w", err)
+	}
+	n := int(order.Uint16(countBuf[:]))
+	raw := make([]byte, n*12)
+	if _, err := f.ReadAt(raw, ifd+2); err != nil {
+		return nil, fmt.Errorf("invalid TIFF directory: %w", err)
+	}
+
+	entries := make(map[uint16]tiffEntry, n)
+	for i := 0; i < n; i++ {
+		e := raw[i*12 : (i+1)*12]
+		var entry tiffEntry
+		entry.typ = order.Uint16(e[2:4])
+		entry.count = order.Uint32(e[4:8])
+		copy(entry.offset[:], e[8:12])
+		entries[order.Uint16(e[0:2])] = entry
+	}
+
+	t := &tiffReader{r: f, order: order, entries: entries}
+	width := int(t.uint(tiffTagImageWidth, 0))
+	height := int(t.uint(tiffTagImageLength, 0))
+	bits := int(t.uint(tiffTagBitsPerSample, 1))
+	format := t.uint(tiffTagSampleFormat, 1)
+
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("missing image dimensions")
+	}
+	if c := t.uint(tiffTagCompression, 1); c != 1 {
+		return nil, fmt.Errorf("compressed GeoTIFF (compression %d) is not supported", c)
+	}
+	if spp := t.uint(tiffTagSamplesPerPixel, 1); spp != 1 {
+		return nil, fmt.Errorf("expected a single band, found %d", spp)
+	}
+
+	decode, err := tiffSampleDecoder(order, bits, format)
+	if err != nil {
+		return nil, err
+	}
+	bytesPerSample := bits / 8
+
+	scale, err := t.floats(tiffTagPixelScale)
+	if err != nil || len(scale) < 2 {
+		return nil, fmt.Errorf("missing ModelPixelScale tag")
+	}
+	tie, err := t.floats(tiffTagTiepoint)
+	if err != nil || len(tie) < 6 {
+		return nil, fmt.Errorf("missing ModelTiepoint tag")
+	}
+
+	// Pixel-is-area rasters describe the pixel's corner; shift to its centre
+	// so all rasters share the sample-point convention.
+	half := 0.5
+	if keys, err := t.uints(tiffTagGeoKeyDirectory); err == nil && len(keys) >= 4 {
+		for i := 4; i+3 < len(keys); i += 4 {
+			if keys[i] == geoKeyRasterType && keys[i+1] == 0 && keys[i+3] != rasterPixelIsArea {
+				half = 0
+			}
+		}
+	}
+
+	raster := &demRaster{
+		file:      f,
+		width:     width,
+		height:    height,
+		stepLng:   scale[0],
+		stepLat:   scale[1],
+		originLng: tie[3] + (half-tie[0])*scale[0],
+		originLat: tie[4] - (half-tie[1])*scale[1],
+	}
+	if s, ok := t.ascii(tiffTagGDALNoData); ok {
+		if v, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			raster.nodata = &v
+		}
+	}
+
+	var offsetOf func(col, row int) (int64, bool)
+	if tileOffsets, err := t.uints(tiffTagTileOffsets); err == nil {
+		tw, th := int(t.uint(tiffTagTileWidth, 0)), int(t.uint(tiffTagTileLength, 0))
+		if tw <= 0 || th <= 0 {
+			return nil, fmt.Errorf("missing tile dimensions")
+		}
+		across := (width + tw - 1) / tw
+		offsetOf = func(col, row int) (int64, bool) {
+			idx := (row/th)*across + col/tw
+			if idx >= len(tileOffsets) {
+				return 0, false
+			}
+			return int64(tileOffsets[idx]) + int64(((row%th)*tw+col%tw)*bytesPerSample), true
+		}
+	} else if stripOffsets, err := t.uints(tiffTagStripOffsets); err == nil {
+		rows := int(t.uint(tiffTagRowsPerStrip, uint64(height)))
+		if rows <= 0 {
+			rows = height
+		}
+		offsetOf = func(col, row int) (int64, bool) {
+			idx := row / rows
+			if idx >= len(stripOffsets) {
+				return 0, false
+			}
+			return int64(stripOffsets[idx]) + int64(((row%rows)*width+col)*bytesPerSample), true
+		}
+	} else {
+		return nil, fmt.Errorf("missing strip or tile offsets")
+	}
+
+	raster.sample = func(col, row int) (float64, error) {
+		off, ok := offsetOf(col, row)
+		if !ok {
+			return 0, fmt.Errorf("sample out of range")
+		}
+		buf := make([]byte, bytesPerSample)
+		if _, err := f.ReadAt(buf, off); err != nil {
+			return 0, err
+		}
+		return decode(buf), nil
+	}
+	return raster, nil
+}
+
+func tiffSampleDecoder(order binary.ByteOrder, bits int, format uint64) (func([]byte) float64, error) {
+	switch {
+	case format == 2 && bits == 16:
+		return func(b []byte) float64 { return float64(int16(order.Uint16(b))) }, nil
+	case format == 1 && bits == 16:
+		return func(b []byte) float64 { return float64(order.Uint16(b)) }, nil
+	case format == 2 && bits == 32:
+		return func(b []byte) float64 { return float64(int32(order.Uint32(b))) }, nil
+	case format == 3 && bits == 32:
+		return func(b []byte) float64 { return float64(math.Float32frombits(order.Uint32(b))) }, nil
+	case format == 3 && bits == 64:
+		return func(b []byte) float64 { return math.Float64frombits(order.Uint64(b)) }, nil
+	}
+	return nil, fmt.Errorf("unsupported sample type (format %d, %d bits)", format, bits)
+}
+
+type tiffReader struct {
+	r       io.ReaderAt
+	order   binary.ByteOrder
+	entries map[uint16]tiffEntry
+}
+
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 12: 8}
+
+// data returns the raw bytes of a tag's values, which live inline in the
+// entry when they fit in four bytes.
+func (t *tiffReader) data(tag uint16) ([]byte, tiffEntry, error) {
+	entry, ok := t.entries[tag]
+	if !ok {
+		return nil, entry, fmt.Errorf("tag %d not present", tag)
+	}
+	size, ok := tiffTypeSizes[entry.typ]
+	if !ok {
+		return nil, entry, fmt.Errorf("tag %d has unsupported type %d", tag, entry.typ)
+	}
+	length := size * int(entry.count)
+	if length <= 4 {
+		return entry.offset[:length], entry, nil
+	}
+	buf := make([]byte, length)
+	if _, err := t.r.ReadAt(buf, int64(t.order.Uint32(entry.offset[:]))); err != nil {
+		return nil, entry, err
+	}
+	return buf, entry, nil
+}
+
+func (t *tiffReader) uints(tag uint16) ([]uint64, error) {
+	buf, entry, err := t.data(tag)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]uint64, entry.count)
+	for i := range values {
+		switch entry.typ {
+		case 1:
+			values[i] = uint64(buf[i])
+		case 3:
+			values[i] = uint64(t.order.Uint16(buf[i*2:]))
+		case 4:
+			values[i] = uint64(t.order.Uint32(buf[i*4:]))
+		default:
+			return nil, fmt.Errorf("tag %d is not an integer", tag)
+		}
+	}
+	return values, nil
+}
+
+func (t *tiffReader) uint(tag uint16, fallback uint64) uint64 {
+	values, err := t.uints(tag)
+	if err != nil || len(values) == 0 {
+		return fallback
+	}
+	return values[0]
+}
+
+func (t *tiffReader) floats(tag uint16) ([]float64, error) {
+	buf, entry, err := t.data(tag)
+	if err != nil {
+		return nil, err
+	}
+	if entry.typ != 12 {
+		return nil, fmt.Errorf("tag %d is not a double", tag)
+	}
+	values := make([]float64, entry.count)
+	for i := range values {
+		values[i] = math.Float64frombits(t.order.Uint64(buf[i*8:]))
+	}
+	return values, nil
+}
+
+func (t *tiffReader) ascii(tag uint16) (string, bool) {
+	buf, entry, err := t.data(tag)
+	if err != nil || entry.typ != 2 {
+		return "", false
+	}
+	return strings.TrimRight(string(buf), "\x00"), true
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"math"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+const (
+	// Altitude changes smaller than this are treated as GPS/barometer noise
+	// and do not count towards gain or loss.
+	elevationHysteresisMeters = 3.0
+
+	DefaultProfileResolutionMeters = 25.0
+	MinProfileResolutionMeters     = 5.0
+	MaxProfileResolutionMeters     = 1000.0
+	maxProfileSamples              = 5000
+)
+
+type ElevationStats struct {
+	GainMeters float64
+	LossMeters float64
+	MinMeters  float64
+	MaxMeters  float64
+}
+
+// ComputeElevation returns gain, loss and range over the points that carry
+// an altitude, or nil when fewer than two do.
+func ComputeElevation(points []models.WaypointData) *ElevationStats {
+	var stats *ElevationStats
+	var reference float64
+	count := 0
+
+	for _, p := range points {
+		if p.Altitude == nil {
+			continue
+		}
+		alt := *p.Altitude
+		count++
+		if stats == nil {
+			stats = &ElevationStats{MinMeters: alt, MaxMeters: alt}
+			reference = alt
+			continue
+		}
+
+		stats.MinMeters = math.Min(stats.MinMeters, alt)
+		stats.MaxMeters = math.Max(stats.MaxMeters, alt)
+
+		// Only move the reference once the change clears the hysteresis band
+		if diff := alt - reference; diff >= elevationHysteresisMeters {
+			stats.GainMeters += diff
+			reference = alt
+		} else if -diff >= elevationHysteresisMeters {
+			stats.LossMeters -= diff
+			reference = alt
+		}
+	}
+
+	if count < 2 {
+		return nil
+	}
+	return stats
+}
+
+// applySplitElevation fills gain, loss and average grade on splits computed
+// from points.
+func applySplitElevation(splits []models.RunSplit, points []models.WaypointData) {
+	for i := range splits {
+		split := &splits[i]
+		if split.StartSeq < 0 || split.EndSeq >= len(points) || split.StartSeq >= split.EndSeq {
+			continue
+		}
+
+		segment := points[split.StartSeq : split.EndSeq+1]
+		stats := ComputeElevation(segment)
+		if stats == nil {
+			continue
+		}
+		gain := round2(stats.GainMeters)
+		loss := round2(stats.LossMeters)
+		split.ElevationGainMeters = &gain
+		split.ElevationLossMeters = &loss
+
+		first, last := firstAltitude(segment), lastAltitude(segment)
+		if first != nil && last != nil && split.DistanceMeters > 0 {
+			grade := round2((*last - *first) / split.DistanceMeters * 100)
+			split.AvgGradePercent = &grade
+		}
+	}
+}
+
+func firstAltitude(points []models.WaypointData) *float64 {
+	for _, p := range points {
+		if p.Altitude != nil {
+			return p.Altitude
+		}
+	}
+	return nil
+}
+
+func lastAltitude(points []models.WaypointData) *float64 {
+	for i := len(points) - 1; i >= 0; i-- {
+		if points[i].Altitude != nil {
+			return points[i].Altitude
+		}
+	}
+	return nil
+}
+
+type ElevationSample struct {
+	DistanceMeters  float64  `json:"distance_meters"`
+	ElevationMeters float64  `json:"elevation_meters"`
+	GradePercent    *float64 `json:"grade_percent,omitempty"`
+	Latitude        float64  `json:"latitude"`
+	Longitude       float64  `json:"longitude"`
+}
+
+// ElevationProfile samples the track every resolution meters of distance,
+// interpolating altitude between fixes. The resolution is widened when the
+// track would otherwise produce more than maxProfileSamples samples; the
+// resolution actually used is returned alongside the samples.
+func ElevationProfile(points []models.WaypointData, resolution float64) ([]ElevationSample, float64) {
+	var withAltitude []models.WaypointData
+	for _, p := range points {
+		if p.Altitude != nil {
+			withAltitude = append(withAltitude, p)
+		}
+	}
+	if len(withAltitude) < 2 {
+		return []ElevationSample{}, resolution
+	}
+
+	cumulative := cumulativeDistances(withAltitude)
+	total := cumulative[len(cumulative)-1]
+	if total/resolution > maxProfileSamples {
+		resolution = math.Ceil(total / maxProfileSamples)
+	}
+
+	samples := make([]ElevationSample, 0, int(total/resolution)+2)
+	seg := 1
+	for k := 0; ; k++ {
+		// Snap to the end once within half a meter so rounding cannot add a
+		// duplicate final sample
+		d := float64(k) * resolution
+		last := d >= total-0.5
+		if last {
+			d = total
+		}
+		for seg < len(cumulative)-1 && cumulative[seg] < d {
+			seg++
+		}
+
+		a, b := withAltitude[seg-1], withAltitude[seg]
+		frac := 0.0
+		if span := cumulative[seg] - cumulative[seg-1]; span > 0 {
+			frac = (d - cumulative[seg-1]) / span
+		}
+
+		sample := ElevationSample{
+			DistanceMeters:  round2(d),
+			ElevationMeters: round2(*a.Altitude + frac*(*b.Altitude-*a.Altitude)),
+			Latitude:        a.Latitude + frac*(b.Latitude-a.Latitude),
+			Longitude:       a.Longitude + frac*(b.Longitude-a.Longitude),
+		}
+		if n := len(samples); n > 0 {
+			if run := sample.DistanceMeters - samples[n-1].DistanceMeters; run > 0 {
+				grade := round2((sample.ElevationMeters - samples[n-1].ElevationMeters) / run * 100)
+				sample.GradePercent = &grade
+			}
+		}
+		samples = append(samples, sample)
+
+		if last {
+			break
+		}
+	}
+	return samples, resolution
+}
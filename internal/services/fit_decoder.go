@@ -0,0 +1,260 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+// Minimal decoder for Garmin FIT activity files. Only the messages needed to
+// rebuild a run are interpreted: record (GPS samples) and session (totals).
+// Everything else, including developer fields, is skipped by size.
+
+const (
+	fitMesgSession = 18
+	fitMesgRecord  = 20
+
+	fitSemicircleToDegrees = 180.0 / (1 << 31)
+)
+
+// FIT timestamps count seconds from 1989-12-31T00:00:00Z.
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+type fitFieldDef struct {
+	num  byte
+	size byte
+}
+
+type fitDefinition struct {
+	global    uint16
+	byteOrder binary.ByteOrder
+	fields    []fitFieldDef
+	devSize   int
+}
+
+func fitCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[b&0xF]
+		tmp = fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0xF]
+	}
+	return crc
+}
+
+func isFIT(data []byte) bool {
+	return len(data) >= 12 && string(data[8:12]) == ".FIT"
+}
+
+func parseFIT(data []byte) ([]ParsedActivity, error) {
+	if !isFIT(data) {
+		return nil, errors.New("not a FIT file")
+	}
+
+	headerSize := int(data[0])
+	if headerSize < 12 || len(data) < headerSize {
+		return nil, errors.New("invalid FIT header")
+	}
+
+	dataSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	end := headerSize + dataSize
+	if end+2 > len(data) {
+		return nil, errors.New("truncated FIT file")
+	}
+	if fitCRC(data[:end]) != binary.LittleEndian.Uint16(data[end:end+2]) {
+		return nil, errors.New("FIT checksum mismatch")
+	}
+
+	definitions := make(map[byte]*fitDefinition)
+	activity := ParsedActivity{}
+	var lastTimestamp uint32
+	var sessionStart *time.Time
+
+	pos := headerSize
+	for pos < end {
+		header := data[pos]
+		pos++
+
+		var localType byte
+
+		switch {
+		case header&0x80 != 0:
+			// Compressed timestamp header: 5-bit rolling offset from the last full timestamp
+			localType = (header >> 5) & 0x03
+			offset := uint32(header & 0x1F)
+			lastTimestamp += (offset - (lastTimestamp & 0x1F)) & 0x1F
+		case header&0x40 != 0:
+			def, n, err := readFITDefinition(data[pos:end], header&0x20 != 0)
+			if err != nil {
+				return nil, err
+			}
+			definitions[header&0x0F] = def
+			pos += n
+			continue
+		default:
+			localType = header & 0x0F
+		}
+
+		def, ok := definitions[localType]
+		if !ok {
+			return nil, fmt.Errorf("FIT data message for undefined local type %d", localType)
+		}
+
+		values := make(map[byte][]byte, len(def.fields))
+		for _, field := range def.fields {
+			if pos+int(field.size) > end {
+				return nil, errors.New("truncated FIT data message")
+			}
+			values[field.num] = data[pos : pos+int(field.size)]
+			pos += int(field.size)
+		}
+		pos += def.devSize
+		if pos > end {
+			return nil, errors.New("truncated FIT developer fields")
+		}
+
+		if ts, ok := fitUint32(values[253], def.byteOrder); ok {
+			lastTimestamp = ts
+		}
+
+		switch def.global {
+		case fitMesgRecord:
+			point, ok := fitRecordToWaypoint(values, def.byteOrder, lastTimestamp)
+			if ok {
+				activity.Points = append(activity.Points, point)
+			}
+		case fitMesgSession:
+			if start, ok := fitUint32(values[2], def.byteOrder); ok {
+				t := fitEpoch.Add(time.Duration(start) * time.Second)
+				sessionStart = &t
+			}
+			if elapsed, ok := fitUint32(values[7], def.byteOrder); ok {
+				seconds := int(math.Round(float64(elapsed) / 1000))
+				activity.DurationSeconds = &seconds
+			}
+			if distance, ok := fitUint32(values[9], def.byteOrder); ok {
+				meters := float64(distance) / 100
+				activity.DistanceMeters = &meters
+			}
+			if calories, ok := fitUint16(values[11], def.byteOrder); ok {
+				kcal := int(calories)
+				activity.CaloriesBurned = &kcal
+			}
+		}
+	}
+
+	if sessionStart != nil {
+		activity.StartedAt = *sessionStart
+	} else if len(activity.Points) > 0 {
+		activity.StartedAt = activity.Points[0].Timestamp
+	}
+
+	return []ParsedActivity{activity}, nil
+}
+
+func readFITDefinition(data []byte, hasDevFields bool) (*fitDefinition, int, error) {
+	if len(data) < 5 {
+		return nil, 0, errors.New("truncated FIT definition")
+	}
+
+	def := &fitDefinition{byteOrder: binary.LittleEndian}
+	if data[1] == 1 {
+		def.byteOrder = binary.BigEndian
+	}
+	def.global = def.byteOrder.Uint16(data[2:4])
+	count := int(data[4])
+
+	pos := 5
+	if len(data) < pos+count*3 {
+		return nil, 0, errors.New("truncated FIT field definitions")
+	}
+	for i := 0; i < count; i++ {
+		def.fields = append(def.fields, fitFieldDef{num: data[pos], size: data[pos+1]})
+		pos += 3
+	}
+
+	if hasDevFields {
+		if len(data) < pos+1 {
+			return nil, 0, errors.New("truncated FIT developer definitions")
+		}
+		devCount := int(data[pos])
+		pos++
+		if len(data) < pos+devCount*3 {
+			return nil, 0, errors.New("truncated FIT developer definitions")
+		}
+		for i := 0; i < devCount; i++ {
+			def.devSize += int(data[pos+1])
+			pos += 3
+		}
+	}
+
+	return def, pos, nil
+}
+
+func fitRecordToWaypoint(values map[byte][]byte, order binary.ByteOrder, timestamp uint32) (models.WaypointData, bool) {
+	lat, okLat := fitSint32(values[0], order)
+	lng, okLng := fitSint32(values[1], order)
+	if !okLat || !okLng || timestamp == 0 {
+		return models.WaypointData{}, false
+	}
+
+	point := models.WaypointData{
+		Latitude:  float64(lat) * fitSemicircleToDegrees,
+		Longitude: float64(lng) * fitSemicircleToDegrees,
+		Timestamp: fitEpoch.Add(time.Duration(timestamp) * time.Second),
+	}
+
+	if alt, ok := fitUint32(values[78], order); ok {
+		altitude := float64(alt)/5 - 500
+		point.Altitude = &altitude
+	} else if alt, ok := fitUint16(values[2], order); ok {
+		altitude := float64(alt)/5 - 500
+		point.Altitude = &altitude
+	}
+
+	if speed, ok := fitUint32(values[73], order); ok {
+		mps := float64(speed) / 1000
+		point.Speed = &mps
+	} else if speed, ok := fitUint16(values[6], order); ok {
+		mps := float64(speed) / 1000
+		point.Speed = &mps
+	}
+
+	return point, true
+}
+
+func fitUint16(b []byte, order binary.ByteOrder) (uint16, bool) {
+	if len(b) != 2 {
+		return 0, false
+	}
+	v := order.Uint16(b)
+	return v, v != math.MaxUint16
+}
+
+func fitUint32(b []byte, order binary.ByteOrder) (uint32, bool) {
+	if len(b) != 4 {
+		return 0, false
+	}
+	v := order.Uint32(b)
+	return v, v != math.MaxUint32
+}
+
+func fitSint32(b []byte, order binary.ByteOrder) (int32, bool) {
+	if len(b) != 4 {
+		return 0, false
+	}
+	v := int32(order.Uint32(b))
+	return v, v != math.MaxInt32
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const earthRadiusMeters = 6371008.8
+
+// haversineMeters returns the great-circle distance between two coordinates.
+func haversineMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lng2 - lng1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * earthRadiusMeters * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// initialBearing returns the compass bearing in degrees (0-360) for travelling
+// from the first coordinate to the second.
+func initialBearing(lat1, lng1, lat2, lng2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dLambda := (lng2 - lng1) * math.Pi / 180
+
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// destinationPoint returns the coordinate reached by travelling distance
+// meters from a coordinate along a compass bearing.
+func destinationPoint(lat, lng, bearing, distance float64) (float64, float64) {
+	phi1 := lat * math.Pi / 180
+	lambda1 := lng * math.Pi / 180
+	theta := bearing * math.Pi / 180
+	delta := distance / earthRadiusMeters
+
+	phi2 := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta))
+	lambda2 := lambda1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(phi1),
+		math.Cos(delta)-math.Sin(phi1)*math.Sin(phi2))
+	return phi2 * 180 / math.Pi, math.Mod(lambda2*180/math.Pi+540, 360) - 180
+}
+
+// BBox is a latitude/longitude rectangle.
+type BBox struct {
+	MinLng float64 `json:"min_lng"`
+	MinLat float64 `json:"min_lat"`
+	MaxLng float64 `json:"max_lng"`
+	MaxLat float64 `json:"max_lat"`
+}
+
+// ParseBBox reads a "minLng,minLat,maxLng,maxLat" box, the order used by
+// GeoJSON.
+func ParseBBox(v string) (*BBox, error) {
+	parts := strings.Split(v, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox must be minLng,minLat,maxLng,maxLat")
+	}
+	var values [4]float64
+	for i, p := range parts {
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bbox must be minLng,minLat,maxLng,maxLat")
+		}
+		values[i] = parsed
+	}
+
+	box := &BBox{MinLng: values[0], MinLat: values[1], MaxLng: values[2], MaxLat: values[3]}
+	if box.MinLat < -90 || box.MaxLat > 90 || box.MinLng < -180 || box.MaxLng > 180 {
+		return nil, fmt.Errorf("bbox is outside valid coordinates")
+	}
+	if box.MinLat >= box.MaxLat || box.MinLng >= box.MaxLng {
+		return nil, fmt.Errorf("bbox minimums must be below its maximums")
+	}
+	return box, nil
+}
+
+// Span returns the box's larger side in degrees.
+func (b *BBox) Span() float64 {
+	return math.Max(b.MaxLat-b.MinLat, b.MaxLng-b.MinLng)
+}
+
+// Contains reports whether a coordinate lies inside the box.
+func (b *BBox) Contains(lat, lng float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lng >= b.MinLng && lng <= b.MaxLng
+}
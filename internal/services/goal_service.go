@@ -0,0 +1,567 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+const (
+	DefaultGoalEventLimit = 50
+	MaxGoalEventLimit     = 200
+)
+
+// GoalProgress is a goal with its progress: the current period's total for
+// period goals, or the personal record in seconds for race time goals.
+type GoalProgress struct {
+	models.Goal
+	PeriodStart   string  `json:"period_start,omitempty"`
+	PeriodEnd     string  `json:"period_end,omitempty"`
+	Progress      float64 `json:"progress"`
+	Percent       float64 `json:"percent"`
+	Completed     bool    `json:"completed"`
+	CurrentStreak int     `json:"current_streak"`
+	BestStreak    int     `json:"best_streak"`
+}
+
+// ValidateGoal checks the combinations the struct tags cannot: period goals
+// need a period, race time goals need a race distance and no period.
+func ValidateGoal(req *models.GoalCreateRequest) error {
+	if req.Type == models.GoalTypeRaceTime {
+		if req.RaceCategory == "" {
+			return errors.New("race_category is required for race_time goals")
+		}
+		if req.Period != "" {
+			return errors.New("race_time goals do not take a period")
+		}
+		return nil
+	}
+
+	if req.Period == "" {
+		return fmt.Errorf("period is required for %s goals", req.Type)
+	}
+	if req.RaceCategory != "" {
+		return fmt.Errorf("race_category only applies to race_time goals")
+	}
+	return nil
+}
+
+// GoalStreaks counts consecutive completed periods. completed holds period
+// start dates (YYYY-MM-DD); current is the start of the period in progress,
+// which extends the streak when completed but does not break it when not yet.
+func GoalStreaks(completed []string, current time.Time, period string) (int, int) {
+	done := make(map[string]bool, len(completed))
+	for _, day := range completed {
+		done[day] = true
+	}
+
+	previous := func(t time.Time) time.Time {
+		if period == models.GoalPeriodMonth {
+			return t.AddDate(0, -1, 0)
+		}
+		return t.AddDate(0, 0, -7)
+	}
+
+	currentStreak := 0
+	at := current
+	if !done[at.Format("2006-01-02")] {
+		at = previous(at)
+	}
+	for done[at.Format("2006-01-02")] {
+		currentStreak++
+		at = previous(at)
+	}
+
+	sorted := append([]string(nil), completed...)
+	sort.Strings(sorted)
+	best, run := 0, 0
+	for i, day := range sorted {
+		t, err := time.Parse("2006-01-02", day)
+		if err != nil {
+			continue
+		}
+		if i > 0 && previous(t).Format("2006-01-02") == sorted[i-1] {
+			run++
+		} else {
+			run = 1
+		}
+		best = max(best, run)
+	}
+
+	return currentStreak, best
+}
+
+type GoalService struct {
+	db *gorm.DB
+}
+
+func NewGoalService(db *gorm.DB) *GoalService {
+	return &GoalService{db: db}
+}
+
+// Create stores a new goal. A goal that is already met, e.g. a race time the
+// user has beaten before, gets its completion event straight away.
+func (s *GoalService) Create(userID uuid.UUID, req *models.GoalCreateRequest) (*GoalProgress, error) {
+	goal := models.Goal{
+		UserID:       userID,
+		Type:         req.Type,
+		Period:       req.Period,
+		Target:       req.Target,
+		RaceCategory: req.RaceCategory,
+		TargetDate:   req.TargetDate,
+		Title:        req.Title,
+		Active:       true,
+	}
+	if err := s.db.Create(&goal).Error; err != nil {
+		return nil, fmt.Errorf("failed to create goal: %w", err)
+	}
+
+	loc, weekStart, err := LoadUserCalendar(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.evaluateGoal(s.db, &goal, loc, weekStart, time.Now(), nil); err != nil {
+		return nil, err
+	}
+	return s.progress(&goal, loc, weekStart)
+}
+
+// List returns the user's goals with progress, active ones only unless all
+// is set.
+func (s *GoalService) List(userID uuid.UUID, all bool) ([]GoalProgress, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if !all {
+		query = query.Where("active = ?", true)
+	}
+
+	var goals []models.Goal
+	if err := query.Order("created_at ASC").Find(&goals).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch goals: %w", err)
+	}
+
+	loc, weekStart, err := LoadUserCalendar(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]GoalProgress, 0, len(goals))
+	for i := range goals {
+		progress, err := s.progress(&goals[i], loc, weekStart)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *progress)
+	}
+	return result, nil
+}
+
+// Update changes a goal's target, title, date or active flag. It returns
+// gorm.ErrRecordNotFound when the goal does not belong to the user.
+func (s *GoalService) Update(userID, goalID uuid.UUID, req *models.GoalUpdateRequest) (*GoalProgress, error) {
+	var goal models.Goal
+	if err := s.db.Where("id = ? AND user_id = ?", goalID, userID).First(&goal).Error; err != nil {
+		return nil, err
+	}
+
+	if req.Target != nil {
+		goal.Target = *req.Target
+		if goal.Type == models.GoalTypeRaceTime {
+			// A new target time has to be earned again
+			goal.CompletedAt = nil
+			if err := s.db.Where("goal_id = ? AND type = ?", goal.ID, models.GoalEventRaceTargetMet).Delete(&models.GoalEvent{}).Error; err != nil {
+				return nil, fmt.Errorf("failed to reset goal events: %w", err)
+			}
+		}
+	}
+	if req.TargetDate != nil {
+		goal.TargetDate = req.TargetDate
+	}
+	if req.Title != nil {
+		goal.Title = *req.Title
+	}
+	if req.Active != nil {
+		goal.Active = *req.Active
+	}
+
+	if err := s.db.Save(&goal).Error; err != nil {
+		return nil, fmt.Errorf("failed to update goal: %w", err)
+	}
+
+	loc, weekStart, err := LoadUserCalendar(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if goal.Active {
+		if _, err := s.evaluateGoal(s.db, &goal, loc, weekStart, time.Now(), nil); err != nil {
+			return nil, err
+		}
+	}
+	return s.progress(&goal, loc, weekStart)
+}
+
+// Delete removes a goal and its events. It returns gorm.ErrRecordNotFound
+// when the goal does not belong to the user.
+func (s *GoalService) Delete(userID, goalID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", goalID, userID).Delete(&models.Goal{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete goal: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Where("goal_id = ?", goalID).Delete(&models.GoalEvent{}).Error; err != nil {
+			return fmt.Errorf("failed to delete goal events: %w", err)
+		}
+		return nil
+	})
+}
+
+// Events returns the user's goal events created after since, newest first.
+func (s *GoalService) Events(userID uuid.UUID, since *time.Time, limit int) ([]models.GoalEvent, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if since != nil {
+		query = query.Where("created_at > ?", *since)
+	}
+
+	events := []models.GoalEvent{}
+	if err := query.Order("created_at DESC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch goal events: %w", err)
+	}
+	return events, nil
+}
+
+// Evaluate checks the user's active goals against a newly stored run inside
+// tx, after personal records have been recalculated, and returns the events
+// for goals the run completed.
+func (s *GoalService) Evaluate(tx *gorm.DB, run *models.Run) ([]models.GoalEvent, error) {
+	var goals []models.Goal
+	if err := tx.Where("user_id = ? AND active = ?", run.UserID, true).Find(&goals).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch goals: %w", err)
+	}
+	if len(goals) == 0 {
+		return nil, nil
+	}
+
+	loc, weekStart, err := LoadUserCalendar(tx, run.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []models.GoalEvent
+	for i := range goals {
+		event, err := s.evaluateGoal(tx, &goals[i], loc, weekStart, run.StartedAt, &run.ID)
+		if err != nil {
+			return nil, err
+		}
+		if event != nil {
+			events = append(events, *event)
+		}
+	}
+	return events, nil
+}
+
+// Reevaluate checks the user's goals inside tx after a stored run was
+// reanalyzed and personal records recalculated, reopening race goals whose
+// record got slower than the target, and returns the events for goals the
+// run now completes.
+func (s *GoalService) Reevaluate(tx *gorm.DB, run *models.Run) ([]models.GoalEvent, error) {
+	var goals []models.Goal
+	err := tx.Where("user_id = ? AND type = ? AND completed_at IS NOT NULL", run.UserID, models.GoalTypeRaceTime).Find(&goals).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch goals: %w", err)
+	}
+	for i := range goals {
+		if err := revokeRaceGoal(tx, &goals[i]); err != nil {
+			return nil, err
+		}
+	}
+	return s.Evaluate(tx, run)
+}
+
+// RevokeRun brings the user's goals up to date inside tx after run has been
+// deleted and personal records recalculated without it. Events stop pointing
+// at the run, a period that no longer reaches its target loses its
+// completion along with the streaks counted through it, and a race goal whose
+// record got slower than the target is open again.
+func (s *GoalService) RevokeRun(tx *gorm.DB, run *models.Run) error {
+	err := tx.Model(&models.GoalEvent{}).Where("run_id = ?", run.ID).Update("run_id", nil).Error
+	if err != nil {
+		return fmt.Errorf("failed to detach goal events: %w", err)
+	}
+
+	var goals []models.Goal
+	if err := tx.Where("user_id = ?", run.UserID).Find(&goals).Error; err != nil {
+		return fmt.Errorf("failed to fetch goals: %w", err)
+	}
+	if len(goals) == 0 {
+		return nil
+	}
+
+	loc, weekStart, err := LoadUserCalendar(tx, run.UserID)
+	if err != nil {
+		return err
+	}
+
+	for i := range goals {
+		goal := &goals[i]
+		if goal.Type == models.GoalTypeRaceTime {
+			err = revokeRaceGoal(tx, goal)
+		} else {
+			err = revokePeriod(tx, goal, BucketStart(run.StartedAt.In(loc), goal.Period, weekStart))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokePeriod drops the completion of the period starting at start if its
+// total has fallen below the target.
+func revokePeriod(db *gorm.DB, goal *models.Goal, start time.Time) error {
+	total, err := periodTotal(db, goal, start, nextBucket(start, goal.Period))
+	if err != nil || total >= goal.Target {
+		return err
+	}
+
+	result := db.Where("goal_id = ? AND type = ? AND period_start = ?", goal.ID, models.GoalEventPeriodCompleted, start.Format("2006-01-02")).
+		Delete(&models.GoalEvent{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke goal event: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	return restreak(db, goal)
+}
+
+// restreak recounts the streak stored on each of the goal's completed
+// periods.
+func restreak(db *gorm.DB, goal *models.Goal) error {
+	var events []models.GoalEvent
+	err := db.Where("goal_id = ? AND type = ?", goal.ID, models.GoalEventPeriodCompleted).
+		Order("period_start ASC").Find(&events).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch goal events: %w", err)
+	}
+
+	completed := make([]string, 0, len(events))
+	for _, event := range events {
+		completed = append(completed, event.PeriodStart)
+		start, err := time.Parse("2006-01-02", event.PeriodStart)
+		if err != nil {
+			continue
+		}
+		streak, _ := GoalStreaks(completed, start, goal.Period)
+		if streak == event.Streak {
+			continue
+		}
+		if err := db.Model(&models.GoalEvent{}).Where("id = ?", event.ID).Update("streak", streak).Error; err != nil {
+			return fmt.Errorf("failed to update goal event: %w", err)
+		}
+	}
+	return nil
+}
+
+// revokeRaceGoal reopens a completed race goal whose personal record no
+// longer meets the target, or credits the run now holding the record.
+func revokeRaceGoal(db *gorm.DB, goal *models.Goal) error {
+	if goal.CompletedAt == nil {
+		return nil
+	}
+	record, err := raceBest(db, goal)
+	if err != nil {
+		return err
+	}
+
+	if record != nil && record.DurationSeconds <= goal.Target {
+		err := db.Model(&models.GoalEvent{}).
+			Where("goal_id = ? AND type = ? AND run_id IS NULL", goal.ID, models.GoalEventRaceTargetMet).
+			Updates(map[string]interface{}{"run_id": record.RunID, "value": record.DurationSeconds}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update goal event: %w", err)
+		}
+		return nil
+	}
+
+	err = db.Where("goal_id = ? AND type = ?", goal.ID, models.GoalEventRaceTargetMet).Delete(&models.GoalEvent{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke goal event: %w", err)
+	}
+	goal.CompletedAt = nil
+	if err := db.Model(goal).Update("completed_at", nil).Error; err != nil {
+		return fmt.Errorf("failed to update goal: %w", err)
+	}
+	return nil
+}
+
+// evaluateGoal records a completion event when the goal is met for the period
+// containing at (or, for race goals, by the current personal record) and has
+// not been recorded yet.
+func (s *GoalService) evaluateGoal(db *gorm.DB, goal *models.Goal, loc *time.Location, weekStart time.Weekday, at time.Time, runID *uuid.UUID) (*models.GoalEvent, error) {
+	if goal.Type == models.GoalTypeRaceTime {
+		if goal.CompletedAt != nil {
+			return nil, nil
+		}
+		record, err := raceBest(db, goal)
+		if err != nil || record == nil || record.DurationSeconds > goal.Target {
+			return nil, err
+		}
+
+		// Credit the run that set the record, which need not be the one
+		// being evaluated
+		event := &models.GoalEvent{GoalID: goal.ID, UserID: goal.UserID, Type: models.GoalEventRaceTargetMet, RunID: &record.RunID, Value: record.DurationSeconds}
+		if err := db.Create(event).Error; err != nil {
+			return nil, fmt.Errorf("failed to save goal event: %w", err)
+		}
+		now := time.Now()
+		goal.CompletedAt = &now
+		if err := db.Model(goal).Update("completed_at", now).Error; err != nil {
+			return nil, fmt.Errorf("failed to update goal: %w", err)
+		}
+		return event, nil
+	}
+
+	start := BucketStart(at.In(loc), goal.Period, weekStart)
+	total, err := periodTotal(db, goal, start, nextBucket(start, goal.Period))
+	if err != nil || total < goal.Target {
+		return nil, err
+	}
+
+	periodStart := start.Format("2006-01-02")
+	var existing int64
+	err = db.Model(&models.GoalEvent{}).
+		Where("goal_id = ? AND type = ? AND period_start = ?", goal.ID, models.GoalEventPeriodCompleted, periodStart).
+		Count(&existing).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to check goal events: %w", err)
+	}
+	if existing > 0 {
+		return nil, nil
+	}
+
+	completed, err := completedPeriods(db, goal.ID)
+	if err != nil {
+		return nil, err
+	}
+	streak, _ := GoalStreaks(append(completed, periodStart), civilDay(start), goal.Period)
+
+	event := &models.GoalEvent{
+		GoalID:      goal.ID,
+		UserID:      goal.UserID,
+		Type:        models.GoalEventPeriodCompleted,
+		PeriodStart: periodStart,
+		RunID:       runID,
+		Value:       round2(total),
+		Streak:      streak,
+	}
+	if err := db.Create(event).Error; err != nil {
+		return nil, fmt.Errorf("failed to save goal event: %w", err)
+	}
+	return event, nil
+}
+
+func (s *GoalService) progress(goal *models.Goal, loc *time.Location, weekStart time.Weekday) (*GoalProgress, error) {
+	progress := &GoalProgress{Goal: *goal}
+
+	if goal.Type == models.GoalTypeRaceTime {
+		record, err := raceBest(s.db, goal)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			best := record.DurationSeconds
+			progress.Progress = round2(best)
+			progress.Percent = round2(math.Min(100, goal.Target/best*100))
+			progress.Completed = best <= goal.Target
+		}
+		return progress, nil
+	}
+
+	start := BucketStart(time.Now().In(loc), goal.Period, weekStart)
+	end := nextBucket(start, goal.Period)
+	total, err := periodTotal(s.db, goal, start, end)
+	if err != nil {
+		return nil, err
+	}
+	completed, err := completedPeriods(s.db, goal.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	progress.PeriodStart = start.Format("2006-01-02")
+	progress.PeriodEnd = end.AddDate(0, 0, -1).Format("2006-01-02")
+	progress.Progress = round2(total)
+	progress.Percent = round2(math.Min(100, total/goal.Target*100))
+	progress.Completed = total >= goal.Target
+	progress.CurrentStreak, progress.BestStreak = GoalStreaks(completed, civilDay(start), goal.Period)
+	return progress, nil
+}
+
+// periodTotal sums the goal's metric over runs started in [start, end), using
+// the device-reported figures like the statistics endpoints.
+func periodTotal(db *gorm.DB, goal *models.Goal, start, end time.Time) (float64, error) {
+	var expr string
+	switch goal.Type {
+	case models.GoalTypeRuns:
+		expr = "COUNT(*)"
+	case models.GoalTypeDistance:
+		expr = "COALESCE(SUM(distance_meters), 0)"
+	case models.GoalTypeDuration:
+		expr = "COALESCE(SUM(duration_seconds), 0)"
+	default:
+		return 0, fmt.Errorf("goal type %q has no period total", goal.Type)
+	}
+
+	var total float64
+	err := db.Model(&models.Run{}).Select(expr).
+		Where("user_id = ? AND started_at >= ? AND started_at < ?", goal.UserID, start, end).
+		Scan(&total).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to total runs: %w", err)
+	}
+	return total, nil
+}
+
+// raceBest returns the personal record for a race goal's category, or nil if
+// the user has none yet.
+func raceBest(db *gorm.DB, goal *models.Goal) (*models.PersonalRecord, error) {
+	var record models.PersonalRecord
+	err := db.Where("user_id = ? AND category = ?", goal.UserID, goal.RaceCategory).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch personal record: %w", err)
+	}
+	return &record, nil
+}
+
+func completedPeriods(db *gorm.DB, goalID uuid.UUID) ([]string, error) {
+	var periods []string
+	err := db.Model(&models.GoalEvent{}).
+		Where("goal_id = ? AND type = ?", goalID, models.GoalEventPeriodCompleted).
+		Pluck("period_start", &periods).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch goal events: %w", err)
+	}
+	return periods, nil
+}
+
+// LoadUserCalendar returns the timezone and first day of week from the
+// user's profile.
+func LoadUserCalendar(db *gorm.DB, userID uuid.UUID) (*time.Location, time.Weekday, error) {
+	var user models.User
+	if err := db.Select("id", "timezone", "week_start").Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load user: %w", err)
+	}
+	return user.Location(), user.FirstDayOfWeek(), nil
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"math"
+	"time"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+// GPSFilterConfig tunes the cleanup applied to uploaded GPS tracks.
+type GPSFilterConfig struct {
+	// Fixes implying a faster movement than this from the previous accepted
+	// fix are treated as teleports and dropped.
+	MaxSpeedMps float64
+	// When this many fixes in a row are dropped as teleports yet agree with
+	// each other, the last accepted fix was the outlier and the track is
+	// re-anchored on them.
+	ReanchorAfter int
+	// Fixes reporting a worse horizontal accuracy than this are dropped.
+	MaxAccuracyMeters float64
+	// Accuracy assumed for fixes that do not report one.
+	DefaultAccuracyMeters float64
+	// Expected change in velocity used by the Kalman filter, in m/s.
+	ProcessNoiseMps float64
+	// Consecutive fixes staying within this radius for at least
+	// StationaryMinDuration are collapsed to their centroid.
+	StationaryRadiusMeters float64
+	StationaryMinDuration  time.Duration
+}
+
+var DefaultGPSFilterConfig = GPSFilterConfig{
+	MaxSpeedMps:            12,
+	ReanchorAfter:          5,
+	MaxAccuracyMeters:      50,
+	DefaultAccuracyMeters:  10,
+	ProcessNoiseMps:        3,
+	StationaryRadiusMeters: 6,
+	StationaryMinDuration:  20 * time.Second,
+}
+
+type GPSFilter struct {
+	config GPSFilterConfig
+}
+
+func NewGPSFilter(config GPSFilterConfig) *GPSFilter {
+	return &GPSFilter{config: config}
+}
+
+// Process runs the full cleanup pipeline: outlier rejection, Kalman
+// smoothing and stationary-cluster collapsing. The input is not modified.
+func (f *GPSFilter) Process(points []models.WaypointData) []models.WaypointData {
+	cleaned := f.RejectOutliers(points)
+	cleaned = f.Smooth(cleaned)
+	return f.CollapseStationary(cleaned)
+}
+
+// RejectOutliers drops fixes with poor accuracy, out-of-order timestamps or
+// an impossible speed relative to the last accepted fix. The track starts at
+// the first fix that agrees with the one after it, so a spike at the start
+// cannot become the reference the rest of the track is judged against.
+func (f *GPSFilter) RejectOutliers(points []models.WaypointData) []models.WaypointData {
+	accurate := make([]models.WaypointData, 0, len(points))
+	for _, p := range points {
+		if p.Accuracy != nil && *p.Accuracy > f.config.MaxAccuracyMeters {
+			continue
+		}
+		accurate = append(accurate, p)
+	}
+	if len(accurate) == 0 {
+		return accurate
+	}
+
+	seed := 0
+	for i := 0; i+1 < len(accurate); i++ {
+		if f.plausible(accurate[i], accurate[i+1]) {
+			seed = i
+			break
+		}
+	}
+
+	result := make([]models.WaypointData, 0, len(accurate)-seed)
+	result = append(result, accurate[seed])
+	var rejected []models.WaypointData
+	for _, p := range accurate[seed+1:] {
+		prev := result[len(result)-1]
+		if !p.Timestamp.After(prev.Timestamp) {
+			continue
+		}
+		if f.plausible(prev, p) {
+			result = append(result, p)
+			rejected = rejected[:0]
+			continue
+		}
+
+		// Keep only the latest rejected fixes that agree with each other
+		if len(rejected) > 0 && !f.plausible(rejected[len(rejected)-1], p) {
+			rejected = rejected[:0]
+		}
+		rejected = append(rejected, p)
+		if f.config.ReanchorAfter > 0 && len(rejected) >= f.config.ReanchorAfter {
+			result = append(f.dropStaleAnchors(result, rejected[0]), rejected...)
+			rejected = rejected[:0]
+		}
+	}
+	return result
+}
+
+// dropStaleAnchors removes the bad fixes accepted just before a re-anchor:
+// the trailing fixes after the latest one, at most ReanchorAfter back, that
+// the new anchor can be reached from. When none can, the track really jumped
+// and is kept whole.
+func (f *GPSFilter) dropStaleAnchors(result []models.WaypointData, anchor models.WaypointData) []models.WaypointData {
+	for i := len(result) - 1; i >= 0 && i >= len(result)-1-f.config.ReanchorAfter; i-- {
+		if f.plausible(result[i], anchor) {
+			return result[:i+1]
+		}
+	}
+	return result
+}
+
+// plausible reports whether a runner could get from one fix to the next.
+func (f *GPSFilter) plausible(from, to models.WaypointData) bool {
+	dt := to.Timestamp.Sub(from.Timestamp).Seconds()
+	if dt <= 0 {
+		return false
+	}
+	return haversineMeters(from.Latitude, from.Longitude, to.Latitude, to.Longitude)/dt <= f.config.MaxSpeedMps
+}
+
+// Smooth applies a constant-position Kalman filter whose measurement noise is
+// taken from each fix's reported accuracy.
+func (f *GPSFilter) Smooth(points []models.WaypointData) []models.WaypointData {
+	result := make([]models.WaypointData, len(points))
+	var lat, lng, variance float64
+	var last time.Time
+
+	for i, p := range points {
+		accuracy := f.config.DefaultAccuracyMeters
+		if p.Accuracy != nil && *p.Accuracy > 0 {
+			accuracy = *p.Accuracy
+		}
+
+		if i == 0 {
+			lat, lng = p.Latitude, p.Longitude
+			variance = accuracy * accuracy
+		} else {
+			dt := p.Timestamp.Sub(last).Seconds()
+			if dt > 0 {
+				variance += dt * f.config.ProcessNoiseMps * f.config.ProcessNoiseMps
+			}
+			gain := variance / (variance + accuracy*accuracy)
+			lat += gain * (p.Latitude - lat)
+			lng += gain * (p.Longitude - lng)
+			variance = (1 - gain) * variance
+		}
+		last = p.Timestamp
+
+		smoothed := p
+		smoothed.Latitude = lat
+		smoothed.Longitude = lng
+		result[i] = smoothed
+	}
+	return result
+}
+
+// CollapseStationary replaces runs of fixes that wander around one spot, such
+// as waiting at a crossing, with two fixes at their centroid marking when the
+// stop began and ended. This removes the distance GPS drift would add.
+func (f *GPSFilter) CollapseStationary(points []models.WaypointData) []models.WaypointData {
+	result := make([]models.WaypointData, 0, len(points))
+
+	i := 0
+	for i < len(points) {
+		sumLat, sumLng := points[i].Latitude, points[i].Longitude
+		j := i + 1
+		for j < len(points) {
+			n := float64(j - i)
+			if haversineMeters(sumLat/n, sumLng/n, points[j].Latitude, points[j].Longitude) > f.config.StationaryRadiusMeters {
+				break
+			}
+			sumLat += points[j].Latitude
+			sumLng += points[j].Longitude
+			j++
+		}
+
+		count := j - i
+		if count >= 3 && points[j-1].Timestamp.Sub(points[i].Timestamp) >= f.config.StationaryMinDuration {
+			zero := 0.0
+			first := points[i]
+			first.Latitude = sumLat / float64(count)
+			first.Longitude = sumLng / float64(count)
+			first.Speed = &zero
+			end := first
+			end.Timestamp = points[j-1].Timestamp
+			end.Altitude = points[j-1].Altitude
+			result = append(result, first, end)
+			i = j
+			continue
+		}
+
+		result = append(result, points[i])
+		i++
+	}
+	return result
+}
+
+// SimplifyIndexes runs Douglas–Peucker over a polyline of n points and returns
+// the indexes of the points to keep, always including the first and last.
+func SimplifyIndexes(n int, coord func(i int) (lat, lng float64), toleranceMeters float64) []int {
+	if n <= 2 {
+		indexes := make([]int, n)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes
+	}
+
+	keep := make([]bool, n)
+	keep[0], keep[n-1] = true, true
+
+	type span struct{ first, last int }
+	stack := []span{{0, n - 1}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		lat1, lng1 := coord(s.first)
+		lat2, lng2 := coord(s.last)
+		maxDist, index := 0.0, -1
+		for i := s.first + 1; i < s.last; i++ {
+			lat, lng := coord(i)
+			if d := crossTrackMeters(lat, lng, lat1, lng1, lat2, lng2); d > maxDist {
+				maxDist, index = d, i
+			}
+		}
+
+		if index >= 0 && maxDist > toleranceMeters {
+			keep[index] = true
+			stack = append(stack, span{s.first, index}, span{index, s.last})
+		}
+	}
+
+	indexes := make([]int, 0, n)
+	for i, k := range keep {
+		if k {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// SimplifyTrack is SimplifyIndexes applied to a waypoint slice.
+func SimplifyTrack(points []models.WaypointData, toleranceMeters float64) []models.WaypointData {
+	indexes := SimplifyIndexes(len(points), func(i int) (float64, float64) {
+		return points[i].Latitude, points[i].Longitude
+	}, toleranceMeters)
+
+	result := make([]models.WaypointData, len(indexes))
+	for i, idx := range indexes {
+		result[i] = points[idx]
+	}
+	return result
+}
+
+// crossTrackMeters is the distance from a point to the segment between two
+// others, using an equirectangular projection which is accurate enough at
+// running scales.
+func crossTrackMeters(lat, lng, lat1, lng1, lat2, lng2 float64) float64 {
+	cosLat := math.Cos(lat1 * math.Pi / 180)
+	toXY := func(la, lo float64) (float64, float64) {
+		return (lo - lng1) * math.Pi / 180 * earthRadiusMeters * cosLat,
+			(la - lat1) * math.Pi / 180 * earthRadiusMeters
+	}
+
+	px, py := toXY(lat, lng)
+	bx, by := toXY(lat2, lng2)
+
+	lengthSq := bx*bx + by*by
+	if lengthSq == 0 {
+		return math.Hypot(px, py)
+	}
+
+	t := math.Max(0, math.Min(1, (px*bx+py*by)/lengthSq))
+	return math.Hypot(px-t*bx, py-t*by)
+}
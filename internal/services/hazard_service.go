@@ -0,0 +1,568 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+const (
+	HazardScopeMine   = "mine"
+	HazardScopeShared = "shared"
+
+	// Detections within this distance of a hotspot's centre belong to it.
+	hazardClusterRadiusMeters = 25.0
+	// A personal hotspot has to show up on more than one run; a one-off
+	// detection is not worth warning about.
+	DefaultHazardMinRuns = 2
+	// Shared hotspots are only published once enough different runners have
+	// hit them that none of them can be singled out.
+	sharedHazardMinUsers = 3
+	// Shared coordinates are rounded to about a meter.
+	sharedHazardPrecision = 1e5
+
+	DefaultHazardLookbackDays = 180
+	MaxHazardLookbackDays     = 730
+	// Shared queries must be limited to a box this many degrees across.
+	MaxSharedHazardSpanDegrees = 1.0
+
+	// Reported hazards start at this confidence; they come from a person
+	// rather than a model but are unverified.
+	reportedHazardConfidence      = 0.6
+	defaultReportedHazardRadius   = 10.0
+	DefaultHazardReportExpiryDays = 30
+	// MaxHazardReportsPerDay caps how many hazards one runner can report in
+	// 24 hours.
+	MaxHazardReportsPerDay = 10
+	// Aggregated hazards stay in the layer this long after the last
+	// detection unless a refresh drops them sooner.
+	aggregatedHazardTTL = 60 * 24 * time.Hour
+	// Confidence of an aggregated hazard grows with the number of runners
+	// who hit it, reaching the detections' average confidence at this many.
+	aggregatedHazardFullUsers = 5
+
+	// Deltas reach back this far before since, so changes committed after a
+	// device's previous sync but stamped before it are not missed. Devices
+	// receive those hazards again, which they treat as updates.
+	hazardSyncMargin = 5 * time.Minute
+	// MaxHazardDeltaAge is the oldest since a delta is served for; devices
+	// that synced longer ago get the full layer again. A refresh moves an
+	// aggregated hazard by at most a cluster radius, so in this time one
+	// cannot drift further than hazardSyncPadMeters.
+	MaxHazardDeltaAge = 7 * 24 * time.Hour
+	// Deltas also look this far outside the box for hazards that moved out
+	// of it, which are sent as removed.
+	hazardSyncPadMeters = 1000.0
+)
+
+// ErrHazardReportLimit is returned when a runner has reported
+// MaxHazardReportsPerDay hazards in the last 24 hours.
+var ErrHazardReportLimit = errors.New("hazard report limit reached")
+
+// HazardPoint is one geolocated detection fed into clustering.
+type HazardPoint struct {
+	RunID         uuid.UUID
+	UserID        uuid.UUID
+	Type          string
+	Timestamp     time.Time
+	Confidence    float64
+	WarningSpoken bool
+	Latitude      float64
+	Longitude     float64
+}
+
+// HazardCluster is a spot where obstacles were detected repeatedly.
+type HazardCluster struct {
+	Latitude      float64        `json:"lat"`
+	Longitude     float64        `json:"lng"`
+	RadiusMeters  float64        `json:"radius_m"`
+	Type          string         `json:"type"`
+	Types         map[string]int `json:"types"`
+	Detections    int            `json:"detections"`
+	Runs          int            `json:"runs"`
+	Users         int            `json:"users"`
+	Warnings      int            `json:"warnings"`
+	AvgConfidence float64        `json:"avg_confidence"`
+	FirstSeen     time.Time      `json:"first_seen"`
+	LastSeen      time.Time      `json:"last_seen"`
+
+	members []HazardPoint
+}
+
+// HazardQuery selects the detections considered for a hazard map.
+type HazardQuery struct {
+	Scope   string
+	BBox    *BBox
+	Types   []string
+	Since   time.Time
+	MinRuns int
+}
+
+type HazardService struct {
+	db *gorm.DB
+}
+
+func NewHazardService(db *gorm.DB) *HazardService {
+	return &HazardService{db: db}
+}
+
+// ClusterHazards groups detections into hotspots: each detection joins the
+// nearest hotspot whose centre is within radius meters, or starts a new one.
+// Unlike single-linkage clustering this cannot chain a row of lampposts along
+// a street into one long hotspot. Points are processed in time order so the
+// result is stable for the same input.
+func ClusterHazards(points []HazardPoint, radius float64) []HazardCluster {
+	if len(points) == 0 {
+		return []HazardCluster{}
+	}
+
+	sorted := make([]HazardPoint, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	// Cells are one radius tall and at least one radius wide everywhere in
+	// the data set, so a point's hotspot is always in a neighbouring cell.
+	maxLat := 0.0
+	for _, p := range sorted {
+		maxLat = math.Max(maxLat, math.Abs(p.Latitude))
+	}
+	cellLat := radius / (earthRadiusMeters * math.Pi / 180)
+	cellLng := cellLat / math.Max(math.Cos(maxLat*math.Pi/180), 0.01)
+	type cell struct{ row, col int }
+	cellOf := func(lat, lng float64) cell {
+		return cell{int(math.Floor(lat / cellLat)), int(math.Floor(lng / cellLng))}
+	}
+
+	var clusters []*HazardCluster
+	grid := make(map[cell][]int)
+	for _, p := range sorted {
+		home := cellOf(p.Latitude, p.Longitude)
+		best, bestDistance := -1, radius
+		for dr := -1; dr <= 1; dr++ {
+			for dc := -1; dc <= 1; dc++ {
+				for _, idx := range grid[cell{home.row + dr, home.col + dc}] {
+					c := clusters[idx]
+					if d := haversineMeters(p.Latitude, p.Longitude, c.Latitude, c.Longitude); d <= bestDistance {
+						best, bestDistance = idx, d
+					}
+				}
+			}
+		}
+
+		if best < 0 {
+			clusters = append(clusters, &HazardCluster{Latitude: p.Latitude, Longitude: p.Longitude})
+			best = len(clusters) - 1
+			grid[home] = append(grid[home], best)
+		}
+		c := clusters[best]
+		c.members = append(c.members, p)
+		n := float64(len(c.members))
+		c.Latitude += (p.Latitude - c.Latitude) / n
+		c.Longitude += (p.Longitude - c.Longitude) / n
+	}
+
+	result := make([]HazardCluster, len(clusters))
+	for i, c := range clusters {
+		summarizeHazardCluster(c)
+		c.members = nil
+		result[i] = *c
+	}
+	return result
+}
+
+func summarizeHazardCluster(c *HazardCluster) {
+	runs := make(map[uuid.UUID]bool)
+	users := make(map[uuid.UUID]bool)
+	c.Types = make(map[string]int)
+	confidence := 0.0
+	for i, p := range c.members {
+		runs[p.RunID] = true
+		users[p.UserID] = true
+		c.Types[p.Type]++
+		confidence += p.Confidence
+		if p.WarningSpoken {
+			c.Warnings++
+		}
+		if i == 0 || p.Timestamp.Before(c.FirstSeen) {
+			c.FirstSeen = p.Timestamp
+		}
+		if p.Timestamp.After(c.LastSeen) {
+			c.LastSeen = p.Timestamp
+		}
+		c.RadiusMeters = math.Max(c.RadiusMeters, haversineMeters(p.Latitude, p.Longitude, c.Latitude, c.Longitude))
+	}
+
+	c.Detections = len(c.members)
+	c.Runs = len(runs)
+	c.Users = len(users)
+	c.AvgConfidence = round2(confidence / float64(c.Detections))
+	c.RadiusMeters = round2(c.RadiusMeters)
+	for t, n := range c.Types {
+		if n > c.Types[c.Type] || (n == c.Types[c.Type] && t < c.Type) {
+			c.Type = t
+		}
+	}
+}
+
+// Hotspots returns the hazard map for a user: their own repeated detections,
+// or the anonymized map built from every runner who opted into sharing.
+func (s *HazardService) Hotspots(userID uuid.UUID, q HazardQuery) ([]HazardCluster, error) {
+	query := s.db.Table("ai_events").
+		Select("ai_events.run_id, runs.user_id, ai_events.type, ai_events.timestamp, ai_events.confidence, ai_events.warning_spoken, "+
+			"COALESCE(ai_events.object_latitude, ai_events.latitude) AS latitude, "+
+			"COALESCE(ai_events.object_longitude, ai_events.longitude) AS longitude").
+		Joins("JOIN runs ON runs.id = ai_events.run_id").
+		Where("ai_events.latitude IS NOT NULL AND ai_events.timestamp >= ?", q.Since)
+
+	if q.Scope == HazardScopeShared {
+		query = query.Joins("JOIN users ON users.id = runs.user_id").Where("users.share_hazard_data = ?", true)
+	} else {
+		query = query.Where("runs.user_id = ?", userID)
+	}
+	if len(q.Types) > 0 {
+		query = query.Where("ai_events.type IN ?", q.Types)
+	}
+	if q.BBox != nil {
+		// Pad the box by two cluster radii so hotspots on its edge keep
+		// their detections from just outside
+		pad := hazardClusterRadiusMeters / (earthRadiusMeters * math.Pi / 180) * 2
+		query = query.
+			Where("COALESCE(ai_events.object_latitude, ai_events.latitude) BETWEEN ? AND ?", q.BBox.MinLat-pad, q.BBox.MaxLat+pad).
+			Where("COALESCE(ai_events.object_longitude, ai_events.longitude) BETWEEN ? AND ?", q.BBox.MinLng-pad, q.BBox.MaxLng+pad)
+	}
+
+	var points []HazardPoint
+	if err := query.Scan(&points).Error; err != nil {
+		return nil, fmt.Errorf("failed to load detections: %w", err)
+	}
+
+	minRuns := q.MinRuns
+	if minRuns < 1 {
+		minRuns = DefaultHazardMinRuns
+	}
+
+	var hotspots []HazardCluster
+	for _, c := range ClusterHazards(points, hazardClusterRadiusMeters) {
+		if c.Runs < minRuns {
+			continue
+		}
+		if q.BBox != nil && !q.BBox.Contains(c.Latitude, c.Longitude) {
+			continue
+		}
+		if q.Scope == HazardScopeShared {
+			if c.Users < sharedHazardMinUsers {
+				continue
+			}
+			c.Latitude = math.Round(c.Latitude*sharedHazardPrecision) / sharedHazardPrecision
+			c.Longitude = math.Round(c.Longitude*sharedHazardPrecision) / sharedHazardPrecision
+		}
+		hotspots = append(hotspots, c)
+	}
+
+	sort.SliceStable(hotspots, func(i, j int) bool {
+		return hotspots[i].Detections > hotspots[j].Detections
+	})
+	return hotspots, nil
+}
+
+// HazardsGeoJSON renders hotspots as a GeoJSON FeatureCollection of points.
+// Shared hotspots leave out when they were seen so runs cannot be matched to
+// them by time.
+func HazardsGeoJSON(scope string, hotspots []HazardCluster) map[string]interface{} {
+	features := make([]interface{}, 0, len(hotspots))
+	for _, h := range hotspots {
+		properties := map[string]interface{}{
+			"scope":          scope,
+			"type":           h.Type,
+			"types":          h.Types,
+			"detections":     h.Detections,
+			"runs":           h.Runs,
+			"radius_m":       h.RadiusMeters,
+			"warnings":       h.Warnings,
+			"avg_confidence": h.AvgConfidence,
+		}
+		if scope == HazardScopeShared {
+			properties["users"] = h.Users
+		} else {
+			properties["first_seen"] = h.FirstSeen.UTC().Format(time.RFC3339)
+			properties["last_seen"] = h.LastSeen.UTC().Format(time.RFC3339)
+		}
+
+		features = append(features, map[string]interface{}{
+			"type": "Feature",
+			"geometry": map[string]interface{}{
+				"type":        "Point",
+				"coordinates": []float64{h.Longitude, h.Latitude},
+			},
+			"properties": properties,
+		})
+	}
+
+	return map[string]interface{}{
+		"type":     "FeatureCollection",
+		"features": features,
+	}
+}
+
+// AggregatedHazardConfidence scores a shared hotspot for the hazard layer:
+// the average detection confidence, scaled down while fewer than five
+// runners have hit the spot.
+func AggregatedHazardConfidence(c HazardCluster) float64 {
+	users := math.Min(float64(c.Users), aggregatedHazardFullUsers)
+	return round2(c.AvgConfidence * users / aggregatedHazardFullUsers)
+}
+
+// PlanAggregatedHazards reconciles the aggregated hazards in the layer with a
+// fresh set of shared hotspots. Each hotspot updates the nearest existing
+// hazard within a cluster radius or becomes a new one; hazards no hotspot
+// matched are returned for removal. Hazards whose values did not change are
+// left out of the upserts so their updated_at, and with it the devices'
+// delta, stays quiet.
+func PlanAggregatedHazards(existing []models.Hazard, hotspots []HazardCluster) ([]models.Hazard, []models.Hazard) {
+	matched := make([]bool, len(existing))
+	var upserts []models.Hazard
+
+	for _, c := range hotspots {
+		best, bestDistance := -1, hazardClusterRadiusMeters
+		for i, h := range existing {
+			if matched[i] {
+				continue
+			}
+			if d := haversineMeters(c.Latitude, c.Longitude, h.Latitude, h.Longitude); d <= bestDistance {
+				best, bestDistance = i, d
+			}
+		}
+
+		next := models.Hazard{Source: models.HazardSourceAggregated, Status: models.HazardStatusApproved}
+		if best >= 0 {
+			matched[best] = true
+			next = existing[best]
+		}
+		previous := next
+		next.Type = c.Type
+		next.Latitude = c.Latitude
+		next.Longitude = c.Longitude
+		next.RadiusMeters = math.Max(c.RadiusMeters, defaultReportedHazardRadius)
+		next.Confidence = AggregatedHazardConfidence(c)
+		next.Detections = c.Detections
+		next.Users = c.Users
+		next.ExpiresAt = c.LastSeen.Add(aggregatedHazardTTL)
+
+		if best < 0 || !sameHazard(previous, next) {
+			upserts = append(upserts, next)
+		}
+	}
+
+	var removed []models.Hazard
+	for i, h := range existing {
+		if !matched[i] {
+			removed = append(removed, h)
+		}
+	}
+	return upserts, removed
+}
+
+func sameHazard(a, b models.Hazard) bool {
+	return a.Type == b.Type &&
+		a.Latitude == b.Latitude && a.Longitude == b.Longitude &&
+		a.RadiusMeters == b.RadiusMeters && a.Confidence == b.Confidence &&
+		a.Detections == b.Detections && a.Users == b.Users &&
+		a.ExpiresAt.Equal(b.ExpiresAt)
+}
+
+// RefreshAggregated rebuilds the aggregated part of the hazard layer from
+// the shared hotspot map. It runs as a background job.
+func (s *HazardService) RefreshAggregated(ctx context.Context) error {
+	now := time.Now()
+	hotspots, err := s.Hotspots(uuid.Nil, HazardQuery{
+		Scope: HazardScopeShared,
+		Since: now.AddDate(0, 0, -DefaultHazardLookbackDays),
+	})
+	if err != nil {
+		return err
+	}
+	// Hotspots last seen too long ago drop out, removing their hazards
+	current := hotspots[:0]
+	for _, c := range hotspots {
+		if c.LastSeen.Add(aggregatedHazardTTL).After(now) {
+			current = append(current, c)
+		}
+	}
+
+	db := s.db.WithContext(ctx)
+	var existing []models.Hazard
+	if err := db.Where("source = ? AND removed_at IS NULL", models.HazardSourceAggregated).Find(&existing).Error; err != nil {
+		return fmt.Errorf("failed to load aggregated hazards: %w", err)
+	}
+
+	upserts, removed := PlanAggregatedHazards(existing, current)
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i := range upserts {
+			if err := tx.Save(&upserts[i]).Error; err != nil {
+				return fmt.Errorf("failed to save hazard: %w", err)
+			}
+		}
+		for _, h := range removed {
+			err := tx.Model(&models.Hazard{}).Where("id = ?", h.ID).Updates(map[string]interface{}{
+				"removed_at": now,
+				"updated_at": now,
+			}).Error
+			if err != nil {
+				return fmt.Errorf("failed to remove hazard: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Report records a hazard reported by a runner. It stays pending, and out of
+// the layer devices download, until an admin approves it.
+func (s *HazardService) Report(userID uuid.UUID, req *models.HazardReportRequest) (*models.Hazard, error) {
+	var recent int64
+	err := s.db.Model(&models.Hazard{}).
+		Where("reported_by = ? AND created_at > ?", userID, time.Now().Add(-24*time.Hour)).
+		Count(&recent).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count hazard reports: %w", err)
+	}
+	if recent >= MaxHazardReportsPerDay {
+		return nil, ErrHazardReportLimit
+	}
+
+	days := DefaultHazardReportExpiryDays
+	if req.ExpiresInDays != nil {
+		days = *req.ExpiresInDays
+	}
+	radius := defaultReportedHazardRadius
+	if req.RadiusMeters != nil {
+		radius = *req.RadiusMeters
+	}
+
+	hazard := &models.Hazard{
+		Source:       models.HazardSourceReported,
+		Status:       models.HazardStatusPending,
+		Type:         strings.ToLower(strings.TrimSpace(req.Type)),
+		Latitude:     req.Latitude,
+		Longitude:    req.Longitude,
+		RadiusMeters: radius,
+		Confidence:   reportedHazardConfidence,
+		Description:  req.Description,
+		ReportedBy:   &userID,
+		ExpiresAt:    time.Now().AddDate(0, 0, days),
+	}
+	if err := s.db.Create(hazard).Error; err != nil {
+		return nil, fmt.Errorf("failed to report hazard: %w", err)
+	}
+	return hazard, nil
+}
+
+// ListReports returns the user's hazard reports that are still in the layer
+// or waiting for review.
+func (s *HazardService) ListReports(userID uuid.UUID) ([]models.Hazard, error) {
+	var hazards []models.Hazard
+	err := s.db.Where("reported_by = ? AND removed_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").Find(&hazards).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch hazard reports: %w", err)
+	}
+	return hazards, nil
+}
+
+// RemoveReport takes one of the user's reports out of the layer.
+func (s *HazardService) RemoveReport(userID, hazardID uuid.UUID) error {
+	now := time.Now()
+	result := s.db.Model(&models.Hazard{}).
+		Where("id = ? AND reported_by = ? AND removed_at IS NULL", hazardID, userID).
+		Updates(map[string]interface{}{"removed_at": now, "updated_at": now})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove hazard: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// PendingReports returns the reports waiting for review, oldest first.
+func (s *HazardService) PendingReports() ([]models.Hazard, error) {
+	var hazards []models.Hazard
+	err := s.db.Where("source = ? AND status = ? AND removed_at IS NULL AND expires_at > ?",
+		models.HazardSourceReported, models.HazardStatusPending, time.Now()).
+		Order("created_at ASC").Find(&hazards).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch hazard reports: %w", err)
+	}
+	return hazards, nil
+}
+
+// Moderate approves a reported hazard into the layer or rejects it.
+// Rejecting an approved report removes it from the layer again.
+func (s *HazardService) Moderate(hazardID uuid.UUID, status string) (*models.Hazard, error) {
+	var hazard models.Hazard
+	err := s.db.Where("id = ? AND source = ? AND removed_at IS NULL", hazardID, models.HazardSourceReported).
+		First(&hazard).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": status, "updated_at": now}
+	if status == models.HazardStatusRejected {
+		updates["removed_at"] = now
+	}
+	if err := s.db.Model(&hazard).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to moderate hazard: %w", err)
+	}
+	return &hazard, nil
+}
+
+// Feed returns the hazard layer inside a box. Without since it is the full
+// set of active hazards; with since it is what changed after it: hazards
+// added or updated, and the ids of ones removed, expired or moved out of the
+// box since.
+func (s *HazardService) Feed(box *BBox, since *time.Time, now time.Time) ([]models.Hazard, []uuid.UUID, error) {
+	area := *box
+	if since != nil {
+		padLat := hazardSyncPadMeters / (earthRadiusMeters * math.Pi / 180)
+		maxLat := math.Max(math.Abs(box.MinLat), math.Abs(box.MaxLat)) + padLat
+		padLng := padLat / math.Max(math.Cos(math.Min(maxLat, 89)*math.Pi/180), 0.01)
+		area = BBox{MinLat: box.MinLat - padLat, MaxLat: box.MaxLat + padLat, MinLng: box.MinLng - padLng, MaxLng: box.MaxLng + padLng}
+	}
+
+	query := s.db.Where("latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?",
+		area.MinLat, area.MaxLat, area.MinLng, area.MaxLng).
+		Where("status <> ?", models.HazardStatusPending)
+	if since == nil {
+		query = query.Where("removed_at IS NULL AND expires_at > ?", now)
+	} else {
+		from := since.Add(-hazardSyncMargin)
+		query = query.Where("(updated_at > ? OR (expires_at > ? AND expires_at <= ?))", from, from, now)
+	}
+
+	var rows []models.Hazard
+	if err := query.Order("updated_at ASC").Find(&rows).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch hazards: %w", err)
+	}
+
+	hazards := make([]models.Hazard, 0, len(rows))
+	removed := make([]uuid.UUID, 0)
+	for _, h := range rows {
+		if h.Active(now) && box.Contains(h.Latitude, h.Longitude) {
+			hazards = append(hazards, h)
+		} else if since != nil {
+			removed = append(removed, h.ID)
+		}
+	}
+	return hazards, removed, nil
+}
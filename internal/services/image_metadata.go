@@ -0,0 +1,177 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrImageMalformed is returned for images whose structure cannot be walked
+// safely enough to remove their metadata.
+var ErrImageMalformed = errors.New("malformed image")
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	// PNG chunks that hold text, timestamps or EXIF rather than pixels.
+	pngMetadataChunks = map[string]bool{
+		"tEXt": true,
+		"zTXt": true,
+		"iTXt": true,
+		"eXIf": true,
+		"tIME": true,
+	}
+)
+
+// StripImageMetadata returns a copy of an image of one of the accepted media
+// types without EXIF, XMP, IPTC, comments or text chunks, leaving the pixel
+// data untouched. Cameras record where and when a frame was taken there, so
+// nothing leaving the service should carry it.
+func StripImageMetadata(contentType string, data []byte) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEGMetadata(data)
+	case "image/png":
+		return stripPNGMetadata(data)
+	case "image/webp":
+		return stripWebPMetadata(data)
+	}
+	return nil, ErrMediaType
+}
+
+// stripJPEGMetadata drops comments and every APPn segment except the JFIF
+// header, ICC colour profiles and the Adobe colour transform, which decoders
+// need to show the frame correctly. Everything from the first scan on is
+// copied as is.
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrImageMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	for i := 2; ; {
+		if i+2 > len(data) || data[i] != 0xFF {
+			return nil, ErrImageMalformed
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			// Fill byte before a marker
+			i++
+			continue
+		}
+		if marker == 0xD9 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			// Markers without a length
+			out.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			return nil, ErrImageMalformed
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			return nil, ErrImageMalformed
+		}
+		if marker == 0xDA {
+			out.Write(data[i:])
+			return out.Bytes(), nil
+		}
+		if !jpegMetadataSegment(marker, data[i+4:end]) {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+}
+
+func jpegMetadataSegment(marker byte, payload []byte) bool {
+	switch {
+	case marker == 0xFE:
+		return true
+	case marker == 0xE0:
+		return !bytes.HasPrefix(payload, []byte("JFIF\x00"))
+	case marker == 0xE2:
+		return !bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+	case marker == 0xEE:
+		return !bytes.HasPrefix(payload, []byte("Adobe"))
+	case marker >= 0xE1 && marker <= 0xEF:
+		return true
+	}
+	return false
+}
+
+// stripPNGMetadata drops text, time and EXIF chunks.
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrImageMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+
+	for i := len(pngSignature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, ErrImageMalformed
+		}
+		length := binary.BigEndian.Uint32(data[i:])
+		if uint64(length) > uint64(len(data)-i-12) {
+			return nil, ErrImageMalformed
+		}
+		end := i + 12 + int(length)
+		chunk := string(data[i+4 : i+8])
+		if !pngMetadataChunks[chunk] {
+			out.Write(data[i:end])
+		}
+		i = end
+		if chunk == "IEND" {
+			break
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// stripWebPMetadata drops the EXIF and XMP chunks, clears the flags that
+// announce them and fixes up the RIFF size.
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrImageMalformed
+	}
+	size := int(binary.LittleEndian.Uint32(data[4:]))
+	if size < 4 || size > len(data)-8 {
+		return nil, ErrImageMalformed
+	}
+	data = data[:8+size]
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrImageMalformed
+		}
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if length > len(data)-i-8 {
+			return nil, ErrImageMalformed
+		}
+		// Chunks are padded to an even size
+		end := i + 8 + length + length%2
+		if end > len(data) {
+			end = len(data)
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if length > 0 {
+				// Bit 3 announces EXIF, bit 2 XMP
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+	return stripped, nil
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/storage"
+	"github.com/labmino/runsight-backend/internal/utils"
+)
+
+const (
+	// MaxMediaSizeBytes caps a single upload; the glasses send low-res frames.
+	MaxMediaSizeBytes = 2 << 20
+	// DefaultMediaQuotaBytes is what each runner may store unless
+	// MEDIA_QUOTA_MB says otherwise.
+	DefaultMediaQuotaBytes = 200 << 20
+	// MediaURLTTL is how long download links handed to the app stay valid.
+	MediaURLTTL = 15 * time.Minute
+	// A frame is linked to the detection closest to when it was captured
+	// within this window.
+	mediaEventMatchWindow = 2 * time.Second
+	// Unreferenced blobs are only removed once untouched this long, so an
+	// upload reusing one is never left pointing at a deleted file.
+	mediaBlobGracePeriod = time.Hour
+)
+
+var (
+	// ErrMediaTooLarge is returned for uploads over MaxMediaSizeBytes.
+	ErrMediaTooLarge = errors.New("media exceeds the size limit")
+	// ErrMediaType is returned for uploads that are not a supported image.
+	ErrMediaType = errors.New("unsupported media type")
+	// ErrMediaQuota is returned when an upload would take the runner over
+	// their storage quota.
+	ErrMediaQuota = errors.New("media quota exceeded")
+	// ErrMediaURLInvalid is returned for download links with a bad signature.
+	ErrMediaURLInvalid = errors.New("invalid media link")
+	// ErrMediaURLExpired is returned for download links past their expiry.
+	ErrMediaURLExpired = errors.New("media link expired")
+)
+
+// mediaExtensions lists the accepted content types, as sniffed from the
+// upload, with the file extension used when copying them out.
+var mediaExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// MediaUsage is how much a runner stores against their quota. A file counts
+// once however many of their runs reference it.
+type MediaUsage struct {
+	UsedBytes  int64 `json:"used_bytes"`
+	QuotaBytes int64 `json:"quota_bytes"`
+}
+
+type MediaService struct {
+	db         *gorm.DB
+	store      storage.Store
+	quota      int64
+	signingKey []byte
+}
+
+func NewMediaService(db *gorm.DB, store storage.Store) *MediaService {
+	quota := int64(DefaultMediaQuotaBytes)
+	if mb, err := strconv.ParseInt(os.Getenv("MEDIA_QUOTA_MB"), 10, 64); err == nil && mb > 0 {
+		quota = mb << 20
+	}
+	key := os.Getenv("MEDIA_URL_SECRET")
+	if key == "" {
+		key = os.Getenv("JWT_SECRET")
+	}
+	if key == "" {
+		key = "your-default-secret-key"
+	}
+	return &MediaService{db: db, store: store, quota: quota, signingKey: []byte(key)}
+}
+
+// MediaKey is where a file with the given content hash lives in the blob
+// store.
+func MediaKey(sha string) string {
+	return "media/" + sha[:2] + "/" + sha
+}
+
+// Upload stores a frame captured during a run. Uploading the same file to
+// the same run again returns the existing media with duplicate set, and a
+// file already in the store is referenced rather than written again.
+func (s *MediaService) Upload(ctx context.Context, run *models.Run, capturedAt time.Time, r io.Reader) (*models.RunMedia, bool, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxMediaSizeBytes+1))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read media: %w", err)
+	}
+	if len(data) > MaxMediaSizeBytes {
+		return nil, false, ErrMediaTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	if _, ok := mediaExtensions[contentType]; !ok {
+		return nil, false, ErrMediaType
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	size := int64(len(data))
+
+	var existing models.RunMedia
+	err = s.db.Where("run_id = ? AND sha256 = ?", run.ID, hash).First(&existing).Error
+	if err == nil {
+		return &existing, true, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, false, fmt.Errorf("failed to check media: %w", err)
+	}
+
+	// Checked up front so nothing is stored for a runner over quota, and
+	// again below once their uploads are serialised
+	if err := s.checkQuota(s.db, run.UserID, hash, size); err != nil {
+		return nil, false, err
+	}
+
+	if err := s.storeBlob(ctx, hash, contentType, data); err != nil {
+		return nil, false, err
+	}
+
+	media := models.RunMedia{
+		RunID:       run.ID,
+		UserID:      run.UserID,
+		SHA256:      hash,
+		SizeBytes:   size,
+		ContentType: contentType,
+		CapturedAt:  capturedAt,
+	}
+	var events []models.AIEvent
+	err = s.db.Where("run_id = ? AND timestamp BETWEEN ? AND ?", run.ID,
+		capturedAt.Add(-mediaEventMatchWindow), capturedAt.Add(mediaEventMatchWindow)).
+		Find(&events).Error
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch AI events: %w", err)
+	}
+	if event := NearestAIEvent(events, capturedAt, mediaEventMatchWindow); event != nil {
+		media.AIEventID = &event.ID
+	}
+
+	duplicate := false
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Concurrent uploads by the same runner would otherwise each see the
+		// usage from before the others and together go over the quota
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ?", run.UserID).First(&models.User{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to lock user: %w", err)
+		}
+		if err := s.checkQuota(tx, run.UserID, hash, size); err != nil {
+			return err
+		}
+
+		// A retried upload racing the first one loses to it
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "run_id"}, {Name: "sha256"}},
+			DoNothing: true,
+		}).Create(&media)
+		if result.Error != nil {
+			return fmt.Errorf("failed to save media: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			if err := tx.Where("run_id = ? AND sha256 = ?", run.ID, hash).First(&existing).Error; err != nil {
+				return fmt.Errorf("failed to load media: %w", err)
+			}
+			duplicate = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if duplicate {
+		return &existing, true, nil
+	}
+	return &media, false, nil
+}
+
+// checkQuota returns ErrMediaQuota if storing a file of size bytes would take
+// the runner over their quota. Files they already store do not count again.
+func (s *MediaService) checkQuota(db *gorm.DB, userID uuid.UUID, hash string, size int64) error {
+	var held int64
+	if err := db.Model(&models.RunMedia{}).Where("user_id = ? AND sha256 = ?", userID, hash).Count(&held).Error; err != nil {
+		return fmt.Errorf("failed to check media: %w", err)
+	}
+	if held > 0 {
+		return nil
+	}
+	usage, err := s.usage(db, userID)
+	if err != nil {
+		return err
+	}
+	if usage.UsedBytes+size > usage.QuotaBytes {
+		return ErrMediaQuota
+	}
+	return nil
+}
+
+// storeBlob writes the file unless the store already holds it, in which case
+// the blob is touched to keep the cleanup job off it.
+func (s *MediaService) storeBlob(ctx context.Context, hash, contentType string, data []byte) error {
+	touched := s.db.Model(&models.MediaBlob{}).Where("sha256 = ?", hash).Update("updated_at", time.Now())
+	if touched.Error != nil {
+		return fmt.Errorf("failed to check media blob: %w", touched.Error)
+	}
+	if touched.RowsAffected > 0 {
+		return nil
+	}
+
+	if err := s.store.Put(ctx, MediaKey(hash), bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to store media: %w", err)
+	}
+	// Another upload of the same file may have got here first; both wrote
+	// the same content
+	blob := models.MediaBlob{SHA256: hash, SizeBytes: int64(len(data)), ContentType: contentType}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&blob).Error; err != nil {
+		return fmt.Errorf("failed to save media blob: %w", err)
+	}
+	return nil
+}
+
+// NearestAIEvent returns the event closest in time to at, or nil when none
+// is within window.
+func NearestAIEvent(events []models.AIEvent, at time.Time, window time.Duration) *models.AIEvent {
+	var nearest *models.AIEvent
+	best := window
+	for i := range events {
+		d := events[i].Timestamp.Sub(at)
+		if d < 0 {
+			d = -d
+		}
+		if d <= best {
+			nearest, best = &events[i], d
+		}
+	}
+	return nearest
+}
+
+// Usage reports what the runner stores against their quota.
+func (s *MediaService) Usage(userID uuid.UUID) (*MediaUsage, error) {
+	return s.usage(s.db, userID)
+}
+
+func (s *MediaService) usage(db *gorm.DB, userID uuid.UUID) (*MediaUsage, error) {
+	usage := MediaUsage{QuotaBytes: s.quota}
+	err := db.Model(&models.MediaBlob{}).
+		Select("COALESCE(SUM(size_bytes), 0)").
+		Where("sha256 IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&models.RunMedia{}).Select("sha256").Where("user_id = ?", userID)).
+		Scan(&usage.UsedBytes).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate media usage: %w", err)
+	}
+	return &usage, nil
+}
+
+// ListForRun returns a run's media in capture order with download links.
+func (s *MediaService) ListForRun(ctx context.Context, runID uuid.UUID) ([]models.RunMedia, error) {
+	var media []models.RunMedia
+	if err := s.db.Where("run_id = ?", runID).Order("captured_at ASC").Find(&media).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch media: %w", err)
+	}
+	if err := s.signURLs(ctx, media); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// signURLs fills in download links. Stores that sign their own URLs are
+// downloaded from directly; anything else is served by the API.
+func (s *MediaService) signURLs(ctx context.Context, media []models.RunMedia) error {
+	expiresAt := time.Now().Add(MediaURLTTL).UTC().Truncate(time.Second)
+	signer, direct := s.store.(storage.URLSigner)
+	for i := range media {
+		m := &media[i]
+		if direct {
+			url, err := signer.SignedURL(ctx, MediaKey(m.SHA256), MediaURLTTL)
+			if err != nil {
+				return fmt.Errorf("failed to sign media URL: %w", err)
+			}
+			m.URL = url
+		} else {
+			m.URL = fmt.Sprintf("/api/v1/media/%s?expires=%d&signature=%s",
+				m.ID, expiresAt.Unix(), SignMediaURL(s.signingKey, m.ID, expiresAt.Unix()))
+		}
+		m.ExpiresAt = &expiresAt
+	}
+	return nil
+}
+
+// SignMediaURL signs an API download link for the media until expires, a
+// Unix time.
+func SignMediaURL(key []byte, mediaID uuid.UUID, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s:%d", mediaID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyMediaURL checks a download link signed by SignMediaURL at now.
+func VerifyMediaURL(key []byte, mediaID uuid.UUID, expires int64, signature string, now time.Time) error {
+	expected := SignMediaURL(key, mediaID, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrMediaURLInvalid
+	}
+	if now.Unix() > expires {
+		return ErrMediaURLExpired
+	}
+	return nil
+}
+
+// OpenSigned opens the file behind an API download link.
+func (s *MediaService) OpenSigned(ctx context.Context, mediaID uuid.UUID, expires int64, signature string) (*models.RunMedia, io.ReadCloser, error) {
+	if err := VerifyMediaURL(s.signingKey, mediaID, expires, signature, time.Now()); err != nil {
+		return nil, nil, err
+	}
+	var media models.RunMedia
+	if err := s.db.Where("id = ?", mediaID).First(&media).Error; err != nil {
+		return nil, nil, err
+	}
+	r, err := s.store.Open(ctx, MediaKey(media.SHA256))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &media, r, nil
+}
+
+// CollectGarbage removes files no run references any more, which is what
+// deleting runs leaves behind. It runs as a background job.
+func (s *MediaService) CollectGarbage(ctx context.Context) error {
+	db := s.db.WithContext(ctx)
+	cutoff := time.Now().Add(-mediaBlobGracePeriod)
+	unreferenced := "updated_at < ? AND NOT EXISTS (SELECT 1 FROM run_media WHERE run_media.sha256 = media_blobs.sha256)"
+
+	var hashes []string
+	if err := db.Model(&models.MediaBlob{}).Where(unreferenced, cutoff).Pluck("sha256", &hashes).Error; err != nil {
+		return fmt.Errorf("failed to find unreferenced media: %w", err)
+	}
+
+	removed := 0
+	for _, hash := range hashes {
+		// Recheck so a blob reused since the query is kept
+		result := db.Where("sha256 = ? AND "+unreferenced, hash, cutoff).Delete(&models.MediaBlob{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete media blob: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		if err := s.store.Delete(ctx, MediaKey(hash)); err != nil {
+			return err
+		}
+		removed++
+	}
+	if removed > 0 {
+		utils.Info("Removed unreferenced media", zap.Int("count", removed))
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+var standardDistances = []struct {
+	category string
+	meters   float64
+}{
+	{models.RecordCategory1K, 1000},
+	{models.RecordCategory5K, 5000},
+	{models.RecordCategory10K, 10000},
+	{models.RecordCategoryHalfMarathon, 21097.5},
+	{models.RecordCategoryMarathon, 42195},
+}
+
+// Runs shorter than this do not count for the fastest pace record.
+const fastestPaceMinMeters = 1000.0
+
+// RecordCategories lists the record categories in display order.
+var RecordCategories = []string{
+	models.RecordCategory1K,
+	models.RecordCategory5K,
+	models.RecordCategory10K,
+	models.RecordCategoryHalfMarathon,
+	models.RecordCategoryMarathon,
+	models.RecordCategoryLongestRun,
+	models.RecordCategoryFastestPace,
+}
+
+// ComputeBestEfforts finds the fastest segment of the track for every
+// standard distance it covers. Segments may start anywhere, not only at a
+// kilometer mark, and their start is interpolated between fixes.
+func ComputeBestEfforts(points []models.WaypointData) []models.RunBestEffort {
+	if len(points) < 2 {
+		return nil
+	}
+
+	track := newTrackIndex(points)
+	var efforts []models.RunBestEffort
+
+	for _, d := range standardDistances {
+		if track.total() < d.meters {
+			break
+		}
+
+		best := models.RunBestEffort{Category: d.category, DistanceMeters: d.meters, DurationSeconds: math.Inf(1)}
+		i := 0
+		for j := 1; j < len(points); j++ {
+			target := track.cumulative[j] - d.meters
+			if target < 0 {
+				continue
+			}
+			for i+1 < j && track.cumulative[i+1] <= target {
+				i++
+			}
+
+			start := points[i].Timestamp
+			if segment := track.cumulative[i+1] - track.cumulative[i]; segment > 0 {
+				frac := (target - track.cumulative[i]) / segment
+				start = start.Add(time.Duration(frac * float64(points[i+1].Timestamp.Sub(points[i].Timestamp))))
+			}
+
+			duration := points[j].Timestamp.Sub(start).Seconds()
+			if duration > 0 && duration < best.DurationSeconds {
+				best.DurationSeconds = duration
+				best.StartSeq = i
+				best.EndSeq = j
+				best.StartedAt = start
+			}
+		}
+
+		if !math.IsInf(best.DurationSeconds, 1) {
+			best.DurationSeconds = round2(best.DurationSeconds)
+			efforts = append(efforts, best)
+		}
+	}
+	return efforts
+}
+
+type RecordService struct {
+	db              *gorm.DB
+	waypointService *WaypointService
+}
+
+func NewRecordService(db *gorm.DB) *RecordService {
+	return &RecordService{
+		db:              db,
+		waypointService: NewWaypointService(db),
+	}
+}
+
+// SaveBestEfforts replaces the best efforts of a run inside tx.
+func (s *RecordService) SaveBestEfforts(tx *gorm.DB, runID uuid.UUID, points []models.WaypointData) error {
+	if err := tx.Where("run_id = ?", runID).Delete(&models.RunBestEffort{}).Error; err != nil {
+		return fmt.Errorf("failed to clear best efforts: %w", err)
+	}
+
+	efforts := ComputeBestEfforts(points)
+	if len(efforts) > 0 {
+		for i := range efforts {
+			efforts[i].RunID = runID
+		}
+		if err := tx.Create(&efforts).Error; err != nil {
+			return fmt.Errorf("failed to save best efforts: %w", err)
+		}
+	}
+
+	if err := tx.Model(&models.Run{}).Where("id = ?", runID).Update("best_efforts_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to mark best efforts: %w", err)
+	}
+	return nil
+}
+
+// Recalculate rebuilds a user's personal records from their runs inside tx
+// and returns the categories in which runID newly holds the record.
+func (s *RecordService) Recalculate(tx *gorm.DB, userID, runID uuid.UUID) ([]string, error) {
+	var previous []models.PersonalRecord
+	if err := tx.Where("user_id = ?", userID).Find(&previous).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch personal records: %w", err)
+	}
+	heldBefore := make(map[string]uuid.UUID, len(previous))
+	for _, r := range previous {
+		heldBefore[r.Category] = r.RunID
+	}
+
+	records, err := s.computeRecords(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.PersonalRecord{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to clear personal records: %w", err)
+	}
+	if len(records) > 0 {
+		if err := tx.Create(&records).Error; err != nil {
+			return nil, fmt.Errorf("failed to save personal records: %w", err)
+		}
+	}
+
+	var newRecords []string
+	for _, r := range records {
+		if r.RunID == runID && heldBefore[r.Category] != runID {
+			newRecords = append(newRecords, r.Category)
+		}
+	}
+	return newRecords, nil
+}
+
+func (s *RecordService) computeRecords(db *gorm.DB, userID uuid.UUID) ([]models.PersonalRecord, error) {
+	var records []models.PersonalRecord
+
+	for _, d := range standardDistances {
+		var best struct {
+			models.RunBestEffort
+			RunStartedAt time.Time
+		}
+		err := db.Table("run_best_efforts").
+			Select("run_best_efforts.*, runs.started_at as run_started_at").
+			Joins("JOIN runs ON runs.id = run_best_efforts.run_id").
+			Where("runs.user_id = ? AND run_best_efforts.category = ?", userID, d.category).
+			Order("run_best_efforts.duration_seconds ASC, runs.started_at ASC").
+			Limit(1).
+			Scan(&best).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to find best %s: %w", d.category, err)
+		}
+		if best.RunID == uuid.Nil {
+			continue
+		}
+
+		pace := round2(best.DurationSeconds / (best.DistanceMeters / 1000))
+		startSeq, endSeq := best.StartSeq, best.EndSeq
+		records = append(records, models.PersonalRecord{
+			UserID:           userID,
+			Category:         d.category,
+			RunID:            best.RunID,
+			DistanceMeters:   best.DistanceMeters,
+			DurationSeconds:  best.DurationSeconds,
+			PaceSecondsPerKm: &pace,
+			StartSeq:         &startSeq,
+			EndSeq:           &endSeq,
+			AchievedAt:       best.RunStartedAt,
+		})
+	}
+
+	// Whole-run records prefer the server-computed metrics and fall back to
+	// what the device reported for runs without a track
+	distance := "COALESCE(computed_distance_meters, distance_meters)"
+	speed := "COALESCE(computed_avg_speed_kmh, avg_speed_kmh)"
+
+	var longest models.Run
+	result := db.Where("user_id = ? AND "+distance+" IS NOT NULL", userID).
+		Order(distance + " DESC, started_at ASC").Limit(1).Find(&longest)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find longest run: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		records = append(records, wholeRunRecord(userID, models.RecordCategoryLongestRun, &longest))
+	}
+
+	var fastest models.Run
+	result = db.Where("user_id = ? AND "+distance+" >= ? AND "+speed+" > 0", userID, fastestPaceMinMeters).
+		Order(speed + " DESC, started_at ASC").Limit(1).Find(&fastest)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find fastest run: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		records = append(records, wholeRunRecord(userID, models.RecordCategoryFastestPace, &fastest))
+	}
+
+	return records, nil
+}
+
+func wholeRunRecord(userID uuid.UUID, category string, run *models.Run) models.PersonalRecord {
+	record := models.PersonalRecord{
+		UserID:     userID,
+		Category:   category,
+		RunID:      run.ID,
+		AchievedAt: run.StartedAt,
+	}
+
+	if run.ComputedDistanceMeters != nil {
+		record.DistanceMeters = *run.ComputedDistanceMeters
+	} else if run.DistanceMeters != nil {
+		record.DistanceMeters = *run.DistanceMeters
+	}
+
+	// Pace is over moving time, matching the average speed it is ranked by
+	switch {
+	case run.ComputedAvgSpeedKmh != nil && run.MovingTimeSeconds != nil:
+		record.DurationSeconds = float64(*run.MovingTimeSeconds)
+	case run.DurationSeconds != nil:
+		record.DurationSeconds = float64(*run.DurationSeconds)
+	}
+
+	speed := run.ComputedAvgSpeedKmh
+	if speed == nil {
+		speed = run.AvgSpeedKmh
+	}
+	if speed != nil && *speed > 0 {
+		pace := round2(3600 / *speed)
+		record.PaceSecondsPerKm = &pace
+	}
+	return record
+}
+
+// GetRecords returns a user's personal records, first extracting best
+// efforts from any runs stored before records were tracked.
+func (s *RecordService) GetRecords(userID uuid.UUID) ([]models.PersonalRecord, error) {
+	var pending []uuid.UUID
+	err := s.db.Model(&models.Run{}).Where("user_id = ? AND best_efforts_at IS NULL", userID).Pluck("id", &pending).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	for _, runID := range pending {
+		points, err := s.waypointService.LoadTrack(runID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.SaveBestEfforts(s.db, runID, points); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(pending) > 0 {
+		if err := s.db.Transaction(func(tx *gorm.DB) error {
+			_, err := s.Recalculate(tx, userID, uuid.Nil)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var records []models.PersonalRecord
+	if err := s.db.Where("user_id = ?", userID).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch personal records: %w", err)
+	}
+
+	order := make(map[string]int, len(RecordCategories))
+	for i, c := range RecordCategories {
+		order[c] = i
+	}
+	sort.Slice(records, func(i, j int) bool { return order[records[i].Category] < order[records[j].Category] })
+	return records, nil
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/database"
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+const (
+	// Segments slower than this are treated as standing still when computing
+	// moving time.
+	movingSpeedThresholdMps = 0.5
+	// Gaps between fixes longer than this are treated as pauses.
+	maxMovingGap = 30 * time.Second
+	// Max speed is taken over a sliding window instead of single fixes so one
+	// noisy sample cannot dominate.
+	speedSmoothingWindow = 10 * time.Second
+)
+
+// ErrTrackTooShort is returned when reanalyzing a run with fewer than two
+// usable waypoints.
+var ErrTrackTooShort = errors.New("at least two waypoints are required")
+
+// DiscrepancyThresholds define how far device-reported metrics may drift from
+// the server's recomputation before a run is flagged. Each check needs both
+// the relative and the absolute difference to be exceeded.
+type DiscrepancyThresholds struct {
+	DistanceRatio   float64
+	DistanceMeters  float64
+	DurationRatio   float64
+	DurationSeconds float64
+	AvgSpeedRatio   float64
+	MaxSpeedRatio   float64
+	SpeedKmh        float64
+}
+
+var DefaultDiscrepancyThresholds = DiscrepancyThresholds{
+	DistanceRatio:   0.10,
+	DistanceMeters:  100,
+	DurationRatio:   0.10,
+	DurationSeconds: 60,
+	AvgSpeedRatio:   0.15,
+	MaxSpeedRatio:   0.25,
+	SpeedKmh:        1,
+}
+
+type TrackAnalysis struct {
+	DistanceMeters float64
+	ElapsedSeconds int
+	MovingSeconds  int
+	AvgSpeedKmh    float64
+	MaxSpeedKmh    float64
+	PointCount     int
+	Elevation      *ElevationStats
+}
+
+// AnalyzeTrack recomputes run totals from GPS fixes: haversine distance,
+// elapsed and moving time, average moving speed and smoothed max speed.
+// It returns nil when there are fewer than two usable points.
+func AnalyzeTrack(points []models.WaypointData) *TrackAnalysis {
+	if len(points) < 2 {
+		return nil
+	}
+
+	sorted := make([]models.WaypointData, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	analysis := &TrackAnalysis{PointCount: len(sorted)}
+	cumulative := make([]float64, len(sorted))
+	var moving time.Duration
+
+	for i := 1; i < len(sorted); i++ {
+		d := haversineMeters(sorted[i-1].Latitude, sorted[i-1].Longitude, sorted[i].Latitude, sorted[i].Longitude)
+		cumulative[i] = cumulative[i-1] + d
+
+		dt := sorted[i].Timestamp.Sub(sorted[i-1].Timestamp)
+		if dt <= 0 || dt > maxMovingGap {
+			continue
+		}
+		if d/dt.Seconds() >= movingSpeedThresholdMps {
+			moving += dt
+		}
+	}
+
+	analysis.DistanceMeters = cumulative[len(cumulative)-1]
+	analysis.ElapsedSeconds = int(math.Round(sorted[len(sorted)-1].Timestamp.Sub(sorted[0].Timestamp).Seconds()))
+	analysis.MovingSeconds = int(math.Round(moving.Seconds()))
+	if analysis.MovingSeconds > 0 {
+		analysis.AvgSpeedKmh = analysis.DistanceMeters / moving.Seconds() * 3.6
+	}
+	analysis.MaxSpeedKmh = smoothedMaxSpeed(sorted, cumulative) * 3.6
+	analysis.Elevation = ComputeElevation(sorted)
+
+	return analysis
+}
+
+// smoothedMaxSpeed returns the highest average speed over any window of at
+// least speedSmoothingWindow, in metres per second.
+func smoothedMaxSpeed(points []models.WaypointData, cumulative []float64) float64 {
+	var best float64
+	start := 0
+	for end := 1; end < len(points); end++ {
+		for start < end-1 && points[end].Timestamp.Sub(points[start+1].Timestamp) >= speedSmoothingWindow {
+			start++
+		}
+		window := points[end].Timestamp.Sub(points[start].Timestamp)
+		if window < speedSmoothingWindow || window > speedSmoothingWindow+maxMovingGap {
+			continue
+		}
+		speed := (cumulative[end] - cumulative[start]) / window.Seconds()
+		if speed > best {
+			best = speed
+		}
+	}
+	return best
+}
+
+// ApplyTrackAnalysis stores the server-computed metrics on the run next to the
+// device-reported ones and flags the run when they disagree.
+func ApplyTrackAnalysis(run *models.Run, analysis *TrackAnalysis, thresholds DiscrepancyThresholds) {
+	if analysis == nil {
+		return
+	}
+
+	now := time.Now()
+	distance := round2(analysis.DistanceMeters)
+	elapsed := analysis.ElapsedSeconds
+	movingTime := analysis.MovingSeconds
+	avgSpeed := round2(analysis.AvgSpeedKmh)
+	maxSpeed := round2(analysis.MaxSpeedKmh)
+
+	run.ComputedDistanceMeters = &distance
+	run.ComputedDurationSeconds = &elapsed
+	run.MovingTimeSeconds = &movingTime
+	run.ComputedAvgSpeedKmh = &avgSpeed
+	run.ComputedMaxSpeedKmh = &maxSpeed
+	run.AnalyzedAt = &now
+
+	if analysis.Elevation != nil {
+		gain := round2(analysis.Elevation.GainMeters)
+		loss := round2(analysis.Elevation.LossMeters)
+		minElevation := round2(analysis.Elevation.MinMeters)
+		maxElevation := round2(analysis.Elevation.MaxMeters)
+		run.ElevationGainMeters = &gain
+		run.ElevationLossMeters = &loss
+		run.MinElevationMeters = &minElevation
+		run.MaxElevationMeters = &maxElevation
+		if run.ElevationSource == "" {
+			run.ElevationSource = models.ElevationSourceGPS
+		}
+	}
+
+	var flags []string
+	if run.DistanceMeters != nil && exceeds(*run.DistanceMeters, distance, thresholds.DistanceRatio, thresholds.DistanceMeters) {
+		flags = append(flags, "distance_meters")
+	}
+	if run.DurationSeconds != nil && exceeds(float64(*run.DurationSeconds), float64(elapsed), thresholds.DurationRatio, thresholds.DurationSeconds) {
+		flags = append(flags, "duration_seconds")
+	}
+	if run.AvgSpeedKmh != nil && movingTime > 0 && exceeds(*run.AvgSpeedKmh, avgSpeed, thresholds.AvgSpeedRatio, thresholds.SpeedKmh) {
+		flags = append(flags, "avg_speed_kmh")
+	}
+	if run.MaxSpeedKmh != nil && maxSpeed > 0 && exceeds(*run.MaxSpeedKmh, maxSpeed, thresholds.MaxSpeedRatio, thresholds.SpeedKmh) {
+		flags = append(flags, "max_speed_kmh")
+	}
+
+	run.MetricsFlagged = len(flags) > 0
+	run.MetricsDiscrepancies = strings.Join(flags, ",")
+}
+
+func exceeds(reported, computed, ratio, absolute float64) bool {
+	diff := math.Abs(reported - computed)
+	if diff <= absolute {
+		return false
+	}
+	base := math.Max(math.Abs(computed), 1e-9)
+	return diff/base > ratio
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+type RunAnalysisService struct {
+	db              *gorm.DB
+	waypointService *WaypointService
+	persistence     *RunPersistence
+	gpsFilter       *GPSFilter
+	dem             *DEM
+	thresholds      DiscrepancyThresholds
+}
+
+func NewRunAnalysisService(db *gorm.DB) *RunAnalysisService {
+	return &RunAnalysisService{
+		db:              db,
+		waypointService: NewWaypointService(db),
+		persistence:     NewRunPersistence(db),
+		gpsFilter:       NewGPSFilter(DefaultGPSFilterConfig),
+		dem:             currentDEM(),
+		thresholds:      DefaultDiscrepancyThresholds,
+	}
+}
+
+// Prepare cleans an uploaded track, replaces its altitudes from the DEM when
+// one is loaded and covers the route, and analyzes the result onto run. The
+// returned points are what should be stored as the filtered track.
+func (s *RunAnalysisService) Prepare(run *models.Run, raw []models.WaypointData) []models.WaypointData {
+	filtered := s.gpsFilter.Process(raw)
+	if corrected, ok := s.dem.CorrectAltitudes(filtered); ok {
+		filtered = corrected
+		run.ElevationSource = models.ElevationSourceDEM
+	}
+	s.Apply(run, filtered)
+	return filtered
+}
+
+// Apply analyzes points and records the result on run without saving it.
+func (s *RunAnalysisService) Apply(run *models.Run, points []models.WaypointData) {
+	ApplyTrackAnalysis(run, AnalyzeTrack(points), s.thresholds)
+}
+
+// Reanalyze recomputes metrics for a stored run from its filtered track,
+// building that track first for runs stored before filtering existed, and
+// refreshes everything derived from them in one transaction. It returns
+// ErrTrackTooShort when the track cannot be analyzed.
+func (s *RunAnalysisService) Reanalyze(runID uuid.UUID) (*models.Run, *RunSaveResult, error) {
+	tx, release, err := database.BeginPinned(s.db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer release()
+
+	run, result, err := s.reanalyze(tx, runID)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to commit: %w", err)
+	}
+	return run, result, nil
+}
+
+func (s *RunAnalysisService) reanalyze(tx *gorm.DB, runID uuid.UUID) (*models.Run, *RunSaveResult, error) {
+	points, err := s.waypointService.EnsureFilteredTrack(tx, runID, s.gpsFilter, s.dem)
+	if err != nil {
+		return nil, nil, err
+	}
+	analysis := AnalyzeTrack(points)
+	if analysis == nil {
+		return nil, nil, ErrTrackTooShort
+	}
+
+	// Loaded after the track so a DEM correction of it is reflected
+	var run models.Run
+	if err := tx.Where("id = ?", runID).First(&run).Error; err != nil {
+		return nil, nil, err
+	}
+	ApplyTrackAnalysis(&run, analysis, s.thresholds)
+
+	result, err := s.persistence.Refresh(tx, &run, points)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &run, result, nil
+}
@@ -0,0 +1,397 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+const (
+	ExportFormatGPX     = "gpx"
+	ExportFormatTCX     = "tcx"
+	ExportFormatGeoJSON = "geojson"
+	ExportFormatCSV     = "csv"
+)
+
+var exportContentTypes = map[string]string{
+	ExportFormatGPX:     "application/gpx+xml",
+	ExportFormatTCX:     "application/vnd.garmin.tcx+xml",
+	ExportFormatGeoJSON: "application/geo+json",
+	ExportFormatCSV:     "text/csv; charset=utf-8",
+}
+
+// ExportContentType reports the MIME type for an export format and whether
+// the format is supported.
+func ExportContentType(format string) (string, bool) {
+	contentType, ok := exportContentTypes[format]
+	return contentType, ok
+}
+
+// ExportFilename builds an ASCII-only download name for a run.
+func ExportFilename(run *models.Run, format string) string {
+	return fmt.Sprintf("runsight-%s-%s.%s",
+		run.StartedAt.UTC().Format("20060102-150405"), run.ID.String()[:8], format)
+}
+
+// ExportRun writes the run and its track to w in the requested format.
+func ExportRun(w io.Writer, format string, run *models.Run, points []models.WaypointData) error {
+	switch format {
+	case ExportFormatGPX:
+		return writeGPX(w, run, points)
+	case ExportFormatTCX:
+		return writeTCX(w, run, points)
+	case ExportFormatGeoJSON:
+		return writeGeoJSON(w, run, points)
+	case ExportFormatCSV:
+		return writeCSV(w, points)
+	}
+	return fmt.Errorf("unsupported export format: %s", format)
+}
+
+func runName(run *models.Run) string {
+	if run.Title != "" {
+		return run.Title
+	}
+	return "Run " + run.StartedAt.UTC().Format("2006-01-02 15:04")
+}
+
+// cumulativeDistances returns the distance travelled up to each point.
+func cumulativeDistances(points []models.WaypointData) []float64 {
+	distances := make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		distances[i] = distances[i-1] + haversineMeters(
+			points[i-1].Latitude, points[i-1].Longitude,
+			points[i].Latitude, points[i].Longitude,
+		)
+	}
+	return distances
+}
+
+type gpxFile struct {
+	XMLName        xml.Name    `xml:"gpx"`
+	Version        string      `xml:"version,attr"`
+	Creator        string      `xml:"creator,attr"`
+	Xmlns          string      `xml:"xmlns,attr"`
+	XmlnsXsi       string      `xml:"xmlns:xsi,attr"`
+	XmlnsTPX       string      `xml:"xmlns:gpxtpx,attr"`
+	SchemaLocation string      `xml:"xsi:schemaLocation,attr"`
+	Metadata       gpxMetadata `xml:"metadata"`
+	Track          gpxTrack    `xml:"trk"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name"`
+	Desc string `xml:"desc,omitempty"`
+	Time string `xml:"time"`
+}
+
+type gpxTrack struct {
+	Name    string          `xml:"name"`
+	Type    string          `xml:"type"`
+	Segment gpxTrackSegment `xml:"trkseg"`
+}
+
+type gpxTrackSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat        string         `xml:"lat,attr"`
+	Lon        string         `xml:"lon,attr"`
+	Ele        *string        `xml:"ele,omitempty"`
+	Time       string         `xml:"time"`
+	Extensions *gpxExtensions `xml:"extensions,omitempty"`
+}
+
+type gpxExtensions struct {
+	TrackPoint gpxTrackPointExtension `xml:"gpxtpx:TrackPointExtension"`
+}
+
+type gpxTrackPointExtension struct {
+	Speed  *string `xml:"gpxtpx:speed,omitempty"`
+	Course *string `xml:"gpxtpx:course,omitempty"`
+}
+
+func writeGPX(w io.Writer, run *models.Run, points []models.WaypointData) error {
+	doc := gpxFile{
+		Version:        "1.1",
+		Creator:        "RunSight",
+		Xmlns:          "http://www.topografix.com/GPX/1/1",
+		XmlnsXsi:       "http://www.w3.org/2001/XMLSchema-instance",
+		XmlnsTPX:       "http://www.garmin.com/xmlschemas/TrackPointExtension/v2",
+		SchemaLocation: "http://www.topografix.com/GPX/1/1 http://www.topografix.com/GPX/1/1/gpx.xsd http://www.garmin.com/xmlschemas/TrackPointExtension/v2 http://www.garmin.com/xmlschemas/TrackPointExtensionv2.xsd",
+		Metadata: gpxMetadata{
+			Name: runName(run),
+			Desc: run.Notes,
+			Time: formatXMLTime(run.StartedAt),
+		},
+		Track: gpxTrack{
+			Name: runName(run),
+			Type: "running",
+		},
+	}
+
+	doc.Track.Segment.Points = make([]gpxPoint, 0, len(points))
+	for _, p := range points {
+		point := gpxPoint{
+			Lat:  formatCoord(p.Latitude),
+			Lon:  formatCoord(p.Longitude),
+			Ele:  formatOptional(p.Altitude, 1),
+			Time: formatXMLTime(p.Timestamp),
+		}
+		if p.Speed != nil || p.Heading != nil {
+			point.Extensions = &gpxExtensions{
+				TrackPoint: gpxTrackPointExtension{
+					Speed:  formatOptional(p.Speed, 2),
+					Course: formatOptional(p.Heading, 1),
+				},
+			}
+		}
+		doc.Track.Segment.Points = append(doc.Track.Segment.Points, point)
+	}
+
+	return writeXML(w, doc)
+}
+
+type tcxFile struct {
+	XMLName        xml.Name      `xml:"TrainingCenterDatabase"`
+	Xmlns          string        `xml:"xmlns,attr"`
+	XmlnsXsi       string        `xml:"xmlns:xsi,attr"`
+	XmlnsNS3       string        `xml:"xmlns:ns3,attr"`
+	SchemaLocation string        `xml:"xsi:schemaLocation,attr"`
+	Activities     tcxActivities `xml:"Activities"`
+}
+
+type tcxActivities struct {
+	Activity tcxActivity `xml:"Activity"`
+}
+
+type tcxActivity struct {
+	Sport string `xml:"Sport,attr"`
+	ID    string `xml:"Id"`
+	Lap   tcxLap `xml:"Lap"`
+	Notes string `xml:"Notes,omitempty"`
+}
+
+type tcxLap struct {
+	StartTime        string   `xml:"StartTime,attr"`
+	TotalTimeSeconds string   `xml:"TotalTimeSeconds"`
+	DistanceMeters   string   `xml:"DistanceMeters"`
+	MaximumSpeed     *string  `xml:"MaximumSpeed,omitempty"`
+	Calories         int      `xml:"Calories"`
+	Intensity        string   `xml:"Intensity"`
+	TriggerMethod    string   `xml:"TriggerMethod"`
+	Track            tcxTrack `xml:"Track"`
+}
+
+type tcxTrack struct {
+	Points []tcxTrackpoint `xml:"Trackpoint"`
+}
+
+type tcxTrackpoint struct {
+	Time           string         `xml:"Time"`
+	Position       tcxPosition    `xml:"Position"`
+	AltitudeMeters *string        `xml:"AltitudeMeters,omitempty"`
+	DistanceMeters string         `xml:"DistanceMeters"`
+	Extensions     *tcxExtensions `xml:"Extensions,omitempty"`
+}
+
+type tcxPosition struct {
+	LatitudeDegrees  string `xml:"LatitudeDegrees"`
+	LongitudeDegrees string `xml:"LongitudeDegrees"`
+}
+
+type tcxExtensions struct {
+	TPX tcxTPX `xml:"ns3:TPX"`
+}
+
+type tcxTPX struct {
+	Speed string `xml:"ns3:Speed"`
+}
+
+func writeTCX(w io.Writer, run *models.Run, points []models.WaypointData) error {
+	distances := cumulativeDistances(points)
+
+	totalSeconds := 0.0
+	if run.DurationSeconds != nil {
+		totalSeconds = float64(*run.DurationSeconds)
+	} else if len(points) > 1 {
+		totalSeconds = points[len(points)-1].Timestamp.Sub(points[0].Timestamp).Seconds()
+	}
+
+	totalDistance := 0.0
+	if run.DistanceMeters != nil {
+		totalDistance = *run.DistanceMeters
+	} else if len(distances) > 0 {
+		totalDistance = distances[len(distances)-1]
+	}
+
+	calories := 0
+	if run.CaloriesBurned != nil {
+		calories = *run.CaloriesBurned
+	}
+
+	lap := tcxLap{
+		StartTime:        formatXMLTime(run.StartedAt),
+		TotalTimeSeconds: strconv.FormatFloat(totalSeconds, 'f', 1, 64),
+		DistanceMeters:   strconv.FormatFloat(totalDistance, 'f', 2, 64),
+		Calories:         calories,
+		Intensity:        "Active",
+		TriggerMethod:    "Manual",
+	}
+	if run.MaxSpeedKmh != nil {
+		maxSpeed := *run.MaxSpeedKmh / 3.6
+		lap.MaximumSpeed = formatOptional(&maxSpeed, 2)
+	}
+
+	lap.Track.Points = make([]tcxTrackpoint, 0, len(points))
+	for i, p := range points {
+		point := tcxTrackpoint{
+			Time: formatXMLTime(p.Timestamp),
+			Position: tcxPosition{
+				LatitudeDegrees:  formatCoord(p.Latitude),
+				LongitudeDegrees: formatCoord(p.Longitude),
+			},
+			AltitudeMeters: formatOptional(p.Altitude, 1),
+			DistanceMeters: strconv.FormatFloat(distances[i], 'f', 2, 64),
+		}
+		if p.Speed != nil {
+			point.Extensions = &tcxExtensions{
+				TPX: tcxTPX{Speed: strconv.FormatFloat(*p.Speed, 'f', 2, 64)},
+			}
+		}
+		lap.Track.Points = append(lap.Track.Points, point)
+	}
+
+	doc := tcxFile{
+		Xmlns:          "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2",
+		XmlnsXsi:       "http://www.w3.org/2001/XMLSchema-instance",
+		XmlnsNS3:       "http://www.garmin.com/xmlschemas/ActivityExtension/v2",
+		SchemaLocation: "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2 http://www.garmin.com/xmlschemas/TrainingCenterDatabasev2.xsd",
+		Activities: tcxActivities{
+			Activity: tcxActivity{
+				Sport: "Running",
+				ID:    formatXMLTime(run.StartedAt),
+				Lap:   lap,
+				Notes: run.Notes,
+			},
+		},
+	}
+
+	return writeXML(w, doc)
+}
+
+func writeGeoJSON(w io.Writer, run *models.Run, points []models.WaypointData) error {
+	coordinates := make([][]float64, 0, len(points))
+	times := make([]string, 0, len(points))
+	speeds := make([]*float64, 0, len(points))
+	for _, p := range points {
+		coord := []float64{p.Longitude, p.Latitude}
+		if p.Altitude != nil {
+			coord = append(coord, *p.Altitude)
+		}
+		coordinates = append(coordinates, coord)
+		times = append(times, p.Timestamp.UTC().Format(time.RFC3339Nano))
+		speeds = append(speeds, p.Speed)
+	}
+
+	properties := map[string]interface{}{
+		"id":               run.ID,
+		"name":             runName(run),
+		"started_at":       run.StartedAt.UTC().Format(time.RFC3339),
+		"ended_at":         run.EndedAt,
+		"duration_seconds": run.DurationSeconds,
+		"distance_meters":  run.DistanceMeters,
+		"avg_speed_kmh":    run.AvgSpeedKmh,
+		"max_speed_kmh":    run.MaxSpeedKmh,
+		"calories_burned":  run.CaloriesBurned,
+		"coordTimes":       times,
+		"speeds":           speeds,
+	}
+
+	feature := map[string]interface{}{
+		"type": "Feature",
+		"geometry": map[string]interface{}{
+			"type":        "LineString",
+			"coordinates": coordinates,
+		},
+		"properties": properties,
+	}
+
+	encoder := json.NewEncoder(w)
+	return encoder.Encode(map[string]interface{}{
+		"type":     "FeatureCollection",
+		"features": []interface{}{feature},
+	})
+}
+
+func writeCSV(w io.Writer, points []models.WaypointData) error {
+	distances := cumulativeDistances(points)
+
+	writer := csv.NewWriter(w)
+	header := []string{"seq", "timestamp", "latitude", "longitude", "altitude_m", "speed_mps", "heading_deg", "accuracy_m", "distance_m"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for i, p := range points {
+		record := []string{
+			strconv.Itoa(i),
+			p.Timestamp.UTC().Format(time.RFC3339Nano),
+			formatCoord(p.Latitude),
+			formatCoord(p.Longitude),
+			optionalString(p.Altitude, 1),
+			optionalString(p.Speed, 2),
+			optionalString(p.Heading, 1),
+			optionalString(p.Accuracy, 1),
+			strconv.FormatFloat(distances[i], 'f', 2, 64),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func formatXMLTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', 8, 64)
+}
+
+func formatOptional(v *float64, precision int) *string {
+	if v == nil {
+		return nil
+	}
+	s := strconv.FormatFloat(*v, 'f', precision, 64)
+	return &s
+}
+
+func optionalString(v *float64, precision int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', precision, 64)
+}
@@ -0,0 +1,532 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/database"
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+// MaxImportActivities caps how many activities one import request reads and
+// stores across all its files, so the request finishes within the server's
+// write timeout.
+const MaxImportActivities = 50
+
+// ErrImportLimit is reported for the first activity of a request beyond
+// MaxImportActivities; nothing after it is read.
+var ErrImportLimit = fmt.Errorf("at most %d activities can be imported per request", MaxImportActivities)
+
+const (
+	maxImportEntryBytes = 50 << 20
+
+	// Two runs are considered the same activity when they start within this
+	// window and their distances differ by less than the tolerance below.
+	importDuplicateWindow        = 2 * time.Minute
+	importDuplicateDistanceRatio = 0.02
+	importDuplicateDistanceFloor = 50.0
+)
+
+const (
+	ImportStatusSaved         = "saved"
+	ImportStatusAlreadyExists = "already_exists"
+	ImportStatusError         = "error"
+)
+
+// ParsedActivity is a run decoded from an external file, before it is stored.
+type ParsedActivity struct {
+	Name            string
+	Notes           string
+	StartedAt       time.Time
+	Points          []models.WaypointData
+	LapMarkers      []time.Time
+	DurationSeconds *int
+	DistanceMeters  *float64
+	CaloriesBurned  *int
+}
+
+// ImportFile is an uploaded file, read in place so archives of a long
+// history never have to fit in memory.
+type ImportFile struct {
+	Name string
+	Data io.ReaderAt
+	Size int64
+}
+
+type ImportResult struct {
+	File      string     `json:"file"`
+	RunID     *uuid.UUID `json:"run_id,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+}
+
+type RunImportService struct {
+	db          *gorm.DB
+	persistence *RunPersistence
+	gpsFilter   *GPSFilter
+	dem         *DEM
+}
+
+func NewRunImportService(db *gorm.DB) *RunImportService {
+	return &RunImportService{
+		db:          db,
+		persistence: NewRunPersistence(db),
+		gpsFilter:   NewGPSFilter(DefaultGPSFilterConfig),
+		dem:         currentDEM(),
+	}
+}
+
+// Import decodes a GPX, TCX, FIT or zip file and stores up to limit of the
+// activities it contains for the user, returning one result per activity or
+// failed entry. Reaching the limit ends the file with an error result.
+func (s *RunImportService) Import(userID uuid.UUID, file ImportFile, limit int) []ImportResult {
+	magic := make([]byte, 4)
+	n, _ := file.Data.ReadAt(magic, 0)
+	if strings.EqualFold(path.Ext(file.Name), ".zip") || bytes.Equal(magic[:n], []byte("PK\x03\x04")) {
+		return s.importArchive(userID, file, limit)
+	}
+
+	if file.Size > maxImportEntryBytes {
+		return []ImportResult{{File: file.Name, Status: ImportStatusError, Error: "file too large"}}
+	}
+	data, err := io.ReadAll(io.NewSectionReader(file.Data, 0, file.Size))
+	if err != nil {
+		return []ImportResult{{File: file.Name, Status: ImportStatusError, Error: "failed to read file: " + err.Error()}}
+	}
+	return s.importFile(userID, file.Name, data, limit)
+}
+
+func (s *RunImportService) importFile(userID uuid.UUID, name string, data []byte, limit int) []ImportResult {
+	activities, err := ParseActivityFile(name, data)
+	if err != nil {
+		return []ImportResult{{File: name, Status: ImportStatusError, Error: err.Error()}}
+	}
+
+	results := make([]ImportResult, 0, min(len(activities), limit+1))
+	for i := range activities {
+		label := name
+		if len(activities) > 1 {
+			label = fmt.Sprintf("%s#%d", name, i+1)
+		}
+		if i >= limit {
+			results = append(results, ImportResult{File: label, Status: ImportStatusError, Error: ErrImportLimit.Error()})
+			break
+		}
+		results = append(results, s.importActivity(userID, label, &activities[i]))
+	}
+	return results
+}
+
+func (s *RunImportService) importArchive(userID uuid.UUID, file ImportFile, limit int) []ImportResult {
+	reader, err := zip.NewReader(file.Data, file.Size)
+	if err != nil {
+		return []ImportResult{{File: file.Name, Status: ImportStatusError, Error: "invalid zip archive: " + err.Error()}}
+	}
+
+	var results []ImportResult
+	for _, entry := range reader.File {
+		if entry.FileInfo().IsDir() || !isSupportedImportName(entry.Name) {
+			continue
+		}
+
+		label := file.Name + "/" + entry.Name
+		if len(results) >= limit {
+			results = append(results, ImportResult{File: label, Status: ImportStatusError, Error: ErrImportLimit.Error()})
+			break
+		}
+
+		if entry.UncompressedSize64 > maxImportEntryBytes {
+			results = append(results, ImportResult{File: label, Status: ImportStatusError, Error: "archive entry too large"})
+			continue
+		}
+
+		data, err := readZipEntry(entry)
+		if err != nil {
+			results = append(results, ImportResult{File: label, Status: ImportStatusError, Error: err.Error()})
+			continue
+		}
+
+		results = append(results, s.importFile(userID, label, data, limit-len(results))...)
+	}
+
+	if len(results) == 0 {
+		results = append(results, ImportResult{File: file.Name, Status: ImportStatusError, Error: "archive contains no GPX, TCX or FIT files"})
+	}
+	return results
+}
+
+func (s *RunImportService) importActivity(userID uuid.UUID, label string, activity *ParsedActivity) ImportResult {
+	result := ImportResult{File: label, Status: ImportStatusError}
+
+	if len(activity.Points) < 2 {
+		result.Error = "activity has fewer than two timestamped GPS points"
+		return result
+	}
+
+	filtered, demCorrected := s.dem.CorrectAltitudes(s.gpsFilter.Process(activity.Points))
+	run := buildImportedRun(userID, activity, filtered)
+	if demCorrected {
+		run.ElevationSource = models.ElevationSourceDEM
+	}
+	result.StartedAt = &run.StartedAt
+
+	duplicate, err := s.findDuplicate(userID, &run)
+	if err != nil {
+		result.Error = "database error: " + err.Error()
+		return result
+	}
+	if duplicate != nil {
+		result.RunID = &duplicate.ID
+		result.Status = ImportStatusAlreadyExists
+		return result
+	}
+
+	tx, release, err := database.BeginPinned(s.db)
+	if err != nil {
+		result.Error = "transaction error: " + err.Error()
+		return result
+	}
+	defer release()
+
+	payload := &RunPayload{Raw: activity.Points, Filtered: filtered, LapMarkers: activity.LapMarkers}
+	if _, err := s.persistence.Save(tx, &run, payload); err != nil {
+		tx.Rollback()
+		result.Error = err.Error()
+		return result
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		result.Error = "failed to commit: " + err.Error()
+		return result
+	}
+
+	result.RunID = &run.ID
+	result.Status = ImportStatusSaved
+	return result
+}
+
+// findDuplicate looks for an existing run of the user that started at about
+// the same time and covered about the same distance.
+func (s *RunImportService) findDuplicate(userID uuid.UUID, run *models.Run) (*models.Run, error) {
+	var candidates []models.Run
+	err := s.db.Select("id", "session_id", "started_at", "distance_meters").
+		Where("user_id = ? AND started_at BETWEEN ? AND ?", userID,
+			run.StartedAt.Add(-importDuplicateWindow), run.StartedAt.Add(importDuplicateWindow)).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range candidates {
+		candidate := &candidates[i]
+		if candidate.SessionID == run.SessionID {
+			return candidate, nil
+		}
+		if candidate.DistanceMeters == nil || run.DistanceMeters == nil {
+			return candidate, nil
+		}
+		tolerance := math.Max(importDuplicateDistanceFloor, *run.DistanceMeters*importDuplicateDistanceRatio)
+		if math.Abs(*candidate.DistanceMeters-*run.DistanceMeters) <= tolerance {
+			return candidate, nil
+		}
+	}
+	return nil, nil
+}
+
+func buildImportedRun(userID uuid.UUID, activity *ParsedActivity, filtered []models.WaypointData) models.Run {
+	points := activity.Points
+	first := points[0]
+	last := points[len(points)-1]
+	analysis := AnalyzeTrack(filtered)
+	if analysis == nil {
+		analysis = AnalyzeTrack(points)
+	}
+
+	if activity.StartedAt.IsZero() {
+		activity.StartedAt = first.Timestamp
+	}
+	endedAt := last.Timestamp
+
+	// Totals recorded by the source app take precedence; the track analysis
+	// fills in whatever the file did not carry.
+	distance := analysis.DistanceMeters
+	if activity.DistanceMeters != nil {
+		distance = *activity.DistanceMeters
+	}
+	duration := int(math.Round(last.Timestamp.Sub(activity.StartedAt).Seconds()))
+	if activity.DurationSeconds != nil {
+		duration = *activity.DurationSeconds
+	}
+	if duration < 1 {
+		duration = 1
+	}
+	avgSpeed := round2(distance / float64(duration) * 3.6)
+	maxSpeed := round2(analysis.MaxSpeedKmh)
+
+	// Titles hold up to 100 characters; cut on rune boundaries so the
+	// stored text stays valid UTF-8
+	title := strings.ToValidUTF8(activity.Name, "")
+	if runes := []rune(title); len(runes) > 100 {
+		title = string(runes[:100])
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%.0f", userID, activity.StartedAt.Unix(), distance)))
+
+	run := models.Run{
+		UserID:          userID,
+		DeviceID:        models.ImportDeviceID,
+		SessionID:       "import_" + hex.EncodeToString(sum[:12]),
+		Title:           title,
+		Notes:           strings.ToValidUTF8(activity.Notes, ""),
+		StartedAt:       activity.StartedAt,
+		EndedAt:         &endedAt,
+		DurationSeconds: &duration,
+		DistanceMeters:  &distance,
+		AvgSpeedKmh:     &avgSpeed,
+		MaxSpeedKmh:     &maxSpeed,
+		CaloriesBurned:  activity.CaloriesBurned,
+		StartLatitude:   &first.Latitude,
+		StartLongitude:  &first.Longitude,
+		EndLatitude:     &last.Latitude,
+		EndLongitude:    &last.Longitude,
+	}
+
+	ApplyTrackAnalysis(&run, analysis, DefaultDiscrepancyThresholds)
+	return run
+}
+
+func isSupportedImportName(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".gpx", ".tcx", ".fit":
+		return true
+	}
+	return false
+}
+
+func readZipEntry(entry *zip.File) ([]byte, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive entry: %w", err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxImportEntryBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive entry: %w", err)
+	}
+	if len(data) > maxImportEntryBytes {
+		return nil, errors.New("archive entry too large")
+	}
+	return data, nil
+}
+
+// ParseActivityFile decodes a single GPX, TCX or FIT file. The format is
+// taken from the extension, falling back to sniffing the content.
+func ParseActivityFile(name string, data []byte) ([]ParsedActivity, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".fit":
+		return parseFIT(data)
+	case ".gpx":
+		return parseGPX(data)
+	case ".tcx":
+		return parseTCX(data)
+	}
+
+	if isFIT(data) {
+		return parseFIT(data)
+	}
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	switch {
+	case bytes.Contains(head, []byte("<gpx")):
+		return parseGPX(data)
+	case bytes.Contains(head, []byte("<TrainingCenterDatabase")):
+		return parseTCX(data)
+	}
+	return nil, errors.New("unsupported file format; expected GPX, TCX or FIT")
+}
+
+type gpxInput struct {
+	Metadata struct {
+		Name string `xml:"name"`
+		Desc string `xml:"desc"`
+		Time string `xml:"time"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Desc     string `xml:"desc"`
+		Segments []struct {
+			Points []gpxInputPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxInputPoint struct {
+	Lat        float64  `xml:"lat,attr"`
+	Lon        float64  `xml:"lon,attr"`
+	Ele        *float64 `xml:"ele"`
+	Time       string   `xml:"time"`
+	Extensions struct {
+		TrackPoint struct {
+			Speed  *float64 `xml:"speed"`
+			Course *float64 `xml:"course"`
+		} `xml:"TrackPointExtension"`
+	} `xml:"extensions"`
+}
+
+func parseGPX(data []byte) ([]ParsedActivity, error) {
+	var doc gpxInput
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid GPX: %w", err)
+	}
+
+	activity := ParsedActivity{Name: doc.Metadata.Name, Notes: doc.Metadata.Desc}
+	for _, track := range doc.Tracks {
+		if activity.Name == "" {
+			activity.Name = track.Name
+		}
+		if activity.Notes == "" {
+			activity.Notes = track.Desc
+		}
+		for _, segment := range track.Segments {
+			for _, p := range segment.Points {
+				ts, err := parseXMLTime(p.Time)
+				if err != nil || !validCoordinate(p.Lat, p.Lon) {
+					continue
+				}
+				activity.Points = append(activity.Points, models.WaypointData{
+					Latitude:  p.Lat,
+					Longitude: p.Lon,
+					Altitude:  p.Ele,
+					Heading:   p.Extensions.TrackPoint.Course,
+					Speed:     p.Extensions.TrackPoint.Speed,
+					Timestamp: ts,
+				})
+			}
+		}
+	}
+
+	if len(activity.Points) > 0 {
+		activity.StartedAt = activity.Points[0].Timestamp
+	}
+	return []ParsedActivity{activity}, nil
+}
+
+type tcxInput struct {
+	Activities []struct {
+		ID    string `xml:"Id"`
+		Notes string `xml:"Notes"`
+		Laps  []struct {
+			StartTime        string   `xml:"StartTime,attr"`
+			TotalTimeSeconds *float64 `xml:"TotalTimeSeconds"`
+			DistanceMeters   *float64 `xml:"DistanceMeters"`
+			Calories         *int     `xml:"Calories"`
+			Tracks           []struct {
+				Points []struct {
+					Time     string `xml:"Time"`
+					Position *struct {
+						Lat float64 `xml:"LatitudeDegrees"`
+						Lng float64 `xml:"LongitudeDegrees"`
+					} `xml:"Position"`
+					AltitudeMeters *float64 `xml:"AltitudeMeters"`
+					Extensions     struct {
+						TPX struct {
+							Speed *float64 `xml:"Speed"`
+						} `xml:"TPX"`
+					} `xml:"Extensions"`
+				} `xml:"Trackpoint"`
+			} `xml:"Track"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+func parseTCX(data []byte) ([]ParsedActivity, error) {
+	var doc tcxInput
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid TCX: %w", err)
+	}
+
+	var activities []ParsedActivity
+	for _, a := range doc.Activities {
+		activity := ParsedActivity{Notes: a.Notes}
+		if start, err := parseXMLTime(a.ID); err == nil {
+			activity.StartedAt = start
+		}
+
+		var totalSeconds, totalDistance float64
+		var calories int
+		hasTotals, hasCalories := false, false
+		for i, lap := range a.Laps {
+			// The first lap starts with the activity, later ones mark boundaries
+			if start, err := parseXMLTime(lap.StartTime); err == nil && i > 0 {
+				activity.LapMarkers = append(activity.LapMarkers, start)
+			}
+			if lap.TotalTimeSeconds != nil && lap.DistanceMeters != nil {
+				totalSeconds += *lap.TotalTimeSeconds
+				totalDistance += *lap.DistanceMeters
+				hasTotals = true
+			}
+			if lap.Calories != nil {
+				calories += *lap.Calories
+				hasCalories = true
+			}
+			for _, track := range lap.Tracks {
+				for _, p := range track.Points {
+					ts, err := parseXMLTime(p.Time)
+					if err != nil || p.Position == nil || !validCoordinate(p.Position.Lat, p.Position.Lng) {
+						continue
+					}
+					activity.Points = append(activity.Points, models.WaypointData{
+						Latitude:  p.Position.Lat,
+						Longitude: p.Position.Lng,
+						Altitude:  p.AltitudeMeters,
+						Speed:     p.Extensions.TPX.Speed,
+						Timestamp: ts,
+					})
+				}
+			}
+		}
+
+		if hasTotals && totalSeconds > 0 {
+			seconds := int(math.Round(totalSeconds))
+			activity.DurationSeconds = &seconds
+			activity.DistanceMeters = &totalDistance
+		}
+		if hasCalories {
+			activity.CaloriesBurned = &calories
+		}
+		if activity.StartedAt.IsZero() && len(activity.Points) > 0 {
+			activity.StartedAt = activity.Points[0].Timestamp
+		}
+		activities = append(activities, activity)
+	}
+
+	if len(activities) == 0 {
+		return nil, errors.New("TCX file contains no activities")
+	}
+	return activities, nil
+}
+
+func parseXMLTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(value))
+}
+
+func validCoordinate(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 && !(lat == 0 && lng == 0)
+}
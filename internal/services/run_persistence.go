@@ -0,0 +1,232 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+// RunPayload is what arrives with a run besides its summary: the raw and
+// filtered tracks and whatever the source recorded alongside them.
+type RunPayload struct {
+	Raw                []models.WaypointData
+	Filtered           []models.WaypointData
+	LapMarkers         []time.Time
+	Streams            []models.RunStream
+	WorkoutSteps       []models.WorkoutStepData
+	ScheduledWorkoutID *uuid.UUID
+	// AIMetrics come from the glasses and must already be validated; Device
+	// is the one that uploaded them.
+	AIMetrics *models.AIMetricsRequest
+	Device    *models.Device
+}
+
+// RunSaveResult is what storing a run changed for the runner.
+type RunSaveResult struct {
+	NewRecords     []string
+	CompletedGoals []models.GoalEvent
+	Workout        *models.ScheduledWorkout
+	// Model is the detection model the AI metrics named, if any. Callers
+	// point the device at it once the transaction commits.
+	Model *models.AIModel
+}
+
+// RunPersistence stores a new run with everything derived from it, whether
+// it was uploaded by the glasses or imported from a file.
+type RunPersistence struct {
+	waypointService *WaypointService
+	splitService    *SplitService
+	streamService   *StreamService
+	zoneService     *ZoneService
+	recordService   *RecordService
+	goalService     *GoalService
+	workoutService  *WorkoutService
+	aiEventService  *AIEventService
+	aiModelService  *AIModelService
+	safetyService   *SafetyService
+}
+
+func NewRunPersistence(db *gorm.DB) *RunPersistence {
+	return &RunPersistence{
+		waypointService: NewWaypointService(db),
+		splitService:    NewSplitService(db),
+		streamService:   NewStreamService(db),
+		zoneService:     NewZoneService(db),
+		recordService:   NewRecordService(db),
+		goalService:     NewGoalService(db),
+		workoutService:  NewWorkoutService(db),
+		aiEventService:  NewAIEventService(db),
+		aiModelService:  NewAIModelService(db),
+		safetyService:   NewSafetyService(db),
+	}
+}
+
+// Save creates run inside tx along with its tracks, splits, streams, zone
+// times, best efforts and AI data, and brings the runner's training load,
+// records, goals, workouts and safety score up to date. Metrics on run are
+// expected to be computed from payload.Filtered already. tx should come from
+// database.BeginPinned so tracks are loaded with COPY; the caller commits or
+// rolls it back.
+func (p *RunPersistence) Save(tx *gorm.DB, run *models.Run, payload *RunPayload) (*RunSaveResult, error) {
+	ApplyStreamSummary(run, payload.Streams)
+	settings, err := p.zoneService.getSettings(tx, run.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute training load: %w", err)
+	}
+	heartRate, err := heartRateStream(payload.Streams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute training load: %w", err)
+	}
+	applyRunLoad(run, heartRate, settings)
+
+	workoutSteps, err := BuildRunWorkoutSteps(payload.WorkoutSteps, payload.Filtered, payload.Streams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process workout steps: %w", err)
+	}
+
+	if err := tx.Create(run).Error; err != nil {
+		return nil, fmt.Errorf("failed to create run: %w", err)
+	}
+	if err := p.waypointService.SaveTracks(tx, run.ID, payload.Raw, payload.Filtered); err != nil {
+		return nil, fmt.Errorf("failed to save waypoints: %w", err)
+	}
+	if err := p.splitService.SaveSplits(tx, run.ID, ComputeSplits(payload.Filtered, payload.LapMarkers)); err != nil {
+		return nil, fmt.Errorf("failed to save splits: %w", err)
+	}
+	if err := p.streamService.SaveStreams(tx, run.ID, payload.Streams); err != nil {
+		return nil, fmt.Errorf("failed to save sensor streams: %w", err)
+	}
+	if err := p.workoutService.SaveRunSteps(tx, run.ID, workoutSteps); err != nil {
+		return nil, fmt.Errorf("failed to save workout steps: %w", err)
+	}
+	if err := p.zoneService.SaveRunZones(tx, run, payload.Filtered, payload.Streams); err != nil {
+		return nil, fmt.Errorf("failed to save zone times: %w", err)
+	}
+	if err := p.recordService.SaveBestEfforts(tx, run.ID, payload.Filtered); err != nil {
+		return nil, fmt.Errorf("failed to save best efforts: %w", err)
+	}
+
+	result := &RunSaveResult{}
+	if result.NewRecords, err = p.recordService.Recalculate(tx, run.UserID, run.ID); err != nil {
+		return nil, fmt.Errorf("failed to update personal records: %w", err)
+	}
+	if result.CompletedGoals, err = p.goalService.Evaluate(tx, run); err != nil {
+		return nil, fmt.Errorf("failed to update goals: %w", err)
+	}
+	if result.Workout, err = p.workoutService.MatchRun(tx, run, payload.ScheduledWorkoutID, workoutSteps); err != nil {
+		return nil, fmt.Errorf("failed to match scheduled workout: %w", err)
+	}
+
+	if payload.AIMetrics != nil {
+		if result.Model, err = p.saveAIData(tx, run, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.safetyService.ScoreRun(tx, run); err != nil {
+		return nil, fmt.Errorf("failed to score run safety: %w", err)
+	}
+	return result, nil
+}
+
+// Refresh brings what is derived from the track of a stored run up to date
+// inside tx once its metrics have been recomputed from points: the stored
+// metrics and training load, splits, zone times, best efforts, records,
+// goals and safety score. Raw data such as streams and AI events is left as
+// it is. The caller commits or rolls tx back.
+func (p *RunPersistence) Refresh(tx *gorm.DB, run *models.Run, points []models.WaypointData) (*RunSaveResult, error) {
+	var streams []models.RunStream
+	if err := tx.Where("run_id = ? AND type = ?", run.ID, models.StreamTypeHeartRate).Find(&streams).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch heart rate stream: %w", err)
+	}
+	settings, err := p.zoneService.getSettings(tx, run.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute training load: %w", err)
+	}
+	heartRate, err := heartRateStream(streams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute training load: %w", err)
+	}
+	applyRunLoad(run, heartRate, settings)
+
+	// Bump updated_at so the daily load history is rebuilt with the new load
+	run.UpdatedAt = time.Now()
+	err = tx.Model(run).Select(
+		"computed_distance_meters", "computed_duration_seconds", "moving_time_seconds",
+		"computed_avg_speed_kmh", "computed_max_speed_kmh",
+		"metrics_flagged", "metrics_discrepancies", "analyzed_at",
+		"elevation_gain_meters", "elevation_loss_meters", "min_elevation_meters",
+		"max_elevation_meters", "elevation_source",
+		"training_load", "training_load_method", "updated_at",
+	).Updates(run).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to store run analysis: %w", err)
+	}
+
+	markers, err := storedLapMarkers(tx, run.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.splitService.SaveSplits(tx, run.ID, ComputeSplits(points, markers)); err != nil {
+		return nil, fmt.Errorf("failed to save splits: %w", err)
+	}
+	if err := p.zoneService.SaveRunZones(tx, run, points, streams); err != nil {
+		return nil, fmt.Errorf("failed to save zone times: %w", err)
+	}
+	if err := p.recordService.SaveBestEfforts(tx, run.ID, points); err != nil {
+		return nil, fmt.Errorf("failed to save best efforts: %w", err)
+	}
+
+	result := &RunSaveResult{}
+	if result.NewRecords, err = p.recordService.Recalculate(tx, run.UserID, run.ID); err != nil {
+		return nil, fmt.Errorf("failed to update personal records: %w", err)
+	}
+	if result.CompletedGoals, err = p.goalService.Reevaluate(tx, run); err != nil {
+		return nil, fmt.Errorf("failed to update goals: %w", err)
+	}
+
+	// Rates per km depend on the recomputed distance
+	if err := p.safetyService.ScoreRun(tx, run); err != nil {
+		return nil, fmt.Errorf("failed to score run safety: %w", err)
+	}
+	return result, nil
+}
+
+func (p *RunPersistence) saveAIData(tx *gorm.DB, run *models.Run, payload *RunPayload) (*models.AIModel, error) {
+	req := payload.AIMetrics
+	aiMetrics := req.ToModel(run.ID)
+	if payload.Device != nil {
+		aiMetrics.HardwareVersion = payload.Device.HardwareVersion
+		aiMetrics.FirmwareVersion = payload.Device.FirmwareVersion
+	}
+
+	var model *models.AIModel
+	if req.Model != nil {
+		var err error
+		if model, err = p.aiModelService.Resolve(tx, req.Model); err != nil {
+			return nil, fmt.Errorf("failed to record AI model: %w", err)
+		}
+		aiMetrics.ModelID = &model.ID
+	}
+	if err := tx.Create(aiMetrics).Error; err != nil {
+		return nil, fmt.Errorf("failed to save AI metrics: %w", err)
+	}
+
+	aiEvents := BuildAIEvents(req.Events, payload.Filtered)
+	if err := p.aiEventService.SaveEvents(tx, run.ID, aiEvents); err != nil {
+		return nil, fmt.Errorf("failed to save AI events: %w", err)
+	}
+	feedback := MatchDeviceFeedback(req.Feedback, aiEvents, payload.Filtered)
+	if err := p.aiEventService.SaveFeedback(tx, run.ID, feedback); err != nil {
+		return nil, fmt.Errorf("failed to save AI feedback: %w", err)
+	}
+	laneEvents := BuildLaneEvents(req.LaneEvents, payload.Filtered)
+	if err := p.aiEventService.SaveLaneEvents(tx, run.ID, laneEvents); err != nil {
+		return nil, fmt.Errorf("failed to save lane events: %w", err)
+	}
+	return model, nil
+}
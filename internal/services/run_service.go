@@ -0,0 +1,81 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+type RunService struct {
+	db            *gorm.DB
+	recordService *RecordService
+	goalService   *GoalService
+}
+
+func NewRunService(db *gorm.DB) *RunService {
+	return &RunService{
+		db:            db,
+		recordService: NewRecordService(db),
+		goalService:   NewGoalService(db),
+	}
+}
+
+// runChildTables lists everything stored per run; keep it in sync when adding
+// tables keyed by run_id.
+var runChildTables = []interface{}{
+	&models.RunWaypoint{},
+	&models.RunSplit{},
+	&models.RunStream{},
+	&models.RunZoneTime{},
+	&models.RunBestEffort{},
+	&models.RunWorkoutStep{},
+	&models.AIMetrics{},
+	&models.AIEvent{},
+	&models.AIEventFeedback{},
+	&models.RunMedia{},
+	&models.LaneEvent{},
+}
+
+// DeleteRun removes a run with everything stored for it and recalculates the
+// owner's personal records and goals without it. The owner's training load
+// history is cleared so it is rebuilt without the run on next access, and a
+// workout the run completed is planned again.
+func (s *RunService) DeleteRun(run *models.Run) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range runChildTables {
+			if err := tx.Where("run_id = ?", run.ID).Delete(table).Error; err != nil {
+				return fmt.Errorf("failed to delete run data: %w", err)
+			}
+		}
+		if err := tx.Delete(&models.Run{}, "id = ?", run.ID).Error; err != nil {
+			return fmt.Errorf("failed to delete run: %w", err)
+		}
+
+		// A workout completed by this run goes back to planned
+		err := tx.Model(&models.ScheduledWorkout{}).Where("run_id = ?", run.ID).Updates(map[string]interface{}{
+			"status":           models.WorkoutStatusPlanned,
+			"run_id":           nil,
+			"compliance_score": nil,
+			"compliance":       nil,
+			"completed_at":     nil,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to reset scheduled workout: %w", err)
+		}
+
+		if err := tx.Where("user_id = ?", run.UserID).Delete(&models.DailyTrainingLoad{}).Error; err != nil {
+			return fmt.Errorf("failed to clear training load history: %w", err)
+		}
+
+		if _, err := s.recordService.Recalculate(tx, run.UserID, uuid.Nil); err != nil {
+			return err
+		}
+		if err := s.goalService.RevokeRun(tx, run); err != nil {
+			return fmt.Errorf("failed to update goals: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/utils"
+)
+
+const (
+	// Weights of the parts of the safety score. Near misses weigh most since
+	// they are the closest the glasses see to a collision.
+	safetyNearMissWeight        = 0.35
+	safetyWarningResponseWeight = 0.25
+	safetyLaneKeepingWeight     = 0.20
+	safetyObstacleDensityWeight = 0.20
+
+	// SafetyNearMissMeters is how close a detected object must be to count
+	// as a near miss. Close detections of the same class less than
+	// safetyNearMissMerge apart are one near miss.
+	SafetyNearMissMeters = 1.5
+	safetyNearMissMerge  = 3 * time.Second
+	// A warning goes unheeded when a near miss with an object of the warned
+	// class follows within this window.
+	safetyWarningWindow = 5 * time.Second
+
+	// Rate based scores fall linearly from 100 to 0 at these rates per km.
+	safetyMaxDetectionsPerKm     = 20.0
+	safetyMaxLaneDeviationsPerKm = 10.0
+	safetyMaxNearMissesPerKm     = 2.0
+	// Rates are not scored on runs shorter than this.
+	safetyMinDistanceMeters = 100.0
+
+	safetyBackfillBatchSize = 200
+)
+
+// ScoreSafety rates how safely a run went from what the glasses recorded.
+// It combines four parts, each scored from 0 to 100:
+//
+//   - near misses (35%): detections within 1.5 m, falling to 0 at 2 per km
+//   - warning response (25%): the share of spoken warnings not followed by a
+//     near miss with the same kind of object within five seconds
+//   - lane keeping (20%): the lane keeping accuracy the device reported, or
+//     else lane deviations, falling to 0 at 10 per km
+//   - obstacle density (20%): detections, falling to 0 at 20 per km
+//
+// The score is the weighted mean of the parts the run has data for, and nil
+// when it has none. Near misses and warning response need the individual
+// detections, which firmware reporting only totals does not send.
+func ScoreSafety(run *models.Run, metrics *models.AIMetrics, events []models.AIEvent, laneEvents []models.LaneEvent) (*float64, *models.SafetyBreakdown) {
+	breakdown := &models.SafetyBreakdown{Version: models.SafetyScoreVersion}
+
+	var distanceMeters float64
+	if run.ComputedDistanceMeters != nil {
+		distanceMeters = *run.ComputedDistanceMeters
+	} else if run.DistanceMeters != nil {
+		distanceMeters = *run.DistanceMeters
+	}
+	breakdown.DistanceKm = round2(distanceMeters / 1000)
+	hasDistance := distanceMeters >= safetyMinDistanceMeters
+	perKm := func(count int) float64 {
+		return round2(float64(count) / (distanceMeters / 1000))
+	}
+
+	// Without events, a zero total still says there was nothing to miss
+	hasEvents := len(events) > 0 || (metrics.TotalObstaclesDetected != nil && *metrics.TotalObstaclesDetected == 0)
+	var weighted, weights float64
+	add := func(target **float64, score, weight float64) {
+		score = round2(math.Max(0, math.Min(100, score)))
+		*target = &score
+		weighted += score * weight
+		weights += weight
+	}
+
+	if hasEvents {
+		sorted := make([]models.AIEvent, len(events))
+		copy(sorted, events)
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp.Before(sorted[j].Timestamp) })
+
+		near := nearMissEvents(sorted)
+		breakdown.NearMisses = countNearMisses(near)
+		if hasDistance {
+			add(&breakdown.NearMissScore, 100*(1-perKm(breakdown.NearMisses)/safetyMaxNearMissesPerKm), safetyNearMissWeight)
+		}
+
+		for _, event := range sorted {
+			if !event.WarningSpoken {
+				continue
+			}
+			breakdown.Warnings++
+			if !nearMissAfter(near, event) {
+				breakdown.WarningsHeeded++
+			}
+		}
+		if breakdown.Warnings > 0 {
+			add(&breakdown.WarningResponseScore, 100*float64(breakdown.WarningsHeeded)/float64(breakdown.Warnings), safetyWarningResponseWeight)
+		}
+	}
+
+	deviations := -1
+	if len(laneEvents) > 0 {
+		deviations = len(laneEvents)
+	} else if metrics.LaneDeviationsCount != nil {
+		deviations = *metrics.LaneDeviationsCount
+	}
+	if deviations >= 0 && hasDistance {
+		rate := perKm(deviations)
+		breakdown.LaneDeviationsPerKm = &rate
+	}
+	switch {
+	case metrics.LaneKeepingAccuracy != nil:
+		breakdown.LaneKeepingAccuracy = metrics.LaneKeepingAccuracy
+		add(&breakdown.LaneKeepingScore, 100**metrics.LaneKeepingAccuracy, safetyLaneKeepingWeight)
+	case breakdown.LaneDeviationsPerKm != nil:
+		add(&breakdown.LaneKeepingScore, 100*(1-*breakdown.LaneDeviationsPerKm/safetyMaxLaneDeviationsPerKm), safetyLaneKeepingWeight)
+	}
+
+	if len(events) > 0 {
+		breakdown.Detections = len(events)
+	} else if metrics.TotalObstaclesDetected != nil {
+		breakdown.Detections = *metrics.TotalObstaclesDetected
+	}
+	if (len(events) > 0 || metrics.TotalObstaclesDetected != nil) && hasDistance {
+		rate := perKm(breakdown.Detections)
+		breakdown.DetectionsPerKm = &rate
+		add(&breakdown.ObstacleDensityScore, 100*(1-rate/safetyMaxDetectionsPerKm), safetyObstacleDensityWeight)
+	}
+
+	if weights == 0 {
+		return nil, breakdown
+	}
+	score := round2(weighted / weights)
+	return &score, breakdown
+}
+
+// nearMissEvents picks the detections within near miss distance from events
+// sorted by time.
+func nearMissEvents(events []models.AIEvent) []models.AIEvent {
+	var near []models.AIEvent
+	for _, event := range events {
+		if event.DistanceMeters != nil && *event.DistanceMeters <= SafetyNearMissMeters {
+			near = append(near, event)
+		}
+	}
+	return near
+}
+
+// countNearMisses counts near detections, taking those of the same class in
+// quick succession as one object passed.
+func countNearMisses(near []models.AIEvent) int {
+	count := 0
+	last := make(map[string]time.Time)
+	for _, event := range near {
+		if prev, ok := last[event.Type]; !ok || event.Timestamp.Sub(prev) > safetyNearMissMerge {
+			count++
+		}
+		last[event.Type] = event.Timestamp
+	}
+	return count
+}
+
+// nearMissAfter reports whether the runner came close to an object of the
+// warned class soon after the warning.
+func nearMissAfter(near []models.AIEvent, warning models.AIEvent) bool {
+	for _, event := range near {
+		if event.Type == warning.Type && event.Timestamp.After(warning.Timestamp) &&
+			event.Timestamp.Sub(warning.Timestamp) <= safetyWarningWindow {
+			return true
+		}
+	}
+	return false
+}
+
+type SafetyService struct {
+	db *gorm.DB
+}
+
+func NewSafetyService(db *gorm.DB) *SafetyService {
+	return &SafetyService{db: db}
+}
+
+// ScoreRun scores a stored run from its AI metrics and events and stores the
+// result. Pass the transaction the AI data was saved in when scoring during
+// upload.
+func (s *SafetyService) ScoreRun(tx *gorm.DB, run *models.Run) error {
+	run.SafetyScore, run.SafetyBreakdown = nil, nil
+
+	var metrics models.AIMetrics
+	err := tx.Where("run_id = ?", run.ID).First(&metrics).Error
+	switch {
+	case err == nil:
+		var events []models.AIEvent
+		err := tx.Select("timestamp", "type", "distance_meters", "warning_spoken").
+			Where("run_id = ?", run.ID).Order("timestamp ASC").Find(&events).Error
+		if err != nil {
+			return fmt.Errorf("failed to fetch AI events: %w", err)
+		}
+		var laneEvents []models.LaneEvent
+		if err := tx.Select("started_at").Where("run_id = ?", run.ID).Find(&laneEvents).Error; err != nil {
+			return fmt.Errorf("failed to fetch lane events: %w", err)
+		}
+		run.SafetyScore, run.SafetyBreakdown = ScoreSafety(run, &metrics, events, laneEvents)
+	case err != gorm.ErrRecordNotFound:
+		return fmt.Errorf("failed to fetch AI metrics: %w", err)
+	}
+
+	now := time.Now()
+	run.SafetyScoredAt = &now
+	err = tx.Model(run).Select("safety_score", "safety_breakdown", "safety_scored_at").Updates(run).Error
+	if err != nil {
+		return fmt.Errorf("failed to store safety score: %w", err)
+	}
+	return nil
+}
+
+// ScorePending scores runs uploaded before safety scores existed, in batches
+// of safetyBackfillBatchSize. It runs as a background job; a run that fails
+// to score is logged and retried on the next run of the job.
+func (s *SafetyService) ScorePending(ctx context.Context) error {
+	db := s.db.WithContext(ctx)
+	var lastID uuid.UUID
+	for {
+		var runs []models.Run
+		err := db.Select("id", "distance_meters", "computed_distance_meters").
+			Where("safety_scored_at IS NULL AND id > ?", lastID).
+			Order("id").Limit(safetyBackfillBatchSize).Find(&runs).Error
+		if err != nil {
+			return fmt.Errorf("failed to list unscored runs: %w", err)
+		}
+		for i := range runs {
+			if err := s.ScoreRun(db, &runs[i]); err != nil {
+				utils.Error("Failed to score run safety", zap.String("run_id", runs[i].ID.String()), zap.Error(err))
+			}
+		}
+		if len(runs) < safetyBackfillBatchSize {
+			return nil
+		}
+		lastID = runs[len(runs)-1].ID
+	}
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+const (
+	metersPerMile = 1609.344
+
+	// Trailing partial splits shorter than this are dropped as noise.
+	minPartialSplitMeters = 10.0
+
+	// An effort is a stretch of at least effortMinDuration where the smoothed
+	// speed stays effortSpeedRatio above the run's average moving speed.
+	effortMinDuration     = 60 * time.Second
+	effortSpeedRatio      = 1.10
+	effortSmoothingWindow = 20 * time.Second
+	effortMaxGap          = 5 * time.Second
+)
+
+type SplitService struct {
+	db              *gorm.DB
+	waypointService *WaypointService
+	gpsFilter       *GPSFilter
+	dem             *DEM
+}
+
+func NewSplitService(db *gorm.DB) *SplitService {
+	return &SplitService{
+		db:              db,
+		waypointService: NewWaypointService(db),
+		gpsFilter:       NewGPSFilter(DefaultGPSFilterConfig),
+		dem:             currentDEM(),
+	}
+}
+
+// SaveSplits replaces the stored splits of a run inside tx.
+func (s *SplitService) SaveSplits(tx *gorm.DB, runID uuid.UUID, splits []models.RunSplit) error {
+	if err := tx.Where("run_id = ?", runID).Delete(&models.RunSplit{}).Error; err != nil {
+		return fmt.Errorf("failed to clear splits: %w", err)
+	}
+	if len(splits) == 0 {
+		return nil
+	}
+
+	for i := range splits {
+		splits[i].RunID = runID
+	}
+	if err := tx.Create(&splits).Error; err != nil {
+		return fmt.Errorf("failed to save splits: %w", err)
+	}
+	return nil
+}
+
+// GetSplits returns the stored splits of a run, computing and storing them
+// first for runs uploaded before splits existed. An empty kind returns all.
+func (s *SplitService) GetSplits(runID uuid.UUID, kind string) ([]models.RunSplit, error) {
+	var count int64
+	if err := s.db.Model(&models.RunSplit{}).Where("run_id = ?", runID).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to count splits: %w", err)
+	}
+
+	if count == 0 {
+		if _, err := s.Recompute(runID); err != nil {
+			return nil, err
+		}
+	}
+
+	query := s.db.Where("run_id = ?", runID)
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var splits []models.RunSplit
+	if err := query.Order("kind ASC, split_index ASC").Find(&splits).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch splits: %w", err)
+	}
+	return splits, nil
+}
+
+// Recompute rebuilds all splits of a run from its filtered track, keeping the
+// lap boundaries that were stored with the previous splits.
+func (s *SplitService) Recompute(runID uuid.UUID) ([]models.RunSplit, error) {
+	points, err := s.waypointService.EnsureFilteredTrack(s.db, runID, s.gpsFilter, s.dem)
+	if err != nil {
+		return nil, err
+	}
+	markers, err := storedLapMarkers(s.db, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	splits := ComputeSplits(points, markers)
+	if err := s.SaveSplits(s.db, runID, splits); err != nil {
+		return nil, err
+	}
+	return splits, nil
+}
+
+// storedLapMarkers returns the lap boundaries kept in a run's stored lap
+// splits.
+func storedLapMarkers(db *gorm.DB, runID uuid.UUID) ([]time.Time, error) {
+	var laps []models.RunSplit
+	if err := db.Where("run_id = ? AND kind = ?", runID, models.SplitKindLap).Order("split_index ASC").Find(&laps).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch laps: %w", err)
+	}
+	var markers []time.Time
+	for i, lap := range laps {
+		if i > 0 {
+			markers = append(markers, lap.StartedAt)
+		}
+	}
+	return markers, nil
+}
+
+// ComputeSplits derives per-kilometer and per-mile splits, laps from the
+// device's lap markers and detected hard efforts from a time-ordered track.
+func ComputeSplits(points []models.WaypointData, lapMarkers []time.Time) []models.RunSplit {
+	if len(points) < 2 {
+		return nil
+	}
+
+	track := newTrackIndex(points)
+
+	var splits []models.RunSplit
+	splits = append(splits, track.distanceSplits(models.SplitKindKilometer, 1000)...)
+	splits = append(splits, track.distanceSplits(models.SplitKindMile, metersPerMile)...)
+	splits = append(splits, track.lapSplits(lapMarkers)...)
+	splits = append(splits, track.efforts()...)
+	applySplitElevation(splits, points)
+	return splits
+}
+
+// trackIndex answers "where was the runner at distance d / time t" questions
+// over a track by interpolating between fixes.
+type trackIndex struct {
+	points     []models.WaypointData
+	cumulative []float64
+}
+
+func newTrackIndex(points []models.WaypointData) *trackIndex {
+	return &trackIndex{points: points, cumulative: cumulativeDistances(points)}
+}
+
+func (t *trackIndex) total() float64 {
+	return t.cumulative[len(t.cumulative)-1]
+}
+
+// timeAtDistance returns when the runner reached distance d and the index of
+// the first fix at or beyond it.
+func (t *trackIndex) timeAtDistance(d float64) (time.Time, int) {
+	i := sort.SearchFloat64s(t.cumulative, d)
+	if i == 0 {
+		return t.points[0].Timestamp, 0
+	}
+	if i >= len(t.points) {
+		return t.points[len(t.points)-1].Timestamp, len(t.points) - 1
+	}
+	segment := t.cumulative[i] - t.cumulative[i-1]
+	frac := 0.0
+	if segment > 0 {
+		frac = (d - t.cumulative[i-1]) / segment
+	}
+	span := t.points[i].Timestamp.Sub(t.points[i-1].Timestamp)
+	return t.points[i-1].Timestamp.Add(time.Duration(frac * float64(span))), i
+}
+
+// distanceAtTime returns the distance covered at ts and the index of the first
+// fix at or after it.
+func (t *trackIndex) distanceAtTime(ts time.Time) (float64, int) {
+	i := sort.Search(len(t.points), func(i int) bool { return !t.points[i].Timestamp.Before(ts) })
+	if i == 0 {
+		return 0, 0
+	}
+	if i >= len(t.points) {
+		return t.total(), len(t.points) - 1
+	}
+	span := t.points[i].Timestamp.Sub(t.points[i-1].Timestamp)
+	frac := 0.0
+	if span > 0 {
+		frac = float64(ts.Sub(t.points[i-1].Timestamp)) / float64(span)
+	}
+	return t.cumulative[i-1] + frac*(t.cumulative[i]-t.cumulative[i-1]), i
+}
+
+func (t *trackIndex) distanceSplits(kind string, unit float64) []models.RunSplit {
+	var splits []models.RunSplit
+	startTime, startSeq := t.points[0].Timestamp, 0
+	total := t.total()
+
+	index := 0
+	for target := unit; target <= total; target += unit {
+		endTime, endSeq := t.timeAtDistance(target)
+		splits = append(splits, newSplit(kind, index, startSeq, endSeq, startTime, endTime, unit, false))
+		startTime, startSeq = endTime, endSeq
+		index++
+	}
+
+	remaining := total - float64(index)*unit
+	if remaining >= minPartialSplitMeters {
+		last := len(t.points) - 1
+		splits = append(splits, newSplit(kind, index, startSeq, last, startTime, t.points[last].Timestamp, remaining, true))
+	}
+	return splits
+}
+
+func (t *trackIndex) lapSplits(markers []time.Time) []models.RunSplit {
+	first := t.points[0].Timestamp
+	last := t.points[len(t.points)-1].Timestamp
+
+	boundaries := []time.Time{first}
+	sorted := append([]time.Time(nil), markers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+	for _, m := range sorted {
+		if m.After(boundaries[len(boundaries)-1]) && m.Before(last) {
+			boundaries = append(boundaries, m)
+		}
+	}
+	if len(boundaries) == 1 {
+		return nil
+	}
+	boundaries = append(boundaries, last)
+
+	splits := make([]models.RunSplit, 0, len(boundaries)-1)
+	for i := 1; i < len(boundaries); i++ {
+		startDist, startSeq := t.distanceAtTime(boundaries[i-1])
+		endDist, endSeq := t.distanceAtTime(boundaries[i])
+		splits = append(splits, newSplit(models.SplitKindLap, i-1, startSeq, endSeq, boundaries[i-1], boundaries[i], endDist-startDist, false))
+	}
+	return splits
+}
+
+// efforts finds sustained stretches noticeably faster than the run's average
+// moving speed, such as intervals or a fast finish.
+func (t *trackIndex) efforts() []models.RunSplit {
+	analysis := AnalyzeTrack(t.points)
+	if analysis == nil || analysis.AvgSpeedKmh <= 0 {
+		return nil
+	}
+	threshold := analysis.AvgSpeedKmh / 3.6 * effortSpeedRatio
+
+	// Centered moving-window speed at each fix
+	n := len(t.points)
+	fast := make([]bool, n)
+	lo, hi := 0, 0
+	half := effortSmoothingWindow / 2
+	for i := 0; i < n; i++ {
+		for lo < i && t.points[i].Timestamp.Sub(t.points[lo].Timestamp) > half {
+			lo++
+		}
+		for hi < n-1 && t.points[hi+1].Timestamp.Sub(t.points[i].Timestamp) <= half {
+			hi++
+		}
+		span := t.points[hi].Timestamp.Sub(t.points[lo].Timestamp).Seconds()
+		if span > 0 {
+			fast[i] = (t.cumulative[hi]-t.cumulative[lo])/span >= threshold
+		}
+	}
+
+	var splits []models.RunSplit
+	i := 0
+	for i < n {
+		if !fast[i] {
+			i++
+			continue
+		}
+		start, end := i, i
+		for j := i + 1; j < n; j++ {
+			if fast[j] {
+				end = j
+				continue
+			}
+			if t.points[j].Timestamp.Sub(t.points[end].Timestamp) > effortMaxGap {
+				break
+			}
+		}
+
+		if t.points[end].Timestamp.Sub(t.points[start].Timestamp) >= effortMinDuration {
+			splits = append(splits, newSplit(models.SplitKindEffort, len(splits), start, end,
+				t.points[start].Timestamp, t.points[end].Timestamp,
+				t.cumulative[end]-t.cumulative[start], false))
+		}
+		i = end + 1
+	}
+	return splits
+}
+
+func newSplit(kind string, index, startSeq, endSeq int, start, end time.Time, distance float64, partial bool) models.RunSplit {
+	duration := end.Sub(start).Seconds()
+	split := models.RunSplit{
+		Kind:            kind,
+		Index:           index,
+		StartSeq:        startSeq,
+		EndSeq:          endSeq,
+		StartedAt:       start,
+		DurationSeconds: round2(duration),
+		DistanceMeters:  round2(distance),
+		Partial:         partial,
+	}
+	if duration > 0 {
+		split.AvgSpeedKmh = round2(distance / duration * 3.6)
+	}
+	if distance > 0 {
+		pace := round2(duration / (distance / 1000))
+		split.PaceSecondsPerKm = &pace
+	}
+	return split
+}
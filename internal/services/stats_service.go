@@ -0,0 +1,157 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+	BucketYear  = "year"
+
+	MaxStatsBuckets = 1000
+)
+
+func IsStatsBucket(bucket string) bool {
+	switch bucket {
+	case BucketDay, BucketWeek, BucketMonth, BucketYear:
+		return true
+	}
+	return false
+}
+
+// BucketStart returns the start of the bucket containing t, in t's location.
+// Weeks begin on weekStart.
+func BucketStart(t time.Time, bucket string, weekStart time.Weekday) time.Time {
+	y, m, d := t.Date()
+	loc := t.Location()
+	switch bucket {
+	case BucketWeek:
+		back := (int(t.Weekday()) - int(weekStart) + 7) % 7
+		return time.Date(y, m, d-back, 0, 0, 0, 0, loc)
+	case BucketMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	case BucketYear:
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	}
+}
+
+// nextBucket steps by calendar units rather than fixed durations so buckets
+// stay aligned to local midnight across DST changes.
+func nextBucket(start time.Time, bucket string) time.Time {
+	switch bucket {
+	case BucketWeek:
+		return start.AddDate(0, 0, 7)
+	case BucketMonth:
+		return start.AddDate(0, 1, 0)
+	case BucketYear:
+		return start.AddDate(1, 0, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// DefaultSeriesFrom is how far back a series reaches when no start is given.
+func DefaultSeriesFrom(to time.Time, bucket string) time.Time {
+	switch bucket {
+	case BucketWeek:
+		return to.AddDate(0, 0, -7*12)
+	case BucketMonth:
+		return to.AddDate(0, -12, 0)
+	case BucketYear:
+		return to.AddDate(-5, 0, 0)
+	default:
+		return to.AddDate(0, 0, -30)
+	}
+}
+
+type StatsBucket struct {
+	Start                time.Time `json:"start"`
+	End                  time.Time `json:"end"`
+	TotalRuns            int       `json:"total_runs"`
+	TotalDistanceMeters  float64   `json:"total_distance_meters"`
+	TotalDurationSeconds int       `json:"total_duration_seconds"`
+	TotalCaloriesBurned  int       `json:"total_calories_burned"`
+	// AvgSafetyScore averages the bucket's runs that have a safety score,
+	// and is null when none do.
+	AvgSafetyScore   *float64 `json:"avg_safety_score"`
+	SafetyScoredRuns int      `json:"safety_scored_runs"`
+}
+
+type StatsService struct {
+	db *gorm.DB
+}
+
+func NewStatsService(db *gorm.DB) *StatsService {
+	return &StatsService{db: db}
+}
+
+// Series returns per-bucket totals for runs started in [from, to), with empty
+// buckets included. Buckets are aligned in from's location, so pass times in
+// the user's timezone.
+func (s *StatsService) Series(userID uuid.UUID, bucket string, from, to time.Time, weekStart time.Weekday) ([]StatsBucket, error) {
+	var buckets []StatsBucket
+	for start := BucketStart(from, bucket, weekStart); start.Before(to); start = nextBucket(start, bucket) {
+		if len(buckets) >= MaxStatsBuckets {
+			return nil, fmt.Errorf("range spans more than %d buckets", MaxStatsBuckets)
+		}
+		buckets = append(buckets, StatsBucket{Start: start, End: nextBucket(start, bucket)})
+	}
+	if len(buckets) == 0 {
+		return buckets, nil
+	}
+
+	var runs []models.Run
+	err := s.db.Select("started_at", "distance_meters", "duration_seconds", "calories_burned", "safety_score").
+		Where("user_id = ? AND started_at >= ? AND started_at < ?", userID, buckets[0].Start, to).
+		Order("started_at ASC").
+		Find(&runs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch runs: %w", err)
+	}
+
+	// Runs and buckets are both ordered, so one pass assigns every run
+	safetySums := make([]float64, len(buckets))
+	i := 0
+	loc := from.Location()
+	for _, run := range runs {
+		started := run.StartedAt.In(loc)
+		for i < len(buckets)-1 && !started.Before(buckets[i].End) {
+			i++
+		}
+
+		b := &buckets[i]
+		b.TotalRuns++
+		if run.DistanceMeters != nil {
+			b.TotalDistanceMeters += *run.DistanceMeters
+		}
+		if run.DurationSeconds != nil {
+			b.TotalDurationSeconds += *run.DurationSeconds
+		}
+		if run.CaloriesBurned != nil {
+			b.TotalCaloriesBurned += *run.CaloriesBurned
+		}
+		if run.SafetyScore != nil {
+			b.SafetyScoredRuns++
+			safetySums[i] += *run.SafetyScore
+		}
+	}
+
+	for i := range buckets {
+		buckets[i].TotalDistanceMeters = round2(buckets[i].TotalDistanceMeters)
+		if buckets[i].SafetyScoredRuns > 0 {
+			avg := round2(safetySums[i] / float64(buckets[i].SafetyScoredRuns))
+			buckets[i].AvgSafetyScore = &avg
+		}
+	}
+	return buckets, nil
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+// streamSpec describes how a sensor channel is stored: values are multiplied
+// by scale and rounded to integers, and samples outside [min, max] are
+// dropped as sensor dropouts (a strap losing contact reports 0 bpm).
+type streamSpec struct {
+	scale int
+	min   float64
+	max   float64
+}
+
+var streamSpecs = map[string]streamSpec{
+	models.StreamTypeHeartRate:    {scale: 1, min: 25, max: 250},
+	models.StreamTypeCadence:      {scale: 1, min: 0, max: 300},
+	models.StreamTypeStrideLength: {scale: 100, min: 0, max: 3},
+	models.StreamTypePower:        {scale: 1, min: 0, max: 2500},
+}
+
+// StreamTypes lists the supported sensor channels in display order.
+var StreamTypes = []string{
+	models.StreamTypeHeartRate,
+	models.StreamTypeCadence,
+	models.StreamTypeStrideLength,
+	models.StreamTypePower,
+}
+
+func IsStreamType(t string) bool {
+	_, ok := streamSpecs[t]
+	return ok
+}
+
+type StreamPoint struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// BuildStreams validates uploaded sensor channels and encodes them for
+// storage. Channels left empty after dropping out-of-range samples are
+// skipped.
+func BuildStreams(data []models.SensorStreamData) ([]models.RunStream, error) {
+	seen := make(map[string]bool, len(data))
+	streams := make([]models.RunStream, 0, len(data))
+
+	for _, d := range data {
+		spec, ok := streamSpecs[d.Type]
+		if !ok {
+			return nil, fmt.Errorf("unsupported stream type %q", d.Type)
+		}
+		if seen[d.Type] {
+			return nil, fmt.Errorf("stream %q sent more than once", d.Type)
+		}
+		seen[d.Type] = true
+
+		points := make([]StreamPoint, 0, len(d.Samples))
+		for _, s := range d.Samples {
+			if s.Timestamp.IsZero() || math.IsNaN(s.Value) || s.Value < spec.min || s.Value > spec.max {
+				continue
+			}
+			points = append(points, StreamPoint{Timestamp: s.Timestamp, Value: s.Value})
+		}
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Timestamp.Before(points[j].Timestamp) })
+		points = dedupeStreamPoints(points)
+		if len(points) == 0 {
+			continue
+		}
+
+		streams = append(streams, encodeStream(d.Type, spec.scale, points))
+	}
+	return streams, nil
+}
+
+// dedupeStreamPoints keeps the last sample for each millisecond, since
+// offsets are stored at millisecond resolution.
+func dedupeStreamPoints(points []StreamPoint) []StreamPoint {
+	out := points[:0]
+	for _, p := range points {
+		if n := len(out); n > 0 && p.Timestamp.Sub(out[n-1].Timestamp) < time.Millisecond {
+			out[n-1] = p
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func encodeStream(streamType string, scale int, points []StreamPoint) models.RunStream {
+	start := points[0].Timestamp
+	data := binary.AppendUvarint(nil, uint64(len(points)))
+
+	var prevOffset, prevValue int64
+	minValue, maxValue, sum := math.Inf(1), math.Inf(-1), 0.0
+	for _, p := range points {
+		offset := p.Timestamp.Sub(start).Milliseconds()
+		value := int64(math.Round(p.Value * float64(scale)))
+		data = binary.AppendUvarint(data, uint64(offset-prevOffset))
+		data = binary.AppendVarint(data, value-prevValue)
+		prevOffset, prevValue = offset, value
+
+		stored := float64(value) / float64(scale)
+		minValue = math.Min(minValue, stored)
+		maxValue = math.Max(maxValue, stored)
+		sum += stored
+	}
+
+	return models.RunStream{
+		Type:        streamType,
+		StartedAt:   start,
+		SampleCount: len(points),
+		Scale:       scale,
+		Data:        data,
+		MinValue:    round2(minValue),
+		MaxValue:    round2(maxValue),
+		AvgValue:    round2(sum / float64(len(points))),
+	}
+}
+
+var errCorruptStream = errors.New("corrupt stream data")
+
+// DecodeStream unpacks the samples stored in a RunStream.
+func DecodeStream(stream *models.RunStream) ([]StreamPoint, error) {
+	data := stream.Data
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > uint64(len(data)) {
+		return nil, errCorruptStream
+	}
+	data = data[n:]
+
+	scale := float64(stream.Scale)
+	if scale <= 0 {
+		scale = 1
+	}
+
+	points := make([]StreamPoint, 0, count)
+	var offset, value int64
+	for i := uint64(0); i < count; i++ {
+		dOffset, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errCorruptStream
+		}
+		data = data[n:]
+		dValue, n := binary.Varint(data)
+		if n <= 0 {
+			return nil, errCorruptStream
+		}
+		data = data[n:]
+
+		offset += int64(dOffset)
+		value += dValue
+		points = append(points, StreamPoint{
+			Timestamp: stream.StartedAt.Add(time.Duration(offset) * time.Millisecond),
+			Value:     float64(value) / scale,
+		})
+	}
+	return points, nil
+}
+
+// ApplyStreamSummary records heart rate and cadence summaries on the run.
+func ApplyStreamSummary(run *models.Run, streams []models.RunStream) {
+	for _, s := range streams {
+		avg := int(math.Round(s.AvgValue))
+		switch s.Type {
+		case models.StreamTypeHeartRate:
+			maxHR := int(math.Round(s.MaxValue))
+			run.AvgHeartRateBpm = &avg
+			run.MaxHeartRateBpm = &maxHR
+		case models.StreamTypeCadence:
+			run.AvgCadenceSpm = &avg
+		}
+	}
+}
+
+type StreamService struct {
+	db *gorm.DB
+}
+
+func NewStreamService(db *gorm.DB) *StreamService {
+	return &StreamService{db: db}
+}
+
+// SaveStreams stores encoded sensor streams for a run inside tx.
+func (s *StreamService) SaveStreams(tx *gorm.DB, runID uuid.UUID, streams []models.RunStream) error {
+	if len(streams) == 0 {
+		return nil
+	}
+	for i := range streams {
+		streams[i].RunID = runID
+	}
+	if err := tx.Create(&streams).Error; err != nil {
+		return fmt.Errorf("failed to save sensor streams: %w", err)
+	}
+	return nil
+}
+
+// GetStreams returns the stored streams of a run, limited to types when given.
+func (s *StreamService) GetStreams(runID uuid.UUID, types []string) ([]models.RunStream, error) {
+	query := s.db.Where("run_id = ?", runID)
+	if len(types) > 0 {
+		query = query.Where("type IN ?", types)
+	}
+
+	var streams []models.RunStream
+	if err := query.Find(&streams).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch sensor streams: %w", err)
+	}
+
+	order := make(map[string]int, len(StreamTypes))
+	for i, t := range StreamTypes {
+		order[t] = i
+	}
+	sort.Slice(streams, func(i, j int) bool { return order[streams[i].Type] < order[streams[j].Type] })
+	return streams, nil
+}
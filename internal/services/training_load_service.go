@@ -0,0 +1,430 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+const (
+	defaultRestingHeartRateBpm       = 60
+	defaultThresholdPaceSecondsPerKm = 360
+	// Threshold heart rate as a fraction of heart rate reserve; an hour there
+	// scores 100, which puts TRIMP on the same scale as the pace-based load.
+	thresholdHeartRateReserve = 0.85
+
+	fitnessTimeConstantDays = 42
+	fatigueTimeConstantDays = 7
+	acuteWindowDays         = 7
+	chronicWindowDays       = 28
+	// Older runs barely move fitness any more and are not replayed.
+	maxTrainingLoadHistoryDays = 3 * 365
+
+	acwrWarningThreshold = 1.5
+	weeklyLoadJumpRatio  = 1.3
+	// Weeks lighter than this are too small a base for a jump to mean much.
+	minWeeklyLoadForJump = 50.0
+
+	TrainingLoadDefaultDays = 90
+	TrainingLoadMaxDays     = maxTrainingLoadHistoryDays
+)
+
+// ComputeTRIMP scores a heart rate stream with Banister's TRIMP, scaled so an
+// hour at threshold heart rate scores 100.
+func ComputeTRIMP(heartRate []StreamPoint, restingHR, maxHR float64) float64 {
+	if maxHR <= restingHR || len(heartRate) < 2 {
+		return 0
+	}
+
+	var trimp float64
+	for i := 0; i < len(heartRate)-1; i++ {
+		dt := heartRate[i+1].Timestamp.Sub(heartRate[i].Timestamp)
+		if dt <= 0 {
+			continue
+		}
+		if dt > maxStreamSampleGap {
+			dt = maxStreamSampleGap
+		}
+		reserve := math.Max(0, math.Min(1, (heartRate[i].Value-restingHR)/(maxHR-restingHR)))
+		trimp += dt.Minutes() * trimpWeight(reserve)
+	}
+
+	return trimp / (60 * trimpWeight(thresholdHeartRateReserve)) * 100
+}
+
+func trimpWeight(reserve float64) float64 {
+	return reserve * 0.64 * math.Exp(1.92*reserve)
+}
+
+// ComputePaceLoad scores a run from its moving time and average speed
+// relative to threshold pace: hours × intensity² × 100.
+func ComputePaceLoad(movingSeconds, avgSpeedKmh, thresholdPaceSecondsPerKm float64) float64 {
+	if movingSeconds <= 0 || avgSpeedKmh <= 0 || thresholdPaceSecondsPerKm <= 0 {
+		return 0
+	}
+	intensity := avgSpeedKmh / (3600 / thresholdPaceSecondsPerKm)
+	return movingSeconds / 3600 * intensity * intensity * 100
+}
+
+// RunTrainingLoad works out a run's load, preferring TRIMP when there is a
+// heart rate stream and a max heart rate to scale it by. It reports false
+// when the run has neither heart rate nor enough data for a pace-based load.
+func RunTrainingLoad(run *models.Run, heartRate []StreamPoint, settings *models.ZoneSettings) (float64, string, bool) {
+	maxHR := effectiveValue(settings.MaxHeartRateBpm, settings.EstimatedMaxHeartRateBpm, settings.AutoEstimate)
+	if settings.AutoEstimate && run.MaxHeartRateBpm != nil && (maxHR == nil || *run.MaxHeartRateBpm > *maxHR) {
+		maxHR = run.MaxHeartRateBpm
+	}
+	if maxHR != nil && len(heartRate) > 1 {
+		restingHR := defaultRestingHeartRateBpm
+		if settings.RestingHeartRateBpm != nil {
+			restingHR = *settings.RestingHeartRateBpm
+		}
+		if load := ComputeTRIMP(heartRate, float64(restingHR), float64(*maxHR)); load > 0 {
+			return round2(load), models.TrainingLoadMethodTRIMP, true
+		}
+	}
+
+	var movingSeconds, avgSpeed float64
+	if run.MovingTimeSeconds != nil && run.ComputedAvgSpeedKmh != nil {
+		movingSeconds, avgSpeed = float64(*run.MovingTimeSeconds), *run.ComputedAvgSpeedKmh
+	} else if run.DurationSeconds != nil && run.AvgSpeedKmh != nil {
+		movingSeconds, avgSpeed = float64(*run.DurationSeconds), *run.AvgSpeedKmh
+	}
+
+	threshold := defaultThresholdPaceSecondsPerKm
+	if t := effectiveValue(settings.ThresholdPaceSecondsPerKm, settings.EstimatedThresholdPaceSecondsPerKm, settings.AutoEstimate); t != nil {
+		threshold = *t
+	}
+	if load := ComputePaceLoad(movingSeconds, avgSpeed, float64(threshold)); load > 0 {
+		return round2(load), models.TrainingLoadMethodPace, true
+	}
+	return 0, "", false
+}
+
+// ComputeLoadSeries turns per-day load, starting on the calendar day start,
+// into fitness, fatigue, form and workload ratio for each day. The ratio is
+// left out until a full chronic window of history exists.
+func ComputeLoadSeries(userID uuid.UUID, start time.Time, daily []float64) []models.DailyTrainingLoad {
+	series := make([]models.DailyTrainingLoad, len(daily))
+	prefix := make([]float64, len(daily)+1)
+	var fitness, fatigue float64
+
+	for i, load := range daily {
+		prefix[i+1] = prefix[i] + load
+		form := fitness - fatigue
+		fitness += (load - fitness) / fitnessTimeConstantDays
+		fatigue += (load - fatigue) / fatigueTimeConstantDays
+
+		acute := (prefix[i+1] - prefix[max(0, i+1-acuteWindowDays)]) / acuteWindowDays
+		chronic := (prefix[i+1] - prefix[max(0, i+1-chronicWindowDays)]) / chronicWindowDays
+
+		day := models.DailyTrainingLoad{
+			UserID:      userID,
+			Day:         start.AddDate(0, 0, i).Format("2006-01-02"),
+			Load:        round2(load),
+			Fitness:     round2(fitness),
+			Fatigue:     round2(fatigue),
+			Form:        round2(form),
+			AcuteLoad:   round2(acute),
+			ChronicLoad: round2(chronic),
+		}
+		if i >= chronicWindowDays-1 && chronic > 0 {
+			ratio := round2(acute / chronic)
+			day.ACWR = &ratio
+		}
+		series[i] = day
+	}
+	return series
+}
+
+type WeeklyLoad struct {
+	Load          float64  `json:"load"`
+	PreviousLoad  float64  `json:"previous_load"`
+	ChangePercent *float64 `json:"change_percent,omitempty"`
+}
+
+type TrainingLoadWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// TrainingLoadWarnings compares the last seven days of series with the seven
+// before and flags a sharp jump in load or a high acute:chronic ratio.
+func TrainingLoadWarnings(series []models.DailyTrainingLoad) (WeeklyLoad, []TrainingLoadWarning) {
+	var week WeeklyLoad
+	warnings := []TrainingLoadWarning{}
+	if len(series) == 0 {
+		return week, warnings
+	}
+
+	for i := len(series) - 1; i >= 0 && i >= len(series)-2*acuteWindowDays; i-- {
+		if i >= len(series)-acuteWindowDays {
+			week.Load += series[i].Load
+		} else {
+			week.PreviousLoad += series[i].Load
+		}
+	}
+	week.Load = round2(week.Load)
+	week.PreviousLoad = round2(week.PreviousLoad)
+	if week.PreviousLoad > 0 {
+		change := round2((week.Load/week.PreviousLoad - 1) * 100)
+		week.ChangePercent = &change
+	}
+
+	if week.PreviousLoad >= minWeeklyLoadForJump && week.Load > week.PreviousLoad*weeklyLoadJumpRatio {
+		warnings = append(warnings, TrainingLoadWarning{
+			Code:    "weekly_load_jump",
+			Message: fmt.Sprintf("Load over the last 7 days is up %.0f%% on the week before", *week.ChangePercent),
+		})
+	}
+
+	if latest := series[len(series)-1]; latest.ACWR != nil && *latest.ACWR > acwrWarningThreshold {
+		warnings = append(warnings, TrainingLoadWarning{
+			Code:    "acwr_high",
+			Message: fmt.Sprintf("Acute:chronic workload ratio is %.2f; injury risk rises above %.1f", *latest.ACWR, acwrWarningThreshold),
+		})
+	}
+
+	return week, warnings
+}
+
+type TrainingLoadSummary struct {
+	Timezone string                     `json:"timezone"`
+	Current  *models.DailyTrainingLoad  `json:"current"`
+	Week     WeeklyLoad                 `json:"week"`
+	Warnings []TrainingLoadWarning      `json:"warnings"`
+	Series   []models.DailyTrainingLoad `json:"series"`
+}
+
+type TrainingLoadService struct {
+	db          *gorm.DB
+	zoneService *ZoneService
+}
+
+func NewTrainingLoadService(db *gorm.DB) *TrainingLoadService {
+	return &TrainingLoadService{
+		db:          db,
+		zoneService: NewZoneService(db),
+	}
+}
+
+// ApplyRunLoad computes the run's training load and records it on run
+// without saving it.
+func (s *TrainingLoadService) ApplyRunLoad(run *models.Run, streams []models.RunStream) error {
+	settings, err := s.zoneService.GetSettings(run.UserID)
+	if err != nil {
+		return err
+	}
+	heartRate, err := heartRateStream(streams)
+	if err != nil {
+		return err
+	}
+
+	applyRunLoad(run, heartRate, settings)
+	return nil
+}
+
+func applyRunLoad(run *models.Run, heartRate []StreamPoint, settings *models.ZoneSettings) {
+	if load, method, ok := RunTrainingLoad(run, heartRate, settings); ok {
+		run.TrainingLoad = &load
+		run.TrainingLoadMethod = method
+	} else {
+		run.TrainingLoad = nil
+		run.TrainingLoadMethod = ""
+	}
+}
+
+// RefreshRun recomputes and stores the load of a stored run, e.g. after it
+// was reanalyzed.
+func (s *TrainingLoadService) RefreshRun(run *models.Run) error {
+	var streams []models.RunStream
+	if err := s.db.Where("run_id = ? AND type = ?", run.ID, models.StreamTypeHeartRate).Find(&streams).Error; err != nil {
+		return fmt.Errorf("failed to fetch heart rate stream: %w", err)
+	}
+	if err := s.ApplyRunLoad(run, streams); err != nil {
+		return err
+	}
+
+	// Bump updated_at so EnsureCurrent sees the change
+	run.UpdatedAt = time.Now()
+	err := s.db.Model(run).Select("training_load", "training_load_method", "updated_at").Updates(run).Error
+	if err != nil {
+		return fmt.Errorf("failed to store training load: %w", err)
+	}
+	return nil
+}
+
+// RecomputeUser recomputes the load of every run of a user and rebuilds the
+// daily history, e.g. after max heart rate or threshold pace changed.
+func (s *TrainingLoadService) RecomputeUser(userID uuid.UUID) error {
+	var runs []models.Run
+	err := s.db.Select("id", "user_id", "duration_seconds", "avg_speed_kmh", "moving_time_seconds",
+		"computed_avg_speed_kmh", "max_heart_rate_bpm").
+		Where("user_id = ?", userID).Find(&runs).Error
+	if err != nil {
+		return fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	for i := range runs {
+		if err := s.RefreshRun(&runs[i]); err != nil {
+			return err
+		}
+	}
+	return s.UpdateUser(userID)
+}
+
+// UpdateUser rebuilds the user's daily load history up to today in their
+// profile timezone.
+func (s *TrainingLoadService) UpdateUser(userID uuid.UUID) error {
+	loc, err := s.userLocation(userID)
+	if err != nil {
+		return err
+	}
+
+	var runs []models.Run
+	err = s.db.Select("started_at", "training_load").
+		Where("user_id = ? AND training_load IS NOT NULL", userID).
+		Order("started_at").Find(&runs).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch run loads: %w", err)
+	}
+
+	var series []models.DailyTrainingLoad
+	if len(runs) > 0 {
+		today := civilDay(time.Now().In(loc))
+		start := civilDay(runs[0].StartedAt.In(loc))
+		if last := civilDay(runs[len(runs)-1].StartedAt.In(loc)); last.After(today) {
+			today = last
+		}
+		if earliest := today.AddDate(0, 0, -maxTrainingLoadHistoryDays+1); start.Before(earliest) {
+			start = earliest
+		}
+
+		daily := make([]float64, daysBetween(start, today)+1)
+		for _, run := range runs {
+			if i := daysBetween(start, civilDay(run.StartedAt.In(loc))); i >= 0 {
+				daily[i] += *run.TrainingLoad
+			}
+		}
+		series = ComputeLoadSeries(userID, start, daily)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.DailyTrainingLoad{}).Error; err != nil {
+			return fmt.Errorf("failed to clear training load history: %w", err)
+		}
+		if len(series) == 0 {
+			return nil
+		}
+		if err := tx.CreateInBatches(series, 500).Error; err != nil {
+			return fmt.Errorf("failed to save training load history: %w", err)
+		}
+		return nil
+	})
+}
+
+// EnsureCurrent rebuilds the user's history when a day has passed or runs
+// were added or changed since it was last built.
+func (s *TrainingLoadService) EnsureCurrent(userID uuid.UUID) error {
+	loc, err := s.userLocation(userID)
+	if err != nil {
+		return err
+	}
+
+	var latest models.DailyTrainingLoad
+	err = s.db.Where("user_id = ?", userID).Order("day DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to fetch training load history: %w", err)
+	}
+
+	query := s.db.Model(&models.Run{}).Where("user_id = ? AND training_load IS NOT NULL", userID)
+	if latest.ID != uuid.Nil {
+		if latest.Day < time.Now().In(loc).Format("2006-01-02") {
+			return s.UpdateUser(userID)
+		}
+		query = query.Where("updated_at > ?", latest.UpdatedAt)
+	}
+
+	var changed int64
+	if err := query.Count(&changed).Error; err != nil {
+		return fmt.Errorf("failed to check runs: %w", err)
+	}
+	if changed == 0 {
+		return nil
+	}
+	return s.UpdateUser(userID)
+}
+
+// UpdateAll brings every user with scored runs up to date. It is run
+// periodically by the background job; users whose history is already
+// current are skipped, so each is rebuilt about once per local day.
+func (s *TrainingLoadService) UpdateAll(ctx context.Context) error {
+	var userIDs []uuid.UUID
+	err := s.db.Model(&models.Run{}).Where("training_load IS NOT NULL").Distinct().Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	var errs []error
+	for _, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.EnsureCurrent(userID); err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", userID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Summary returns the user's current fitness, fatigue and form, the last
+// days of history and any load warnings.
+func (s *TrainingLoadService) Summary(userID uuid.UUID, days int) (*TrainingLoadSummary, error) {
+	if err := s.EnsureCurrent(userID); err != nil {
+		return nil, err
+	}
+	loc, err := s.userLocation(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.DailyTrainingLoad
+	err = s.db.Where("user_id = ?", userID).Order("day DESC").Limit(max(days, 2*acuteWindowDays)).Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch training load history: %w", err)
+	}
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+
+	summary := &TrainingLoadSummary{Timezone: loc.String(), Series: []models.DailyTrainingLoad{}}
+	summary.Week, summary.Warnings = TrainingLoadWarnings(rows)
+	if len(rows) > 0 {
+		summary.Current = &rows[len(rows)-1]
+		summary.Series = rows[max(0, len(rows)-days):]
+	}
+	return summary, nil
+}
+
+func (s *TrainingLoadService) userLocation(userID uuid.UUID) (*time.Location, error) {
+	loc, _, err := LoadUserCalendar(s.db, userID)
+	return loc, err
+}
+
+// civilDay returns t's calendar date as midnight UTC, so day arithmetic is
+// not thrown off by DST changes in the user's timezone.
+func civilDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(math.Round(to.Sub(from).Hours() / 24))
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/database"
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+const waypointInsertBatchSize = 500
+
+type WaypointService struct {
+	db *gorm.DB
+}
+
+func NewWaypointService(db *gorm.DB) *WaypointService {
+	return &WaypointService{db: db}
+}
+
+// WaypointQuery selects a slice of a run's track. Zero values mean "no bound";
+// MaxPoints > 0 downsamples the selected range to at most that many points.
+// Track defaults to the filtered track.
+type WaypointQuery struct {
+	Track     string
+	FromSeq   *int
+	ToSeq     *int
+	From      *time.Time
+	To        *time.Time
+	MaxPoints int
+}
+
+type WaypointPage struct {
+	Track       string
+	Waypoints   []models.RunWaypoint
+	TotalPoints int64
+	Matched     int64
+	Step        int
+}
+
+// SaveTracks stores both the raw upload and its filtered counterpart.
+func (s *WaypointService) SaveTracks(tx *gorm.DB, runID uuid.UUID, raw, filtered []models.WaypointData) error {
+	if err := s.SaveWaypoints(tx, runID, models.TrackRaw, raw); err != nil {
+		return err
+	}
+	return s.SaveWaypoints(tx, runID, models.TrackFiltered, filtered)
+}
+
+// SaveWaypoints stores one track for a run inside tx. When tx comes from
+// database.BeginPinned on PostgreSQL the rows are loaded with COPY, otherwise
+// they are inserted in batches.
+func (s *WaypointService) SaveWaypoints(tx *gorm.DB, runID uuid.UUID, track string, points []models.WaypointData) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	rows := models.NewRunWaypoints(runID, track, points)
+
+	values := make([][]interface{}, len(rows))
+	for i := range rows {
+		values[i] = rows[i].Values()
+	}
+
+	copied, err := database.CopyFrom(tx, "run_waypoints", models.RunWaypointColumns, values)
+	if err != nil {
+		return err
+	}
+	if copied {
+		return nil
+	}
+
+	if err := tx.CreateInBatches(rows, waypointInsertBatchSize).Error; err != nil {
+		return fmt.Errorf("failed to insert waypoints: %w", err)
+	}
+	return nil
+}
+
+// resolveTrack returns the track to read and its size. Runs stored before
+// filtering existed only have a raw track, which is served in place of the
+// filtered one.
+func (s *WaypointService) resolveTrack(db *gorm.DB, runID uuid.UUID, track string) (string, int64, error) {
+	if track == "" {
+		track = models.TrackFiltered
+	}
+
+	var count int64
+	if err := db.Model(&models.RunWaypoint{}).Where("run_id = ? AND track = ?", runID, track).Count(&count).Error; err != nil {
+		return "", 0, fmt.Errorf("failed to count waypoints: %w", err)
+	}
+	if count > 0 || track != models.TrackFiltered {
+		return track, count, nil
+	}
+
+	if err := db.Model(&models.RunWaypoint{}).Where("run_id = ? AND track = ?", runID, models.TrackRaw).Count(&count).Error; err != nil {
+		return "", 0, fmt.Errorf("failed to count waypoints: %w", err)
+	}
+	return models.TrackRaw, count, nil
+}
+
+func (s *WaypointService) GetWaypoints(runID uuid.UUID, q WaypointQuery) (*WaypointPage, error) {
+	page := &WaypointPage{Step: 1}
+
+	track, total, err := s.resolveTrack(s.db, runID, q.Track)
+	if err != nil {
+		return nil, err
+	}
+	page.Track = track
+	page.TotalPoints = total
+	if page.TotalPoints == 0 {
+		return page, nil
+	}
+
+	query := s.db.Model(&models.RunWaypoint{}).Where("run_id = ? AND track = ?", runID, track)
+	if q.FromSeq != nil {
+		query = query.Where("sequence >= ?", *q.FromSeq)
+	}
+	if q.ToSeq != nil {
+		query = query.Where("sequence <= ?", *q.ToSeq)
+	}
+	if q.From != nil {
+		query = query.Where("recorded_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		query = query.Where("recorded_at <= ?", *q.To)
+	}
+
+	var bounds struct {
+		Matched int64
+		MinSeq  int
+		MaxSeq  int
+	}
+	err = query.Session(&gorm.Session{}).
+		Select("COUNT(*) as matched, COALESCE(MIN(sequence), 0) as min_seq, COALESCE(MAX(sequence), 0) as max_seq").
+		Scan(&bounds).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect waypoint range: %w", err)
+	}
+	page.Matched = bounds.Matched
+	if bounds.Matched == 0 {
+		page.Waypoints = []models.RunWaypoint{}
+		return page, nil
+	}
+
+	// Downsample by keeping every n-th point of the range plus its last point
+	// so the shape and end of the track are preserved. The step leaves one
+	// slot for the last point so no more than MaxPoints are returned.
+	if q.MaxPoints > 0 && bounds.Matched > int64(q.MaxPoints) {
+		if q.MaxPoints == 1 {
+			page.Step = int(bounds.Matched)
+			query = query.Where("sequence = ?", bounds.MinSeq)
+		} else {
+			page.Step = int((bounds.Matched + int64(q.MaxPoints) - 3) / int64(q.MaxPoints-1))
+			query = query.Where("((sequence - ?) % ? = 0 OR sequence = ?)", bounds.MinSeq, page.Step, bounds.MaxSeq)
+		}
+	}
+
+	if err := query.Order("sequence ASC").Find(&page.Waypoints).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch waypoints: %w", err)
+	}
+
+	return page, nil
+}
+
+// LoadTrack returns every waypoint of a run's filtered track, or of the raw
+// track for runs stored before filtering, in sequence order.
+func (s *WaypointService) LoadTrack(runID uuid.UUID) ([]models.WaypointData, error) {
+	return s.loadTrack(s.db, runID)
+}
+
+func (s *WaypointService) loadTrack(db *gorm.DB, runID uuid.UUID) ([]models.WaypointData, error) {
+	track, _, err := s.resolveTrack(db, runID, models.TrackFiltered)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []models.RunWaypoint
+	if err := db.Where("run_id = ? AND track = ?", runID, track).Order("sequence ASC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load waypoints: %w", err)
+	}
+
+	points := make([]models.WaypointData, len(rows))
+	for i := range rows {
+		points[i] = rows[i].ToData()
+	}
+	return points, nil
+}
+
+// EnsureFilteredTrack builds and stores the filtered track for runs that were
+// saved with only a raw track, returning the filtered points. Like uploads,
+// the track takes its altitudes from dem when that covers the route, and the
+// run's elevation source says so.
+func (s *WaypointService) EnsureFilteredTrack(db *gorm.DB, runID uuid.UUID, filter *GPSFilter, dem *DEM) ([]models.WaypointData, error) {
+	track, _, err := s.resolveTrack(db, runID, models.TrackFiltered)
+	if err != nil {
+		return nil, err
+	}
+	if track == models.TrackFiltered {
+		return s.loadTrack(db, runID)
+	}
+
+	raw, err := s.loadTrack(db, runID)
+	if err != nil || len(raw) == 0 {
+		return raw, err
+	}
+
+	filtered := filter.Process(raw)
+	if corrected, ok := dem.CorrectAltitudes(filtered); ok {
+		filtered = corrected
+		err := db.Model(&models.Run{}).Where("id = ?", runID).Update("elevation_source", models.ElevationSourceDEM).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to update elevation source: %w", err)
+		}
+	}
+	if err := s.SaveWaypoints(db, runID, models.TrackFiltered, filtered); err != nil {
+		return nil, err
+	}
+	return filtered, nil
+}
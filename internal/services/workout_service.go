@@ -0,0 +1,552 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/labmino/runsight-backend/internal/models"
+)
+
+const (
+	// Distance and duration within this fraction of target score full marks;
+	// beyond it each 1% of deviation costs two points.
+	complianceVolumeTolerance = 0.05
+	complianceVolumePenalty   = 200
+	// Pace is held to a tighter band and penalized harder: 5% outside the
+	// tolerance costs 25 points.
+	compliancePaceTolerance = 0.03
+	compliancePacePenalty   = 500
+
+	MaxScheduleRangeDays = 366
+)
+
+// ErrWorkoutCompleted is returned when changing a workout that already has a
+// run matched to it.
+var ErrWorkoutCompleted = errors.New("workout already completed")
+
+// ScoreCompliance rates how closely run followed the workout's distance,
+// duration and pace targets and, when the glasses guided it step by step, how
+// many step targets were hit. The score is the mean of the parts that apply,
+// or 100 when the workout set no targets.
+func ScoreCompliance(workout *models.ScheduledWorkout, run *models.Run, steps []models.RunWorkoutStep) (float64, *models.ComplianceBreakdown) {
+	breakdown := &models.ComplianceBreakdown{}
+
+	if run.ComputedDistanceMeters != nil {
+		breakdown.ActualDistanceMeters = *run.ComputedDistanceMeters
+	} else if run.DistanceMeters != nil {
+		breakdown.ActualDistanceMeters = *run.DistanceMeters
+	}
+	switch {
+	case run.MovingTimeSeconds != nil:
+		breakdown.ActualDurationSeconds = *run.MovingTimeSeconds
+	case run.ComputedDurationSeconds != nil:
+		breakdown.ActualDurationSeconds = *run.ComputedDurationSeconds
+	case run.DurationSeconds != nil:
+		breakdown.ActualDurationSeconds = *run.DurationSeconds
+	}
+	if breakdown.ActualDistanceMeters > 0 && breakdown.ActualDurationSeconds > 0 {
+		pace := round2(float64(breakdown.ActualDurationSeconds) / breakdown.ActualDistanceMeters * 1000)
+		breakdown.ActualPaceSecondsPerKm = &pace
+	}
+
+	var scores []float64
+	if workout.TargetDistanceMeters != nil && *workout.TargetDistanceMeters > 0 {
+		score := deviationScore(breakdown.ActualDistanceMeters, *workout.TargetDistanceMeters, complianceVolumeTolerance, complianceVolumePenalty)
+		breakdown.DistanceScore = &score
+		scores = append(scores, score)
+	}
+	if workout.TargetDurationSeconds != nil && *workout.TargetDurationSeconds > 0 {
+		score := deviationScore(float64(breakdown.ActualDurationSeconds), float64(*workout.TargetDurationSeconds), complianceVolumeTolerance, complianceVolumePenalty)
+		breakdown.DurationScore = &score
+		scores = append(scores, score)
+	}
+	if workout.TargetPaceSecondsPerKm != nil && *workout.TargetPaceSecondsPerKm > 0 {
+		var score float64
+		if breakdown.ActualPaceSecondsPerKm != nil {
+			score = deviationScore(*breakdown.ActualPaceSecondsPerKm, float64(*workout.TargetPaceSecondsPerKm), compliancePaceTolerance, compliancePacePenalty)
+		}
+		breakdown.PaceScore = &score
+		scores = append(scores, score)
+	}
+
+	var targeted, hit int
+	for _, step := range steps {
+		if step.HitTarget == nil {
+			continue
+		}
+		targeted++
+		if *step.HitTarget {
+			hit++
+		}
+	}
+	if targeted > 0 {
+		score := round2(float64(hit) / float64(targeted) * 100)
+		breakdown.StepsScore = &score
+		scores = append(scores, score)
+	}
+
+	if len(scores) == 0 {
+		return 100, breakdown
+	}
+	var sum float64
+	for _, s := range scores {
+		sum += s
+	}
+	return round2(sum / float64(len(scores))), breakdown
+}
+
+// ValidateWorkoutSteps checks step structure the struct tags cannot: a step
+// is either a leaf with a kind ended by duration or distance, or a repeated
+// block of leaf steps.
+func ValidateWorkoutSteps(steps []models.WorkoutStep) error {
+	for i, step := range steps {
+		if len(step.Steps) > 0 {
+			if step.Repeat == 0 {
+				return fmt.Errorf("steps[%d]: a block of steps needs repeat", i)
+			}
+			for j, inner := range step.Steps {
+				if len(inner.Steps) > 0 {
+					return fmt.Errorf("steps[%d].steps[%d]: blocks cannot be nested", i, j)
+				}
+				if err := validateLeafStep(inner); err != nil {
+					return fmt.Errorf("steps[%d].steps[%d]: %w", i, j, err)
+				}
+			}
+			continue
+		}
+		if err := validateLeafStep(step); err != nil {
+			return fmt.Errorf("steps[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateLeafStep(step models.WorkoutStep) error {
+	if step.Kind == "" {
+		return errors.New("kind is required")
+	}
+	if (step.DurationSeconds == nil) == (step.DistanceMeters == nil) {
+		return errors.New("exactly one of duration_seconds and distance_meters is required")
+	}
+	return nil
+}
+
+// BuildRunWorkoutSteps turns the executed steps uploaded by the glasses into
+// stored steps, filling in distance from the track and heart rate from the
+// stream where the device did not measure them, and judging each step against
+// its targets.
+func BuildRunWorkoutSteps(data []models.WorkoutStepData, track []models.WaypointData, streams []models.RunStream) ([]models.RunWorkoutStep, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	heartRate, err := heartRateStream(streams)
+	if err != nil {
+		return nil, err
+	}
+	var index *trackIndex
+	if len(track) > 1 {
+		index = newTrackIndex(track)
+	}
+
+	sorted := make([]models.WorkoutStepData, len(data))
+	copy(sorted, data)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartedAt.Before(sorted[j].StartedAt)
+	})
+
+	steps := make([]models.RunWorkoutStep, len(sorted))
+	for i, d := range sorted {
+		step := models.RunWorkoutStep{
+			StepIndex:              i,
+			Kind:                   d.Kind,
+			Repetition:             d.Repetition,
+			StartedAt:              d.StartedAt,
+			EndedAt:                d.EndedAt,
+			TargetDurationSeconds:  d.TargetDurationSeconds,
+			TargetDistanceMeters:   d.TargetDistanceMeters,
+			TargetPaceSecondsPerKm: d.TargetPaceSecondsPerKm,
+			DurationSeconds:        round2(d.EndedAt.Sub(d.StartedAt).Seconds()),
+			AvgHeartRateBpm:        d.AvgHeartRateBpm,
+		}
+
+		if d.DistanceMeters != nil {
+			step.DistanceMeters = round2(*d.DistanceMeters)
+		} else if index != nil {
+			from, _ := index.distanceAtTime(d.StartedAt)
+			to, _ := index.distanceAtTime(d.EndedAt)
+			step.DistanceMeters = round2(to - from)
+		}
+		if step.DistanceMeters > 0 {
+			pace := round2(step.DurationSeconds / step.DistanceMeters * 1000)
+			step.PaceSecondsPerKm = &pace
+		}
+		if step.AvgHeartRateBpm == nil {
+			step.AvgHeartRateBpm = averageHeartRate(heartRate, d.StartedAt, d.EndedAt)
+		}
+
+		step.HitTarget = stepHitTarget(&step)
+		steps[i] = step
+	}
+	return steps, nil
+}
+
+func averageHeartRate(heartRate []StreamPoint, from, to time.Time) *int {
+	var sum float64
+	var count int
+	for _, p := range heartRate {
+		if !p.Timestamp.Before(from) && p.Timestamp.Before(to) {
+			sum += p.Value
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	avg := int(math.Round(sum / float64(count)))
+	return &avg
+}
+
+// stepHitTarget reports whether a step covered its target distance or
+// duration (within tolerance) and was at least as fast as its target pace
+// (within tolerance). Steps without targets are not judged.
+func stepHitTarget(step *models.RunWorkoutStep) *bool {
+	if step.TargetDistanceMeters == nil && step.TargetDurationSeconds == nil && step.TargetPaceSecondsPerKm == nil {
+		return nil
+	}
+
+	hit := true
+	if step.TargetDistanceMeters != nil && step.DistanceMeters < *step.TargetDistanceMeters*(1-complianceVolumeTolerance) {
+		hit = false
+	}
+	if step.TargetDurationSeconds != nil && step.DurationSeconds < float64(*step.TargetDurationSeconds)*(1-complianceVolumeTolerance) {
+		hit = false
+	}
+	if step.TargetPaceSecondsPerKm != nil &&
+		(step.PaceSecondsPerKm == nil || *step.PaceSecondsPerKm > float64(*step.TargetPaceSecondsPerKm)*(1+compliancePaceTolerance)) {
+		hit = false
+	}
+	return &hit
+}
+
+func deviationScore(actual, target, tolerance, penalty float64) float64 {
+	deviation := math.Abs(actual/target - 1)
+	return round2(math.Max(0, math.Min(100, 100-math.Max(0, deviation-tolerance)*penalty)))
+}
+
+type WorkoutService struct {
+	db *gorm.DB
+}
+
+func NewWorkoutService(db *gorm.DB) *WorkoutService {
+	return &WorkoutService{db: db}
+}
+
+func (s *WorkoutService) CreateTemplate(userID uuid.UUID, req *models.WorkoutTemplateRequest) (*models.WorkoutTemplate, error) {
+	template := models.WorkoutTemplate{
+		UserID:                 userID,
+		Name:                   req.Name,
+		Type:                   req.Type,
+		Description:            req.Description,
+		TargetDistanceMeters:   req.TargetDistanceMeters,
+		TargetDurationSeconds:  req.TargetDurationSeconds,
+		TargetPaceSecondsPerKm: req.TargetPaceSecondsPerKm,
+		Steps:                  req.Steps,
+	}
+	if err := s.db.Create(&template).Error; err != nil {
+		return nil, fmt.Errorf("failed to create workout template: %w", err)
+	}
+	return &template, nil
+}
+
+func (s *WorkoutService) ListTemplates(userID uuid.UUID) ([]models.WorkoutTemplate, error) {
+	templates := []models.WorkoutTemplate{}
+	if err := s.db.Where("user_id = ?", userID).Order("name ASC").Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch workout templates: %w", err)
+	}
+	return templates, nil
+}
+
+// DeleteTemplate removes a template. Workouts already scheduled from it keep
+// their copy of its targets.
+func (s *WorkoutService) DeleteTemplate(userID, templateID uuid.UUID) error {
+	result := s.db.Where("id = ? AND user_id = ?", templateID, userID).Delete(&models.WorkoutTemplate{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete workout template: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CreatePlan stores a plan after checking every entry refers to one of the
+// user's templates.
+func (s *WorkoutService) CreatePlan(userID uuid.UUID, req *models.TrainingPlanRequest) (*models.TrainingPlan, error) {
+	if _, err := s.templatesByID(s.db, userID, req.Entries); err != nil {
+		return nil, err
+	}
+
+	plan := models.TrainingPlan{
+		UserID:      userID,
+		Name:        req.Name,
+		Description: req.Description,
+		Entries:     req.Entries,
+	}
+	if err := s.db.Create(&plan).Error; err != nil {
+		return nil, fmt.Errorf("failed to create training plan: %w", err)
+	}
+	return &plan, nil
+}
+
+func (s *WorkoutService) ListPlans(userID uuid.UUID) ([]models.TrainingPlan, error) {
+	plans := []models.TrainingPlan{}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&plans).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch training plans: %w", err)
+	}
+	return plans, nil
+}
+
+// DeletePlan removes a plan along with the workouts it scheduled that are
+// still only planned; completed and skipped ones stay on the calendar.
+func (s *WorkoutService) DeletePlan(userID, planID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", planID, userID).Delete(&models.TrainingPlan{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete training plan: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		err := tx.Where("plan_id = ? AND status = ?", planID, models.WorkoutStatusPlanned).Delete(&models.ScheduledWorkout{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to delete scheduled workouts: %w", err)
+		}
+		return nil
+	})
+}
+
+// SchedulePlan puts every workout of a plan on the user's calendar, counting
+// day offsets from startDate (YYYY-MM-DD).
+func (s *WorkoutService) SchedulePlan(userID, planID uuid.UUID, startDate string) ([]models.ScheduledWorkout, error) {
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date: %w", err)
+	}
+
+	var plan models.TrainingPlan
+	if err := s.db.Where("id = ? AND user_id = ?", planID, userID).First(&plan).Error; err != nil {
+		return nil, err
+	}
+
+	var workouts []models.ScheduledWorkout
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		templates, err := s.templatesByID(tx, userID, plan.Entries)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range plan.Entries {
+			workout := scheduledFromTemplate(templates[entry.TemplateID], start.AddDate(0, 0, entry.DayOffset).Format("2006-01-02"))
+			workout.PlanID = &plan.ID
+			workouts = append(workouts, workout)
+		}
+		if err := tx.Create(&workouts).Error; err != nil {
+			return fmt.Errorf("failed to schedule workouts: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return workouts, nil
+}
+
+func (s *WorkoutService) templatesByID(db *gorm.DB, userID uuid.UUID, entries []models.PlanEntry) (map[uuid.UUID]*models.WorkoutTemplate, error) {
+	ids := make([]uuid.UUID, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.TemplateID)
+	}
+
+	var templates []models.WorkoutTemplate
+	if err := db.Where("user_id = ? AND id IN ?", userID, ids).Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch workout templates: %w", err)
+	}
+
+	byID := make(map[uuid.UUID]*models.WorkoutTemplate, len(templates))
+	for i := range templates {
+		byID[templates[i].ID] = &templates[i]
+	}
+	for _, id := range ids {
+		if byID[id] == nil {
+			return nil, fmt.Errorf("workout template %s: %w", id, gorm.ErrRecordNotFound)
+		}
+	}
+	return byID, nil
+}
+
+func scheduledFromTemplate(template *models.WorkoutTemplate, date string) models.ScheduledWorkout {
+	return models.ScheduledWorkout{
+		UserID:                 template.UserID,
+		Date:                   date,
+		TemplateID:             &template.ID,
+		Name:                   template.Name,
+		Type:                   template.Type,
+		Description:            template.Description,
+		TargetDistanceMeters:   template.TargetDistanceMeters,
+		TargetDurationSeconds:  template.TargetDurationSeconds,
+		TargetPaceSecondsPerKm: template.TargetPaceSecondsPerKm,
+		Steps:                  template.Steps,
+		Status:                 models.WorkoutStatusPlanned,
+	}
+}
+
+// ScheduleWorkout puts a single template on the user's calendar.
+func (s *WorkoutService) ScheduleWorkout(userID uuid.UUID, req *models.ScheduleWorkoutRequest) (*models.ScheduledWorkout, error) {
+	var template models.WorkoutTemplate
+	if err := s.db.Where("id = ? AND user_id = ?", req.TemplateID, userID).First(&template).Error; err != nil {
+		return nil, err
+	}
+
+	workout := scheduledFromTemplate(&template, req.Date)
+	if err := s.db.Create(&workout).Error; err != nil {
+		return nil, fmt.Errorf("failed to schedule workout: %w", err)
+	}
+	return &workout, nil
+}
+
+// ListSchedule returns the user's workouts dated from..to inclusive
+// (YYYY-MM-DD).
+func (s *WorkoutService) ListSchedule(userID uuid.UUID, from, to string) ([]models.ScheduledWorkout, error) {
+	workouts := []models.ScheduledWorkout{}
+	err := s.db.Where("user_id = ? AND date >= ? AND date <= ?", userID, from, to).
+		Order("date ASC, created_at ASC").Find(&workouts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch scheduled workouts: %w", err)
+	}
+	return workouts, nil
+}
+
+// UpdateScheduled moves a workout or changes whether it is skipped. Completed
+// workouts cannot be changed.
+func (s *WorkoutService) UpdateScheduled(userID, workoutID uuid.UUID, req *models.ScheduledWorkoutUpdateRequest) (*models.ScheduledWorkout, error) {
+	var workout models.ScheduledWorkout
+	if err := s.db.Where("id = ? AND user_id = ?", workoutID, userID).First(&workout).Error; err != nil {
+		return nil, err
+	}
+	if workout.Status == models.WorkoutStatusCompleted {
+		return nil, ErrWorkoutCompleted
+	}
+
+	if req.Date != nil {
+		workout.Date = *req.Date
+	}
+	if req.Status != nil {
+		workout.Status = *req.Status
+	}
+	if err := s.db.Save(&workout).Error; err != nil {
+		return nil, fmt.Errorf("failed to update scheduled workout: %w", err)
+	}
+	return &workout, nil
+}
+
+func (s *WorkoutService) DeleteScheduled(userID, workoutID uuid.UUID) error {
+	result := s.db.Where("id = ? AND user_id = ?", workoutID, userID).Delete(&models.ScheduledWorkout{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete scheduled workout: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// NextWorkout returns the earliest planned workout from today on in the
+// user's timezone, or nil when nothing is scheduled.
+func (s *WorkoutService) NextWorkout(userID uuid.UUID) (*models.ScheduledWorkout, error) {
+	loc, _, err := LoadUserCalendar(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var workout models.ScheduledWorkout
+	err = s.db.Where("user_id = ? AND status = ? AND date >= ?", userID, models.WorkoutStatusPlanned, time.Now().In(loc).Format("2006-01-02")).
+		Order("date ASC, created_at ASC").First(&workout).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch next workout: %w", err)
+	}
+	return &workout, nil
+}
+
+// SaveRunSteps replaces the stored workout steps of a run inside tx.
+func (s *WorkoutService) SaveRunSteps(tx *gorm.DB, runID uuid.UUID, steps []models.RunWorkoutStep) error {
+	if err := tx.Where("run_id = ?", runID).Delete(&models.RunWorkoutStep{}).Error; err != nil {
+		return fmt.Errorf("failed to clear workout steps: %w", err)
+	}
+	if len(steps) == 0 {
+		return nil
+	}
+
+	for i := range steps {
+		steps[i].RunID = runID
+	}
+	if err := tx.Create(&steps).Error; err != nil {
+		return fmt.Errorf("failed to save workout steps: %w", err)
+	}
+	return nil
+}
+
+func (s *WorkoutService) GetRunSteps(runID uuid.UUID) ([]models.RunWorkoutStep, error) {
+	var steps []models.RunWorkoutStep
+	if err := s.db.Where("run_id = ?", runID).Order("step_index ASC").Find(&steps).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch workout steps: %w", err)
+	}
+	return steps, nil
+}
+
+// MatchRun attaches a newly stored run to a scheduled workout inside tx and
+// scores it. The workout named by the device is used when given; otherwise
+// the first planned workout on the run's local date. It returns nil when
+// nothing matched.
+func (s *WorkoutService) MatchRun(tx *gorm.DB, run *models.Run, scheduledID *uuid.UUID, steps []models.RunWorkoutStep) (*models.ScheduledWorkout, error) {
+	query := tx.Where("user_id = ? AND status = ?", run.UserID, models.WorkoutStatusPlanned)
+	if scheduledID != nil {
+		query = query.Where("id = ?", *scheduledID)
+	} else {
+		loc, _, err := LoadUserCalendar(tx, run.UserID)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("date = ?", run.StartedAt.In(loc).Format("2006-01-02"))
+	}
+
+	var workout models.ScheduledWorkout
+	err := query.Order("created_at ASC").First(&workout).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch scheduled workout: %w", err)
+	}
+
+	score, breakdown := ScoreCompliance(&workout, run, steps)
+	now := time.Now()
+	workout.Status = models.WorkoutStatusCompleted
+	workout.RunID = &run.ID
+	workout.ComplianceScore = &score
+	workout.Compliance = breakdown
+	workout.CompletedAt = &now
+	if err := tx.Save(&workout).Error; err != nil {
+		return nil, fmt.Errorf("failed to update scheduled workout: %w", err)
+	}
+	return &workout, nil
+}
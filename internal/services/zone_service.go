@@ -0,0 +1,523 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/utils"
+)
+
+var (
+	// Heart rate zone boundaries as fractions of max heart rate.
+	heartRateZoneRatios = []float64{0.60, 0.70, 0.80, 0.90}
+	// Pace zone boundaries as multiples of threshold pace, slowest first:
+	// recovery, endurance, tempo, threshold, speed.
+	paceZoneRatios = []float64{1.29, 1.14, 1.06, 0.97}
+)
+
+const (
+	// Sensor samples further apart than this are treated as a dropout and
+	// only credited up to the gap.
+	maxStreamSampleGap = 5 * time.Second
+
+	zoneEstimateMaxAge   = 24 * time.Hour
+	zoneEstimateLookback = 365 * 24 * time.Hour
+	// Runs of roughly 20 to 70 minutes' moving time are the ones whose best
+	// average pace approximates threshold (about one-hour race) pace.
+	thresholdRunMinSeconds = 20 * 60
+	thresholdRunMaxSeconds = 70 * 60
+)
+
+// ZoneBounds are the four boundaries between five zones. Heart rate bounds
+// ascend in bpm; pace bounds descend in seconds per km.
+type ZoneBounds struct {
+	HeartRate []float64 `json:"heart_rate,omitempty"`
+	Pace      []float64 `json:"pace,omitempty"`
+}
+
+// ResolveZoneBounds works out the zones in effect for settings: custom bounds
+// first, then bounds derived from the manual or estimated max heart rate and
+// threshold pace.
+func ResolveZoneBounds(settings *models.ZoneSettings) ZoneBounds {
+	var bounds ZoneBounds
+
+	if custom := parseBounds(settings.HeartRateZoneBounds); custom != nil {
+		bounds.HeartRate = custom
+	} else if maxHR := effectiveValue(settings.MaxHeartRateBpm, settings.EstimatedMaxHeartRateBpm, settings.AutoEstimate); maxHR != nil {
+		for _, r := range heartRateZoneRatios {
+			bounds.HeartRate = append(bounds.HeartRate, math.Round(float64(*maxHR)*r))
+		}
+	}
+
+	if custom := parseBounds(settings.PaceZoneBounds); custom != nil {
+		bounds.Pace = custom
+	} else if threshold := effectiveValue(settings.ThresholdPaceSecondsPerKm, settings.EstimatedThresholdPaceSecondsPerKm, settings.AutoEstimate); threshold != nil {
+		for _, r := range paceZoneRatios {
+			bounds.Pace = append(bounds.Pace, math.Round(float64(*threshold)*r))
+		}
+	}
+
+	return bounds
+}
+
+func effectiveValue(manual, estimated *int, auto bool) *int {
+	if manual != nil {
+		return manual
+	}
+	if auto {
+		return estimated
+	}
+	return nil
+}
+
+func parseBounds(s string) []float64 {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != models.ZoneCount-1 {
+		return nil
+	}
+	bounds := make([]float64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil
+		}
+		bounds[i] = v
+	}
+	return bounds
+}
+
+func formatBounds(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func heartRateZone(bpm float64, bounds []float64) int {
+	zone := 1
+	for _, b := range bounds {
+		if bpm >= b {
+			zone++
+		}
+	}
+	return zone
+}
+
+func paceZone(secondsPerKm float64, bounds []float64) int {
+	zone := 1
+	for _, b := range bounds {
+		if secondsPerKm <= b {
+			zone++
+		}
+	}
+	return zone
+}
+
+// ComputeZoneTimes returns the seconds spent in each heart rate zone (from
+// the heart rate stream) and pace zone (from the moving parts of the track).
+// Kinds without bounds or data are left out.
+func ComputeZoneTimes(heartRate []StreamPoint, track []models.WaypointData, bounds ZoneBounds) []models.RunZoneTime {
+	var times []models.RunZoneTime
+
+	if len(bounds.HeartRate) == models.ZoneCount-1 && len(heartRate) > 1 {
+		seconds := make([]float64, models.ZoneCount)
+		for i := 0; i < len(heartRate)-1; i++ {
+			dt := heartRate[i+1].Timestamp.Sub(heartRate[i].Timestamp)
+			if dt > maxStreamSampleGap {
+				dt = maxStreamSampleGap
+			}
+			seconds[heartRateZone(heartRate[i].Value, bounds.HeartRate)-1] += dt.Seconds()
+		}
+		times = append(times, zoneTimes(models.ZoneKindHeartRate, seconds)...)
+	}
+
+	if len(bounds.Pace) == models.ZoneCount-1 && len(track) > 1 {
+		seconds := make([]float64, models.ZoneCount)
+		cumulative := cumulativeDistances(track)
+		start := 0
+		for i := 1; i < len(track); i++ {
+			dt := track[i].Timestamp.Sub(track[i-1].Timestamp)
+			if dt <= 0 || dt > maxMovingGap {
+				continue
+			}
+
+			// Pace over a trailing window so single noisy fixes do not jump zones
+			for start < i-1 && track[i].Timestamp.Sub(track[start+1].Timestamp) >= speedSmoothingWindow {
+				start++
+			}
+			window := track[i].Timestamp.Sub(track[start].Timestamp).Seconds()
+			speed := (cumulative[i] - cumulative[start]) / window
+			if speed < movingSpeedThresholdMps {
+				continue
+			}
+			seconds[paceZone(1000/speed, bounds.Pace)-1] += dt.Seconds()
+		}
+		times = append(times, zoneTimes(models.ZoneKindPace, seconds)...)
+	}
+
+	return times
+}
+
+func zoneTimes(kind string, seconds []float64) []models.RunZoneTime {
+	times := make([]models.RunZoneTime, len(seconds))
+	for i, s := range seconds {
+		times[i] = models.RunZoneTime{Kind: kind, Zone: i + 1, Seconds: round2(s)}
+	}
+	return times
+}
+
+type ZoneService struct {
+	db              *gorm.DB
+	waypointService *WaypointService
+}
+
+func NewZoneService(db *gorm.DB) *ZoneService {
+	return &ZoneService{
+		db:              db,
+		waypointService: NewWaypointService(db),
+	}
+}
+
+// GetSettings returns the user's zone settings, refreshing auto-estimated
+// values when they are missing or stale. Users who never saved settings get
+// auto-estimated defaults.
+func (s *ZoneService) GetSettings(userID uuid.UUID) (*models.ZoneSettings, error) {
+	return s.getSettings(s.db, userID)
+}
+
+func (s *ZoneService) getSettings(db *gorm.DB, userID uuid.UUID) (*models.ZoneSettings, error) {
+	var settings models.ZoneSettings
+	err := db.Where("user_id = ?", userID).First(&settings).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to fetch zone settings: %w", err)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		settings = models.ZoneSettings{UserID: userID, AutoEstimate: true}
+	}
+
+	stale := settings.EstimatedAt == nil || time.Since(*settings.EstimatedAt) > zoneEstimateMaxAge
+	if settings.AutoEstimate && stale {
+		if err := s.estimate(db, &settings); err != nil {
+			return nil, err
+		}
+		if err := saveEstimate(db, &settings); err != nil {
+			return nil, fmt.Errorf("failed to save zone settings: %w", err)
+		}
+	}
+
+	return &settings, nil
+}
+
+// saveEstimate stores freshly estimated settings. The first uploads of a new
+// user race to create the row, so a new row is upserted on user_id and the
+// row that won is read back.
+func saveEstimate(db *gorm.DB, settings *models.ZoneSettings) error {
+	if settings.ID != uuid.Nil {
+		return db.Save(settings).Error
+	}
+
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"estimated_max_heart_rate_bpm", "estimated_threshold_pace_seconds_per_km", "estimated_at", "updated_at",
+		}),
+	}).Create(settings).Error
+	if err != nil {
+		return err
+	}
+
+	var stored models.ZoneSettings
+	if err := db.Where("user_id = ?", settings.UserID).First(&stored).Error; err != nil {
+		return err
+	}
+	*settings = stored
+	return nil
+}
+
+// ValidateZoneSettings checks that custom bounds are strictly ordered from
+// the easiest zone to the hardest.
+func ValidateZoneSettings(req *models.ZoneSettingsRequest) error {
+	for i := 1; i < len(req.HeartRateZoneBounds); i++ {
+		if req.HeartRateZoneBounds[i] <= req.HeartRateZoneBounds[i-1] {
+			return errors.New("heart_rate_zone_bounds must be in ascending order")
+		}
+	}
+	for i := 1; i < len(req.PaceZoneBounds); i++ {
+		if req.PaceZoneBounds[i] >= req.PaceZoneBounds[i-1] {
+			return errors.New("pace_zone_bounds must go from slowest to fastest pace")
+		}
+	}
+	return nil
+}
+
+// UpdateSettings replaces the user's zone settings and queues their past
+// runs for RecomputePending.
+func (s *ZoneService) UpdateSettings(userID uuid.UUID, req *models.ZoneSettingsRequest) (*models.ZoneSettings, error) {
+	settings, err := s.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	settings.MaxHeartRateBpm = req.MaxHeartRateBpm
+	settings.RestingHeartRateBpm = req.RestingHeartRateBpm
+	settings.ThresholdPaceSecondsPerKm = req.ThresholdPaceSecondsPerKm
+	settings.HeartRateZoneBounds = formatBounds(req.HeartRateZoneBounds)
+	settings.PaceZoneBounds = formatBounds(req.PaceZoneBounds)
+	if req.AutoEstimate != nil {
+		settings.AutoEstimate = *req.AutoEstimate
+	}
+	now := time.Now()
+	settings.RecomputeRequestedAt = &now
+
+	if err := s.db.Save(settings).Error; err != nil {
+		return nil, fmt.Errorf("failed to save zone settings: %w", err)
+	}
+	return settings, nil
+}
+
+// estimate derives max heart rate and threshold pace from the past year of
+// runs: the highest heart rate seen, and the best average pace among runs
+// long enough to approximate a one-hour effort.
+func (s *ZoneService) estimate(db *gorm.DB, settings *models.ZoneSettings) error {
+	since := time.Now().Add(-zoneEstimateLookback)
+
+	var result struct {
+		MaxHR    *float64
+		MaxSpeed *float64
+	}
+	err := db.Model(&models.Run{}).
+		Select(`
+			MAX(max_heart_rate_bpm) as max_hr,
+			MAX(CASE WHEN moving_time_seconds BETWEEN ? AND ? THEN computed_avg_speed_kmh END) as max_speed
+		`, thresholdRunMinSeconds, thresholdRunMaxSeconds).
+		Where("user_id = ? AND started_at >= ?", settings.UserID, since).
+		Scan(&result).Error
+	if err != nil {
+		return fmt.Errorf("failed to estimate zones: %w", err)
+	}
+
+	now := time.Now()
+	settings.EstimatedAt = &now
+	if result.MaxHR != nil && *result.MaxHR > 0 {
+		maxHR := int(math.Round(*result.MaxHR))
+		settings.EstimatedMaxHeartRateBpm = &maxHR
+	}
+	if result.MaxSpeed != nil && *result.MaxSpeed > 0 {
+		pace := int(math.Round(3600 / *result.MaxSpeed))
+		settings.EstimatedThresholdPaceSecondsPerKm = &pace
+	}
+	return nil
+}
+
+// SaveRunZones computes and stores time in zone for a run inside tx. A run
+// that beats the user's estimated max heart rate raises the estimate first,
+// so the very first run with heart rate data still gets zones.
+func (s *ZoneService) SaveRunZones(tx *gorm.DB, run *models.Run, track []models.WaypointData, streams []models.RunStream) error {
+	settings, err := s.getSettings(tx, run.UserID)
+	if err != nil {
+		return err
+	}
+
+	if settings.AutoEstimate && run.MaxHeartRateBpm != nil &&
+		(settings.EstimatedMaxHeartRateBpm == nil || *run.MaxHeartRateBpm > *settings.EstimatedMaxHeartRateBpm) {
+		settings.EstimatedMaxHeartRateBpm = run.MaxHeartRateBpm
+		if err := tx.Save(settings).Error; err != nil {
+			return fmt.Errorf("failed to save zone settings: %w", err)
+		}
+	}
+
+	heartRate, err := heartRateStream(streams)
+	if err != nil {
+		return err
+	}
+	return s.replaceRunZones(tx, run.ID, ComputeZoneTimes(heartRate, track, ResolveZoneBounds(settings)))
+}
+
+// RecomputeUserZones recomputes time in zone for every run of a user, e.g.
+// after the zone settings changed.
+func (s *ZoneService) RecomputeUserZones(userID uuid.UUID) error {
+	settings, err := s.GetSettings(userID)
+	if err != nil {
+		return err
+	}
+	bounds := ResolveZoneBounds(settings)
+
+	var runIDs []uuid.UUID
+	if err := s.db.Model(&models.Run{}).Where("user_id = ?", userID).Pluck("id", &runIDs).Error; err != nil {
+		return fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	for _, runID := range runIDs {
+		track, err := s.waypointService.LoadTrack(runID)
+		if err != nil {
+			return err
+		}
+
+		var streams []models.RunStream
+		if err := s.db.Where("run_id = ? AND type = ?", runID, models.StreamTypeHeartRate).Find(&streams).Error; err != nil {
+			return fmt.Errorf("failed to fetch heart rate stream: %w", err)
+		}
+		heartRate, err := heartRateStream(streams)
+		if err != nil {
+			return err
+		}
+
+		if err := s.replaceRunZones(s.db, runID, ComputeZoneTimes(heartRate, track, bounds)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecomputePending re-buckets past runs and rebuilds training load for users
+// whose zone settings changed. Users are handled one at a time, so repeated
+// changes never recompute the same history concurrently; a change made while
+// a user is being recomputed leaves them queued for the next pass.
+func (s *ZoneService) RecomputePending(ctx context.Context) error {
+	var pending []models.ZoneSettings
+	err := s.db.WithContext(ctx).Select("user_id", "recompute_requested_at").
+		Where("recompute_requested_at IS NOT NULL").
+		Order("recompute_requested_at ASC").
+		Find(&pending).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch pending zone recomputes: %w", err)
+	}
+
+	loadService := NewTrainingLoadService(s.db)
+	for _, p := range pending {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err := s.RecomputeUserZones(p.UserID); err != nil {
+			utils.Error("Failed to recompute zone times", zap.String("user_id", p.UserID.String()), zap.Error(err))
+			continue
+		}
+		if err := loadService.RecomputeUser(p.UserID); err != nil {
+			utils.Error("Failed to recompute training load", zap.String("user_id", p.UserID.String()), zap.Error(err))
+			continue
+		}
+
+		err := s.db.Model(&models.ZoneSettings{}).
+			Where("user_id = ? AND recompute_requested_at = ?", p.UserID, *p.RecomputeRequestedAt).
+			UpdateColumn("recompute_requested_at", nil).Error
+		if err != nil {
+			return fmt.Errorf("failed to clear zone recompute: %w", err)
+		}
+	}
+	return nil
+}
+
+func heartRateStream(streams []models.RunStream) ([]StreamPoint, error) {
+	for i := range streams {
+		if streams[i].Type == models.StreamTypeHeartRate {
+			return DecodeStream(&streams[i])
+		}
+	}
+	return nil, nil
+}
+
+func (s *ZoneService) replaceRunZones(db *gorm.DB, runID uuid.UUID, times []models.RunZoneTime) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("run_id = ?", runID).Delete(&models.RunZoneTime{}).Error; err != nil {
+			return fmt.Errorf("failed to clear zone times: %w", err)
+		}
+		if len(times) == 0 {
+			return nil
+		}
+		for i := range times {
+			times[i].RunID = runID
+		}
+		if err := tx.Create(&times).Error; err != nil {
+			return fmt.Errorf("failed to save zone times: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetRunZones returns the stored time in zone of one run.
+func (s *ZoneService) GetRunZones(runID uuid.UUID) ([]models.RunZoneTime, error) {
+	var times []models.RunZoneTime
+	if err := s.db.Where("run_id = ?", runID).Order("kind ASC, zone ASC").Find(&times).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch zone times: %w", err)
+	}
+	return times, nil
+}
+
+type ZoneDistributionEntry struct {
+	Zone    int     `json:"zone"`
+	Seconds float64 `json:"seconds"`
+	Percent float64 `json:"percent"`
+}
+
+type ZoneDistribution struct {
+	TotalSeconds float64                 `json:"total_seconds"`
+	Zones        []ZoneDistributionEntry `json:"zones"`
+}
+
+// Distribution sums time in zone across a user's runs started within
+// [from, to); zero times leave that bound open.
+func (s *ZoneService) Distribution(userID uuid.UUID, from, to time.Time) (map[string]*ZoneDistribution, error) {
+	query := s.db.Table("run_zone_times").
+		Select("run_zone_times.kind as kind, run_zone_times.zone as zone, COALESCE(SUM(run_zone_times.seconds), 0) as seconds").
+		Joins("JOIN runs ON runs.id = run_zone_times.run_id").
+		Where("runs.user_id = ?", userID)
+	if !from.IsZero() {
+		query = query.Where("runs.started_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("runs.started_at < ?", to)
+	}
+
+	var rows []struct {
+		Kind    string
+		Zone    int
+		Seconds float64
+	}
+	if err := query.Group("run_zone_times.kind, run_zone_times.zone").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate zone times: %w", err)
+	}
+
+	distribution := make(map[string]*ZoneDistribution, 2)
+	for _, kind := range []string{models.ZoneKindHeartRate, models.ZoneKindPace} {
+		d := &ZoneDistribution{Zones: make([]ZoneDistributionEntry, models.ZoneCount)}
+		for i := range d.Zones {
+			d.Zones[i].Zone = i + 1
+		}
+		distribution[kind] = d
+	}
+
+	for _, row := range rows {
+		d, ok := distribution[row.Kind]
+		if !ok || row.Zone < 1 || row.Zone > models.ZoneCount {
+			continue
+		}
+		d.Zones[row.Zone-1].Seconds = round2(row.Seconds)
+		d.TotalSeconds += row.Seconds
+	}
+	for _, d := range distribution {
+		d.TotalSeconds = round2(d.TotalSeconds)
+		if d.TotalSeconds == 0 {
+			continue
+		}
+		for i := range d.Zones {
+			d.Zones[i].Percent = round2(d.Zones[i].Seconds / d.TotalSeconds * 100)
+		}
+	}
+	return distribution, nil
+}
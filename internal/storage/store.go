@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when opening a key that holds no object.
+var ErrNotFound = errors.New("object not found")
+
+// Store keeps binary objects such as frames and dataset exports under
+// slash-separated keys like "datasets/v3/manifest.jsonl".
+type Store interface {
+	// Put writes the object, replacing any object stored under the key.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open reads the object, returning ErrNotFound when there is none.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object; deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// URLSigner is implemented by stores that can hand out short-lived URLs
+// for clients to download an object directly.
+type URLSigner interface {
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// validateKey rejects keys that are empty, absolute or not in clean
+// slash-separated form, so a key can never escape its store.
+func validateKey(key string) error {
+	clean := path.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "\\") || clean != "/"+key {
+		return fmt.Errorf("invalid object key %q", key)
+	}
+	return nil
+}
+
+const defaultLocalRoot = "data/blobs"
+
+var (
+	defaultStoreMu sync.RWMutex
+	defaultStore   Store
+)
+
+// SetDefault installs the store used by services created after the call.
+func SetDefault(s Store) {
+	defaultStoreMu.Lock()
+	defer defaultStoreMu.Unlock()
+	defaultStore = s
+}
+
+// Default returns the store installed at startup, falling back to a local
+// store under data/blobs.
+func Default() Store {
+	defaultStoreMu.RLock()
+	s := defaultStore
+	defaultStoreMu.RUnlock()
+	if s != nil {
+		return s
+	}
+	return &LocalStore{root: defaultLocalRoot}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type AIEventTestSuite struct {
+	suite.Suite
+}
+
+func (suite *AIEventTestSuite) TestEventsPlacedOnTrack() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	track := straightTrack(start, 600, 3.0)
+
+	events := services.BuildAIEvents([]models.AIEventData{
+		{
+			Timestamp:      start.Add(200*time.Second + 500*time.Millisecond),
+			Type:           " Bicycle ",
+			Confidence:     0.8,
+			DistanceMeters: floatPtr(10),
+			BearingDegrees: floatPtr(90),
+			WarningSpoken:  true,
+		},
+		{Timestamp: start.Add(100 * time.Second), Type: "person", Confidence: 0.9},
+	}, track)
+
+	assert.Len(suite.T(), events, 2)
+
+	// Sorted by time, classes normalized
+	first, second := events[0], events[1]
+	assert.Equal(suite.T(), "person", first.Type)
+	assert.Equal(suite.T(), "bicycle", second.Type)
+
+	assert.InDelta(suite.T(), 300, *first.RouteDistanceMeters, 1)
+	assert.Equal(suite.T(), 100, *first.WaypointSequence)
+	assert.InDelta(suite.T(), track[100].Latitude, *first.Latitude, 1e-9)
+	assert.Nil(suite.T(), first.ObjectLatitude, "no distance estimate, no object position")
+
+	assert.InDelta(suite.T(), 601.5, *second.RouteDistanceMeters, 1)
+	assert.Equal(suite.T(), 201, *second.WaypointSequence)
+	midLat := (track[200].Latitude + track[201].Latitude) / 2
+	assert.InDelta(suite.T(), midLat, *second.Latitude, 1e-9)
+
+	// Running north, an object 10 m to the right lies due east
+	assert.NotNil(suite.T(), second.ObjectLatitude)
+	assert.InDelta(suite.T(), *second.Latitude, *second.ObjectLatitude, 1e-6)
+	assert.Greater(suite.T(), *second.ObjectLongitude, *second.Longitude)
+	assert.InDelta(suite.T(), 10, (*second.ObjectLongitude-*second.Longitude)*111195*0.9941, 0.2)
+}
+
+func (suite *AIEventTestSuite) TestEventsWithoutTrack() {
+	events := services.BuildAIEvents([]models.AIEventData{
+		{Timestamp: time.Now(), Type: "pole", Confidence: 0.5, DistanceMeters: floatPtr(5)},
+	}, nil)
+
+	assert.Len(suite.T(), events, 1)
+	assert.Nil(suite.T(), events[0].Latitude)
+	assert.Nil(suite.T(), events[0].WaypointSequence)
+	assert.Nil(suite.T(), events[0].ObjectLatitude)
+}
+
+func (suite *AIEventTestSuite) TestLaneEventsPlacedOnTrack() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	track := straightTrack(start, 600, 3.0)
+
+	events := services.BuildLaneEvents([]models.LaneEventData{
+		{StartedAt: start.Add(400 * time.Second), EndedAt: start.Add(410 * time.Second), Direction: models.LaneDirectionRight, MaxOffsetMeters: 0.4},
+		{StartedAt: start.Add(50 * time.Second), EndedAt: start.Add(150 * time.Second), Direction: models.LaneDirectionLeft, MaxOffsetMeters: 0.8, CorrectionLatencyMs: intPtr(900)},
+	}, track)
+
+	assert.Len(suite.T(), events, 2)
+	first := events[0]
+	assert.Equal(suite.T(), models.LaneDirectionLeft, first.Direction)
+	assert.InDelta(suite.T(), 150, *first.StartDistanceMeters, 1)
+	assert.InDelta(suite.T(), 450, *first.EndDistanceMeters, 1)
+	assert.Equal(suite.T(), 50, *first.StartWaypointSequence)
+	assert.Equal(suite.T(), 150, *first.EndWaypointSequence)
+	assert.InDelta(suite.T(), track[150].Latitude, *first.EndLatitude, 1e-9)
+}
+
+func (suite *AIEventTestSuite) TestLaneKeepingCurve() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	track := straightTrack(start, 600, 3.0)
+	events := []models.LaneEvent{
+		{StartedAt: start.Add(50 * time.Second), EndedAt: start.Add(150 * time.Second), MaxOffsetMeters: 0.8},
+	}
+
+	curve, resolution := services.LaneKeepingCurve(track, events, 300)
+	assert.Equal(suite.T(), 300.0, resolution)
+	assert.Len(suite.T(), curve, 6)
+
+	// The deviation is counted where it started and its time is shared
+	assert.Equal(suite.T(), 1, curve[0].Deviations)
+	assert.InDelta(suite.T(), 50, curve[0].DriftSeconds, 0.5)
+	assert.InDelta(suite.T(), 0.5, curve[0].InLaneRatio, 0.01)
+	assert.Equal(suite.T(), 0, curve[1].Deviations)
+	assert.InDelta(suite.T(), 50, curve[1].DriftSeconds, 0.5)
+	assert.Equal(suite.T(), 0.8, *curve[1].MaxOffsetMeters)
+
+	assert.Equal(suite.T(), 1.0, curve[2].InLaneRatio)
+	assert.Nil(suite.T(), curve[2].MaxOffsetMeters)
+	assert.InDelta(suite.T(), 1800, curve[5].ToMeters, 1)
+
+	empty, _ := services.LaneKeepingCurve(nil, events, 300)
+	assert.Empty(suite.T(), empty)
+}
+
+func (suite *AIEventTestSuite) TestDeviceFeedbackMatchesWarnings() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	track := straightTrack(start, 600, 3.0)
+
+	events := services.BuildAIEvents([]models.AIEventData{
+		{Timestamp: start.Add(100 * time.Second), Type: "pole", Confidence: 0.7, WarningSpoken: true},
+		{Timestamp: start.Add(103 * time.Second), Type: "person", Confidence: 0.5},
+		{Timestamp: start.Add(300 * time.Second), Type: "bicycle", Confidence: 0.6},
+	}, track)
+	for i := range events {
+		events[i].ID = uuid.New()
+	}
+
+	feedback := services.MatchDeviceFeedback([]models.AIFeedbackData{
+		// Missed obstacle, placed on the track
+		{Timestamp: start.Add(500 * time.Second), Label: models.AIFeedbackMissed},
+		// Reacts to the spoken warning, not the later silent detection;
+		// the second press replaces the first
+		{Timestamp: start.Add(105 * time.Second), Label: models.AIFeedbackCorrect},
+		{Timestamp: start.Add(107 * time.Second), Label: models.AIFeedbackFalsePositive},
+		// Nothing spoken, falls back to the last detection
+		{Timestamp: start.Add(302 * time.Second), Label: models.AIFeedbackCorrect},
+		// Too long after anything to label
+		{Timestamp: start.Add(200 * time.Second), Label: models.AIFeedbackFalsePositive},
+	}, events, track)
+
+	assert.Len(suite.T(), feedback, 3)
+
+	pole := feedback[0]
+	assert.Equal(suite.T(), events[0].ID, *pole.AIEventID)
+	assert.Equal(suite.T(), models.AIFeedbackFalsePositive, pole.Label)
+	assert.Equal(suite.T(), models.AIFeedbackSourceDevice, pole.Source)
+	assert.Equal(suite.T(), "pole", pole.Type)
+	assert.Equal(suite.T(), events[0].Timestamp, pole.Timestamp)
+
+	bicycle := feedback[1]
+	assert.Equal(suite.T(), events[2].ID, *bicycle.AIEventID)
+	assert.Equal(suite.T(), models.AIFeedbackCorrect, bicycle.Label)
+
+	missed := feedback[2]
+	assert.Nil(suite.T(), missed.AIEventID)
+	assert.Equal(suite.T(), models.AIFeedbackMissed, missed.Label)
+	expectedLat, _ := offsetMeters(-6.2, 106.8, 1500, 0)
+	assert.InDelta(suite.T(), expectedLat, *missed.Latitude, 1e-6)
+}
+
+func TestAIEventTestSuite(t *testing.T) {
+	suite.Run(t, new(AIEventTestSuite))
+}
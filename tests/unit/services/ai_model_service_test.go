@@ -0,0 +1,199 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type AIModelTestSuite struct {
+	suite.Suite
+}
+
+func (suite *AIModelTestSuite) TestRatesFromUsage() {
+	c := services.CompareAIModelUsage(services.AIModelUsage{
+		Name:              "yolov8n",
+		Version:           "1.2.0",
+		HardwareVersion:   "rev-b",
+		Runs:              3,
+		Frames:            30000,
+		Detections:        450,
+		Warnings:          90,
+		WeightedInference: floatPtr(30000 * 42.5),
+		InferenceFrames:   floatPtr(30000),
+		MeanInference:     floatPtr(50),
+		MinInference:      floatPtr(20.123),
+		MaxInference:      floatPtr(180),
+		DetectionFrames:   floatPtr(30000),
+		DetectionMeters:   floatPtr(15000),
+	})
+
+	assert.Equal(suite.T(), int64(3), c.Runs)
+	assert.InDelta(suite.T(), 42.5, *c.AvgInferenceMs, 0.001)
+	assert.InDelta(suite.T(), 20.12, *c.MinInferenceMs, 0.001)
+	assert.InDelta(suite.T(), 15, *c.DetectionsPer1kFrames, 0.001)
+	assert.InDelta(suite.T(), 30, *c.DetectionsPerKm, 0.001)
+	assert.InDelta(suite.T(), 0.2, *c.WarningsPerDetection, 0.001)
+}
+
+func (suite *AIModelTestSuite) TestAverageFallsBackWithoutFrames() {
+	c := services.CompareAIModelUsage(services.AIModelUsage{
+		Runs:          2,
+		MeanInference: floatPtr(55.555),
+	})
+
+	assert.InDelta(suite.T(), 55.56, *c.AvgInferenceMs, 0.001)
+	assert.Nil(suite.T(), c.DetectionsPer1kFrames)
+	assert.Nil(suite.T(), c.DetectionsPerKm)
+	assert.Nil(suite.T(), c.WarningsPerDetection)
+}
+
+func (suite *AIModelTestSuite) TestNothingReported() {
+	c := services.CompareAIModelUsage(services.AIModelUsage{Runs: 1})
+
+	assert.Nil(suite.T(), c.AvgInferenceMs)
+	assert.Nil(suite.T(), c.MinInferenceMs)
+	assert.Nil(suite.T(), c.MaxInferenceMs)
+}
+
+func (suite *AIModelTestSuite) TestCompareVersions() {
+	assert.Equal(suite.T(), 0, services.CompareVersions("1.2.0", "1.2"))
+	assert.Equal(suite.T(), 1, services.CompareVersions("1.10.0", "1.9.3"))
+	assert.Equal(suite.T(), -1, services.CompareVersions("v2.0.0-rc1", "2.0.1"))
+	assert.Equal(suite.T(), 0, services.CompareVersions("v2.0.0-rc1", "2.0.0+build5"))
+}
+
+func (suite *AIModelTestSuite) TestSelectArtifact() {
+	artifacts := []models.AIModelArtifact{
+		{URL: "rev-c", HardwareVersions: []string{"rev-c"}},
+		{URL: "new-firmware", MinFirmwareVersion: "2.1.0"},
+		{URL: "any"},
+	}
+
+	assert.Equal(suite.T(), "rev-c", services.SelectArtifact(artifacts, "REV-C", "1.0.0").URL)
+	assert.Equal(suite.T(), "new-firmware", services.SelectArtifact(artifacts, "rev-b", "2.1.3").URL)
+	assert.Equal(suite.T(), "any", services.SelectArtifact(artifacts, "rev-b", "2.0.9").URL)
+	// Unknown firmware cannot satisfy a minimum
+	assert.Equal(suite.T(), "any", services.SelectArtifact(artifacts, "rev-b", "").URL)
+	assert.Nil(suite.T(), services.SelectArtifact(artifacts[:2], "rev-b", "1.0.0"))
+}
+
+func (suite *AIModelTestSuite) TestRolloutCohortSplit() {
+	rolloutID := uuid.New()
+
+	candidates := 0
+	for i := 0; i < 2000; i++ {
+		deviceID := fmt.Sprintf("glasses-%d", i)
+		cohort := services.RolloutCohort(rolloutID, deviceID, 25)
+		assert.Equal(suite.T(), cohort, services.RolloutCohort(rolloutID, deviceID, 25), "split must be stable")
+		if cohort == models.AICohortCandidate {
+			candidates++
+			// Raising the percentage never moves candidates back to control
+			assert.Equal(suite.T(), models.AICohortCandidate, services.RolloutCohort(rolloutID, deviceID, 60))
+		}
+	}
+	assert.InDelta(suite.T(), 500, candidates, 100)
+	assert.Equal(suite.T(), models.AICohortCandidate, services.RolloutCohort(rolloutID, "glasses-1", 100))
+}
+
+func (suite *AIModelTestSuite) TestRolloutTarget() {
+	candidate, baseline := uuid.New(), uuid.New()
+	rollout := &models.AIModelRollout{
+		ID:              uuid.New(),
+		ModelID:         candidate,
+		BaselineModelID: &baseline,
+		Percentage:      100,
+		Status:          models.AIRolloutStatusActive,
+	}
+
+	target, cohort := services.RolloutTarget(rollout, "glasses-1")
+	assert.Equal(suite.T(), candidate, *target)
+	assert.Equal(suite.T(), models.AICohortCandidate, cohort)
+
+	rollout.Status = models.AIRolloutStatusRolledBack
+	target, cohort = services.RolloutTarget(rollout, "glasses-1")
+	assert.Equal(suite.T(), baseline, *target)
+	assert.Equal(suite.T(), models.AICohortControl, cohort)
+
+	// Control devices of a first rollout have nothing to run
+	rollout.Status = models.AIRolloutStatusActive
+	rollout.BaselineModelID = nil
+	rollout.Percentage = 0
+	target, cohort = services.RolloutTarget(rollout, "glasses-1")
+	assert.Nil(suite.T(), target)
+	assert.Equal(suite.T(), models.AICohortControl, cohort)
+}
+
+func (suite *AIModelTestSuite) TestEvaluateRollout() {
+	rollout := &models.AIModelRollout{
+		MinRuns:                   10,
+		MaxInferenceRegressionPct: 20,
+		MaxDetectionDropPct:       25,
+	}
+	control := services.AIModelComparison{Runs: 40, AvgInferenceMs: floatPtr(40), DetectionsPer1kFrames: floatPtr(12)}
+
+	_, regressed := services.EvaluateRollout(rollout, services.AIModelComparison{
+		Runs: 30, AvgInferenceMs: floatPtr(46), DetectionsPer1kFrames: floatPtr(10),
+	}, control)
+	assert.False(suite.T(), regressed)
+
+	reason, regressed := services.EvaluateRollout(rollout, services.AIModelComparison{
+		Runs: 30, AvgInferenceMs: floatPtr(52), DetectionsPer1kFrames: floatPtr(12),
+	}, control)
+	assert.True(suite.T(), regressed)
+	assert.Contains(suite.T(), reason, "inference")
+
+	reason, regressed = services.EvaluateRollout(rollout, services.AIModelComparison{
+		Runs: 30, AvgInferenceMs: floatPtr(38), DetectionsPer1kFrames: floatPtr(8),
+	}, control)
+	assert.True(suite.T(), regressed)
+	assert.Contains(suite.T(), reason, "detections")
+
+	// Too few runs to judge
+	_, regressed = services.EvaluateRollout(rollout, services.AIModelComparison{
+		Runs: 5, AvgInferenceMs: floatPtr(90),
+	}, control)
+	assert.False(suite.T(), regressed)
+}
+
+func (suite *AIModelTestSuite) TestRollupAIFeedback() {
+	v1, v2 := uuid.New(), uuid.New()
+	rollup := services.RollupAIFeedback([]services.AIFeedbackUsage{
+		{ModelID: v1, Name: "yolov8n", Version: "1", Type: "", Missed: 3},
+		{ModelID: v1, Name: "yolov8n", Version: "1", Type: "person", Correct: 45, FalsePositives: 5},
+		{ModelID: v1, Name: "yolov8n", Version: "1", Type: "pole", Correct: 5, FalsePositives: 5, Missed: 1},
+		{ModelID: v2, Name: "yolov8n", Version: "2", Type: "person", Correct: 1},
+	})
+
+	assert.Len(suite.T(), rollup, 2)
+
+	first := rollup[0]
+	assert.Equal(suite.T(), int64(50), first.Correct)
+	assert.Equal(suite.T(), int64(10), first.FalsePositives)
+	assert.Equal(suite.T(), int64(4), first.Missed)
+	assert.InDelta(suite.T(), 0.833, *first.Precision, 0.001)
+	assert.Less(suite.T(), *first.PrecisionLow, *first.Precision)
+	assert.Greater(suite.T(), *first.PrecisionHigh, *first.Precision)
+
+	assert.Len(suite.T(), first.Classes, 3)
+	assert.Equal(suite.T(), "unspecified", first.Classes[0].Type)
+	assert.Nil(suite.T(), first.Classes[0].Precision)
+	assert.InDelta(suite.T(), 0.9, *first.Classes[1].Precision, 0.001)
+	assert.InDelta(suite.T(), 0.5, *first.Classes[2].Precision, 0.001)
+
+	// A single label gives a wide interval
+	second := rollup[1]
+	assert.InDelta(suite.T(), 1.0, *second.Precision, 0.001)
+	assert.Less(suite.T(), *second.PrecisionLow, 0.3)
+	assert.InDelta(suite.T(), 1.0, *second.PrecisionHigh, 0.001)
+}
+
+func TestAIModelTestSuite(t *testing.T) {
+	suite.Run(t, new(AIModelTestSuite))
+}
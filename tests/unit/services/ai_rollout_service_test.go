@@ -0,0 +1,184 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type AIRolloutTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service *services.AIModelService
+}
+
+func (suite *AIRolloutTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	// Every connection to an in-memory database gets its own database
+	sqlDB, err := db.DB()
+	suite.Require().NoError(err)
+	sqlDB.SetMaxOpenConns(1)
+
+	for _, stmt := range []string{
+		`CREATE TABLE ai_models (id TEXT PRIMARY KEY, name TEXT, version TEXT, quantization TEXT,
+			first_seen_at DATETIME, last_seen_at DATETIME)`,
+		`CREATE UNIQUE INDEX idx_ai_models_identity ON ai_models (name, version, quantization)`,
+		`CREATE TABLE ai_model_artifacts (id TEXT PRIMARY KEY, model_id TEXT, url TEXT, size_bytes INTEGER,
+			sha256 TEXT, signature TEXT, hardware_versions TEXT, min_firmware_version TEXT, created_at DATETIME)`,
+		`CREATE TABLE ai_model_rollouts (id TEXT PRIMARY KEY, model_id TEXT, baseline_model_id TEXT,
+			percentage INTEGER, status TEXT, min_runs INTEGER, max_inference_regression_pct REAL,
+			max_detection_drop_pct REAL, rollback_reason TEXT, started_at DATETIME, ended_at DATETIME,
+			created_at DATETIME, updated_at DATETIME)`,
+		`CREATE UNIQUE INDEX idx_ai_model_rollouts_one_active ON ai_model_rollouts (status) WHERE status = 'active'`,
+		`CREATE TABLE ai_model_assignments (device_id TEXT PRIMARY KEY, model_id TEXT, rollout_id TEXT,
+			cohort TEXT, previous_model_id TEXT, assigned_at DATETIME)`,
+	} {
+		suite.Require().NoError(db.Exec(stmt).Error)
+	}
+
+	suite.db = db
+	suite.service = services.NewAIModelService(db)
+}
+
+func (suite *AIRolloutTestSuite) createModel(version string, hardware ...string) *models.AIModel {
+	model := &models.AIModel{Name: "obstacles", Version: version, FirstSeenAt: time.Now(), LastSeenAt: time.Now()}
+	suite.Require().NoError(suite.db.Create(model).Error)
+	suite.Require().NoError(suite.db.Create(&models.AIModelArtifact{
+		ModelID:          model.ID,
+		URL:              "https://models.example.com/" + version,
+		SizeBytes:        1024,
+		SHA256:           "00",
+		Signature:        "sig",
+		HardwareVersions: hardware,
+	}).Error)
+	return model
+}
+
+// candidateDevice finds a device the rollout puts in its candidate cohort.
+func candidateDevice(rolloutID uuid.UUID, percentage int) *models.Device {
+	for i := 0; ; i++ {
+		id := "GLASSES_" + uuid.NewString()[:8]
+		if services.RolloutCohort(rolloutID, id, percentage) == models.AICohortCandidate {
+			return &models.Device{DeviceID: id, HardwareVersion: "v2"}
+		}
+	}
+}
+
+func (suite *AIRolloutTestSuite) TestRollbackWithoutBaselineRevertsCandidates() {
+	candidate := suite.createModel("2.0")
+	rollout, err := suite.service.StartRollout(&models.AIModelRolloutRequest{ModelID: candidate.ID, Percentage: 50})
+	suite.Require().NoError(err)
+	suite.Require().Nil(rollout.BaselineModelID)
+
+	device := candidateDevice(rollout.ID, 50)
+	check, err := suite.service.CheckForDevice(device)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(check.Model)
+	assert.Equal(suite.T(), candidate.ID, check.Model.ID)
+	device.CurrentModelID = &candidate.ID
+
+	suite.Require().NoError(suite.db.Model(rollout).Update("status", models.AIRolloutStatusRolledBack).Error)
+
+	check, err = suite.service.CheckForDevice(device)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), check.UpdateAvailable)
+	assert.True(suite.T(), check.Revert)
+	assert.Nil(suite.T(), check.Model)
+
+	// Devices that never took the candidate are left alone
+	check, err = suite.service.CheckForDevice(&models.Device{DeviceID: "GLASSES_OTHER", HardwareVersion: "v2"})
+	suite.Require().NoError(err)
+	assert.False(suite.T(), check.UpdateAvailable)
+	assert.False(suite.T(), check.Revert)
+}
+
+func (suite *AIRolloutTestSuite) TestRollbackWithoutBaselineBuildReturnsToPreviousModel() {
+	previous := suite.createModel("1.0")
+	baseline := suite.createModel("1.5", "v1")
+	candidate := suite.createModel("2.0")
+	rollout, err := suite.service.StartRollout(&models.AIModelRolloutRequest{
+		ModelID: candidate.ID, BaselineModelID: &baseline.ID, Percentage: 50,
+	})
+	suite.Require().NoError(err)
+
+	device := candidateDevice(rollout.ID, 50)
+	device.CurrentModelID = &previous.ID
+	check, err := suite.service.CheckForDevice(device)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), candidate.ID, check.Model.ID)
+	device.CurrentModelID = &candidate.ID
+
+	suite.Require().NoError(suite.db.Model(rollout).Update("status", models.AIRolloutStatusRolledBack).Error)
+
+	// The baseline has no build for v2 hardware
+	check, err = suite.service.CheckForDevice(device)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(check.Model)
+	assert.Equal(suite.T(), previous.ID, check.Model.ID)
+	assert.True(suite.T(), check.UpdateAvailable)
+	assert.False(suite.T(), check.Revert)
+	assert.Equal(suite.T(), models.AICohortControl, check.Cohort)
+}
+
+func (suite *AIRolloutTestSuite) TestUpdateAfterAutomaticRollback() {
+	candidate := suite.createModel("2.0")
+	rollout, err := suite.service.StartRollout(&models.AIModelRolloutRequest{ModelID: candidate.ID, Percentage: 10})
+	suite.Require().NoError(err)
+
+	_, err = suite.service.StartRollout(&models.AIModelRolloutRequest{ModelID: candidate.ID, Percentage: 10})
+	assert.ErrorIs(suite.T(), err, services.ErrRolloutActive)
+
+	updated, err := suite.service.UpdateRollout(rollout.ID, &models.AIModelRolloutUpdateRequest{Percentage: intPtr(25)})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), 25, updated.Percentage)
+
+	suite.Require().NoError(suite.db.Model(rollout).Updates(map[string]interface{}{
+		"status":          models.AIRolloutStatusRolledBack,
+		"rollback_reason": "detections dropped",
+	}).Error)
+
+	// Completing it now must not overwrite the rollback
+	_, err = suite.service.UpdateRollout(rollout.ID, &models.AIModelRolloutUpdateRequest{Status: models.AIRolloutStatusCompleted})
+	assert.ErrorIs(suite.T(), err, services.ErrRolloutEnded)
+	var stored models.AIModelRollout
+	suite.Require().NoError(suite.db.First(&stored, "id = ?", rollout.ID).Error)
+	assert.Equal(suite.T(), models.AIRolloutStatusRolledBack, stored.Status)
+	assert.Equal(suite.T(), "detections dropped", stored.RollbackReason)
+
+	_, err = suite.service.UpdateRollout(uuid.New(), &models.AIModelRolloutUpdateRequest{Percentage: intPtr(25)})
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (suite *AIRolloutTestSuite) TestResolveRefreshesLastSeenHourly() {
+	recent := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	model := &models.AIModel{Name: "obstacles", Version: "1.0", FirstSeenAt: recent, LastSeenAt: recent}
+	suite.Require().NoError(suite.db.Create(model).Error)
+
+	resolved, err := suite.service.Resolve(suite.db, &models.AIModelInfo{Name: "obstacles", Version: "1.0"})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), model.ID, resolved.ID)
+	var stored models.AIModel
+	suite.Require().NoError(suite.db.First(&stored, "id = ?", model.ID).Error)
+	assert.True(suite.T(), recent.Equal(stored.LastSeenAt), "seen within the hour is left alone")
+
+	earlier := time.Now().Add(-2 * time.Hour)
+	suite.Require().NoError(suite.db.Model(model).Update("last_seen_at", earlier).Error)
+	_, err = suite.service.Resolve(suite.db, &models.AIModelInfo{Name: "obstacles", Version: "1.0"})
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.db.First(&stored, "id = ?", model.ID).Error)
+	assert.True(suite.T(), stored.LastSeenAt.After(time.Now().Add(-time.Minute)))
+}
+
+func TestAIRolloutTestSuite(t *testing.T) {
+	suite.Run(t, new(AIRolloutTestSuite))
+}
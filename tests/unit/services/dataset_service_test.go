@@ -0,0 +1,103 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type DatasetTestSuite struct {
+	suite.Suite
+}
+
+func datasetRow(lat, lng float64) services.DatasetRow {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	homeLat, homeLng := -6.2, 106.8
+	return services.DatasetRow{
+		FeedbackID:        uuid.New(),
+		RunID:             uuid.New(),
+		Label:             models.AIFeedbackFalsePositive,
+		Source:            models.AIFeedbackSourceApp,
+		Type:              "pole",
+		Timestamp:         start.Add(90 * time.Second),
+		Latitude:          &lat,
+		Longitude:         &lng,
+		Confidence:        floatPtr(0.8),
+		ModelName:         "yolov8n",
+		ModelVersion:      "1.2.0",
+		ModelQuantization: "int8",
+		RunStartedAt:      start,
+		StartLatitude:     &homeLat,
+		StartLongitude:    &homeLng,
+		EndLatitude:       &homeLat,
+		EndLongitude:      &homeLng,
+	}
+}
+
+func (suite *DatasetTestSuite) TestSampleIsPseudonymized() {
+	salt := []byte("export-key")
+	row := datasetRow(offsetMeters(-6.2, 106.8, 2000, 0))
+	other := row
+	other.FeedbackID = uuid.New()
+
+	sample := services.BuildDatasetSample(row, salt)
+
+	assert.Len(suite.T(), sample.ID, 16)
+	assert.NotContains(suite.T(), sample.ID, row.FeedbackID.String()[:8])
+	assert.Equal(suite.T(), sample.Group, services.BuildDatasetSample(other, salt).Group, "same run, same group")
+	assert.NotEqual(suite.T(), sample.Group, services.BuildDatasetSample(row, []byte("other-key")).Group)
+	assert.Equal(suite.T(), 90.0, sample.OffsetSeconds)
+	assert.Equal(suite.T(), "yolov8n", sample.Model.Name)
+	assert.Equal(suite.T(), "pole", sample.Type)
+	assert.Equal(suite.T(), 0.8, *sample.Confidence)
+
+	// Far from home, coarsened to about 100 m
+	assert.InDelta(suite.T(), -6.182, *sample.Latitude, 1e-9)
+	assert.InDelta(suite.T(), 106.8, *sample.Longitude, 1e-9)
+}
+
+func (suite *DatasetTestSuite) TestPositionsNearHomeDropped() {
+	sample := services.BuildDatasetSample(datasetRow(offsetMeters(-6.2, 106.8, 300, 200)), []byte("k"))
+	assert.Nil(suite.T(), sample.Latitude)
+	assert.Nil(suite.T(), sample.Longitude)
+
+	// Unknown run ends give no way to tell
+	row := datasetRow(offsetMeters(-6.2, 106.8, 5000, 0))
+	row.EndLatitude, row.EndLongitude = nil, nil
+	sample = services.BuildDatasetSample(row, []byte("k"))
+	assert.Nil(suite.T(), sample.Latitude)
+}
+
+func (suite *DatasetTestSuite) TestFrameNamedAfterSample() {
+	row := datasetRow(offsetMeters(-6.2, 106.8, 2000, 0))
+	assert.Empty(suite.T(), services.BuildDatasetSample(row, []byte("k")).Frame)
+
+	row.FrameSHA256 = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	row.FrameContentType = "image/jpeg"
+	sample := services.BuildDatasetSample(row, []byte("k"))
+	assert.Equal(suite.T(), "frames/"+sample.ID+".jpg", sample.Frame)
+	assert.NotEqual(suite.T(), sample.Frame, services.BuildDatasetSample(row, []byte("other")).Frame)
+}
+
+func (suite *DatasetTestSuite) TestFrameDroppedWithPosition() {
+	row := datasetRow(offsetMeters(-6.2, 106.8, 300, 200))
+	row.FrameSHA256 = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	row.FrameContentType = "image/jpeg"
+	assert.Empty(suite.T(), services.BuildDatasetSample(row, []byte("k")).Frame)
+
+	row = datasetRow(offsetMeters(-6.2, 106.8, 5000, 0))
+	row.FrameSHA256 = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	row.FrameContentType = "image/jpeg"
+	row.Latitude, row.Longitude = nil, nil
+	assert.Empty(suite.T(), services.BuildDatasetSample(row, []byte("k")).Frame)
+}
+
+func TestDatasetTestSuite(t *testing.T) {
+	suite.Run(t, new(DatasetTestSuite))
+}
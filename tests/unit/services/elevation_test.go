@@ -0,0 +1,239 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type ElevationTestSuite struct {
+	suite.Suite
+}
+
+func withAltitudes(points []models.WaypointData, altitude func(i int) float64) []models.WaypointData {
+	for i := range points {
+		alt := altitude(i)
+		points[i].Altitude = &alt
+	}
+	return points
+}
+
+func (suite *ElevationTestSuite) TestGainAndLossIgnoreNoise() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	// Climb 50 m, descend 20 m, with ±1 m jitter on every fix
+	points := withAltitudes(straightTrack(start, 140, 3.0), func(i int) float64 {
+		jitter := float64(i%2)*2 - 1
+		if i <= 100 {
+			return 100 + float64(i)*0.5 + jitter
+		}
+		return 150 - float64(i-100)*0.5 + jitter
+	})
+
+	stats := services.ComputeElevation(points)
+	assert.NotNil(suite.T(), stats)
+	assert.InDelta(suite.T(), 50, stats.GainMeters, 4)
+	assert.InDelta(suite.T(), 20, stats.LossMeters, 4)
+	assert.InDelta(suite.T(), 99, stats.MinMeters, 0.01)
+	assert.InDelta(suite.T(), 151, stats.MaxMeters, 1.01)
+}
+
+func (suite *ElevationTestSuite) TestNoAltitudes() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	assert.Nil(suite.T(), services.ComputeElevation(straightTrack(start, 60, 3.0)))
+
+	profile, _ := services.ElevationProfile(straightTrack(start, 60, 3.0), 25)
+	assert.Empty(suite.T(), profile)
+}
+
+func (suite *ElevationTestSuite) TestProfileAndSplitGrade() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	// 3 m/s for 400 s is 1200 m at a steady 5% grade
+	points := withAltitudes(straightTrack(start, 400, 3.0), func(i int) float64 {
+		return 10 + float64(i)*3.0*0.05
+	})
+
+	profile, resolution := services.ElevationProfile(points, 100)
+	assert.Equal(suite.T(), 100.0, resolution)
+	assert.Len(suite.T(), profile, 13)
+	assert.InDelta(suite.T(), 10, profile[0].ElevationMeters, 0.1)
+	assert.InDelta(suite.T(), 15, profile[1].ElevationMeters, 0.2)
+	assert.InDelta(suite.T(), 5, *profile[5].GradePercent, 0.2)
+
+	km := splitsOfKind(services.ComputeSplits(points, nil), models.SplitKindKilometer)
+	assert.NotEmpty(suite.T(), km)
+	assert.InDelta(suite.T(), 5, *km[0].AvgGradePercent, 0.2)
+	assert.InDelta(suite.T(), 50, *km[0].ElevationGainMeters, 3)
+}
+
+func (suite *ElevationTestSuite) TestSRTMTileLookup() {
+	dir := suite.T().TempDir()
+
+	// Heights rise by one meter per column going east
+	const size = 1201
+	data := make([]byte, size*size*2)
+	for row := 0; row < size; row++ {
+		for col := 0; col < size; col++ {
+			binary.BigEndian.PutUint16(data[(row*size+col)*2:], uint16(int16(col)))
+		}
+	}
+	assert.NoError(suite.T(), os.WriteFile(filepath.Join(dir, "S07E106.hgt"), data, 0o644))
+
+	dem, err := services.LoadDEM(dir)
+	assert.NoError(suite.T(), err)
+
+	v, ok := dem.Elevation(-6.5, 106.5)
+	assert.True(suite.T(), ok)
+	assert.InDelta(suite.T(), 600, v, 0.01)
+
+	_, ok = dem.Elevation(10, 10)
+	assert.False(suite.T(), ok)
+}
+
+func (suite *ElevationTestSuite) TestConcurrentLookups() {
+	dir := suite.T().TempDir()
+	const size = 1201
+	data := make([]byte, size*size*2)
+	for row := 0; row < size; row++ {
+		for col := 0; col < size; col++ {
+			binary.BigEndian.PutUint16(data[(row*size+col)*2:], uint16(int16(col)))
+		}
+	}
+	assert.NoError(suite.T(), os.WriteFile(filepath.Join(dir, "S07E106.hgt"), data, 0o644))
+
+	dem, err := services.LoadDEM(dir)
+	suite.Require().NoError(err)
+
+	var wg sync.WaitGroup
+	results := make([]float64, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				v, ok := dem.Elevation(-6.5, 106.5)
+				if !ok {
+					return
+				}
+				results[i] = v
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, v := range results {
+		assert.InDelta(suite.T(), 600, v, 0.01)
+	}
+}
+
+func (suite *ElevationTestSuite) TestGeoTIFFLookupAndCorrection() {
+	dir := suite.T().TempDir()
+	// 10x10 float32 grid over lat -6.0..-6.1, lng 106.8..106.9, heights = 100 + row
+	assert.NoError(suite.T(), os.WriteFile(filepath.Join(dir, "area.tif"), buildGeoTIFF(10, 10, 106.8, -6.0, 0.01), 0o644))
+
+	dem, err := services.LoadDEM(dir)
+	assert.NoError(suite.T(), err)
+
+	v, ok := dem.Elevation(-6.025, 106.845)
+	assert.True(suite.T(), ok)
+	assert.InDelta(suite.T(), 102, v, 0.01)
+
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	points := straightTrack(start, 30, 3.0)
+	for i := range points {
+		points[i].Latitude = -6.05 + float64(i)*0.0001
+		points[i].Longitude = 106.85
+	}
+	corrected, ok := dem.CorrectAltitudes(points)
+	assert.True(suite.T(), ok)
+	assert.NotNil(suite.T(), corrected[0].Altitude)
+	assert.Nil(suite.T(), points[0].Altitude)
+
+	outside := straightTrack(start, 30, 3.0)
+	_, ok = dem.CorrectAltitudes(outside)
+	assert.False(suite.T(), ok)
+}
+
+// buildGeoTIFF writes a little-endian, uncompressed, single-strip float32
+// GeoTIFF whose pixel (col, row) holds 100 + row.
+func buildGeoTIFF(width, height int, west, north, step float64) []byte {
+	pixels := new(bytes.Buffer)
+	for row := 0; row < height; row++ {
+		for col := 0; col < width; col++ {
+			binary.Write(pixels, binary.LittleEndian, math.Float32bits(float32(100+row)))
+		}
+	}
+
+	type entry struct {
+		tag, typ uint16
+		count    uint32
+		value    []byte
+	}
+	u16 := func(v uint16) []byte { b := make([]byte, 2); binary.LittleEndian.PutUint16(b, v); return b }
+	u32 := func(v uint32) []byte { b := make([]byte, 4); binary.LittleEndian.PutUint32(b, v); return b }
+	doubles := func(vs ...float64) []byte {
+		b := new(bytes.Buffer)
+		for _, v := range vs {
+			binary.Write(b, binary.LittleEndian, v)
+		}
+		return b.Bytes()
+	}
+
+	entries := []entry{
+		{256, 3, 1, u16(uint16(width))},
+		{257, 3, 1, u16(uint16(height))},
+		{258, 3, 1, u16(32)},
+		{259, 3, 1, u16(1)},
+		{273, 4, 1, nil}, // patched below
+		{277, 3, 1, u16(1)},
+		{278, 3, 1, u16(uint16(height))},
+		{279, 4, 1, u32(uint32(pixels.Len()))},
+		{339, 3, 1, u16(3)},
+		{33550, 12, 3, doubles(step, step, 0)},
+		{33922, 12, 6, doubles(0, 0, 0, west, north, 0)},
+	}
+
+	ifdOffset := 8
+	extraOffset := ifdOffset + 2 + len(entries)*12 + 4
+	extra := new(bytes.Buffer)
+	for i := range entries {
+		if len(entries[i].value) > 4 {
+			offset := extraOffset + extra.Len()
+			extra.Write(entries[i].value)
+			entries[i].value = u32(uint32(offset))
+		}
+	}
+	pixelOffset := extraOffset + extra.Len()
+	entries[4].value = u32(uint32(pixelOffset))
+
+	out := new(bytes.Buffer)
+	out.WriteString("II")
+	out.Write(u16(42))
+	out.Write(u32(uint32(ifdOffset)))
+	out.Write(u16(uint16(len(entries))))
+	for _, e := range entries {
+		out.Write(u16(e.tag))
+		out.Write(u16(e.typ))
+		out.Write(u32(e.count))
+		value := make([]byte, 4)
+		copy(value, e.value)
+		out.Write(value)
+	}
+	out.Write(u32(0))
+	out.Write(extra.Bytes())
+	out.Write(pixels.Bytes())
+	return out.Bytes()
+}
+
+func TestElevationTestSuite(t *testing.T) {
+	suite.Run(t, new(ElevationTestSuite))
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type GoalServiceTestSuite struct {
+	suite.Suite
+}
+
+func (suite *GoalServiceTestSuite) TestWeeklyStreaks() {
+	current := time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC)
+	completed := []string{"2025-01-27", "2025-02-03", "2025-02-10", "2025-03-03", "2025-03-10"}
+
+	// The week in progress is not done yet, so the streak runs to last week
+	streak, best := services.GoalStreaks(completed, current, models.GoalPeriodWeek)
+	assert.Equal(suite.T(), 2, streak)
+	assert.Equal(suite.T(), 3, best)
+
+	streak, best = services.GoalStreaks(append(completed, "2025-03-17"), current, models.GoalPeriodWeek)
+	assert.Equal(suite.T(), 3, streak)
+	assert.Equal(suite.T(), 3, best)
+
+	streak, _ = services.GoalStreaks(completed, current.AddDate(0, 0, 14), models.GoalPeriodWeek)
+	assert.Equal(suite.T(), 0, streak)
+}
+
+func (suite *GoalServiceTestSuite) TestMonthlyStreaks() {
+	current := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	streak, best := services.GoalStreaks([]string{"2024-12-01", "2025-01-01", "2025-02-01"}, current, models.GoalPeriodMonth)
+	assert.Equal(suite.T(), 3, streak)
+	assert.Equal(suite.T(), 3, best)
+}
+
+func (suite *GoalServiceTestSuite) TestValidateGoal() {
+	assert.NoError(suite.T(), services.ValidateGoal(&models.GoalCreateRequest{Type: models.GoalTypeDistance, Period: models.GoalPeriodWeek, Target: 20000}))
+	assert.NoError(suite.T(), services.ValidateGoal(&models.GoalCreateRequest{Type: models.GoalTypeRaceTime, RaceCategory: models.RecordCategory10K, Target: 3000}))
+
+	assert.Error(suite.T(), services.ValidateGoal(&models.GoalCreateRequest{Type: models.GoalTypeRuns, Target: 3}))
+	assert.Error(suite.T(), services.ValidateGoal(&models.GoalCreateRequest{Type: models.GoalTypeRaceTime, Target: 3000}))
+	assert.Error(suite.T(), services.ValidateGoal(&models.GoalCreateRequest{Type: models.GoalTypeRaceTime, Period: models.GoalPeriodWeek, RaceCategory: models.RecordCategory5K, Target: 1500}))
+}
+
+func TestGoalServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(GoalServiceTestSuite))
+}
+
+type GoalEvaluationTestSuite struct {
+	suite.Suite
+	db     *gorm.DB
+	userID uuid.UUID
+}
+
+func (suite *GoalEvaluationTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	// Every connection to an in-memory database gets its own database
+	sqlDB, err := db.DB()
+	suite.Require().NoError(err)
+	sqlDB.SetMaxOpenConns(1)
+
+	for _, stmt := range []string{
+		`CREATE TABLE users (id TEXT PRIMARY KEY, timezone TEXT, week_start TEXT)`,
+		`CREATE TABLE goals (id TEXT PRIMARY KEY, user_id TEXT, type TEXT, period TEXT, target REAL,
+			race_category TEXT, target_date DATETIME, title TEXT, active BOOLEAN, completed_at DATETIME,
+			created_at DATETIME, updated_at DATETIME)`,
+		`CREATE TABLE goal_events (id TEXT PRIMARY KEY, goal_id TEXT, user_id TEXT, type TEXT, period_start TEXT,
+			run_id TEXT, value REAL, streak INTEGER, notified_at DATETIME, created_at DATETIME)`,
+		`CREATE TABLE runs (id TEXT PRIMARY KEY, user_id TEXT, started_at DATETIME, distance_meters REAL,
+			duration_seconds INTEGER)`,
+		`CREATE TABLE personal_records (id TEXT PRIMARY KEY, user_id TEXT, category TEXT, run_id TEXT,
+			distance_meters REAL, duration_seconds REAL, pace_seconds_per_km REAL, start_seq INTEGER,
+			end_seq INTEGER, achieved_at DATETIME, created_at DATETIME)`,
+	} {
+		suite.Require().NoError(db.Exec(stmt).Error)
+	}
+	suite.db = db
+
+	suite.userID = uuid.New()
+	suite.Require().NoError(db.Exec(`INSERT INTO users (id, timezone, week_start) VALUES (?, 'UTC', 'monday')`, suite.userID).Error)
+}
+
+func (suite *GoalEvaluationTestSuite) TestRaceGoalCreditsRecordRun() {
+	recordRun := uuid.New()
+	suite.Require().NoError(suite.db.Create(&models.PersonalRecord{
+		UserID:          suite.userID,
+		Category:        models.RecordCategory5K,
+		RunID:           recordRun,
+		DistanceMeters:  5000,
+		DurationSeconds: 1450,
+		AchievedAt:      time.Date(2025, 3, 2, 7, 0, 0, 0, time.UTC),
+	}).Error)
+
+	// The goal is met on creation, when no run is being evaluated
+	progress, err := services.NewGoalService(suite.db).Create(suite.userID, &models.GoalCreateRequest{
+		Type:         models.GoalTypeRaceTime,
+		RaceCategory: models.RecordCategory5K,
+		Target:       1500,
+	})
+	suite.Require().NoError(err)
+	assert.True(suite.T(), progress.Completed)
+
+	var events []models.GoalEvent
+	suite.Require().NoError(suite.db.Find(&events).Error)
+	suite.Require().Len(events, 1)
+	suite.Require().NotNil(events[0].RunID)
+	assert.Equal(suite.T(), recordRun, *events[0].RunID)
+	assert.Equal(suite.T(), 1450.0, events[0].Value)
+}
+
+func (suite *GoalEvaluationTestSuite) addRun(startedAt time.Time, distance float64) *models.Run {
+	run := &models.Run{ID: uuid.New(), UserID: suite.userID, StartedAt: startedAt}
+	suite.Require().NoError(suite.db.Exec(`INSERT INTO runs (id, user_id, started_at, distance_meters) VALUES (?, ?, ?, ?)`,
+		run.ID, run.UserID, run.StartedAt, distance).Error)
+	return run
+}
+
+func (suite *GoalEvaluationTestSuite) TestRevokeRunReopensPeriod() {
+	goals := services.NewGoalService(suite.db)
+	_, err := goals.Create(suite.userID, &models.GoalCreateRequest{Type: models.GoalTypeDistance, Period: models.GoalPeriodWeek, Target: 10000})
+	suite.Require().NoError(err)
+
+	// Two weeks in a row reach the target
+	first := suite.addRun(time.Date(2025, 3, 3, 7, 0, 0, 0, time.UTC), 6000)
+	second := suite.addRun(time.Date(2025, 3, 5, 7, 0, 0, 0, time.UTC), 5000)
+	third := suite.addRun(time.Date(2025, 3, 11, 7, 0, 0, 0, time.UTC), 10000)
+	for _, run := range []*models.Run{first, second, third} {
+		_, err := goals.Evaluate(suite.db, run)
+		suite.Require().NoError(err)
+	}
+
+	var events []models.GoalEvent
+	suite.Require().NoError(suite.db.Order("period_start ASC").Find(&events).Error)
+	suite.Require().Len(events, 2)
+	assert.Equal(suite.T(), 2, events[1].Streak)
+
+	suite.Require().NoError(suite.db.Exec(`DELETE FROM runs WHERE id = ?`, second.ID).Error)
+	suite.Require().NoError(goals.RevokeRun(suite.db, second))
+
+	events = nil
+	suite.Require().NoError(suite.db.Order("period_start ASC").Find(&events).Error)
+	suite.Require().Len(events, 1)
+	assert.Equal(suite.T(), "2025-03-10", events[0].PeriodStart)
+	assert.Equal(suite.T(), 1, events[0].Streak)
+}
+
+func (suite *GoalEvaluationTestSuite) TestRevokeRunKeepsPeriodStillMet() {
+	goals := services.NewGoalService(suite.db)
+	_, err := goals.Create(suite.userID, &models.GoalCreateRequest{Type: models.GoalTypeRuns, Period: models.GoalPeriodWeek, Target: 1})
+	suite.Require().NoError(err)
+
+	first := suite.addRun(time.Date(2025, 3, 3, 7, 0, 0, 0, time.UTC), 5000)
+	_, err = goals.Evaluate(suite.db, first)
+	suite.Require().NoError(err)
+	suite.addRun(time.Date(2025, 3, 4, 7, 0, 0, 0, time.UTC), 5000)
+
+	suite.Require().NoError(suite.db.Exec(`DELETE FROM runs WHERE id = ?`, first.ID).Error)
+	suite.Require().NoError(goals.RevokeRun(suite.db, first))
+
+	var events []models.GoalEvent
+	suite.Require().NoError(suite.db.Find(&events).Error)
+	suite.Require().Len(events, 1)
+	assert.Nil(suite.T(), events[0].RunID, "events no longer point at the deleted run")
+}
+
+func (suite *GoalEvaluationTestSuite) TestRevokeRunReopensRaceGoal() {
+	run := suite.addRun(time.Date(2025, 3, 2, 7, 0, 0, 0, time.UTC), 5000)
+	suite.Require().NoError(suite.db.Create(&models.PersonalRecord{
+		UserID:          suite.userID,
+		Category:        models.RecordCategory5K,
+		RunID:           run.ID,
+		DistanceMeters:  5000,
+		DurationSeconds: 1450,
+		AchievedAt:      run.StartedAt,
+	}).Error)
+
+	goals := services.NewGoalService(suite.db)
+	_, err := goals.Create(suite.userID, &models.GoalCreateRequest{Type: models.GoalTypeRaceTime, RaceCategory: models.RecordCategory5K, Target: 1500})
+	suite.Require().NoError(err)
+
+	// Recalculating records without the run leaves a slower one
+	slower := suite.addRun(time.Date(2025, 2, 2, 7, 0, 0, 0, time.UTC), 5000)
+	suite.Require().NoError(suite.db.Exec(`DELETE FROM runs WHERE id = ?`, run.ID).Error)
+	suite.Require().NoError(suite.db.Exec(`UPDATE personal_records SET run_id = ?, duration_seconds = ?`, slower.ID, 1600.0).Error)
+	suite.Require().NoError(goals.RevokeRun(suite.db, run))
+
+	var goal models.Goal
+	suite.Require().NoError(suite.db.First(&goal).Error)
+	assert.Nil(suite.T(), goal.CompletedAt)
+	var count int64
+	suite.Require().NoError(suite.db.Model(&models.GoalEvent{}).Count(&count).Error)
+	assert.Zero(suite.T(), count)
+}
+
+func TestGoalEvaluationTestSuite(t *testing.T) {
+	suite.Run(t, new(GoalEvaluationTestSuite))
+}
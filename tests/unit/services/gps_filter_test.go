@@ -0,0 +1,138 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type GPSFilterTestSuite struct {
+	suite.Suite
+	filter *services.GPSFilter
+	start  time.Time
+}
+
+func (suite *GPSFilterTestSuite) SetupTest() {
+	suite.filter = services.NewGPSFilter(services.DefaultGPSFilterConfig)
+	suite.start = time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+}
+
+func (suite *GPSFilterTestSuite) TestRejectsTeleport() {
+	points := straightTrack(suite.start, 10, 3.0)
+	points[5].Latitude += 500 / 111195.0
+
+	cleaned := suite.filter.RejectOutliers(points)
+	assert.Len(suite.T(), cleaned, len(points)-1)
+	for _, p := range cleaned {
+		assert.NotEqual(suite.T(), points[5].Timestamp, p.Timestamp)
+	}
+}
+
+func (suite *GPSFilterTestSuite) TestRejectsSpikedFirstFix() {
+	points := straightTrack(suite.start, 600, 3.0)
+	points[0].Latitude += 500 / 111195.0
+
+	cleaned := suite.filter.RejectOutliers(points)
+	assert.Len(suite.T(), cleaned, len(points)-1)
+	assert.Equal(suite.T(), points[1].Timestamp, cleaned[0].Timestamp)
+}
+
+func (suite *GPSFilterTestSuite) TestReanchorsAfterBadStart() {
+	// The first two fixes agree with each other but both sit 500 m off
+	points := straightTrack(suite.start, 600, 3.0)
+	points[0].Latitude += 500 / 111195.0
+	points[1].Latitude += 500 / 111195.0
+
+	cleaned := suite.filter.RejectOutliers(points)
+	reanchor := services.DefaultGPSFilterConfig.ReanchorAfter
+	assert.Len(suite.T(), cleaned, len(points))
+	assert.Equal(suite.T(), points[2].Timestamp, cleaned[2].Timestamp,
+		"the good fixes are kept once %d in a row agree", reanchor)
+}
+
+func (suite *GPSFilterTestSuite) TestReanchorDropsAcceptedBadFix() {
+	// After a 12 s gap the next fix lands 80 m off the route. It is close
+	// enough to be reachable, but the fixes after it are not, until enough
+	// of them agree to re-anchor the track
+	track := straightTrack(suite.start, 60, 3.0)
+	bad := track[20]
+	bad.Longitude += 80 / 111195.0
+	points := append(append(track[:9:9], bad), track[21:]...)
+
+	cleaned := suite.filter.RejectOutliers(points)
+	assert.Len(suite.T(), cleaned, len(points)-1)
+	for _, p := range cleaned {
+		assert.NotEqual(suite.T(), bad.Longitude, p.Longitude)
+	}
+}
+
+func (suite *GPSFilterTestSuite) TestRejectsInaccurateFixes() {
+	points := straightTrack(suite.start, 5, 3.0)
+	poor := 120.0
+	points[2].Accuracy = &poor
+
+	assert.Len(suite.T(), suite.filter.RejectOutliers(points), len(points)-1)
+}
+
+func (suite *GPSFilterTestSuite) TestCollapsesStationaryCluster() {
+	points := straightTrack(suite.start, 10, 3.0)
+	stop := points[len(points)-1]
+	for i := 1; i <= 60; i++ {
+		jitter := stop
+		jitter.Timestamp = stop.Timestamp.Add(time.Duration(i) * time.Second)
+		if i%2 == 0 {
+			jitter.Latitude += 2 / 111195.0
+		}
+		points = append(points, jitter)
+	}
+
+	collapsed := suite.filter.CollapseStationary(points)
+	assert.Less(suite.T(), len(collapsed), 20)
+	assert.Equal(suite.T(), points[len(points)-1].Timestamp, collapsed[len(collapsed)-1].Timestamp,
+		"the stop keeps its end time so moving time stays correct")
+}
+
+func (suite *GPSFilterTestSuite) TestSmoothingReducesJitter() {
+	points := straightTrack(suite.start, 60, 3.0)
+	for i := range points {
+		if i%2 == 1 {
+			points[i].Longitude += 8 / 111195.0
+		}
+	}
+
+	raw := services.AnalyzeTrack(points)
+	smoothed := services.AnalyzeTrack(suite.filter.Smooth(points))
+	assert.Less(suite.T(), smoothed.DistanceMeters, raw.DistanceMeters)
+}
+
+func (suite *GPSFilterTestSuite) TestSimplifyStraightLine() {
+	points := straightTrack(suite.start, 100, 3.0)
+	simplified := services.SimplifyTrack(points, 1)
+
+	assert.Len(suite.T(), simplified, 2)
+	assert.Equal(suite.T(), points[0].Timestamp, simplified[0].Timestamp)
+	assert.Equal(suite.T(), points[100].Timestamp, simplified[1].Timestamp)
+}
+
+func (suite *GPSFilterTestSuite) TestSimplifyKeepsCorner() {
+	points := straightTrack(suite.start, 50, 3.0)
+	corner := points[len(points)-1]
+	for i := 1; i <= 50; i++ {
+		p := corner
+		p.Longitude += float64(i) * 3 / 111195.0
+		p.Timestamp = corner.Timestamp.Add(time.Duration(i) * time.Second)
+		points = append(points, p)
+	}
+
+	simplified := services.SimplifyTrack(points, 1)
+	assert.Len(suite.T(), simplified, 3)
+	assert.Equal(suite.T(), corner.Timestamp, simplified[1].Timestamp)
+}
+
+func TestGPSFilterTestSuite(t *testing.T) {
+	suite.Run(t, new(GPSFilterTestSuite))
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type HazardServiceTestSuite struct {
+	suite.Suite
+}
+
+// offsetMeters moves a coordinate north and east by the given meters.
+func offsetMeters(lat, lng, north, east float64) (float64, float64) {
+	return lat + north/111195.0, lng + east/(111195.0*0.99415)
+}
+
+func (suite *HazardServiceTestSuite) TestClusterHazards() {
+	start := time.Date(2025, 3, 1, 6, 0, 0, 0, time.UTC)
+	user := uuid.New()
+	var points []services.HazardPoint
+
+	// The same lamppost on three mornings, a few meters apart each time
+	for day := 0; day < 3; day++ {
+		lat, lng := offsetMeters(-6.2, 106.8, float64(day)*3, float64(day))
+		points = append(points, services.HazardPoint{
+			RunID: uuid.New(), UserID: user, Type: "pole", Confidence: 0.9, WarningSpoken: day > 0,
+			Timestamp: start.AddDate(0, 0, day), Latitude: lat, Longitude: lng,
+		})
+	}
+	// A cyclist 200 m away, once
+	lat, lng := offsetMeters(-6.2, 106.8, 200, 0)
+	points = append(points, services.HazardPoint{
+		RunID: uuid.New(), UserID: user, Type: "bicycle", Confidence: 0.6,
+		Timestamp: start, Latitude: lat, Longitude: lng,
+	})
+
+	clusters := services.ClusterHazards(points, 25)
+	assert.Len(suite.T(), clusters, 2)
+
+	var pole services.HazardCluster
+	for _, c := range clusters {
+		if c.Type == "pole" {
+			pole = c
+		}
+	}
+	assert.Equal(suite.T(), 3, pole.Detections)
+	assert.Equal(suite.T(), 3, pole.Runs)
+	assert.Equal(suite.T(), 1, pole.Users)
+	assert.Equal(suite.T(), 2, pole.Warnings)
+	assert.Equal(suite.T(), 0.9, pole.AvgConfidence)
+	assert.Equal(suite.T(), start, pole.FirstSeen)
+	assert.Equal(suite.T(), start.AddDate(0, 0, 2), pole.LastSeen)
+	centreLat, _ := offsetMeters(-6.2, 106.8, 3, 1)
+	assert.InDelta(suite.T(), centreLat, pole.Latitude, 1e-6)
+	assert.Less(suite.T(), pole.RadiusMeters, 5.0)
+}
+
+func (suite *HazardServiceTestSuite) TestClusterHazardsDoesNotChain() {
+	start := time.Date(2025, 3, 1, 6, 0, 0, 0, time.UTC)
+	var points []services.HazardPoint
+
+	// Poles every 20 m along a 400 m street stay separate hotspots instead
+	// of merging into one
+	for i := 0; i <= 20; i++ {
+		lat, lng := offsetMeters(-6.2, 106.8, float64(i)*20, 0)
+		points = append(points, services.HazardPoint{
+			RunID: uuid.New(), UserID: uuid.New(), Type: "pole", Confidence: 0.8,
+			Timestamp: start.Add(time.Duration(i) * time.Second), Latitude: lat, Longitude: lng,
+		})
+	}
+
+	clusters := services.ClusterHazards(points, 25)
+	assert.Greater(suite.T(), len(clusters), 5)
+	for _, c := range clusters {
+		assert.LessOrEqual(suite.T(), c.RadiusMeters, 25.0)
+	}
+
+	assert.Empty(suite.T(), services.ClusterHazards(nil, 25))
+}
+
+func (suite *HazardServiceTestSuite) TestHazardsGeoJSON() {
+	hotspot := services.HazardCluster{
+		Latitude: -6.2, Longitude: 106.8, Type: "pole", Types: map[string]int{"pole": 3},
+		Detections: 3, Runs: 3, Users: 3, FirstSeen: time.Now(), LastSeen: time.Now(),
+	}
+
+	doc := services.HazardsGeoJSON(services.HazardScopeShared, []services.HazardCluster{hotspot})
+	assert.Equal(suite.T(), "FeatureCollection", doc["type"])
+	features := doc["features"].([]interface{})
+	assert.Len(suite.T(), features, 1)
+
+	feature := features[0].(map[string]interface{})
+	geometry := feature["geometry"].(map[string]interface{})
+	assert.Equal(suite.T(), []float64{106.8, -6.2}, geometry["coordinates"])
+	properties := feature["properties"].(map[string]interface{})
+	assert.Equal(suite.T(), 3, properties["users"])
+	assert.NotContains(suite.T(), properties, "first_seen")
+}
+
+func (suite *HazardServiceTestSuite) TestParseBBox() {
+	box, err := services.ParseBBox("106.7,-6.3,106.9,-6.1")
+	assert.NoError(suite.T(), err)
+	assert.True(suite.T(), box.Contains(-6.2, 106.8))
+	assert.False(suite.T(), box.Contains(-6.0, 106.8))
+	assert.InDelta(suite.T(), 0.2, box.Span(), 1e-9)
+
+	_, err = services.ParseBBox("106.9,-6.3,106.7,-6.1")
+	assert.Error(suite.T(), err)
+	_, err = services.ParseBBox("1,2,3")
+	assert.Error(suite.T(), err)
+	_, err = services.ParseBBox("0,-95,1,0")
+	assert.Error(suite.T(), err)
+}
+
+func (suite *HazardServiceTestSuite) TestAggregatedHazardConfidence() {
+	c := services.HazardCluster{AvgConfidence: 0.9, Users: 3}
+	assert.Equal(suite.T(), 0.54, services.AggregatedHazardConfidence(c))
+
+	c.Users = 8
+	assert.Equal(suite.T(), 0.9, services.AggregatedHazardConfidence(c))
+}
+
+func (suite *HazardServiceTestSuite) TestPlanAggregatedHazards() {
+	lastSeen := time.Date(2025, 3, 1, 6, 0, 0, 0, time.UTC)
+	hotspot := services.HazardCluster{
+		Latitude: -6.2, Longitude: 106.8, RadiusMeters: 4, Type: "pole",
+		Detections: 6, Users: 3, AvgConfidence: 0.9, LastSeen: lastSeen,
+	}
+
+	// A new hotspot becomes a hazard
+	upserts, removed := services.PlanAggregatedHazards(nil, []services.HazardCluster{hotspot})
+	assert.Len(suite.T(), upserts, 1)
+	assert.Empty(suite.T(), removed)
+	created := upserts[0]
+	assert.Equal(suite.T(), models.HazardSourceAggregated, created.Source)
+	assert.Equal(suite.T(), 10.0, created.RadiusMeters, "radius is at least the reported default")
+	assert.Equal(suite.T(), 0.54, created.Confidence)
+	assert.Equal(suite.T(), lastSeen.AddDate(0, 0, 60), created.ExpiresAt)
+
+	// Refreshing with the same hotspot changes nothing
+	created.ID = uuid.New()
+	upserts, removed = services.PlanAggregatedHazards([]models.Hazard{created}, []services.HazardCluster{hotspot})
+	assert.Empty(suite.T(), upserts)
+	assert.Empty(suite.T(), removed)
+
+	// A nearby hotspot with new detections updates the same hazard
+	moved := hotspot
+	moved.Latitude, moved.Longitude = offsetMeters(-6.2, 106.8, 5, 0)
+	moved.Detections = 7
+	upserts, removed = services.PlanAggregatedHazards([]models.Hazard{created}, []services.HazardCluster{moved})
+	assert.Len(suite.T(), upserts, 1)
+	assert.Equal(suite.T(), created.ID, upserts[0].ID)
+	assert.Equal(suite.T(), 7, upserts[0].Detections)
+	assert.Empty(suite.T(), removed)
+
+	// A hazard with no hotspot left is removed
+	upserts, removed = services.PlanAggregatedHazards([]models.Hazard{created}, nil)
+	assert.Empty(suite.T(), upserts)
+	assert.Len(suite.T(), removed, 1)
+}
+
+func (suite *HazardServiceTestSuite) TestHazardActive() {
+	now := time.Now()
+	hazard := models.Hazard{ExpiresAt: now.Add(time.Hour)}
+	assert.True(suite.T(), hazard.Active(now))
+	assert.False(suite.T(), hazard.Active(now.Add(2*time.Hour)))
+
+	hazard.RemovedAt = &now
+	assert.False(suite.T(), hazard.Active(now))
+}
+
+func TestHazardServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(HazardServiceTestSuite))
+}
+
+type HazardLayerTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service *services.HazardService
+	box     *services.BBox
+}
+
+func (suite *HazardLayerTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	// Every connection to an in-memory database gets its own database
+	sqlDB, err := db.DB()
+	suite.Require().NoError(err)
+	sqlDB.SetMaxOpenConns(1)
+	suite.Require().NoError(db.Exec(`CREATE TABLE hazards (
+		id TEXT PRIMARY KEY, source TEXT NOT NULL, status TEXT NOT NULL DEFAULT 'approved', type TEXT NOT NULL,
+		latitude REAL NOT NULL, longitude REAL NOT NULL, radius_meters REAL, confidence REAL, description TEXT,
+		reported_by TEXT, detections INTEGER, users INTEGER, expires_at DATETIME NOT NULL, removed_at DATETIME,
+		created_at DATETIME, updated_at DATETIME)`).Error)
+
+	suite.db = db
+	suite.service = services.NewHazardService(db)
+	suite.box = &services.BBox{MinLat: -6.3, MaxLat: -6.1, MinLng: 106.7, MaxLng: 106.9}
+}
+
+func (suite *HazardLayerTestSuite) report(userID uuid.UUID) *models.Hazard {
+	hazard, err := suite.service.Report(userID, &models.HazardReportRequest{
+		Type: "Roadworks", Latitude: -6.2, Longitude: 106.8, Description: "Trench across the path",
+	})
+	suite.Require().NoError(err)
+	return hazard
+}
+
+func (suite *HazardLayerTestSuite) TestReportsReachFeedOnlyOnceApproved() {
+	userID := uuid.New()
+	hazard := suite.report(userID)
+	assert.Equal(suite.T(), models.HazardStatusPending, hazard.Status)
+	assert.Equal(suite.T(), "roadworks", hazard.Type)
+
+	hazards, _, err := suite.service.Feed(suite.box, nil, time.Now())
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), hazards)
+
+	// The reporter and admins still see it
+	mine, err := suite.service.ListReports(userID)
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), mine, 1)
+	pending, err := suite.service.PendingReports()
+	suite.Require().NoError(err)
+	assert.Len(suite.T(), pending, 1)
+
+	approved, err := suite.service.Moderate(hazard.ID, models.HazardStatusApproved)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), models.HazardStatusApproved, approved.Status)
+
+	hazards, _, err = suite.service.Feed(suite.box, nil, time.Now())
+	suite.Require().NoError(err)
+	suite.Require().Len(hazards, 1)
+	assert.Equal(suite.T(), hazard.ID, hazards[0].ID)
+	pending, err = suite.service.PendingReports()
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), pending)
+}
+
+func (suite *HazardLayerTestSuite) TestRejectingApprovedReportRemovesIt() {
+	hazard := suite.report(uuid.New())
+	_, err := suite.service.Moderate(hazard.ID, models.HazardStatusApproved)
+	suite.Require().NoError(err)
+	since := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	rejected, err := suite.service.Moderate(hazard.ID, models.HazardStatusRejected)
+	suite.Require().NoError(err)
+	assert.NotNil(suite.T(), rejected.RemovedAt)
+
+	hazards, removed, err := suite.service.Feed(suite.box, &since, time.Now())
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), hazards)
+	assert.Equal(suite.T(), []uuid.UUID{hazard.ID}, removed)
+
+	_, err = suite.service.Moderate(hazard.ID, models.HazardStatusApproved)
+	assert.ErrorIs(suite.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (suite *HazardLayerTestSuite) TestReportLimit() {
+	userID := uuid.New()
+	for i := 0; i < services.MaxHazardReportsPerDay; i++ {
+		suite.report(userID)
+	}
+	_, err := suite.service.Report(userID, &models.HazardReportRequest{Type: "pole", Latitude: -6.2, Longitude: 106.8})
+	assert.ErrorIs(suite.T(), err, services.ErrHazardReportLimit)
+
+	// Other runners are unaffected
+	suite.report(uuid.New())
+}
+
+func (suite *HazardLayerTestSuite) aggregated(lat, lng float64) *models.Hazard {
+	hazard := &models.Hazard{
+		Source: models.HazardSourceAggregated, Status: models.HazardStatusApproved, Type: "pole",
+		Latitude: lat, Longitude: lng, RadiusMeters: 10, Confidence: 0.5, ExpiresAt: time.Now().Add(24 * time.Hour),
+	}
+	suite.Require().NoError(suite.db.Create(hazard).Error)
+	return hazard
+}
+
+func (suite *HazardLayerTestSuite) TestDeltaCoversLateCommits() {
+	since := time.Now()
+	// Stamped before the previous sync but committed after it
+	hazard := suite.aggregated(-6.2, 106.8)
+	suite.Require().NoError(suite.db.Model(hazard).UpdateColumn("updated_at", since.Add(-time.Minute)).Error)
+
+	hazards, removed, err := suite.service.Feed(suite.box, &since, time.Now())
+	suite.Require().NoError(err)
+	suite.Require().Len(hazards, 1)
+	assert.Equal(suite.T(), hazard.ID, hazards[0].ID)
+	assert.Empty(suite.T(), removed)
+}
+
+func (suite *HazardLayerTestSuite) TestDeltaRemovesHazardsMovedOutOfBox() {
+	// Just inside the box's northern edge
+	hazard := suite.aggregated(-6.1001, 106.8)
+	far := suite.aggregated(-5.5, 106.8)
+	hazards, _, err := suite.service.Feed(suite.box, nil, time.Now())
+	suite.Require().NoError(err)
+	suite.Require().Len(hazards, 1)
+
+	since := time.Now().Add(time.Hour)
+	lat, _ := offsetMeters(-6.1001, 106.8, 25, 0)
+	suite.Require().NoError(suite.db.Model(hazard).Updates(map[string]interface{}{
+		"latitude": lat, "updated_at": since.Add(time.Minute),
+	}).Error)
+	// Changes far outside the box are none of the device's business
+	suite.Require().NoError(suite.db.Model(far).UpdateColumn("updated_at", since.Add(time.Minute)).Error)
+
+	hazards, removed, err := suite.service.Feed(suite.box, &since, since.Add(time.Hour))
+	suite.Require().NoError(err)
+	assert.Empty(suite.T(), hazards)
+	assert.Equal(suite.T(), []uuid.UUID{hazard.ID}, removed)
+}
+
+func TestHazardLayerTestSuite(t *testing.T) {
+	suite.Run(t, new(HazardLayerTestSuite))
+}
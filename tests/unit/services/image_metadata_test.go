@@ -0,0 +1,123 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type ImageMetadataTestSuite struct {
+	suite.Suite
+	img image.Image
+}
+
+func (suite *ImageMetadataTestSuite) SetupTest() {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for x := 0; x < 8; x++ {
+		img.Set(x, x, color.RGBA{R: 200, A: 255})
+	}
+	suite.img = img
+}
+
+func pngChunk(kind string, data []byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+	buf.WriteString(kind)
+	buf.Write(data)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(append([]byte(kind), data...)))
+	return buf.Bytes()
+}
+
+func riffChunk(kind string, data []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(kind)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+func (suite *ImageMetadataTestSuite) TestJPEG() {
+	var encoded bytes.Buffer
+	suite.Require().NoError(jpeg.Encode(&encoded, suite.img, nil))
+	exif := []byte("Exif\x00\x00GPSLatitude-6.2")
+	segment := append([]byte{0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+	comment := []byte{0xFF, 0xFE, 0, 6, 'h', 'o', 'm', 'e'}
+	data := append(append(append([]byte{0xFF, 0xD8}, segment...), comment...), encoded.Bytes()[2:]...)
+
+	stripped, err := services.StripImageMetadata("image/jpeg", data)
+	suite.Require().NoError(err)
+	assert.NotContains(suite.T(), string(stripped), "GPSLatitude")
+	assert.NotContains(suite.T(), string(stripped), "home")
+	assert.Equal(suite.T(), len(data)-len(segment)-len(comment), len(stripped))
+
+	decoded, err := jpeg.Decode(bytes.NewReader(stripped))
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), suite.img.Bounds(), decoded.Bounds())
+}
+
+func (suite *ImageMetadataTestSuite) TestPNG() {
+	var encoded bytes.Buffer
+	suite.Require().NoError(png.Encode(&encoded, suite.img))
+	// The signature and IHDR come first
+	head := encoded.Bytes()[:8+25]
+	data := append(append([]byte(nil), head...), pngChunk("tEXt", []byte("Location\x00-6.2,106.8"))...)
+	data = append(data, pngChunk("eXIf", []byte("MM\x00*GPS"))...)
+	data = append(data, encoded.Bytes()[len(head):]...)
+
+	stripped, err := services.StripImageMetadata("image/png", data)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), encoded.Bytes(), stripped)
+
+	_, err = png.Decode(bytes.NewReader(stripped))
+	suite.Require().NoError(err)
+}
+
+func (suite *ImageMetadataTestSuite) TestWebP() {
+	// Bits 3 and 2 of VP8X announce EXIF and XMP, bit 4 alpha
+	vp8x := riffChunk("VP8X", []byte{0x1C, 0, 0, 0, 7, 0, 0, 7, 0, 0})
+	alpha := riffChunk("ALPH", []byte{1, 2, 3})
+	pixels := riffChunk("VP8L", []byte{0x2F, 1, 2, 3, 4})
+	body := append(append([]byte("WEBP"), vp8x...), alpha...)
+	body = append(body, riffChunk("EXIF", []byte("GPSLatitude"))...)
+	body = append(body, pixels...)
+	body = append(body, riffChunk("XMP ", []byte("<x:xmpmeta/>"))...)
+	data := append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+
+	stripped, err := services.StripImageMetadata("image/webp", data)
+	suite.Require().NoError(err)
+	assert.NotContains(suite.T(), string(stripped), "GPSLatitude")
+	assert.NotContains(suite.T(), string(stripped), "xmpmeta")
+	assert.Equal(suite.T(), uint32(len(stripped)-8), binary.LittleEndian.Uint32(stripped[4:]))
+	assert.Equal(suite.T(), byte(0x10), stripped[20])
+	assert.Equal(suite.T(), 12+len(vp8x)+len(alpha)+len(pixels), len(stripped))
+}
+
+func (suite *ImageMetadataTestSuite) TestRejectsMalformed() {
+	for contentType, data := range map[string][]byte{
+		"image/jpeg": {0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF},
+		"image/png":  append([]byte("\x89PNG\r\n\x1a\n"), 0, 0, 1, 0, 'I', 'D'),
+		"image/webp": []byte("RIFF\xff\x00\x00\x00WEBP"),
+	} {
+		_, err := services.StripImageMetadata(contentType, data)
+		assert.ErrorIs(suite.T(), err, services.ErrImageMalformed, contentType)
+	}
+	_, err := services.StripImageMetadata("image/gif", []byte("GIF89a"))
+	assert.ErrorIs(suite.T(), err, services.ErrMediaType)
+}
+
+func TestImageMetadataTestSuite(t *testing.T) {
+	suite.Run(t, new(ImageMetadataTestSuite))
+}
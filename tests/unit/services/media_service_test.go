@@ -0,0 +1,163 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+	"github.com/labmino/runsight-backend/internal/storage"
+)
+
+type MediaTestSuite struct {
+	suite.Suite
+}
+
+func (suite *MediaTestSuite) TestNearestAIEvent() {
+	at := time.Date(2025, 1, 5, 6, 0, 10, 0, time.UTC)
+	events := []models.AIEvent{
+		{ID: uuid.New(), Timestamp: at.Add(-1500 * time.Millisecond)},
+		{ID: uuid.New(), Timestamp: at.Add(400 * time.Millisecond)},
+		{ID: uuid.New(), Timestamp: at.Add(5 * time.Second)},
+	}
+
+	nearest := services.NearestAIEvent(events, at, 2*time.Second)
+	suite.Require().NotNil(nearest)
+	assert.Equal(suite.T(), events[1].ID, nearest.ID)
+
+	assert.Nil(suite.T(), services.NearestAIEvent(events[2:], at, 2*time.Second))
+	assert.Nil(suite.T(), services.NearestAIEvent(nil, at, 2*time.Second))
+}
+
+func (suite *MediaTestSuite) TestSignedURL() {
+	key := []byte("secret")
+	mediaID := uuid.New()
+	now := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	expires := now.Add(services.MediaURLTTL).Unix()
+	signature := services.SignMediaURL(key, mediaID, expires)
+
+	assert.NoError(suite.T(), services.VerifyMediaURL(key, mediaID, expires, signature, now))
+	assert.ErrorIs(suite.T(), services.VerifyMediaURL(key, mediaID, expires, signature, now.Add(time.Hour)), services.ErrMediaURLExpired)
+	// Extending the expiry or pointing at other media breaks the signature
+	assert.ErrorIs(suite.T(), services.VerifyMediaURL(key, mediaID, expires+3600, signature, now), services.ErrMediaURLInvalid)
+	assert.ErrorIs(suite.T(), services.VerifyMediaURL(key, uuid.New(), expires, signature, now), services.ErrMediaURLInvalid)
+	assert.ErrorIs(suite.T(), services.VerifyMediaURL([]byte("other"), mediaID, expires, signature, now), services.ErrMediaURLInvalid)
+}
+
+func (suite *MediaTestSuite) TestMediaKeyShardsByHash() {
+	hash := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	assert.Equal(suite.T(), "media/9f/"+hash, services.MediaKey(hash))
+}
+
+func TestMediaTestSuite(t *testing.T) {
+	suite.Run(t, new(MediaTestSuite))
+}
+
+type MediaUploadTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service *services.MediaService
+	run     *models.Run
+}
+
+func (suite *MediaUploadTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	// Every connection to an in-memory database gets its own database
+	sqlDB, err := db.DB()
+	suite.Require().NoError(err)
+	sqlDB.SetMaxOpenConns(1)
+
+	for _, stmt := range []string{
+		`CREATE TABLE users (id TEXT PRIMARY KEY)`,
+		`CREATE TABLE ai_events (id TEXT PRIMARY KEY, run_id TEXT, timestamp DATETIME)`,
+		`CREATE TABLE media_blobs (sha256 TEXT PRIMARY KEY, size_bytes INTEGER, content_type TEXT,
+			created_at DATETIME, updated_at DATETIME)`,
+		`CREATE TABLE run_media (id TEXT PRIMARY KEY, run_id TEXT, user_id TEXT, ai_event_id TEXT, sha256 TEXT,
+			size_bytes INTEGER, content_type TEXT, captured_at DATETIME, created_at DATETIME,
+			UNIQUE (run_id, sha256))`,
+	} {
+		suite.Require().NoError(db.Exec(stmt).Error)
+	}
+	suite.db = db
+
+	store, err := storage.NewLocalStore(suite.T().TempDir())
+	suite.Require().NoError(err)
+	suite.T().Setenv("MEDIA_QUOTA_MB", "1")
+	suite.service = services.NewMediaService(db, store)
+
+	suite.run = &models.Run{ID: uuid.New(), UserID: uuid.New()}
+	suite.Require().NoError(db.Exec(`INSERT INTO users (id) VALUES (?)`, suite.run.UserID).Error)
+}
+
+// pngOfSize returns distinct data of the given size that is sniffed as PNG.
+func pngOfSize(size int, fill byte) []byte {
+	data := bytes.Repeat([]byte{fill}, size)
+	copy(data, "\x89PNG\r\n\x1a\n")
+	return data
+}
+
+func (suite *MediaUploadTestSuite) upload(data []byte) (*models.RunMedia, bool, error) {
+	return suite.service.Upload(context.Background(), suite.run, time.Now(), bytes.NewReader(data))
+}
+
+func (suite *MediaUploadTestSuite) TestUploadWithinQuota() {
+	first := pngOfSize(600<<10, 1)
+	_, duplicate, err := suite.upload(first)
+	suite.Require().NoError(err)
+	suite.False(duplicate)
+
+	_, _, err = suite.upload(pngOfSize(600<<10, 2))
+	suite.ErrorIs(err, services.ErrMediaQuota)
+
+	// A file the runner already stores costs nothing to reference again
+	suite.run.ID = uuid.New()
+	_, duplicate, err = suite.upload(first)
+	suite.Require().NoError(err)
+	suite.False(duplicate)
+}
+
+func (suite *MediaUploadTestSuite) TestConcurrentUploadCountsAgainstQuota() {
+	// Another upload by the runner lands once this one has passed the first
+	// check but before it is saved
+	other := models.RunMedia{ID: uuid.New(), RunID: uuid.New(), UserID: suite.run.UserID,
+		SHA256: "other", SizeBytes: 600 << 10, ContentType: "image/png", CapturedAt: time.Now()}
+	landed := false
+	err := suite.db.Callback().Create().Before("gorm:create").Register("test:concurrent_upload", func(tx *gorm.DB) {
+		if landed || tx.Statement.Table != "media_blobs" {
+			return
+		}
+		landed = true
+		db := tx.Session(&gorm.Session{NewDB: true})
+		db.Exec(`INSERT INTO media_blobs (sha256, size_bytes, content_type) VALUES (?, ?, ?)`,
+			other.SHA256, other.SizeBytes, other.ContentType)
+		db.Exec(`INSERT INTO run_media (id, run_id, user_id, sha256, size_bytes, content_type, captured_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			other.ID, other.RunID, other.UserID, other.SHA256, other.SizeBytes, other.ContentType, other.CapturedAt)
+	})
+	suite.Require().NoError(err)
+
+	_, _, err = suite.upload(pngOfSize(600<<10, 1))
+	suite.True(landed)
+	suite.ErrorIs(err, services.ErrMediaQuota)
+
+	var count int64
+	suite.Require().NoError(suite.db.Model(&models.RunMedia{}).Count(&count).Error)
+	suite.Equal(int64(1), count)
+	usage, err := suite.service.Usage(suite.run.UserID)
+	suite.Require().NoError(err)
+	suite.Equal(int64(600<<10), usage.UsedBytes)
+}
+
+func TestMediaUploadTestSuite(t *testing.T) {
+	suite.Run(t, new(MediaUploadTestSuite))
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type RecordServiceTestSuite struct {
+	suite.Suite
+}
+
+func (suite *RecordServiceTestSuite) TestBestEffortFindsFastestSegment() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	// 2 km easy at 2.5 m/s, 1.2 km fast at 4 m/s, then 2 km easy again
+	easy := straightTrack(start, 800, 2.5)
+	last := easy[len(easy)-1]
+	fast := straightTrack(last.Timestamp, 300, 4.0)
+	offset := last.Latitude - fast[0].Latitude
+	for i := range fast {
+		fast[i].Latitude += offset
+	}
+	last = fast[len(fast)-1]
+	tail := straightTrack(last.Timestamp, 800, 2.5)
+	offset = last.Latitude - tail[0].Latitude
+	for i := range tail {
+		tail[i].Latitude += offset
+	}
+	points := append(append(easy, fast[1:]...), tail[1:]...)
+
+	efforts := services.ComputeBestEfforts(points)
+	assert.Len(suite.T(), efforts, 2)
+
+	oneK := efforts[0]
+	assert.Equal(suite.T(), models.RecordCategory1K, oneK.Category)
+	assert.InDelta(suite.T(), 250, oneK.DurationSeconds, 1)
+	assert.GreaterOrEqual(suite.T(), oneK.StartSeq, 800)
+	assert.LessOrEqual(suite.T(), oneK.EndSeq, 1100)
+
+	fiveK := efforts[1]
+	assert.Equal(suite.T(), models.RecordCategory5K, fiveK.Category)
+	// 1.2 km at 4 m/s plus 3.8 km at 2.5 m/s
+	assert.InDelta(suite.T(), 300+1520, fiveK.DurationSeconds, 2)
+}
+
+func (suite *RecordServiceTestSuite) TestShortRunHasNoEfforts() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	assert.Empty(suite.T(), services.ComputeBestEfforts(straightTrack(start, 200, 3.0)))
+	assert.Empty(suite.T(), services.ComputeBestEfforts(nil))
+}
+
+func TestRecordServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(RecordServiceTestSuite))
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type RunAnalysisTestSuite struct {
+	suite.Suite
+}
+
+// straightTrack heads north at a constant speed with one fix per second.
+// 0.00001 degrees of latitude is roughly 1.11 m.
+func straightTrack(start time.Time, seconds int, metersPerSecond float64) []models.WaypointData {
+	points := make([]models.WaypointData, 0, seconds+1)
+	step := metersPerSecond / 111195.0
+	for i := 0; i <= seconds; i++ {
+		points = append(points, models.WaypointData{
+			Latitude:  -6.2 + float64(i)*step,
+			Longitude: 106.8,
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	return points
+}
+
+func (suite *RunAnalysisTestSuite) TestAnalyzeConstantSpeed() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	analysis := services.AnalyzeTrack(straightTrack(start, 600, 3.0))
+
+	assert.NotNil(suite.T(), analysis)
+	assert.InDelta(suite.T(), 1800, analysis.DistanceMeters, 5)
+	assert.Equal(suite.T(), 600, analysis.ElapsedSeconds)
+	assert.Equal(suite.T(), 600, analysis.MovingSeconds)
+	assert.InDelta(suite.T(), 10.8, analysis.AvgSpeedKmh, 0.1)
+	assert.InDelta(suite.T(), 10.8, analysis.MaxSpeedKmh, 0.1)
+}
+
+func (suite *RunAnalysisTestSuite) TestStationaryTimeIsNotMoving() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	points := straightTrack(start, 300, 3.0)
+	last := points[len(points)-1]
+	for i := 1; i <= 120; i++ {
+		p := last
+		p.Timestamp = last.Timestamp.Add(time.Duration(i) * time.Second)
+		points = append(points, p)
+	}
+
+	analysis := services.AnalyzeTrack(points)
+	assert.Equal(suite.T(), 420, analysis.ElapsedSeconds)
+	assert.Equal(suite.T(), 300, analysis.MovingSeconds)
+}
+
+func (suite *RunAnalysisTestSuite) TestSingleSpikeDoesNotSetMaxSpeed() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	points := straightTrack(start, 120, 3.0)
+	points[60].Latitude += 10 / 111195.0
+
+	analysis := services.AnalyzeTrack(points)
+	assert.Less(suite.T(), analysis.MaxSpeedKmh, 25.0)
+}
+
+func (suite *RunAnalysisTestSuite) TestFlagsDisagreeingDeviceMetrics() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	analysis := services.AnalyzeTrack(straightTrack(start, 600, 3.0))
+
+	reportedDistance := 5000.0
+	reportedDuration := 600
+	run := &models.Run{DistanceMeters: &reportedDistance, DurationSeconds: &reportedDuration}
+	services.ApplyTrackAnalysis(run, analysis, services.DefaultDiscrepancyThresholds)
+
+	assert.True(suite.T(), run.MetricsFlagged)
+	assert.Equal(suite.T(), "distance_meters", run.MetricsDiscrepancies)
+	assert.Equal(suite.T(), 600, *run.MovingTimeSeconds)
+}
+
+func (suite *RunAnalysisTestSuite) TestTooFewPoints() {
+	assert.Nil(suite.T(), services.AnalyzeTrack(nil))
+}
+
+func TestRunAnalysisTestSuite(t *testing.T) {
+	suite.Run(t, new(RunAnalysisTestSuite))
+}
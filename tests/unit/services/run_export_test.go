@@ -0,0 +1,136 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type RunExportTestSuite struct {
+	suite.Suite
+	run    *models.Run
+	points []models.WaypointData
+}
+
+func (suite *RunExportTestSuite) SetupTest() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	suite.points = straightTrack(start, 60, 3.0)
+	altitude, speed := 12.5, 3.0
+	suite.points[0].Altitude = &altitude
+	suite.points[0].Speed = &speed
+
+	duration, distance, calories := 60, 180.0, 12
+	suite.run = &models.Run{
+		ID:              uuid.MustParse("0b7c1a2e-5f9d-4c3b-8a6e-1d2f3a4b5c6d"),
+		Title:           "Park <loop> & back",
+		Notes:           "Felt good",
+		StartedAt:       start,
+		DurationSeconds: &duration,
+		DistanceMeters:  &distance,
+		CaloriesBurned:  &calories,
+	}
+}
+
+func (suite *RunExportTestSuite) export(format string) []byte {
+	var buf bytes.Buffer
+	suite.Require().NoError(services.ExportRun(&buf, format, suite.run, suite.points))
+	return buf.Bytes()
+}
+
+func (suite *RunExportTestSuite) TestGPXRoundTrip() {
+	parsed, err := services.ParseActivityFile("run.gpx", suite.export(services.ExportFormatGPX))
+	suite.Require().NoError(err)
+	suite.Require().Len(parsed, 1)
+
+	activity := parsed[0]
+	assert.Equal(suite.T(), "Park <loop> & back", activity.Name)
+	assert.Equal(suite.T(), suite.run.StartedAt, activity.StartedAt)
+	suite.Require().Len(activity.Points, len(suite.points))
+	assert.InDelta(suite.T(), suite.points[30].Latitude, activity.Points[30].Latitude, 1e-8)
+	assert.Equal(suite.T(), suite.points[30].Timestamp, activity.Points[30].Timestamp)
+	suite.Require().NotNil(activity.Points[0].Altitude)
+	assert.InDelta(suite.T(), 12.5, *activity.Points[0].Altitude, 0.05)
+	suite.Require().NotNil(activity.Points[0].Speed)
+	assert.InDelta(suite.T(), 3.0, *activity.Points[0].Speed, 0.01)
+	assert.Nil(suite.T(), activity.Points[1].Altitude)
+}
+
+func (suite *RunExportTestSuite) TestTCXRoundTrip() {
+	parsed, err := services.ParseActivityFile("run.tcx", suite.export(services.ExportFormatTCX))
+	suite.Require().NoError(err)
+	suite.Require().Len(parsed, 1)
+
+	activity := parsed[0]
+	assert.Equal(suite.T(), "Felt good", activity.Notes)
+	assert.Len(suite.T(), activity.Points, len(suite.points))
+	suite.Require().NotNil(activity.DurationSeconds)
+	assert.Equal(suite.T(), 60, *activity.DurationSeconds)
+	suite.Require().NotNil(activity.DistanceMeters)
+	assert.InDelta(suite.T(), 180, *activity.DistanceMeters, 0.01)
+	suite.Require().NotNil(activity.CaloriesBurned)
+	assert.Equal(suite.T(), 12, *activity.CaloriesBurned)
+}
+
+func (suite *RunExportTestSuite) TestGeoJSON() {
+	var doc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type        string      `json:"type"`
+				Coordinates [][]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties struct {
+				Name       string   `json:"name"`
+				CoordTimes []string `json:"coordTimes"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	suite.Require().NoError(json.Unmarshal(suite.export(services.ExportFormatGeoJSON), &doc))
+
+	assert.Equal(suite.T(), "FeatureCollection", doc.Type)
+	suite.Require().Len(doc.Features, 1)
+	feature := doc.Features[0]
+	assert.Equal(suite.T(), "LineString", feature.Geometry.Type)
+	suite.Require().Len(feature.Geometry.Coordinates, len(suite.points))
+	// GeoJSON orders positions longitude first, with altitude when known
+	assert.Equal(suite.T(), []float64{106.8, -6.2, 12.5}, feature.Geometry.Coordinates[0])
+	assert.Len(suite.T(), feature.Geometry.Coordinates[1], 2)
+	assert.Equal(suite.T(), "Park <loop> & back", feature.Properties.Name)
+	assert.Equal(suite.T(), "2025-01-05T06:00:01Z", feature.Properties.CoordTimes[1])
+}
+
+func (suite *RunExportTestSuite) TestCSV() {
+	records, err := csv.NewReader(bytes.NewReader(suite.export(services.ExportFormatCSV))).ReadAll()
+	suite.Require().NoError(err)
+	suite.Require().Len(records, len(suite.points)+1)
+
+	assert.Equal(suite.T(), []string{"seq", "timestamp", "latitude", "longitude", "altitude_m", "speed_mps", "heading_deg", "accuracy_m", "distance_m"}, records[0])
+	assert.Equal(suite.T(), []string{"0", "2025-01-05T06:00:00Z", "-6.20000000", "106.80000000", "12.5", "3.00", "", "", "0.00"}, records[1])
+	assert.Equal(suite.T(), "60", records[61][0])
+	assert.Equal(suite.T(), "180.00", records[61][8])
+}
+
+func (suite *RunExportTestSuite) TestUnsupportedFormat() {
+	var buf bytes.Buffer
+	assert.Error(suite.T(), services.ExportRun(&buf, "kml", suite.run, suite.points))
+
+	_, ok := services.ExportContentType("kml")
+	assert.False(suite.T(), ok)
+	contentType, ok := services.ExportContentType(services.ExportFormatGPX)
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), "application/gpx+xml", contentType)
+	assert.Equal(suite.T(), "runsight-20250105-060000-0b7c1a2e.gpx", services.ExportFilename(suite.run, services.ExportFormatGPX))
+}
+
+func TestRunExportTestSuite(t *testing.T) {
+	suite.Run(t, new(RunExportTestSuite))
+}
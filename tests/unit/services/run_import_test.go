@@ -0,0 +1,198 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type RunImportTestSuite struct {
+	suite.Suite
+}
+
+const sampleGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v2">
+  <metadata><name>Morning Run</name></metadata>
+  <trk><trkseg>
+    <trkpt lat="-6.20000000" lon="106.80000000"><ele>10.0</ele><time>2025-01-05T06:00:00Z</time>
+      <extensions><gpxtpx:TrackPointExtension><gpxtpx:speed>3.20</gpxtpx:speed></gpxtpx:TrackPointExtension></extensions>
+    </trkpt>
+    <trkpt lat="-6.20100000" lon="106.80000000"><ele>11.0</ele><time>2025-01-05T06:00:30Z</time></trkpt>
+  </trkseg></trk>
+</gpx>`
+
+const sampleTCX = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">
+  <Activities><Activity Sport="Running">
+    <Id>2025-01-05T06:00:00Z</Id>
+    <Lap StartTime="2025-01-05T06:00:00Z">
+      <TotalTimeSeconds>30</TotalTimeSeconds><DistanceMeters>111.2</DistanceMeters><Calories>9</Calories>
+      <Track>
+        <Trackpoint><Time>2025-01-05T06:00:00Z</Time><Position><LatitudeDegrees>-6.2</LatitudeDegrees><LongitudeDegrees>106.8</LongitudeDegrees></Position></Trackpoint>
+        <Trackpoint><Time>2025-01-05T06:00:30Z</Time><Position><LatitudeDegrees>-6.201</LatitudeDegrees><LongitudeDegrees>106.8</LongitudeDegrees></Position></Trackpoint>
+        <Trackpoint><Time>2025-01-05T06:00:31Z</Time></Trackpoint>
+      </Track>
+    </Lap>
+  </Activity></Activities>
+</TrainingCenterDatabase>`
+
+func (suite *RunImportTestSuite) TestParseGPX() {
+	activities, err := services.ParseActivityFile("run.gpx", []byte(sampleGPX))
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), activities, 1)
+
+	activity := activities[0]
+	assert.Equal(suite.T(), "Morning Run", activity.Name)
+	assert.Len(suite.T(), activity.Points, 2)
+	assert.Equal(suite.T(), time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC), activity.StartedAt)
+	assert.InDelta(suite.T(), 3.2, *activity.Points[0].Speed, 0.001)
+	assert.InDelta(suite.T(), 11.0, *activity.Points[1].Altitude, 0.001)
+}
+
+func (suite *RunImportTestSuite) TestParseTCX() {
+	activities, err := services.ParseActivityFile("run.tcx", []byte(sampleTCX))
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), activities, 1)
+
+	activity := activities[0]
+	assert.Len(suite.T(), activity.Points, 2, "trackpoints without a position are skipped")
+	assert.Equal(suite.T(), 30, *activity.DurationSeconds)
+	assert.InDelta(suite.T(), 111.2, *activity.DistanceMeters, 0.001)
+	assert.Equal(suite.T(), 9, *activity.CaloriesBurned)
+}
+
+func (suite *RunImportTestSuite) TestParseFIT() {
+	activities, err := services.ParseActivityFile("run.fit", buildFITFile())
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), activities, 1)
+
+	points := activities[0].Points
+	assert.Len(suite.T(), points, 2)
+	assert.InDelta(suite.T(), 45.0, points[0].Latitude, 1e-6)
+	assert.InDelta(suite.T(), -120.0, points[0].Longitude, 1e-6)
+	assert.InDelta(suite.T(), 2.5, *points[0].Speed, 1e-6)
+	assert.Equal(suite.T(), 5*time.Second, points[1].Timestamp.Sub(points[0].Timestamp))
+}
+
+func (suite *RunImportTestSuite) TestParseUnknownFormat() {
+	_, err := services.ParseActivityFile("notes.txt", []byte("hello"))
+	assert.Error(suite.T(), err)
+}
+
+func (suite *RunImportTestSuite) TestImportRejectsOversizedFile() {
+	service := services.NewRunImportService(nil)
+	data := []byte(sampleGPX)
+
+	results := service.Import(uuid.New(), services.ImportFile{Name: "huge.gpx", Data: bytes.NewReader(data), Size: 51 << 20}, services.MaxImportActivities)
+	suite.Require().Len(results, 1)
+	assert.Equal(suite.T(), services.ImportStatusError, results[0].Status)
+	assert.Equal(suite.T(), "file too large", results[0].Error)
+}
+
+func (suite *RunImportTestSuite) TestImportReadsArchiveInPlace() {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	w, err := archive.Create("readme.txt")
+	suite.Require().NoError(err)
+	w.Write([]byte("not an activity"))
+	suite.Require().NoError(archive.Close())
+
+	// Sniffed from the content even without a .zip extension
+	results := services.NewRunImportService(nil).Import(uuid.New(), services.ImportFile{
+		Name: "export", Data: bytes.NewReader(buf.Bytes()), Size: int64(buf.Len()),
+	}, services.MaxImportActivities)
+	suite.Require().Len(results, 1)
+	assert.Equal(suite.T(), "archive contains no GPX, TCX or FIT files", results[0].Error)
+}
+
+func (suite *RunImportTestSuite) TestImportStopsAtLimit() {
+	// Single-point tracks fail before anything is stored
+	single := strings.Replace(sampleGPX, `<trkpt lat="-6.20100000" lon="106.80000000"><ele>11.0</ele><time>2025-01-05T06:00:30Z</time></trkpt>`, "", 1)
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for i := 0; i < 10; i++ {
+		w, err := archive.Create(fmt.Sprintf("run%d.gpx", i))
+		suite.Require().NoError(err)
+		w.Write([]byte(single))
+	}
+	suite.Require().NoError(archive.Close())
+
+	results := services.NewRunImportService(nil).Import(uuid.New(), services.ImportFile{
+		Name: "export.zip", Data: bytes.NewReader(buf.Bytes()), Size: int64(buf.Len()),
+	}, 3)
+	suite.Require().Len(results, 4)
+	assert.Equal(suite.T(), "activity has fewer than two timestamped GPS points", results[2].Error)
+	assert.Equal(suite.T(), "export.zip/run3.gpx", results[3].File)
+	assert.Equal(suite.T(), services.ErrImportLimit.Error(), results[3].Error)
+}
+
+// buildFITFile encodes a record definition and two GPS samples, the second
+// using a compressed timestamp header.
+func buildFITFile() []byte {
+	var body bytes.Buffer
+	le := binary.LittleEndian
+
+	// Definition for local type 0: record (20) with timestamp, lat, long, speed
+	body.Write([]byte{0x40, 0, 0})
+	binary.Write(&body, le, uint16(20))
+	body.WriteByte(4)
+	body.Write([]byte{253, 4, 0x86, 0, 4, 0x85, 1, 4, 0x85, 6, 2, 0x84})
+
+	toSemicircles := func(deg float64) int32 { return int32(deg * (1 << 31) / 180) }
+
+	body.WriteByte(0x00)
+	binary.Write(&body, le, uint32(1000000000))
+	binary.Write(&body, le, toSemicircles(45))
+	binary.Write(&body, le, toSemicircles(-120))
+	binary.Write(&body, le, uint16(2500))
+
+	// Compressed timestamp header: local type 0, offset = (1000000000+5) & 0x1F
+	body.WriteByte(0x80 | byte((1000000000+5)&0x1F))
+	binary.Write(&body, le, uint32(0xFFFFFFFF))
+	binary.Write(&body, le, toSemicircles(45.0001))
+	binary.Write(&body, le, toSemicircles(-120))
+	binary.Write(&body, le, uint16(2600))
+
+	header := make([]byte, 12)
+	header[0] = 12
+	header[1] = 0x10
+	le.PutUint16(header[2:4], 2100)
+	le.PutUint32(header[4:8], uint32(body.Len()))
+	copy(header[8:12], ".FIT")
+
+	file := append(header, body.Bytes()...)
+	crc := fitCRC(file)
+	return binary.LittleEndian.AppendUint16(file, crc)
+}
+
+func fitCRC(data []byte) uint16 {
+	table := [16]uint16{
+		0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+		0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+	}
+	var crc uint16
+	for _, b := range data {
+		tmp := table[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ table[b&0xF]
+		tmp = table[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ table[(b>>4)&0xF]
+	}
+	return crc
+}
+
+func TestRunImportTestSuite(t *testing.T) {
+	suite.Run(t, new(RunImportTestSuite))
+}
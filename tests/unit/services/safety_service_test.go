@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type SafetyTestSuite struct {
+	suite.Suite
+	start time.Time
+}
+
+func (suite *SafetyTestSuite) SetupTest() {
+	suite.start = time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+}
+
+func (suite *SafetyTestSuite) event(secs int, kind string, distance float64, warned bool) models.AIEvent {
+	return models.AIEvent{
+		Timestamp:      suite.start.Add(time.Duration(secs) * time.Second),
+		Type:           kind,
+		DistanceMeters: floatPtr(distance),
+		WarningSpoken:  warned,
+	}
+}
+
+func (suite *SafetyTestSuite) TestScoresAllParts() {
+	run := &models.Run{DistanceMeters: floatPtr(5200), ComputedDistanceMeters: floatPtr(5000)}
+	metrics := &models.AIMetrics{TotalObstaclesDetected: intPtr(10), LaneKeepingAccuracy: floatPtr(0.9)}
+	events := []models.AIEvent{
+		suite.event(10, "person", 8, true),
+		suite.event(20, "bicycle", 6, false),
+		suite.event(58, "pole", 4, true),
+		// Passing the warned pole closely twice in a row is one near miss
+		suite.event(60, "pole", 1.0, false),
+		suite.event(61, "pole", 0.8, false),
+		suite.event(120, "person", 5, true),
+		suite.event(180, "car", 10, false),
+		// A near miss with a pole does not count against a warning about a dog
+		suite.event(240, "dog", 3, true),
+		suite.event(250, "pole", 1.2, false),
+		suite.event(300, "bench", 7, false),
+	}
+
+	score, breakdown := services.ScoreSafety(run, metrics, events, nil)
+
+	assert.Equal(suite.T(), models.SafetyScoreVersion, breakdown.Version)
+	assert.Equal(suite.T(), 5.0, breakdown.DistanceKm)
+	assert.Equal(suite.T(), 10, breakdown.Detections)
+	assert.Equal(suite.T(), 2.0, *breakdown.DetectionsPerKm)
+	assert.Equal(suite.T(), 90.0, *breakdown.ObstacleDensityScore)
+	assert.Equal(suite.T(), 2, breakdown.NearMisses)
+	assert.Equal(suite.T(), 80.0, *breakdown.NearMissScore)
+	assert.Equal(suite.T(), 4, breakdown.Warnings)
+	assert.Equal(suite.T(), 3, breakdown.WarningsHeeded)
+	assert.Equal(suite.T(), 75.0, *breakdown.WarningResponseScore)
+	assert.Equal(suite.T(), 90.0, *breakdown.LaneKeepingScore)
+	suite.Require().NotNil(score)
+	// 0.35*80 + 0.25*75 + 0.2*90 + 0.2*90
+	assert.Equal(suite.T(), 82.75, *score)
+}
+
+func (suite *SafetyTestSuite) TestTotalsOnly() {
+	run := &models.Run{DistanceMeters: floatPtr(5000)}
+	metrics := &models.AIMetrics{TotalObstaclesDetected: intPtr(15), LaneDeviationsCount: intPtr(5)}
+
+	score, breakdown := services.ScoreSafety(run, metrics, nil, nil)
+
+	assert.Nil(suite.T(), breakdown.NearMissScore)
+	assert.Nil(suite.T(), breakdown.WarningResponseScore)
+	assert.Equal(suite.T(), 85.0, *breakdown.ObstacleDensityScore)
+	assert.Equal(suite.T(), 1.0, *breakdown.LaneDeviationsPerKm)
+	assert.Equal(suite.T(), 90.0, *breakdown.LaneKeepingScore)
+	suite.Require().NotNil(score)
+	assert.Equal(suite.T(), 87.5, *score)
+}
+
+func (suite *SafetyTestSuite) TestNothingDetected() {
+	run := &models.Run{DistanceMeters: floatPtr(3000)}
+	metrics := &models.AIMetrics{TotalObstaclesDetected: intPtr(0)}
+
+	score, breakdown := services.ScoreSafety(run, metrics, nil, nil)
+
+	assert.Equal(suite.T(), 100.0, *breakdown.NearMissScore)
+	assert.Equal(suite.T(), 100.0, *breakdown.ObstacleDensityScore)
+	assert.Nil(suite.T(), breakdown.WarningResponseScore)
+	suite.Require().NotNil(score)
+	assert.Equal(suite.T(), 100.0, *score)
+}
+
+func (suite *SafetyTestSuite) TestScoresClampAtZero() {
+	run := &models.Run{DistanceMeters: floatPtr(1000)}
+	var events []models.AIEvent
+	for i := 0; i < 30; i++ {
+		events = append(events, suite.event(i*10, "person", 1, false))
+	}
+
+	_, breakdown := services.ScoreSafety(run, &models.AIMetrics{}, events, nil)
+
+	assert.Equal(suite.T(), 30, breakdown.NearMisses)
+	assert.Equal(suite.T(), 0.0, *breakdown.NearMissScore)
+	assert.Equal(suite.T(), 0.0, *breakdown.ObstacleDensityScore)
+}
+
+func (suite *SafetyTestSuite) TestUnscoredWithoutData() {
+	score, _ := services.ScoreSafety(&models.Run{DistanceMeters: floatPtr(5000)}, &models.AIMetrics{}, nil, nil)
+	assert.Nil(suite.T(), score)
+
+	// Too short for rates, and no lane keeping reported
+	short := &models.Run{DistanceMeters: floatPtr(50)}
+	score, breakdown := services.ScoreSafety(short, &models.AIMetrics{TotalObstaclesDetected: intPtr(3)}, nil, nil)
+	assert.Nil(suite.T(), score)
+	assert.Equal(suite.T(), 3, breakdown.Detections)
+	assert.Nil(suite.T(), breakdown.DetectionsPerKm)
+}
+
+func TestSafetyTestSuite(t *testing.T) {
+	suite.Run(t, new(SafetyTestSuite))
+}
+
+type SafetyBackfillTestSuite struct {
+	suite.Suite
+	db *gorm.DB
+}
+
+func (suite *SafetyBackfillTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	// Every connection to an in-memory database gets its own database
+	sqlDB, err := db.DB()
+	suite.Require().NoError(err)
+	sqlDB.SetMaxOpenConns(1)
+
+	for _, stmt := range []string{
+		`CREATE TABLE runs (id TEXT PRIMARY KEY, distance_meters REAL, computed_distance_meters REAL,
+			safety_score REAL, safety_breakdown TEXT, safety_scored_at DATETIME, updated_at DATETIME)`,
+		`CREATE TABLE ai_metrics (id TEXT PRIMARY KEY, run_id TEXT, total_obstacles_detected INTEGER,
+			lane_keeping_accuracy REAL, created_at DATETIME)`,
+		`CREATE TABLE ai_events (id TEXT PRIMARY KEY, run_id TEXT, timestamp DATETIME, type TEXT,
+			distance_meters REAL, warning_spoken BOOLEAN)`,
+		`CREATE TABLE lane_events (id TEXT PRIMARY KEY, run_id TEXT, started_at DATETIME)`,
+	} {
+		suite.Require().NoError(db.Exec(stmt).Error)
+	}
+	suite.db = db
+}
+
+func (suite *SafetyBackfillTestSuite) insertRun(scoredAt *time.Time) uuid.UUID {
+	id := uuid.New()
+	suite.Require().NoError(suite.db.Exec(`INSERT INTO runs (id, distance_meters, safety_scored_at) VALUES (?, ?, ?)`,
+		id, 3000.0, scoredAt).Error)
+	return id
+}
+
+func (suite *SafetyBackfillTestSuite) TestScoresUnscoredRuns() {
+	withMetrics := suite.insertRun(nil)
+	suite.Require().NoError(suite.db.Exec(`INSERT INTO ai_metrics (id, run_id, total_obstacles_detected) VALUES (?, ?, 0)`,
+		uuid.New(), withMetrics).Error)
+	withoutMetrics := suite.insertRun(nil)
+	earlier := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	scored := suite.insertRun(&earlier)
+
+	suite.Require().NoError(services.NewSafetyService(suite.db).ScorePending(context.Background()))
+
+	var rows []struct {
+		ID             uuid.UUID
+		SafetyScore    *float64
+		SafetyScoredAt *time.Time
+	}
+	suite.Require().NoError(suite.db.Table("runs").Find(&rows).Error)
+	byID := make(map[uuid.UUID]int)
+	for i, row := range rows {
+		byID[row.ID] = i
+		assert.NotNil(suite.T(), row.SafetyScoredAt)
+	}
+
+	suite.Require().NotNil(rows[byID[withMetrics]].SafetyScore)
+	assert.Equal(suite.T(), 100.0, *rows[byID[withMetrics]].SafetyScore)
+	assert.Nil(suite.T(), rows[byID[withoutMetrics]].SafetyScore)
+	assert.True(suite.T(), earlier.Equal(*rows[byID[scored]].SafetyScoredAt), "scored runs are left alone")
+}
+
+func TestSafetyBackfillTestSuite(t *testing.T) {
+	suite.Run(t, new(SafetyBackfillTestSuite))
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type SplitServiceTestSuite struct {
+	suite.Suite
+}
+
+func splitsOfKind(splits []models.RunSplit, kind string) []models.RunSplit {
+	var out []models.RunSplit
+	for _, s := range splits {
+		if s.Kind == kind {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (suite *SplitServiceTestSuite) TestKilometerAndMileSplits() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	// 2500 m at 2.5 m/s: two full kilometers and a partial third
+	splits := services.ComputeSplits(straightTrack(start, 1000, 2.5), nil)
+
+	km := splitsOfKind(splits, models.SplitKindKilometer)
+	assert.Len(suite.T(), km, 3)
+	assert.InDelta(suite.T(), 400, km[0].DurationSeconds, 2)
+	assert.InDelta(suite.T(), 400, *km[0].PaceSecondsPerKm, 2)
+	assert.False(suite.T(), km[1].Partial)
+	assert.True(suite.T(), km[2].Partial)
+	assert.InDelta(suite.T(), 500, km[2].DistanceMeters, 5)
+	assert.Equal(suite.T(), km[0].EndSeq, km[1].StartSeq)
+
+	miles := splitsOfKind(splits, models.SplitKindMile)
+	assert.Len(suite.T(), miles, 2)
+	assert.InDelta(suite.T(), 1609.344/2.5, miles[0].DurationSeconds, 2)
+	assert.True(suite.T(), miles[1].Partial)
+}
+
+func (suite *SplitServiceTestSuite) TestLapsFromMarkers() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	points := straightTrack(start, 600, 3.0)
+
+	markers := []time.Time{start.Add(200 * time.Second), start.Add(450 * time.Second)}
+	laps := splitsOfKind(services.ComputeSplits(points, markers), models.SplitKindLap)
+
+	assert.Len(suite.T(), laps, 3)
+	assert.InDelta(suite.T(), 200, laps[0].DurationSeconds, 0.01)
+	assert.InDelta(suite.T(), 600, laps[0].DistanceMeters, 5)
+	assert.InDelta(suite.T(), 250, laps[1].DurationSeconds, 0.01)
+	assert.InDelta(suite.T(), 150, laps[2].DurationSeconds, 0.01)
+
+	noLaps := splitsOfKind(services.ComputeSplits(points, nil), models.SplitKindLap)
+	assert.Empty(suite.T(), noLaps)
+}
+
+func (suite *SplitServiceTestSuite) TestDetectsSustainedEffort() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	easy := straightTrack(start, 300, 2.5)
+	last := easy[len(easy)-1]
+
+	// 90 s at 4 m/s followed by another easy stretch
+	hard := straightTrack(last.Timestamp, 90, 4.0)
+	offset := last.Latitude - hard[0].Latitude
+	for i := range hard {
+		hard[i].Latitude += offset
+	}
+	tail := straightTrack(hard[len(hard)-1].Timestamp, 300, 2.5)
+	offset = hard[len(hard)-1].Latitude - tail[0].Latitude
+	for i := range tail {
+		tail[i].Latitude += offset
+	}
+
+	points := append(append(easy, hard[1:]...), tail[1:]...)
+	efforts := splitsOfKind(services.ComputeSplits(points, nil), models.SplitKindEffort)
+
+	assert.Len(suite.T(), efforts, 1)
+	assert.InDelta(suite.T(), 90, efforts[0].DurationSeconds, 20)
+	assert.Greater(suite.T(), efforts[0].AvgSpeedKmh, 12.0)
+}
+
+func (suite *SplitServiceTestSuite) TestTooFewPoints() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	assert.Empty(suite.T(), services.ComputeSplits(straightTrack(start, 0, 3.0), nil))
+}
+
+func TestSplitServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(SplitServiceTestSuite))
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type StatsServiceTestSuite struct {
+	suite.Suite
+}
+
+func (suite *StatsServiceTestSuite) TestWeekStartPreference() {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	assert.NoError(suite.T(), err)
+
+	// Sunday morning local time is still Saturday in UTC
+	t := time.Date(2025, 3, 9, 6, 30, 0, 0, jakarta)
+
+	monday := services.BucketStart(t, services.BucketWeek, time.Monday)
+	assert.Equal(suite.T(), time.Date(2025, 3, 3, 0, 0, 0, 0, jakarta), monday)
+
+	sunday := services.BucketStart(t, services.BucketWeek, time.Sunday)
+	assert.Equal(suite.T(), time.Date(2025, 3, 9, 0, 0, 0, 0, jakarta), sunday)
+
+	day := services.BucketStart(t.UTC().In(jakarta), services.BucketDay, time.Monday)
+	assert.Equal(suite.T(), 9, day.Day())
+}
+
+func (suite *StatsServiceTestSuite) TestMonthAndYearBuckets() {
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(suite.T(), err)
+
+	t := time.Date(2025, 3, 31, 23, 0, 0, 0, newYork)
+	assert.Equal(suite.T(), time.Date(2025, 3, 1, 0, 0, 0, 0, newYork), services.BucketStart(t, services.BucketMonth, time.Monday))
+	assert.Equal(suite.T(), time.Date(2025, 1, 1, 0, 0, 0, 0, newYork), services.BucketStart(t, services.BucketYear, time.Monday))
+}
+
+func (suite *StatsServiceTestSuite) TestBucketValidation() {
+	assert.True(suite.T(), services.IsStatsBucket("month"))
+	assert.False(suite.T(), services.IsStatsBucket("hour"))
+}
+
+func TestStatsServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(StatsServiceTestSuite))
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type StreamServiceTestSuite struct {
+	suite.Suite
+}
+
+func (suite *StreamServiceTestSuite) TestEncodeDecodeRoundTrip() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	var hr, stride []models.StreamSample
+	for i := 0; i < 600; i++ {
+		ts := start.Add(time.Duration(i) * time.Second)
+		hr = append(hr, models.StreamSample{Timestamp: ts, Value: float64(120 + i%40)})
+		stride = append(stride, models.StreamSample{Timestamp: ts.Add(250 * time.Millisecond), Value: 1.05 + float64(i%5)*0.01})
+	}
+
+	streams, err := services.BuildStreams([]models.SensorStreamData{
+		{Type: models.StreamTypeHeartRate, Samples: hr},
+		{Type: models.StreamTypeStrideLength, Samples: stride},
+	})
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), streams, 2)
+
+	// Roughly three bytes per 1 Hz heart rate sample
+	assert.Less(suite.T(), len(streams[0].Data), 600*4)
+	assert.Equal(suite.T(), 600, streams[0].SampleCount)
+	assert.Equal(suite.T(), 159.0, streams[0].MaxValue)
+
+	points, err := services.DecodeStream(&streams[0])
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), points, 600)
+	assert.Equal(suite.T(), hr[123].Timestamp, points[123].Timestamp)
+	assert.Equal(suite.T(), hr[123].Value, points[123].Value)
+
+	points, err = services.DecodeStream(&streams[1])
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), stride[7].Timestamp, points[7].Timestamp)
+	assert.InDelta(suite.T(), stride[7].Value, points[7].Value, 0.001)
+}
+
+func (suite *StreamServiceTestSuite) TestDropsDropoutsAndSorts() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	streams, err := services.BuildStreams([]models.SensorStreamData{{
+		Type: models.StreamTypeHeartRate,
+		Samples: []models.StreamSample{
+			{Timestamp: start.Add(2 * time.Second), Value: 150},
+			{Timestamp: start, Value: 140},
+			{Timestamp: start.Add(1 * time.Second), Value: 0},
+			{Timestamp: start.Add(3 * time.Second), Value: 400},
+		},
+	}})
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), streams, 1)
+	assert.Equal(suite.T(), 2, streams[0].SampleCount)
+	assert.Equal(suite.T(), start, streams[0].StartedAt)
+	assert.Equal(suite.T(), 145.0, streams[0].AvgValue)
+
+	var run models.Run
+	services.ApplyStreamSummary(&run, streams)
+	assert.Equal(suite.T(), 145, *run.AvgHeartRateBpm)
+	assert.Equal(suite.T(), 150, *run.MaxHeartRateBpm)
+	assert.Nil(suite.T(), run.AvgCadenceSpm)
+}
+
+func (suite *StreamServiceTestSuite) TestRejectsDuplicateTypes() {
+	sample := []models.StreamSample{{Timestamp: time.Now(), Value: 170}}
+	_, err := services.BuildStreams([]models.SensorStreamData{
+		{Type: models.StreamTypeCadence, Samples: sample},
+		{Type: models.StreamTypeCadence, Samples: sample},
+	})
+	assert.Error(suite.T(), err)
+}
+
+func TestStreamServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(StreamServiceTestSuite))
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type TrainingLoadTestSuite struct {
+	suite.Suite
+}
+
+func constantHeartRate(start time.Time, seconds int, bpm float64) []services.StreamPoint {
+	points := make([]services.StreamPoint, seconds+1)
+	for i := range points {
+		points[i] = services.StreamPoint{Timestamp: start.Add(time.Duration(i) * time.Second), Value: bpm}
+	}
+	return points
+}
+
+func (suite *TrainingLoadTestSuite) TestHourAtThresholdScoresAbout100() {
+	start := time.Date(2025, 3, 1, 6, 0, 0, 0, time.UTC)
+
+	// Threshold is 85% of heart rate reserve: 60 + 0.85 * (190 - 60)
+	trimp := services.ComputeTRIMP(constantHeartRate(start, 3600, 170.5), 60, 190)
+	assert.InDelta(suite.T(), 100, trimp, 0.5)
+
+	easy := services.ComputeTRIMP(constantHeartRate(start, 3600, 130), 60, 190)
+	assert.Less(suite.T(), easy, 50.0)
+
+	assert.InDelta(suite.T(), 100, services.ComputePaceLoad(3600, 12, 300), 0.01)
+	assert.InDelta(suite.T(), 25, services.ComputePaceLoad(3600, 6, 300), 0.01)
+}
+
+func (suite *TrainingLoadTestSuite) TestRunLoadFallsBackToPace() {
+	start := time.Date(2025, 3, 1, 6, 0, 0, 0, time.UTC)
+	moving := 1800
+	speed := 10.0
+	run := &models.Run{MovingTimeSeconds: &moving, ComputedAvgSpeedKmh: &speed, MaxHeartRateBpm: intPtr(180)}
+	settings := &models.ZoneSettings{AutoEstimate: true, ThresholdPaceSecondsPerKm: intPtr(300)}
+
+	load, method, ok := services.RunTrainingLoad(run, constantHeartRate(start, 1800, 150), settings)
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), models.TrainingLoadMethodTRIMP, method)
+	assert.Greater(suite.T(), load, 0.0)
+
+	load, method, ok = services.RunTrainingLoad(run, nil, settings)
+	assert.True(suite.T(), ok)
+	assert.Equal(suite.T(), models.TrainingLoadMethodPace, method)
+	assert.InDelta(suite.T(), 34.72, load, 0.01)
+
+	_, _, ok = services.RunTrainingLoad(&models.Run{}, nil, settings)
+	assert.False(suite.T(), ok)
+}
+
+func (suite *TrainingLoadTestSuite) TestSeriesAndWarnings() {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Five weeks of 50 a day, then a week of 100 a day
+	daily := make([]float64, 42)
+	for i := range daily {
+		daily[i] = 50
+		if i >= 35 {
+			daily[i] = 100
+		}
+	}
+
+	series := services.ComputeLoadSeries(uuid.New(), start, daily)
+	assert.Len(suite.T(), series, 42)
+	assert.Equal(suite.T(), "2025-01-01", series[0].Day)
+	assert.Equal(suite.T(), "2025-02-11", series[41].Day)
+	assert.Nil(suite.T(), series[26].ACWR)
+	assert.InDelta(suite.T(), 1.0, *series[27].ACWR, 0.001)
+
+	latest := series[41]
+	assert.Greater(suite.T(), latest.Fatigue, latest.Fitness)
+	assert.InDelta(suite.T(), 100, latest.AcuteLoad, 0.01)
+	assert.InDelta(suite.T(), 62.5, latest.ChronicLoad, 0.01)
+
+	week, warnings := services.TrainingLoadWarnings(series)
+	assert.InDelta(suite.T(), 700, week.Load, 0.01)
+	assert.InDelta(suite.T(), 350, week.PreviousLoad, 0.01)
+	assert.InDelta(suite.T(), 100, *week.ChangePercent, 0.01)
+
+	codes := []string{}
+	for _, w := range warnings {
+		codes = append(codes, w.Code)
+	}
+	assert.Equal(suite.T(), []string{"weekly_load_jump", "acwr_high"}, codes)
+
+	_, warnings = services.TrainingLoadWarnings(series[:35])
+	assert.Empty(suite.T(), warnings)
+}
+
+func TestTrainingLoadTestSuite(t *testing.T) {
+	suite.Run(t, new(TrainingLoadTestSuite))
+}
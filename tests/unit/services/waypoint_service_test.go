@@ -0,0 +1,157 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type WaypointServiceTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	service *services.WaypointService
+	runID   uuid.UUID
+	start   time.Time
+}
+
+func (suite *WaypointServiceTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	// Every connection to an in-memory database gets its own database
+	sqlDB, err := db.DB()
+	suite.Require().NoError(err)
+	sqlDB.SetMaxOpenConns(1)
+	suite.Require().NoError(db.Exec(`CREATE TABLE run_waypoints (
+		id TEXT PRIMARY KEY, run_id TEXT NOT NULL, track TEXT NOT NULL, sequence INTEGER NOT NULL,
+		latitude REAL NOT NULL, longitude REAL NOT NULL, altitude REAL, heading REAL,
+		accuracy REAL, speed REAL, recorded_at DATETIME NOT NULL)`).Error)
+
+	suite.db = db
+	suite.service = services.NewWaypointService(db)
+	suite.runID = uuid.New()
+	suite.start = time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+}
+
+func (suite *WaypointServiceTestSuite) saveTrack(track string, n int) {
+	points := straightTrack(suite.start, n-1, 3.0)
+	suite.Require().NoError(suite.service.SaveWaypoints(suite.db, suite.runID, track, points))
+}
+
+func sequences(waypoints []models.RunWaypoint) []int {
+	seqs := make([]int, len(waypoints))
+	for i, w := range waypoints {
+		seqs[i] = w.Sequence
+	}
+	return seqs
+}
+
+func (suite *WaypointServiceTestSuite) TestDownsampleKeepsEndsWithinLimit() {
+	suite.saveTrack(models.TrackFiltered, 10)
+
+	page, err := suite.service.GetWaypoints(suite.runID, services.WaypointQuery{MaxPoints: 3})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), []int{0, 5, 9}, sequences(page.Waypoints))
+	assert.Equal(suite.T(), 5, page.Step)
+	assert.Equal(suite.T(), int64(10), page.Matched)
+
+	for _, limit := range []int{2, 4, 7, 9} {
+		page, err := suite.service.GetWaypoints(suite.runID, services.WaypointQuery{MaxPoints: limit})
+		suite.Require().NoError(err)
+		seqs := sequences(page.Waypoints)
+		assert.LessOrEqual(suite.T(), len(seqs), limit, "max_points=%d returned %v", limit, seqs)
+		assert.Equal(suite.T(), 0, seqs[0])
+		assert.Equal(suite.T(), 9, seqs[len(seqs)-1])
+	}
+}
+
+func (suite *WaypointServiceTestSuite) TestDownsampleWithinRange() {
+	suite.saveTrack(models.TrackFiltered, 100)
+	from, to := 20, 40
+
+	page, err := suite.service.GetWaypoints(suite.runID, services.WaypointQuery{FromSeq: &from, ToSeq: &to, MaxPoints: 5})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), []int{20, 25, 30, 35, 40}, sequences(page.Waypoints))
+	assert.Equal(suite.T(), int64(100), page.TotalPoints)
+	assert.Equal(suite.T(), int64(21), page.Matched)
+}
+
+func (suite *WaypointServiceTestSuite) TestSmallTrackIsNotDownsampled() {
+	suite.saveTrack(models.TrackFiltered, 5)
+
+	page, err := suite.service.GetWaypoints(suite.runID, services.WaypointQuery{MaxPoints: 5})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), []int{0, 1, 2, 3, 4}, sequences(page.Waypoints))
+	assert.Equal(suite.T(), 1, page.Step)
+}
+
+func (suite *WaypointServiceTestSuite) TestFallsBackToRawTrack() {
+	suite.saveTrack(models.TrackRaw, 4)
+
+	page, err := suite.service.GetWaypoints(suite.runID, services.WaypointQuery{})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), models.TrackRaw, page.Track)
+	assert.Len(suite.T(), page.Waypoints, 4)
+
+	page, err = suite.service.GetWaypoints(uuid.New(), services.WaypointQuery{})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), int64(0), page.TotalPoints)
+	assert.Empty(suite.T(), page.Waypoints)
+}
+
+func (suite *WaypointServiceTestSuite) TestTimeRange() {
+	suite.saveTrack(models.TrackFiltered, 20)
+	from := suite.start.Add(5 * time.Second)
+	to := suite.start.Add(9 * time.Second)
+
+	page, err := suite.service.GetWaypoints(suite.runID, services.WaypointQuery{From: &from, To: &to})
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), []int{5, 6, 7, 8, 9}, sequences(page.Waypoints))
+}
+
+func (suite *WaypointServiceTestSuite) TestFilteredTrackForLegacyRunUsesDEM() {
+	dir := suite.T().TempDir()
+	suite.Require().NoError(os.WriteFile(filepath.Join(dir, "area.tif"), buildGeoTIFF(10, 10, 106.8, -6.0, 0.01), 0o644))
+	dem, err := services.LoadDEM(dir)
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(suite.db.Exec(`CREATE TABLE runs (id TEXT PRIMARY KEY, elevation_source TEXT, updated_at DATETIME)`).Error)
+	suite.Require().NoError(suite.db.Exec(`INSERT INTO runs (id) VALUES (?)`, suite.runID).Error)
+
+	// Stored before filtering existed, inside the DEM's coverage
+	raw := straightTrack(suite.start, 30, 3.0)
+	for i := range raw {
+		raw[i].Latitude += 0.15
+		raw[i].Longitude = 106.85
+	}
+	suite.Require().NoError(suite.service.SaveWaypoints(suite.db, suite.runID, models.TrackRaw, raw))
+
+	points, err := suite.service.EnsureFilteredTrack(suite.db, suite.runID, services.NewGPSFilter(services.DefaultGPSFilterConfig), dem)
+	suite.Require().NoError(err)
+	suite.Require().NotEmpty(points)
+	suite.Require().NotNil(points[0].Altitude)
+	terrain, _ := dem.Elevation(points[0].Latitude, points[0].Longitude)
+	assert.InDelta(suite.T(), terrain, *points[0].Altitude, 0.01)
+
+	stored, err := suite.service.LoadTrack(suite.runID)
+	suite.Require().NoError(err)
+	assert.Equal(suite.T(), points, stored)
+
+	var source string
+	suite.Require().NoError(suite.db.Raw(`SELECT elevation_source FROM runs WHERE id = ?`, suite.runID).Scan(&source).Error)
+	assert.Equal(suite.T(), models.ElevationSourceDEM, source)
+}
+
+func TestWaypointServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(WaypointServiceTestSuite))
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type WorkoutServiceTestSuite struct {
+	suite.Suite
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func (suite *WorkoutServiceTestSuite) TestComplianceScoring() {
+	workout := &models.ScheduledWorkout{
+		TargetDistanceMeters:   floatPtr(10000),
+		TargetPaceSecondsPerKm: intPtr(300),
+	}
+
+	// On target within tolerance scores full marks
+	run := &models.Run{ComputedDistanceMeters: floatPtr(10200), MovingTimeSeconds: intPtr(3060)}
+	score, breakdown := services.ScoreCompliance(workout, run, nil)
+	assert.Equal(suite.T(), 100.0, score)
+	assert.InDelta(suite.T(), 300, *breakdown.ActualPaceSecondsPerKm, 0.01)
+
+	// 20% short and 10% slow
+	run = &models.Run{ComputedDistanceMeters: floatPtr(8000), MovingTimeSeconds: intPtr(2640)}
+	score, breakdown = services.ScoreCompliance(workout, run, nil)
+	assert.InDelta(suite.T(), 70, *breakdown.DistanceScore, 0.01)
+	assert.InDelta(suite.T(), 65, *breakdown.PaceScore, 0.01)
+	assert.Nil(suite.T(), breakdown.DurationScore)
+	assert.InDelta(suite.T(), 67.5, score, 0.01)
+
+	score, _ = services.ScoreCompliance(&models.ScheduledWorkout{}, run, nil)
+	assert.Equal(suite.T(), 100.0, score)
+}
+
+func (suite *WorkoutServiceTestSuite) TestValidateSteps() {
+	valid := []models.WorkoutStep{
+		{Kind: models.WorkoutStepWarmup, DurationSeconds: intPtr(600)},
+		{Repeat: 6, Steps: []models.WorkoutStep{
+			{Kind: models.WorkoutStepWork, DistanceMeters: floatPtr(400), TargetPaceSecondsPerKm: intPtr(240)},
+			{Kind: models.WorkoutStepRecovery, DurationSeconds: intPtr(90)},
+		}},
+		{Kind: models.WorkoutStepCooldown, DurationSeconds: intPtr(600)},
+	}
+	assert.NoError(suite.T(), services.ValidateWorkoutSteps(valid))
+
+	assert.Error(suite.T(), services.ValidateWorkoutSteps([]models.WorkoutStep{{Kind: models.WorkoutStepWork}}))
+	assert.Error(suite.T(), services.ValidateWorkoutSteps([]models.WorkoutStep{{Steps: valid[1].Steps}}))
+	assert.Error(suite.T(), services.ValidateWorkoutSteps([]models.WorkoutStep{{Repeat: 2, Steps: []models.WorkoutStep{valid[1]}}}))
+}
+
+func (suite *WorkoutServiceTestSuite) TestWorkoutStepsFromTrack() {
+	start := time.Date(2025, 3, 1, 6, 0, 0, 0, time.UTC)
+	track := straightTrack(start, 600, 4)
+
+	data := []models.WorkoutStepData{
+		// Uploaded out of order; stored in the order they ran
+		{Kind: models.WorkoutStepRecovery, Repetition: 1, StartedAt: start.Add(100 * time.Second), EndedAt: start.Add(190 * time.Second), TargetDurationSeconds: intPtr(90)},
+		{Kind: models.WorkoutStepWork, Repetition: 1, StartedAt: start, EndedAt: start.Add(100 * time.Second), TargetDistanceMeters: floatPtr(400), TargetPaceSecondsPerKm: intPtr(250)},
+		{Kind: models.WorkoutStepWork, Repetition: 2, StartedAt: start.Add(190 * time.Second), EndedAt: start.Add(290 * time.Second), TargetDistanceMeters: floatPtr(400), TargetPaceSecondsPerKm: intPtr(200)},
+		{Kind: models.WorkoutStepCooldown, StartedAt: start.Add(290 * time.Second), EndedAt: start.Add(600 * time.Second)},
+	}
+
+	steps, err := services.BuildRunWorkoutSteps(data, track, nil)
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), steps, 4)
+
+	assert.Equal(suite.T(), models.WorkoutStepWork, steps[0].Kind)
+	assert.InDelta(suite.T(), 400, steps[0].DistanceMeters, 2)
+	assert.InDelta(suite.T(), 250, *steps[0].PaceSecondsPerKm, 2)
+	assert.True(suite.T(), *steps[0].HitTarget)
+
+	assert.True(suite.T(), *steps[1].HitTarget)
+	assert.False(suite.T(), *steps[2].HitTarget)
+	assert.Nil(suite.T(), steps[3].HitTarget)
+
+	score, breakdown := services.ScoreCompliance(&models.ScheduledWorkout{}, &models.Run{}, steps)
+	assert.InDelta(suite.T(), 66.67, *breakdown.StepsScore, 0.01)
+	assert.InDelta(suite.T(), 66.67, score, 0.01)
+}
+
+func TestWorkoutServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkoutServiceTestSuite))
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/labmino/runsight-backend/internal/models"
+	"github.com/labmino/runsight-backend/internal/services"
+)
+
+type ZoneServiceTestSuite struct {
+	suite.Suite
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func (suite *ZoneServiceTestSuite) TestResolveBoundsFromMaxHeartRateAndPace() {
+	settings := &models.ZoneSettings{
+		MaxHeartRateBpm:           intPtr(200),
+		ThresholdPaceSecondsPerKm: intPtr(300),
+	}
+
+	bounds := services.ResolveZoneBounds(settings)
+	assert.Equal(suite.T(), []float64{120, 140, 160, 180}, bounds.HeartRate)
+	assert.Equal(suite.T(), []float64{387, 342, 318, 291}, bounds.Pace)
+}
+
+func (suite *ZoneServiceTestSuite) TestResolveBoundsPrecedence() {
+	settings := &models.ZoneSettings{
+		AutoEstimate:             true,
+		EstimatedMaxHeartRateBpm: intPtr(190),
+		PaceZoneBounds:           "400,350,320,290",
+	}
+	bounds := services.ResolveZoneBounds(settings)
+	assert.Equal(suite.T(), []float64{114, 133, 152, 171}, bounds.HeartRate)
+	assert.Equal(suite.T(), []float64{400, 350, 320, 290}, bounds.Pace)
+
+	// Manual values beat estimates, and estimates are ignored when disabled
+	settings.MaxHeartRateBpm = intPtr(200)
+	assert.Equal(suite.T(), 120.0, services.ResolveZoneBounds(settings).HeartRate[0])
+
+	settings.MaxHeartRateBpm = nil
+	settings.AutoEstimate = false
+	assert.Nil(suite.T(), services.ResolveZoneBounds(settings).HeartRate)
+}
+
+func (suite *ZoneServiceTestSuite) TestHeartRateTimeInZone() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	var hr []services.StreamPoint
+	for i := 0; i <= 600; i++ {
+		value := 130.0
+		if i >= 300 {
+			value = 175
+		}
+		hr = append(hr, services.StreamPoint{Timestamp: start.Add(time.Duration(i) * time.Second), Value: value})
+	}
+
+	bounds := services.ZoneBounds{HeartRate: []float64{120, 140, 160, 180}}
+	times := services.ComputeZoneTimes(hr, nil, bounds)
+
+	assert.Len(suite.T(), times, models.ZoneCount)
+	assert.Equal(suite.T(), models.ZoneKindHeartRate, times[0].Kind)
+	assert.Equal(suite.T(), 300.0, times[1].Seconds)
+	assert.Equal(suite.T(), 300.0, times[3].Seconds)
+	assert.Equal(suite.T(), 0.0, times[4].Seconds)
+}
+
+func (suite *ZoneServiceTestSuite) TestPaceTimeInZoneSkipsStops() {
+	start := time.Date(2025, 1, 5, 6, 0, 0, 0, time.UTC)
+	// 3.5 m/s is about 286 s/km, then standing still for a minute
+	track := straightTrack(start, 300, 3.5)
+	last := track[len(track)-1]
+	for i := 1; i <= 60; i++ {
+		still := last
+		still.Timestamp = last.Timestamp.Add(time.Duration(i) * time.Second)
+		track = append(track, still)
+	}
+
+	bounds := services.ZoneBounds{Pace: []float64{400, 350, 320, 290}}
+	times := services.ComputeZoneTimes(nil, track, bounds)
+
+	assert.Len(suite.T(), times, models.ZoneCount)
+	var total float64
+	for _, t := range times {
+		total += t.Seconds
+	}
+	assert.InDelta(suite.T(), 300, total, 12)
+	assert.InDelta(suite.T(), 300, times[4].Seconds, 12)
+}
+
+func (suite *ZoneServiceTestSuite) TestValidateBoundsOrder() {
+	assert.NoError(suite.T(), services.ValidateZoneSettings(&models.ZoneSettingsRequest{
+		HeartRateZoneBounds: []int{120, 140, 160, 180},
+		PaceZoneBounds:      []int{400, 350, 320, 290},
+	}))
+	assert.Error(suite.T(), services.ValidateZoneSettings(&models.ZoneSettingsRequest{
+		HeartRateZoneBounds: []int{120, 160, 140, 180},
+	}))
+	assert.Error(suite.T(), services.ValidateZoneSettings(&models.ZoneSettingsRequest{
+		PaceZoneBounds: []int{290, 320, 350, 400},
+	}))
+}
+
+func TestZoneServiceTestSuite(t *testing.T) {
+	suite.Run(t, new(ZoneServiceTestSuite))
+}
+
+type ZoneSettingsTestSuite struct {
+	suite.Suite
+	db *gorm.DB
+}
+
+func (suite *ZoneSettingsTestSuite) SetupTest() {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	suite.Require().NoError(err)
+	// Every connection to an in-memory database gets its own database
+	sqlDB, err := db.DB()
+	suite.Require().NoError(err)
+	sqlDB.SetMaxOpenConns(1)
+
+	for _, stmt := range []string{
+		`CREATE TABLE runs (id TEXT PRIMARY KEY, user_id TEXT, started_at DATETIME, max_heart_rate_bpm INTEGER,
+			moving_time_seconds INTEGER, computed_avg_speed_kmh REAL)`,
+		`CREATE TABLE zone_settings (id TEXT PRIMARY KEY, user_id TEXT NOT NULL UNIQUE, max_heart_rate_bpm INTEGER,
+			resting_heart_rate_bpm INTEGER, threshold_pace_seconds_per_km INTEGER, heart_rate_zone_bounds TEXT,
+			pace_zone_bounds TEXT, auto_estimate BOOLEAN, estimated_max_heart_rate_bpm INTEGER,
+			estimated_threshold_pace_seconds_per_km INTEGER, estimated_at DATETIME, recompute_requested_at DATETIME,
+			created_at DATETIME, updated_at DATETIME)`,
+	} {
+		suite.Require().NoError(db.Exec(stmt).Error)
+	}
+	suite.db = db
+}
+
+func (suite *ZoneSettingsTestSuite) TestFirstSettingsRaceKeepsStoredRow() {
+	userID := uuid.New()
+	suite.Require().NoError(suite.db.Exec(`INSERT INTO runs (id, user_id, started_at, max_heart_rate_bpm) VALUES (?, ?, ?, 188)`,
+		uuid.New(), userID, time.Now().Add(-time.Hour)).Error)
+
+	// Another upload stores the user's settings between our read and insert
+	winner := uuid.New()
+	raced := false
+	err := suite.db.Callback().Create().Before("gorm:create").Register("test:race", func(tx *gorm.DB) {
+		if raced {
+			return
+		}
+		raced = true
+		suite.Require().NoError(tx.Session(&gorm.Session{NewDB: true}).
+			Exec(`INSERT INTO zone_settings (id, user_id, auto_estimate) VALUES (?, ?, ?)`, winner, userID, true).Error)
+	})
+	suite.Require().NoError(err)
+
+	settings, err := services.NewZoneService(suite.db).GetSettings(userID)
+	suite.Require().NoError(err)
+	assert.True(suite.T(), raced)
+	assert.Equal(suite.T(), winner, settings.ID)
+	suite.Require().NotNil(settings.EstimatedMaxHeartRateBpm)
+	assert.Equal(suite.T(), 188, *settings.EstimatedMaxHeartRateBpm)
+
+	var count int64
+	suite.Require().NoError(suite.db.Model(&models.ZoneSettings{}).Count(&count).Error)
+	assert.Equal(suite.T(), int64(1), count)
+}
+
+func TestZoneSettingsTestSuite(t *testing.T) {
+	suite.Run(t, new(ZoneSettingsTestSuite))
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/labmino/runsight-backend/internal/storage"
+)
+
+type LocalStoreTestSuite struct {
+	suite.Suite
+	store *storage.LocalStore
+}
+
+func (suite *LocalStoreTestSuite) SetupTest() {
+	store, err := storage.NewLocalStore(suite.T().TempDir())
+	suite.Require().NoError(err)
+	suite.store = store
+}
+
+func (suite *LocalStoreTestSuite) TestPutOpenDelete() {
+	ctx := context.Background()
+	key := "datasets/v1/manifest.jsonl"
+
+	suite.Require().NoError(suite.store.Put(ctx, key, strings.NewReader("first")))
+	suite.Require().NoError(suite.store.Put(ctx, key, strings.NewReader("second")))
+
+	r, err := suite.store.Open(ctx, key)
+	suite.Require().NoError(err)
+	body, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(suite.T(), "second", string(body))
+
+	suite.Require().NoError(suite.store.Delete(ctx, key))
+	_, err = suite.store.Open(ctx, key)
+	assert.ErrorIs(suite.T(), err, storage.ErrNotFound)
+	assert.NoError(suite.T(), suite.store.Delete(ctx, key))
+}
+
+func (suite *LocalStoreTestSuite) TestRejectsEscapingKeys() {
+	ctx := context.Background()
+	for _, key := range []string{"", "../secret", "datasets/../../secret", "/abs", "a//b", `a\b`} {
+		assert.Error(suite.T(), suite.store.Put(ctx, key, strings.NewReader("x")), key)
+	}
+}
+
+func TestLocalStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(LocalStoreTestSuite))
+}